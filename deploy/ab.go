@@ -0,0 +1,383 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// DefaultABMinCohortSize is the cohort size below which an A/B comparison is flagged as too
+// small to tell the builds apart
+const DefaultABMinCohortSize = 30
+
+// maxOverlapListed bounds how many shared devices a cohort overlap error lists
+const maxOverlapListed = 10
+
+// CohortResult summarizes the rollout of one arm of an A/B deployment
+type CohortResult struct {
+	Cohort           string          `json:"cohort"`
+	FirmwareFile     string          `json:"firmware_file"`
+	UploadedFilename string          `json:"uploaded_filename,omitempty"`
+	Devices          int             `json:"devices"`
+	Completed        int             `json:"completed"`
+	Failed           int             `json:"failed"`
+	Pending          int             `json:"pending"`
+	SuccessRate      float64         `json:"success_rate"`
+	MedianCompleteMs int64           `json:"median_complete_ms,omitempty"`
+	FailureReasons   []FailureReason `json:"failure_reasons,omitempty"`
+}
+
+// FailureReason counts the devices of a cohort whose update failed with the same description
+type FailureReason struct {
+	Reason  string `json:"reason"`
+	Devices int    `json:"devices"`
+}
+
+// ABComparison compares the rollouts of the two arms of an A/B deployment.
+// SuccessRateDelta is B's success rate minus A's, in percentage points.
+type ABComparison struct {
+	Cohorts          []CohortResult `json:"cohorts"`
+	SuccessRateDelta float64        `json:"success_rate_delta"`
+	Note             string         `json:"note,omitempty"`
+}
+
+// cohortOutcome is what polling observed of one arm's rollout. completedAfter holds, for
+// each completed device, the time from the DFU trigger to the poll that first saw it done.
+type cohortOutcome struct {
+	name             string
+	firmwareFile     string
+	uploadedFilename string
+	devices          int
+	states           []notehub.DeviceDFUState
+	completedAfter   map[string]time.Duration
+}
+
+// summarizeCohort computes a cohort's success rate, median time to complete, and failure
+// reasons. Devices the DFU status never reported count as pending.
+func summarizeCohort(o cohortOutcome) CohortResult {
+	result := CohortResult{
+		Cohort:           o.name,
+		FirmwareFile:     o.firmwareFile,
+		UploadedFilename: o.uploadedFilename,
+		Devices:          o.devices,
+	}
+
+	reasons := map[string]int{}
+	var durations []time.Duration
+	for _, s := range o.states {
+		switch s.Status {
+		case notehub.DFUStateCompleted:
+			result.Completed++
+			if d, ok := o.completedAfter[s.DeviceUID]; ok {
+				durations = append(durations, d)
+			}
+		case notehub.DFUStateError:
+			result.Failed++
+			reason := s.Description
+			if reason == "" {
+				reason = "no description"
+			}
+			reasons[reason]++
+		}
+	}
+	result.Pending = result.Devices - result.Completed - result.Failed
+	if result.Pending < 0 {
+		result.Pending = 0
+	}
+	if result.Devices > 0 {
+		result.SuccessRate = 100 * float64(result.Completed) / float64(result.Devices)
+	}
+	result.MedianCompleteMs = medianDuration(durations).Milliseconds()
+
+	for reason, n := range reasons {
+		result.FailureReasons = append(result.FailureReasons, FailureReason{Reason: reason, Devices: n})
+	}
+	sort.Slice(result.FailureReasons, func(i, j int) bool {
+		a, b := result.FailureReasons[i], result.FailureReasons[j]
+		if a.Devices != b.Devices {
+			return a.Devices > b.Devices
+		}
+		return a.Reason < b.Reason
+	})
+	return result
+}
+
+// medianDuration returns the median of durations, or zero when there are none
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 1 {
+		return sorted[mid]
+	}
+	return (sorted[mid-1] + sorted[mid]) / 2
+}
+
+// compareCohorts compares the two arms of an A/B deployment. When either cohort has fewer
+// than minCohortSize devices, the comparison carries a note that the difference may be
+// chance; a minCohortSize of zero disables the note.
+func compareCohorts(a, b cohortOutcome, minCohortSize int) *ABComparison {
+	ra, rb := summarizeCohort(a), summarizeCohort(b)
+	comparison := &ABComparison{
+		Cohorts:          []CohortResult{ra, rb},
+		SuccessRateDelta: rb.SuccessRate - ra.SuccessRate,
+	}
+	if minCohortSize > 0 && (ra.Devices < minCohortSize || rb.Devices < minCohortSize) {
+		comparison.Note = fmt.Sprintf("Cohorts of %d and %d devices are smaller than ab_min_cohort_size (%d), so the %.1f point difference in success rate may be chance",
+			ra.Devices, rb.Devices, minCohortSize, comparison.SuccessRateDelta)
+	}
+	return comparison
+}
+
+// abComparisonMarkdown renders an A/B comparison for the job summary
+func abComparisonMarkdown(c *ABComparison) string {
+	var b strings.Builder
+	b.WriteString("\n#### A/B Comparison\n\n")
+	b.WriteString("| Cohort | Firmware | Devices | Completed | Failed | Pending | Success Rate | Median Time to Complete |\n")
+	b.WriteString("| ------ | -------- | ------- | --------- | ------ | ------- | ------------ | ----------------------- |\n")
+	for _, r := range c.Cohorts {
+		median := "-"
+		if r.MedianCompleteMs > 0 {
+			median = (time.Duration(r.MedianCompleteMs) * time.Millisecond).String()
+		}
+		firmware := r.FirmwareFile
+		if r.UploadedFilename != "" {
+			firmware = r.UploadedFilename
+		}
+		fmt.Fprintf(&b, "| %s | %s | %d | %d | %d | %d | %.1f%% | %s |\n",
+			r.Cohort, escapeTableCell(firmware), r.Devices, r.Completed, r.Failed, r.Pending, r.SuccessRate, median)
+	}
+	fmt.Fprintf(&b, "\nB's success rate differs from A's by %+.1f percentage points.\n", c.SuccessRateDelta)
+	if c.Note != "" {
+		fmt.Fprintf(&b, "\n> ⚠️ %s.\n", c.Note)
+	}
+
+	for _, r := range c.Cohorts {
+		if len(r.FailureReasons) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\nFailure reasons in cohort %s:\n\n", r.Cohort)
+		for _, f := range r.FailureReasons {
+			fmt.Fprintf(&b, "- %s: %d device(s)\n", escapeTableCell(f.Reason), f.Devices)
+		}
+	}
+	return b.String()
+}
+
+// checkCohortOverlap fails when a device belongs to both cohorts, which would make the
+// two rollouts race for it and muddle the comparison
+func checkCohortOverlap(a, b []notehub.Device) error {
+	inA := map[string]bool{}
+	for _, d := range a {
+		inA[d.UID] = true
+	}
+	var shared []string
+	for _, d := range b {
+		if inA[d.UID] {
+			shared = append(shared, d.UID)
+		}
+	}
+	if len(shared) == 0 {
+		return nil
+	}
+	sort.Strings(shared)
+	listed := shared
+	if len(listed) > maxOverlapListed {
+		listed = listed[:maxOverlapListed]
+	}
+	return fmt.Errorf("cohort_a and cohort_b must be disjoint, but %d device(s) match both: %s", len(shared), strings.Join(listed, ", "))
+}
+
+// abArm is one arm of an A/B deployment while it is rolled out and polled
+type abArm struct {
+	name      string
+	config    *DeploymentConfig
+	devices   []notehub.Device
+	report    *DeploymentReport
+	triggered time.Time
+	outcome   cohortOutcome
+	lastSeen  map[string]string
+}
+
+// deployAB runs the ab operation: the two firmware files are deployed to two disjoint
+// cohorts, both rollouts are polled to completion, and the report compares them
+func deployAB(ctx context.Context, config *DeploymentConfig, files []string) (*DeploymentReport, error) {
+	report := newDeploymentReport(config)
+	report.retries = config.retryLedger()
+	defer func() { report.RetrySummary = report.retries.summary() }()
+	defer report.endPhase()
+
+	if len(files) != 2 {
+		return report, fmt.Errorf("operation ab takes two firmware files, got %d", len(files))
+	}
+
+	client := newNotehubClient(config)
+	report.startPhase("authenticate")
+	if err := authenticate(ctx, client, config, report); err != nil {
+		return report, fmt.Errorf("authentication failed: %w", err)
+	}
+
+	// Resolve both cohorts up front, so an overlap fails before anything is uploaded
+	report.startPhase("resolve_cohorts")
+	arms := []*abArm{{name: "A"}, {name: "B"}}
+	for i, query := range []url.Values{config.CohortA, config.CohortB} {
+		arm := arms[i]
+		devices, err := client.ListDevices(ctx, config.ProjectUID, query)
+		if err != nil {
+			return report, fmt.Errorf("resolving cohort %s failed: %w", arm.name, err)
+		}
+		if len(devices) == 0 {
+			return report, fmt.Errorf("cohort_%s matches no devices: %s", strings.ToLower(arm.name), query.Encode())
+		}
+		config.logf("Cohort %s: %d device(s) matching %s", arm.name, len(devices), query.Encode())
+		arm.devices = devices
+	}
+	if err := checkCohortOverlap(arms[0].devices, arms[1].devices); err != nil {
+		return report, err
+	}
+	report.endPhase()
+
+	// Each arm is an ordinary deployment of its file to its cohort's devices
+	var results []FileResult
+	for i, arm := range arms {
+		armConfig := explicitTargetConfig(config, arm.devices)
+		armConfig.Operation = OperationDeploy
+		armConfig.FirmwareFile = files[i]
+		armConfig.WaitForCompletion = false
+		armConfig.CohortA, armConfig.CohortB = nil, nil
+		arm.config = armConfig
+
+		config.logf("=== Cohort %s: %s ===", arm.name, DisplayFirmwareFile(files[i]))
+		armReport, err := DeployFirmware(ctx, armConfig)
+		arm.report = armReport
+		arm.triggered = time.Now()
+		result := FileResult{
+			FirmwareFile:     DisplayFirmwareFile(files[i]),
+			UploadedFilename: armReport.UploadedFilename,
+			FirmwareSHA256:   armReport.FirmwareSHA256,
+			FirmwareSize:     armReport.FirmwareSize,
+			DFU:              armReport.DFUTriggered,
+			Status:           StatusSuccess,
+		}
+		if err != nil {
+			result.Status = StatusFailed
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+		report.Files = results
+		for _, p := range armReport.PhaseTimings {
+			report.PhaseTimings = append(report.PhaseTimings, PhaseTiming{Phase: "cohort " + arm.name + " " + p.Phase, StartedAt: p.StartedAt, DurationMs: p.DurationMs})
+		}
+		for _, tr := range armReport.TriggerTimes {
+			tr.Scope = "cohort " + arm.name + " " + tr.Scope
+			report.TriggerTimes = append(report.TriggerTimes, tr)
+		}
+		if err != nil {
+			return report, fmt.Errorf("cohort %s failed: %w", arm.name, err)
+		}
+	}
+	report.DFUTriggered = true
+
+	report.startPhase("wait_for_completion")
+	err := pollCohorts(ctx, client, config, arms)
+	for _, arm := range arms {
+		report.DeviceStates = append(report.DeviceStates, arm.outcome.states...)
+	}
+	if err != nil && ctx.Err() != nil {
+		return report, fmt.Errorf("waiting for the A/B rollouts failed: %w", err)
+	}
+	if err != nil {
+		config.Warnf("A/B rollouts did not finish: %v; comparing them as they stand", err)
+	}
+	report.endPhase()
+
+	report.ABComparison = compareCohorts(arms[0].outcome, arms[1].outcome, config.ABMinCohortSize)
+	logABComparison(config, report.ABComparison)
+	report.Status = StatusSuccess
+	return report, nil
+}
+
+// pollCohorts polls the DFU status of both arms until every device has reached a final
+// state or config.WaitTimeout expires, recording when each device was first seen complete
+func pollCohorts(ctx context.Context, client *notehub.Client, config *DeploymentConfig, arms []*abArm) error {
+	config.logf("Waiting up to %s for both cohorts to complete the update...", config.WaitTimeout)
+	deadline := time.Now().Add(config.WaitTimeout)
+	for _, arm := range arms {
+		arm.lastSeen = map[string]string{}
+		arm.outcome = cohortOutcome{
+			name:             arm.name,
+			firmwareFile:     DisplayFirmwareFile(arm.config.FirmwareFile),
+			uploadedFilename: arm.report.UploadedFilename,
+			devices:          len(arm.devices),
+			completedAfter:   map[string]time.Duration{},
+		}
+	}
+
+	for {
+		pending := 0
+		for _, arm := range arms {
+			states, err := client.GetDFUStatus(ctx, config.ProjectUID, config.FirmwareType, buildTargetingParams(arm.config))
+			if err != nil {
+				return fmt.Errorf("cohort %s: %w", arm.name, err)
+			}
+			now := time.Now()
+			for _, s := range states {
+				if _, seen := arm.outcome.completedAfter[s.DeviceUID]; s.Status == notehub.DFUStateCompleted && !seen {
+					arm.outcome.completedAfter[s.DeviceUID] = now.Sub(arm.triggered)
+				}
+			}
+			logDFUProgress(config, states, arm.lastSeen)
+			arm.outcome.states = states
+
+			terminal := 0
+			for _, s := range states {
+				if s.Terminal() {
+					terminal++
+				}
+			}
+			pending += len(arm.devices) - terminal
+		}
+		if pending <= 0 {
+			config.logf("✅ Every device in both cohorts reached a final DFU state")
+			return nil
+		}
+
+		if time.Now().Add(config.PollInterval).After(deadline) {
+			return fmt.Errorf("timed out after %s with %d device(s) still updating", config.WaitTimeout, pending)
+		}
+		config.logf("  - %d device(s) across both cohorts still updating; checking again in %s", pending, config.PollInterval)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(config.PollInterval):
+		}
+	}
+}
+
+// logABComparison prints the A/B comparison
+func logABComparison(config *DeploymentConfig, c *ABComparison) {
+	config.logf("=== A/B Comparison ===")
+	for _, r := range c.Cohorts {
+		median := "n/a"
+		if r.MedianCompleteMs > 0 {
+			median = (time.Duration(r.MedianCompleteMs) * time.Millisecond).String()
+		}
+		config.logf("Cohort %s (%s): %d/%d completed (%.1f%%), %d failed, %d pending, median time to complete %s",
+			r.Cohort, r.FirmwareFile, r.Completed, r.Devices, r.SuccessRate, r.Failed, r.Pending, median)
+		for _, f := range r.FailureReasons {
+			config.logf("  - %s: %d device(s)", f.Reason, f.Devices)
+		}
+	}
+	config.logf("B's success rate differs from A's by %+.1f percentage points", c.SuccessRateDelta)
+	if c.Note != "" {
+		config.logf("Note: %s", c.Note)
+	}
+}
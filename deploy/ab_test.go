@@ -0,0 +1,233 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// syntheticCohort builds a cohort of n devices, of which the first completed devices
+// finished after 1m, 2m, ... and the next failed devices failed with reasons in turn
+func syntheticCohort(name string, n, completed, failed int, reasons ...string) cohortOutcome {
+	o := cohortOutcome{name: name, firmwareFile: name + ".bin", devices: n, completedAfter: map[string]time.Duration{}}
+	for i := 0; i < completed+failed; i++ {
+		uid := fmt.Sprintf("dev:%s%d", name, i)
+		if i < completed {
+			o.states = append(o.states, notehub.DeviceDFUState{DeviceUID: uid, Status: notehub.DFUStateCompleted})
+			o.completedAfter[uid] = time.Duration(i+1) * time.Minute
+			continue
+		}
+		reason := ""
+		if len(reasons) > 0 {
+			reason = reasons[(i-completed)%len(reasons)]
+		}
+		o.states = append(o.states, notehub.DeviceDFUState{DeviceUID: uid, Status: notehub.DFUStateError, Description: reason})
+	}
+	return o
+}
+
+func TestSummarizeCohort(t *testing.T) {
+	r := summarizeCohort(syntheticCohort("A", 10, 5, 3, "image rejected", "low battery", "image rejected"))
+	if r.Devices != 10 || r.Completed != 5 || r.Failed != 3 || r.Pending != 2 {
+		t.Errorf("Unexpected counts %+v", r)
+	}
+	if r.SuccessRate != 50 {
+		t.Errorf("Expected a 50%% success rate, got %v", r.SuccessRate)
+	}
+	if r.MedianCompleteMs != (3 * time.Minute).Milliseconds() {
+		t.Errorf("Expected a median of 3m, got %dms", r.MedianCompleteMs)
+	}
+	expected := []FailureReason{{"image rejected", 2}, {"low battery", 1}}
+	if fmt.Sprint(r.FailureReasons) != fmt.Sprint(expected) {
+		t.Errorf("Expected failure reasons %v, got %v", expected, r.FailureReasons)
+	}
+
+	empty := summarizeCohort(cohortOutcome{name: "B", devices: 4})
+	if empty.Pending != 4 || empty.SuccessRate != 0 || empty.MedianCompleteMs != 0 {
+		t.Errorf("Expected unreported devices to count as pending, got %+v", empty)
+	}
+	unexplained := summarizeCohort(syntheticCohort("C", 1, 0, 1))
+	if len(unexplained.FailureReasons) != 1 || unexplained.FailureReasons[0].Reason != "no description" {
+		t.Errorf("Expected a failure without description to be counted, got %v", unexplained.FailureReasons)
+	}
+}
+
+func TestMedianDuration(t *testing.T) {
+	tests := []struct {
+		durations []time.Duration
+		expected  time.Duration
+	}{
+		{nil, 0},
+		{[]time.Duration{3 * time.Second}, 3 * time.Second},
+		{[]time.Duration{5 * time.Second, time.Second, 3 * time.Second}, 3 * time.Second},
+		{[]time.Duration{4 * time.Second, time.Second, 2 * time.Second, 3 * time.Second}, 2500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := medianDuration(tt.durations); got != tt.expected {
+			t.Errorf("medianDuration(%v) = %s, expected %s", tt.durations, got, tt.expected)
+		}
+	}
+}
+
+func TestCompareCohorts(t *testing.T) {
+	a := syntheticCohort("A", 40, 30, 10, "image rejected")
+	b := syntheticCohort("B", 40, 38, 2, "image rejected")
+
+	c := compareCohorts(a, b, DefaultABMinCohortSize)
+	if c.SuccessRateDelta != 20 {
+		t.Errorf("Expected B to lead by 20 points, got %v", c.SuccessRateDelta)
+	}
+	if c.Note != "" {
+		t.Errorf("Expected no note for cohorts above the minimum, got %q", c.Note)
+	}
+
+	small := compareCohorts(syntheticCohort("A", 5, 4, 1), syntheticCohort("B", 40, 40, 0), DefaultABMinCohortSize)
+	if !strings.Contains(small.Note, "Cohorts of 5 and 40 devices are smaller than ab_min_cohort_size (30)") {
+		t.Errorf("Expected a note about the small cohort, got %q", small.Note)
+	}
+	if disabled := compareCohorts(syntheticCohort("A", 5, 4, 1), syntheticCohort("B", 5, 5, 0), 0); disabled.Note != "" {
+		t.Errorf("Expected ab_min_cohort_size 0 to disable the note, got %q", disabled.Note)
+	}
+}
+
+func TestABComparisonMarkdown(t *testing.T) {
+	c := compareCohorts(syntheticCohort("A", 4, 2, 2, "image rejected"), syntheticCohort("B", 4, 4, 0), DefaultABMinCohortSize)
+	c.Cohorts[1].UploadedFilename = "B$20261016.bin"
+	md := abComparisonMarkdown(c)
+
+	for _, expected := range []string{
+		"#### A/B Comparison",
+		"| A | A.bin | 4 | 2 | 2 | 0 | 50.0% | 1m30s |",
+		"| B | B$20261016.bin | 4 | 4 | 0 | 0 | 100.0% | 2m30s |",
+		"by +50.0 percentage points",
+		"> ⚠️ Cohorts of 4 and 4 devices",
+		"Failure reasons in cohort A:\n\n- image rejected: 2 device(s)",
+	} {
+		if !strings.Contains(md, expected) {
+			t.Errorf("Expected summary to contain %q, got:\n%s", expected, md)
+		}
+	}
+	if strings.Contains(md, "Failure reasons in cohort B") {
+		t.Error("Expected no failure reasons for a cohort without failures")
+	}
+}
+
+func TestCheckCohortOverlap(t *testing.T) {
+	devices := func(uids ...string) []notehub.Device {
+		var d []notehub.Device
+		for _, uid := range uids {
+			d = append(d, notehub.Device{UID: uid})
+		}
+		return d
+	}
+
+	if err := checkCohortOverlap(devices("dev:1", "dev:2"), devices("dev:3")); err != nil {
+		t.Errorf("Expected disjoint cohorts to pass, got %v", err)
+	}
+	err := checkCohortOverlap(devices("dev:1", "dev:2", "dev:3"), devices("dev:3", "dev:4", "dev:2"))
+	if err == nil || !strings.Contains(err.Error(), "2 device(s) match both: dev:2, dev:3") {
+		t.Errorf("Expected the shared devices to be listed, got %v", err)
+	}
+}
+
+// newABServer fakes Notehub for an A/B deployment: tags=a matches dev:1 and dev:2, tags=b
+// matches dev:2 or dev:3 depending on overlap, and each polled device reports completed,
+// except dev:1, which fails
+func newABServer(t *testing.T, overlap bool) *fakeNotehub {
+	t.Helper()
+	return newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": func(w http.ResponseWriter, r *http.Request) {
+			uids := map[string][]string{"a": {"dev:1", "dev:2"}, "b": {"dev:3"}}
+			if overlap {
+				uids["b"] = []string{"dev:2", "dev:3"}
+			}
+			var devices []notehub.Device
+			for _, uid := range uids[r.URL.Query().Get("tags")] {
+				devices = append(devices, notehub.Device{UID: uid})
+			}
+			json.NewEncoder(w).Encode(map[string]any{"devices": devices, "has_more": false})
+		},
+		"/projects/app:123/dfu/host/status": func(w http.ResponseWriter, r *http.Request) {
+			var states []notehub.DeviceDFUState
+			for _, uid := range strings.Split(strings.Join(r.URL.Query()["deviceUID"], ","), ",") {
+				state := notehub.DeviceDFUState{DeviceUID: uid, Status: notehub.DFUStateCompleted}
+				if uid == "dev:1" {
+					state.Status, state.Description = notehub.DFUStateError, "image rejected"
+				}
+				states = append(states, state)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"devices": states, "has_more": false})
+		},
+	})
+}
+
+func TestDeployAB(t *testing.T) {
+	dir := t.TempDir()
+	files := []string{filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")}
+	for _, f := range files {
+		if err := os.WriteFile(f, []byte(filepath.Base(f)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	config := func(server *fakeNotehub) *DeploymentConfig {
+		return &DeploymentConfig{
+			ProjectUID:      "app:123",
+			Operation:       OperationAB,
+			APIBaseURL:      server.URL,
+			OAuthTokenURL:   server.URL + "/oauth2/token",
+			IssueDFU:        true,
+			WaitTimeout:     time.Minute,
+			PollInterval:    10 * time.Millisecond,
+			CohortA:         url.Values{"tags": {"a"}},
+			CohortB:         url.Values{"tags": {"b"}},
+			ABMinCohortSize: DefaultABMinCohortSize,
+		}
+	}
+
+	server := newABServer(t, false)
+	report, err := DeployFirmwareFiles(context.Background(), config(server), files, "")
+	if err != nil {
+		t.Fatalf("A/B deployment failed: %v", err)
+	}
+	if uploads := server.uploaded(); len(uploads) != 2 {
+		t.Errorf("Expected both files uploaded, got %v", uploads)
+	}
+	c := report.ABComparison
+	if c == nil || len(c.Cohorts) != 2 {
+		t.Fatalf("Expected a comparison of two cohorts, got %+v", c)
+	}
+	if a := c.Cohorts[0]; a.Devices != 2 || a.Completed != 1 || a.Failed != 1 || a.FailureReasons[0].Reason != "image rejected" {
+		t.Errorf("Unexpected cohort A result %+v", a)
+	}
+	if b := c.Cohorts[1]; b.Devices != 1 || b.Completed != 1 || b.SuccessRate != 100 {
+		t.Errorf("Unexpected cohort B result %+v", b)
+	}
+	if c.SuccessRateDelta != 50 || c.Note == "" {
+		t.Errorf("Expected B to lead by 50 points with a small-cohort note, got %+v", c)
+	}
+	if len(report.TriggerTimes) != 2 || !strings.HasPrefix(report.TriggerTimes[1].Scope, "cohort B") {
+		t.Errorf("Expected a DFU trigger per cohort, got %+v", report.TriggerTimes)
+	}
+	if !strings.Contains(report.Outputs()["ab_comparison"], `"success_rate_delta":50`) {
+		t.Error("Expected the ab_comparison output")
+	}
+
+	// Overlapping cohorts fail before anything is uploaded
+	server = newABServer(t, true)
+	_, err = DeployFirmwareFiles(context.Background(), config(server), files, "")
+	if err == nil || !strings.Contains(err.Error(), "must be disjoint, but 1 device(s) match both: dev:2") {
+		t.Errorf("Expected overlapping cohorts to be rejected, got %v", err)
+	}
+	if uploads := server.uploaded(); len(uploads) != 0 {
+		t.Errorf("Expected no uploads for overlapping cohorts, got %v", uploads)
+	}
+}
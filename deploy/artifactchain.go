@@ -0,0 +1,95 @@
+package deploy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// RecordedSHA256 returns the firmware digest recorded earlier in the workflow, from
+// expected_sha256 or from artifact_manifest, and checks the two agree when both are set.
+// verify_artifact_chain without either is a configuration error: verifying against nothing
+// would only give false assurance.
+func RecordedSHA256(verifyChain bool, expectedSHA256, manifestPath, firmwareFile string) (string, error) {
+	if manifestPath != "" {
+		manifestSHA256, err := loadManifestSHA256(manifestPath, firmwareFile)
+		if err != nil {
+			return "", err
+		}
+		if expectedSHA256 != "" && expectedSHA256 != manifestSHA256 {
+			return "", fmt.Errorf("expected_sha256 %s disagrees with %s in artifact_manifest %s", expectedSHA256, manifestSHA256, manifestPath)
+		}
+		expectedSHA256 = manifestSHA256
+	}
+	if verifyChain && expectedSHA256 == "" {
+		return "", fmt.Errorf("verify_artifact_chain requires the digest recorded by the build: set expected_sha256 or artifact_manifest")
+	}
+	return expectedSHA256, nil
+}
+
+// loadManifestSHA256 reads the SHA-256 of firmwareFile from a manifest written by the
+// build job: either this action's report (firmware_sha256) or sha256sum output, where the
+// line for firmwareFile's base name is used, or the only line if there is just one
+func loadManifestSHA256(path, firmwareFile string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read artifact_manifest: %w", err)
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '{' {
+		var report struct {
+			FirmwareSHA256 string `json:"firmware_sha256"`
+		}
+		if err := json.Unmarshal(trimmed, &report); err != nil {
+			return "", fmt.Errorf("failed to parse artifact_manifest %s: %w", path, err)
+		}
+		if report.FirmwareSHA256 == "" {
+			return "", fmt.Errorf("artifact_manifest %s has no firmware_sha256", path)
+		}
+		return ParseExpectedSHA256(report.FirmwareSHA256)
+	}
+
+	// sha256sum lines are "<digest>  <name>", with a '*' before the name in binary mode
+	digests := map[string]string{}
+	var only string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return "", fmt.Errorf("artifact_manifest %s is neither a report nor sha256sum output: %q", path, scanner.Text())
+		}
+		digests[filepath.Base(strings.TrimPrefix(fields[1], "*"))] = fields[0]
+		only = fields[0]
+	}
+	if digest, ok := digests[filepath.Base(firmwareFile)]; ok {
+		return ParseExpectedSHA256(digest)
+	}
+	if len(digests) == 1 {
+		return ParseExpectedSHA256(only)
+	}
+	return "", fmt.Errorf("artifact_manifest %s has no digest for %s", path, filepath.Base(firmwareFile))
+}
+
+// artifactChainError explains a firmware file whose digest differs from the one recorded
+// by the build, including when the file was last modified so a step that rewrote it
+// between build and deploy stands out
+func artifactChainError(path, expectedSHA256, actualSHA256 string, now time.Time) error {
+	modified := "unknown"
+	if info, err := os.Stat(path); err == nil {
+		if age := now.Sub(info.ModTime()); age >= 0 {
+			modified = fmt.Sprintf("%s (%s before this deployment started)", info.ModTime().UTC().Format(time.RFC3339), age.Round(time.Second))
+		} else {
+			modified = fmt.Sprintf("%s (after this deployment started)", info.ModTime().UTC().Format(time.RFC3339))
+		}
+	}
+	return fmt.Errorf("verify_artifact_chain: firmware file %s is not the artifact the build recorded, refusing to deploy\n  recorded SHA-256: %s\n  current SHA-256:  %s\n  last modified:    %s",
+		filepath.Base(path), expectedSHA256, actualSHA256, modified)
+}
@@ -0,0 +1,95 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	chainSHA256 = "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b" // sha256("secret")
+	otherSHA256 = "0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "manifest")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRecordedSHA256(t *testing.T) {
+	tests := []struct {
+		name        string
+		verify      bool
+		expected    string
+		manifest    string
+		want        string
+		expectError string
+	}{
+		{name: "nothing recorded", want: ""},
+		{name: "expected_sha256 only", verify: true, expected: chainSHA256, want: chainSHA256},
+		{name: "verify without a digest", verify: true, expectError: "verify_artifact_chain requires the digest recorded by the build"},
+		{name: "report manifest", verify: true, manifest: `{"firmware_sha256":"` + strings.ToUpper(chainSHA256) + `"}`, want: chainSHA256},
+		{name: "report without digest", verify: true, manifest: `{"status":"success"}`, expectError: "has no firmware_sha256"},
+		{name: "sha256sum by name", manifest: otherSHA256 + "  other.bin\n" + chainSHA256 + " *build/app.bin\n", want: chainSHA256},
+		{name: "sha256sum single line", manifest: chainSHA256 + "  firmware.bin\n", want: chainSHA256},
+		{name: "sha256sum without the file", manifest: otherSHA256 + "  a.bin\n" + otherSHA256 + "  b.bin\n", expectError: "has no digest for app.bin"},
+		{name: "unrecognized manifest", manifest: "not a manifest at all\n", expectError: "neither a report nor sha256sum output"},
+		{name: "manifest agrees", expected: chainSHA256, manifest: chainSHA256 + "  app.bin\n", want: chainSHA256},
+		{name: "manifest disagrees", expected: otherSHA256, manifest: chainSHA256 + "  app.bin\n", expectError: "disagrees with"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manifest := ""
+			if tt.manifest != "" {
+				manifest = writeManifest(t, tt.manifest)
+			}
+			got, err := RecordedSHA256(tt.verify, tt.expected, manifest, "firmware/app.bin")
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Expected %q, got %q, %v", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_VerifyArtifactChain(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now().Add(10 * time.Minute)
+
+	_, err := DeployFirmware(context.Background(), &DeploymentConfig{
+		ProjectUID:          "app:123",
+		FirmwareFile:        firmwareFile,
+		ExpectedSHA256:      chainSHA256,
+		VerifyArtifactChain: true,
+		APIBaseURL:          server.URL,
+		OAuthTokenURL:       server.URL + "/oauth2/token",
+		Clock:               func() time.Time { return started },
+	})
+	if err == nil {
+		t.Fatal("Expected the modified firmware to be refused")
+	}
+	for _, want := range []string{"not the artifact the build recorded", "recorded SHA-256: " + chainSHA256, "current SHA-256:", "10m0s before this deployment started"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to contain %q, got %v", want, err)
+		}
+	}
+	if uploads := server.uploaded(); len(uploads) != 0 {
+		t.Errorf("The modified firmware must not be uploaded, got %v", uploads)
+	}
+}
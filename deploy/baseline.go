@@ -0,0 +1,270 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// DefaultBaselinePercentile is the baseline curve a rollout is compared against when
+// baseline_percentile is not set
+const DefaultBaselinePercentile = 90
+
+// baselinePercentiles are the percentile curves written by the export-baseline operation
+var baselinePercentiles = []int{50, 75, 90, 95, 99}
+
+// baselineMilestones are the completion fractions each baseline curve records
+var baselineMilestones = []float64{0.1, 0.25, 0.5, 0.75, 0.9, 1.0}
+
+// ProgressSample records how many targeted devices had completed the update at a point
+// in a rollout, measured from when the DFU was triggered
+type ProgressSample struct {
+	ElapsedMs int64 `json:"elapsed_ms"`
+	Completed int   `json:"completed"`
+	Total     int   `json:"total"`
+}
+
+// BaselinePoint is the time a rollout took to reach a completion fraction
+type BaselinePoint struct {
+	Fraction  float64 `json:"fraction"`
+	ElapsedMs int64   `json:"elapsed_ms"`
+}
+
+// BaselineCurve gives, for each completion milestone, the time within which the given
+// percentile of historical rollouts reached it
+type BaselineCurve struct {
+	Percentile int             `json:"percentile"`
+	Points     []BaselinePoint `json:"points"`
+}
+
+// RolloutBaseline holds the historical rollout duration curves read from baseline_file
+type RolloutBaseline struct {
+	Runs   int             `json:"runs"`
+	Curves []BaselineCurve `json:"curves"`
+}
+
+// BaselineAnomaly records a completion milestone the rollout had not reached by the time
+// the baseline percentile of historical rollouts had
+type BaselineAnomaly struct {
+	Fraction   float64 `json:"fraction"`
+	Percentile int     `json:"percentile"`
+	BaselineMs int64   `json:"baseline_ms"`
+	ElapsedMs  int64   `json:"elapsed_ms"`
+	Completion float64 `json:"completion"`
+}
+
+// milestoneElapsed returns when a rollout's samples first reached fraction of its devices
+// completed, and false if they never did
+func milestoneElapsed(samples []ProgressSample, fraction float64) (int64, bool) {
+	for _, s := range samples {
+		if s.Total > 0 && float64(s.Completed)/float64(s.Total) >= fraction {
+			return s.ElapsedMs, true
+		}
+	}
+	return 0, false
+}
+
+// percentile returns the nearest-rank percentile p of sorted values
+func percentile(sorted []int64, p int) int64 {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > len(sorted) {
+		rank = len(sorted)
+	}
+	return sorted[rank-1]
+}
+
+// buildBaseline derives percentile curves from the progress samples of past rollouts.
+// Each milestone's percentiles are taken over the rollouts that reached it; milestones no
+// rollout reached are left out of the curves.
+func buildBaseline(histories [][]ProgressSample) (*RolloutBaseline, error) {
+	baseline := &RolloutBaseline{}
+	for _, samples := range histories {
+		if len(samples) > 0 {
+			baseline.Runs++
+		}
+	}
+	if baseline.Runs == 0 {
+		return nil, fmt.Errorf("no rollout progress samples to build a baseline from")
+	}
+
+	for _, p := range baselinePercentiles {
+		baseline.Curves = append(baseline.Curves, BaselineCurve{Percentile: p})
+	}
+	for _, fraction := range baselineMilestones {
+		var durations []int64
+		for _, samples := range histories {
+			if elapsed, ok := milestoneElapsed(samples, fraction); ok {
+				durations = append(durations, elapsed)
+			}
+		}
+		if len(durations) == 0 {
+			continue
+		}
+		sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+		for i := range baseline.Curves {
+			baseline.Curves[i].Points = append(baseline.Curves[i].Points, BaselinePoint{
+				Fraction:  fraction,
+				ElapsedMs: percentile(durations, baseline.Curves[i].Percentile),
+			})
+		}
+	}
+
+	return baseline, nil
+}
+
+// Curve returns the baseline curve for percentile p, or the nearest curve above it when
+// the baseline has no curve for p exactly
+func (b *RolloutBaseline) Curve(p int) (*BaselineCurve, error) {
+	var best *BaselineCurve
+	for i := range b.Curves {
+		c := &b.Curves[i]
+		if c.Percentile >= p && (best == nil || c.Percentile < best.Percentile) {
+			best = c
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("baseline has no curve at or above the %dth percentile", p)
+	}
+	return best, nil
+}
+
+// slowMilestones returns the baseline points the rollout is behind on: milestones above
+// its current completion fraction whose baseline time has already passed
+func slowMilestones(curve *BaselineCurve, elapsed time.Duration, completion float64) []BaselinePoint {
+	var slow []BaselinePoint
+	for _, point := range curve.Points {
+		if completion < point.Fraction && elapsed.Milliseconds() > point.ElapsedMs {
+			slow = append(slow, point)
+		}
+	}
+	return slow
+}
+
+// rolloutTracker samples completion progress while waiting for a rollout and compares it
+// against the baseline curve, when one is configured. A nil tracker records nothing.
+type rolloutTracker struct {
+	config    *DeploymentConfig
+	start     time.Time
+	curve     *BaselineCurve
+	samples   []ProgressSample
+	anomalies []BaselineAnomaly
+	flagged   map[float64]bool
+}
+
+// newRolloutTracker starts tracking a rollout triggered now, warning through config's
+// logger. curve may be nil.
+func newRolloutTracker(config *DeploymentConfig, curve *BaselineCurve) *rolloutTracker {
+	return &rolloutTracker{config: config, start: time.Now(), curve: curve, flagged: map[float64]bool{}}
+}
+
+// observe records a poll's device states, warning the first time the rollout falls
+// behind the baseline at each milestone
+func (t *rolloutTracker) observe(states []notehub.DeviceDFUState) {
+	if t == nil || len(states) == 0 {
+		return
+	}
+
+	completed := 0
+	for _, s := range states {
+		if s.Status == notehub.DFUStateCompleted {
+			completed++
+		}
+	}
+	elapsed := time.Since(t.start)
+	if n := len(t.samples); n == 0 || t.samples[n-1].Completed != completed || t.samples[n-1].Total != len(states) {
+		t.samples = append(t.samples, ProgressSample{ElapsedMs: elapsed.Milliseconds(), Completed: completed, Total: len(states)})
+	}
+
+	if t.curve == nil {
+		return
+	}
+	completion := float64(completed) / float64(len(states))
+	for _, point := range slowMilestones(t.curve, elapsed, completion) {
+		if t.flagged[point.Fraction] {
+			continue
+		}
+		t.flagged[point.Fraction] = true
+		t.anomalies = append(t.anomalies, BaselineAnomaly{
+			Fraction:   point.Fraction,
+			Percentile: t.curve.Percentile,
+			BaselineMs: point.ElapsedMs,
+			ElapsedMs:  elapsed.Milliseconds(),
+			Completion: completion,
+		})
+		t.config.Warnf("Rollout is slower than the baseline: %.0f%% of devices completed after %s, but %d%% of past rollouts reached %.0f%% within %s",
+			completion*100, elapsed.Round(time.Second), t.curve.Percentile, point.Fraction*100, (time.Duration(point.ElapsedMs) * time.Millisecond).Round(time.Second))
+	}
+}
+
+// LoadBaseline reads a baseline file written by the export-baseline operation
+func LoadBaseline(path string) (*RolloutBaseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline file: %w", err)
+	}
+	var baseline RolloutBaseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("failed to parse baseline file: %w", err)
+	}
+	return &baseline, nil
+}
+
+// ExportBaseline builds a baseline from the deployment reports matching patterns, a
+// comma-separated list of paths or globs, and writes it to path. Reports without
+// progress samples, from runs that did not wait for completion, are ignored. Each report
+// read is logged through logger; nil logs through the standard library's log.
+func ExportBaseline(patterns, path string, logger Logger) (*RolloutBaseline, error) {
+	logger = orStdLogger(logger)
+	var histories [][]ProgressSample
+	for _, pattern := range strings.Split(patterns, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid baseline_reports pattern %q: %w", pattern, err)
+		}
+		for _, match := range matches {
+			data, err := os.ReadFile(match)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read report %s: %w", match, err)
+			}
+			var report DeploymentReport
+			if err := json.Unmarshal(data, &report); err != nil {
+				return nil, fmt.Errorf("failed to parse report %s: %w", match, err)
+			}
+			if len(report.ProgressSamples) == 0 {
+				logger.Printf("  - %s: no progress samples, ignored", match)
+				continue
+			}
+			logger.Printf("  - %s: %d progress sample(s)", match, len(report.ProgressSamples))
+			histories = append(histories, report.ProgressSamples)
+		}
+	}
+
+	baseline, err := buildBaseline(histories)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(baseline, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal baseline: %w", err)
+	}
+	if err := writeFileSynced(path, data); err != nil {
+		return nil, fmt.Errorf("failed to write baseline file: %w", err)
+	}
+
+	return baseline, nil
+}
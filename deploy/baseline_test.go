@@ -0,0 +1,182 @@
+package deploy
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// syntheticRollout returns progress samples for a rollout of 10 devices completing one
+// device every step
+func syntheticRollout(step time.Duration) []ProgressSample {
+	var samples []ProgressSample
+	for completed := 0; completed <= 10; completed++ {
+		samples = append(samples, ProgressSample{ElapsedMs: (time.Duration(completed) * step).Milliseconds(), Completed: completed, Total: 10})
+	}
+	return samples
+}
+
+func TestMilestoneElapsed(t *testing.T) {
+	samples := syntheticRollout(time.Minute)
+
+	if elapsed, ok := milestoneElapsed(samples, 0.5); !ok || elapsed != (5*time.Minute).Milliseconds() {
+		t.Errorf("Expected 50%% at 5m, got %d, %v", elapsed, ok)
+	}
+	if _, ok := milestoneElapsed(samples[:3], 0.5); ok {
+		t.Error("Expected a rollout stopping at 20% never to reach 50%")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []int64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}
+	for p, expected := range map[int]int64{1: 10, 50: 50, 90: 90, 95: 100, 99: 100} {
+		if got := percentile(sorted, p); got != expected {
+			t.Errorf("percentile(%d) = %d, expected %d", p, got, expected)
+		}
+	}
+	if got := percentile([]int64{42}, 90); got != 42 {
+		t.Errorf("Expected a single value to be every percentile, got %d", got)
+	}
+}
+
+func TestBuildBaseline(t *testing.T) {
+	// Ten rollouts taking 1 to 10 minutes per device, and one that never finished
+	var histories [][]ProgressSample
+	for i := 1; i <= 10; i++ {
+		histories = append(histories, syntheticRollout(time.Duration(i)*time.Minute))
+	}
+	histories = append(histories, syntheticRollout(time.Hour)[:4], nil)
+
+	baseline, err := buildBaseline(histories)
+	if err != nil {
+		t.Fatalf("buildBaseline failed: %v", err)
+	}
+	if baseline.Runs != 11 {
+		t.Errorf("Expected 11 runs with samples, got %d", baseline.Runs)
+	}
+	if len(baseline.Curves) != len(baselinePercentiles) {
+		t.Fatalf("Expected %d curves, got %d", len(baselinePercentiles), len(baseline.Curves))
+	}
+
+	curve, err := baseline.Curve(90)
+	if err != nil {
+		t.Fatalf("curve failed: %v", err)
+	}
+	points := map[float64]int64{}
+	for _, p := range curve.Points {
+		points[p.Fraction] = p.ElapsedMs
+	}
+	// 90% of devices takes 9 steps; the 90th percentile of 1..10 minute steps is 9 minutes
+	if points[0.9] != (81 * time.Minute).Milliseconds() {
+		t.Errorf("Expected p90 of the 90%% milestone at 81m, got %s", time.Duration(points[0.9])*time.Millisecond)
+	}
+	// The unfinished rollout counts towards the milestones it reached, as the slowest
+	if curve, _ := baseline.Curve(99); curve.Points[0].ElapsedMs != (time.Hour).Milliseconds() {
+		t.Errorf("Expected p99 of the 10%% milestone at 1h, got %+v", curve.Points[0])
+	}
+
+	if _, err := buildBaseline([][]ProgressSample{nil}); err == nil {
+		t.Error("Expected an error without any progress samples")
+	}
+}
+
+func TestRolloutBaselineCurve(t *testing.T) {
+	baseline := &RolloutBaseline{Curves: []BaselineCurve{{Percentile: 50}, {Percentile: 90}, {Percentile: 99}}}
+
+	for p, expected := range map[int]int{50: 50, 80: 90, 90: 90, 95: 99} {
+		curve, err := baseline.Curve(p)
+		if err != nil || curve.Percentile != expected {
+			t.Errorf("curve(%d) = %+v, %v; expected the %dth percentile", p, curve, err, expected)
+		}
+	}
+	if _, err := (&RolloutBaseline{Curves: []BaselineCurve{{Percentile: 50}}}).Curve(90); err == nil {
+		t.Error("Expected an error when no curve covers the percentile")
+	}
+}
+
+func TestSlowMilestones(t *testing.T) {
+	curve := &BaselineCurve{Percentile: 90, Points: []BaselinePoint{
+		{Fraction: 0.5, ElapsedMs: (time.Hour).Milliseconds()},
+		{Fraction: 0.9, ElapsedMs: (4 * time.Hour).Milliseconds()},
+	}}
+
+	tests := []struct {
+		name       string
+		elapsed    time.Duration
+		completion float64
+		expected   int
+	}{
+		{"on track", 30 * time.Minute, 0.2, 0},
+		{"milestone reached in time", 2 * time.Hour, 0.6, 0},
+		{"behind at 50%", 2 * time.Hour, 0.3, 1},
+		{"behind at both", 5 * time.Hour, 0.4, 2},
+		{"finished", 5 * time.Hour, 1.0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := slowMilestones(curve, tt.elapsed, tt.completion); len(got) != tt.expected {
+				t.Errorf("Expected %d slow milestone(s), got %+v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRolloutTracker_FlagsEachMilestoneOnce(t *testing.T) {
+	curve := &BaselineCurve{Percentile: 90, Points: []BaselinePoint{{Fraction: 0.5, ElapsedMs: 0}}}
+	tracker := newRolloutTracker(&DeploymentConfig{}, curve)
+
+	pending := []notehub.DeviceDFUState{{DeviceUID: "dev:1", Status: "downloading"}, {DeviceUID: "dev:2", Status: "pending"}}
+	time.Sleep(2 * time.Millisecond)
+	tracker.observe(pending)
+	tracker.observe(pending)
+	tracker.observe([]notehub.DeviceDFUState{{DeviceUID: "dev:1", Status: notehub.DFUStateCompleted}, {DeviceUID: "dev:2", Status: notehub.DFUStateCompleted}})
+
+	if len(tracker.anomalies) != 1 || tracker.anomalies[0].Fraction != 0.5 || tracker.anomalies[0].Completion != 0 {
+		t.Errorf("Expected a single anomaly at the 50%% milestone, got %+v", tracker.anomalies)
+	}
+	if len(tracker.samples) != 2 || tracker.samples[1].Completed != 2 {
+		t.Errorf("Expected samples only when progress changes, got %+v", tracker.samples)
+	}
+
+	var none *rolloutTracker
+	none.observe(pending)
+}
+
+func TestExportBaseline_FromReports(t *testing.T) {
+	dir := t.TempDir()
+	for i, report := range []DeploymentReport{
+		{Status: StatusSuccess, ProgressSamples: syntheticRollout(time.Minute)},
+		{Status: StatusSuccess, ProgressSamples: syntheticRollout(2 * time.Minute)},
+		{Status: StatusSuccess},
+	} {
+		data, _ := json.Marshal(report)
+		if err := os.WriteFile(filepath.Join(dir, "report-"+string(rune('a'+i))+".json"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	path := filepath.Join(dir, "baseline.json")
+	if _, err := ExportBaseline(filepath.Join(dir, "report-*.json"), path, nil); err != nil {
+		t.Fatalf("exportBaseline failed: %v", err)
+	}
+
+	baseline, err := LoadBaseline(path)
+	if err != nil {
+		t.Fatalf("loadBaseline failed: %v", err)
+	}
+	if baseline.Runs != 2 {
+		t.Errorf("Expected reports without samples to be ignored, got %d runs", baseline.Runs)
+	}
+	curve, err := baseline.Curve(50)
+	if err != nil || len(curve.Points) != len(baselineMilestones) {
+		t.Errorf("Expected a point per milestone, got %+v, %v", curve, err)
+	}
+
+	if _, err := ExportBaseline(filepath.Join(dir, "missing-*.json"), path, nil); err == nil {
+		t.Error("Expected an error when no reports match")
+	}
+}
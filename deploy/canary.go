@@ -0,0 +1,80 @@
+package deploy
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// CanarySelection records the share of the targeted devices a canary rollout updated, and
+// the rest, which a later run can target to finish the rollout
+type CanarySelection struct {
+	Percentage          int      `json:"percentage"`
+	DeviceUIDs          []string `json:"device_uids"`
+	RemainingDeviceUIDs []string `json:"remaining_device_uids"`
+}
+
+// ParseRolloutPercentage validates the rollout_percentage input. Zero means the rollout
+// is not a canary and updates every targeted device.
+func ParseRolloutPercentage(value string) (int, error) {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	if value == "" {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(value)
+	if err != nil || p < 1 || p > 99 {
+		return 0, fmt.Errorf("invalid rollout_percentage %q: must be an integer from 1 to 99", value)
+	}
+	return p, nil
+}
+
+// canaryRank orders a device for canary selection by a hash of its UID, so the same
+// devices are picked on every run regardless of the order Notehub lists them in
+func canaryRank(uid string) string {
+	sum := sha256.Sum256([]byte(uid))
+	return string(sum[:])
+}
+
+// selectCanary picks percentage percent of devices, rounded up so that a small fleet still
+// gets a canary, and returns them along with the devices left for the rest of the rollout.
+// Both lists are in rank order.
+func selectCanary(devices []notehub.Device, percentage int) (canary, remaining []notehub.Device) {
+	ranked := append([]notehub.Device(nil), devices...)
+	sort.Slice(ranked, func(i, j int) bool {
+		ri, rj := canaryRank(ranked[i].UID), canaryRank(ranked[j].UID)
+		if ri != rj {
+			return ri < rj
+		}
+		return ranked[i].UID < ranked[j].UID
+	})
+	n := (len(ranked)*percentage + 99) / 100
+	return ranked[:n], ranked[n:]
+}
+
+// applyCanary narrows the DFU to the canary share of targets, recording both the canary
+// and the remaining devices in the report, and returns the config for the narrowed DFU
+func applyCanary(config *DeploymentConfig, report *DeploymentReport, targets []notehub.Device) ([]notehub.Device, *DeploymentConfig, error) {
+	if len(targets) == 0 {
+		return nil, nil, fmt.Errorf("rollout_percentage: targeting matched no devices to select a canary from")
+	}
+	if keys := unlistableFilters(buildTargetingParams(config)); len(keys) > 0 {
+		config.Warnf("rollout_percentage selects the canary from the devices listing, which does not filter on %s", strings.Join(keys, ", "))
+	}
+
+	canary, remaining := selectCanary(targets, config.RolloutPercentage)
+	selection := &CanarySelection{Percentage: config.RolloutPercentage, DeviceUIDs: []string{}, RemainingDeviceUIDs: []string{}}
+	for _, d := range canary {
+		selection.DeviceUIDs = append(selection.DeviceUIDs, d.UID)
+	}
+	for _, d := range remaining {
+		selection.RemainingDeviceUIDs = append(selection.RemainingDeviceUIDs, d.UID)
+	}
+	report.Canary = selection
+
+	config.logf("Canary rollout: updating %d of %d device(s) (%d%%), leaving %d for a later run", len(canary), len(targets), config.RolloutPercentage, len(remaining))
+	return canary, explicitTargetConfig(config, canary), nil
+}
@@ -0,0 +1,130 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestParseRolloutPercentage(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected int
+		valid    bool
+	}{
+		{"", 0, true},
+		{"10", 10, true},
+		{" 25% ", 25, true},
+		{"99", 99, true},
+		{"0", 0, false},
+		{"100", 0, false},
+		{"ten", 0, false},
+		{"12.5", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseRolloutPercentage(tt.value)
+		if (err == nil) != tt.valid || got != tt.expected {
+			t.Errorf("ParseRolloutPercentage(%q) = %d, %v; expected %d, valid %t", tt.value, got, err, tt.expected, tt.valid)
+		}
+	}
+}
+
+// fleetOf returns n devices named dev:1 to dev:n
+func fleetOf(n int) []notehub.Device {
+	devices := make([]notehub.Device, n)
+	for i := range devices {
+		devices[i].UID = fmt.Sprintf("dev:%d", i+1)
+	}
+	return devices
+}
+
+func deviceUIDs(devices []notehub.Device) []string {
+	var uids []string
+	for _, d := range devices {
+		uids = append(uids, d.UID)
+	}
+	return uids
+}
+
+func TestSelectCanary(t *testing.T) {
+	fleet := fleetOf(50)
+	canary, remaining := selectCanary(fleet, 10)
+	if len(canary) != 5 || len(remaining) != 45 {
+		t.Fatalf("Expected 5 canary and 45 remaining devices, got %d and %d", len(canary), len(remaining))
+	}
+
+	// The listing order does not change which devices are picked
+	reversed := append([]notehub.Device(nil), fleet...)
+	sort.Slice(reversed, func(i, j int) bool { return reversed[i].UID > reversed[j].UID })
+	again, _ := selectCanary(reversed, 10)
+	if fmt.Sprint(deviceUIDs(again)) != fmt.Sprint(deviceUIDs(canary)) {
+		t.Errorf("Expected the same canary regardless of order, got %v and %v", deviceUIDs(canary), deviceUIDs(again))
+	}
+
+	// Every device lands in exactly one of the two lists
+	seen := map[string]int{}
+	for _, uid := range append(deviceUIDs(canary), deviceUIDs(remaining)...) {
+		seen[uid]++
+	}
+	if len(seen) != 50 {
+		t.Errorf("Expected all 50 devices across both lists, got %d", len(seen))
+	}
+
+	// Small fleets round up, so a canary always has a device
+	if canary, _ := selectCanary(fleetOf(3), 10); len(canary) != 1 {
+		t.Errorf("Expected 10%% of 3 devices to round up to 1, got %d", len(canary))
+	}
+}
+
+func TestDeployFirmware_Canary(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("tags") != "prod" {
+				t.Errorf("Expected the devices listing filtered on the targeting, got %s", r.URL.RawQuery)
+			}
+			json.NewEncoder(w).Encode(map[string]any{"devices": fleetOf(240), "has_more": false})
+		},
+	})
+	config := server.config(t)
+	config.DeviceUID = ""
+	config.Tag = "prod"
+	config.RolloutPercentage = 50
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	// 120 devices are more than fit in one request, so the DFU is split
+	dfus := server.queries("POST /projects/app:123/dfu/host/update")
+	if len(dfus) != 2 {
+		t.Fatalf("Expected the canary DFU split into 2 requests, got %d", len(dfus))
+	}
+	var targeted []string
+	for _, query := range dfus {
+		targeted = append(targeted, query["deviceUID"]...)
+	}
+	canary, _ := selectCanary(fleetOf(240), 50)
+	if fmt.Sprint(targeted) != fmt.Sprint(deviceUIDs(canary)) {
+		t.Errorf("Expected the DFU to target the canary devices only")
+	}
+
+	outputs := report.Outputs()
+	var canaryOut, remainingOut []string
+	json.Unmarshal([]byte(outputs["canary_devices"]), &canaryOut)
+	json.Unmarshal([]byte(outputs["remaining_devices"]), &remainingOut)
+	if len(canaryOut) != 120 || len(remainingOut) != 120 {
+		t.Errorf("Expected 120 canary and 120 remaining devices in the outputs, got %d and %d", len(canaryOut), len(remainingOut))
+	}
+	if report.TargetPreview == nil || report.TargetPreview.Count != 120 {
+		t.Errorf("Expected the target count to be the canary's, got %+v", report.TargetPreview)
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "| Canary | 50%: 120 device(s) updated, 120 remaining |") {
+		t.Errorf("Expected the canary in the summary, got:\n%s", DeploymentSummaryMarkdown(report))
+	}
+}
@@ -0,0 +1,109 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// cancelDeployment runs the cancel operation: it cancels the pending DFU of the devices the
+// targeting inputs select, without uploading anything. The devices whose update was still
+// pending are read from the DFU status beforehand and recorded as pending before the
+// cancel, since Notehub does not say which devices the cancel cleared.
+func cancelDeployment(ctx context.Context, config *DeploymentConfig, report *DeploymentReport) (*DeploymentReport, error) {
+	filters := buildTargetingParams(config)
+	if len(filters) == 0 && config.FleetName == "" && !config.AllowAllDevices {
+		return report, fmt.Errorf("no device targeting is set, so cancel would clear the pending DFU of every device in the project; set one of %s, or set allow_all_devices: true to cancel project-wide",
+			strings.Join(TargetingInputs, ", "))
+	}
+	report.TargetingParams = filters.Encode()
+
+	client := newNotehubClient(config)
+
+	report.startPhase("authenticate")
+	if err := authenticate(ctx, client, config, report); err != nil {
+		return report, fmt.Errorf("authentication failed: %w", err)
+	}
+	config, err := applyFleetName(ctx, client, config, report)
+	if err != nil {
+		return report, err
+	}
+	filters = buildTargetingParams(config)
+	report.TargetingParams = filters.Encode()
+
+	report.startPhase("dfu_status")
+	states, err := client.GetDFUStatus(ctx, config.ProjectUID, config.FirmwareType, filters)
+	if err != nil {
+		return report, fmt.Errorf("failed to read the pending DFU: %w", err)
+	}
+	pending := []string{}
+	for _, s := range states {
+		if !s.Terminal() {
+			pending = append(pending, s.DeviceUID)
+		}
+	}
+	config.logf("%d targeted device(s) have a pending DFU", len(pending))
+	report.endPhase()
+
+	if config.DryRun {
+		config.logf("🔍 Dry run: the pending DFU of %d device(s) would be cancelled", len(pending))
+		report.PendingBeforeCancel = pending
+		report.Status = StatusSuccess
+		return report, nil
+	}
+
+	report.startPhase("cancel_dfu")
+	err = client.CancelDFU(ctx, config.ProjectUID, config.FirmwareType, filters)
+	if errors.Is(err, notehub.ErrNoDFUPending) {
+		return report, fmt.Errorf("nothing to cancel: %w for the targeted devices", err)
+	}
+	if err != nil {
+		return report, fmt.Errorf("DFU cancel failed: %w", err)
+	}
+	report.endPhase()
+
+	report.PendingBeforeCancel = pending
+	config.logf("✅ Cancelled the pending DFU; %d targeted device(s) were pending before the cancel", len(pending))
+	for _, uid := range pending {
+		config.logf("  - %s", uid)
+	}
+
+	report.Status = StatusSuccess
+	return report, nil
+}
+
+// abortCleanupTimeout bounds the cleanup of an aborted run, which runs after the run's own
+// context has been cancelled
+const abortCleanupTimeout = 30 * time.Second
+
+// cancelDFUOnAbort cancels the DFU this run issued when the run is aborted afterwards, by a
+// cancelled workflow or the overall deadline, and cancel_dfu_on_abort is set. Each DFU
+// request sent is cancelled with the parameters it was sent with, extra_dfu_params
+// included, so the cleanup reaches no device the DFU did not; failures are warnings, since
+// the run has already failed.
+func cancelDFUOnAbort(ctx context.Context, client *notehub.Client, config, dfuConfig *DeploymentConfig, report *DeploymentReport) {
+	sent := len(report.TriggerTimes)
+	if !config.CancelDFUOnAbort || ctx.Err() == nil || sent == 0 {
+		return
+	}
+	config.logf("Run aborted after the DFU was issued; cancelling it (cancel_dfu_on_abort)...")
+
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortCleanupTimeout)
+	defer cancel()
+	cancelled := 0
+	for _, batch := range dfuTargetBatches(dfuConfig)[:sent] {
+		filters := dfuParams(batch)
+		err := client.CancelDFU(cleanupCtx, batch.ProjectUID, batch.FirmwareType, filters)
+		if err != nil && !errors.Is(err, notehub.ErrNoDFUPending) {
+			config.Warnf("Cleanup: cancelling the DFU for %s failed: %v", filters.Encode(), err)
+			continue
+		}
+		cancelled++
+	}
+	report.DFUCancelledOnAbort = cancelled > 0
+	config.logf("Cleanup: cancelled %d of %d DFU request(s) issued by this run", cancelled, sent)
+}
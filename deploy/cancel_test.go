@@ -0,0 +1,219 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newCancelNotehub serves the DFU status of three devices and the cancel endpoint, which
+// reports nothing pending when nothingPending is set
+func newCancelNotehub(t *testing.T, nothingPending bool) *fakeNotehub {
+	t.Helper()
+	return newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/status": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("tags") != "prod" {
+				t.Errorf("Expected the targeting in the status request, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"devices":[{"device_uid":"dev:1","status":"pending"},{"device_uid":"dev:2","status":"completed"},{"device_uid":"dev:3","status":"downloading"}]}`)
+		},
+		"/projects/app:123/dfu/host/cancel": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("tags") != "prod" {
+				t.Errorf("Expected the targeting in the cancel request, got %s", r.URL.RawQuery)
+			}
+			if nothingPending {
+				http.Error(w, `{"err":"no firmware update is pending"}`, http.StatusConflict)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		},
+	})
+}
+
+func cancelConfig(serverURL string) *DeploymentConfig {
+	return &DeploymentConfig{
+		ProjectUID:    "app:123",
+		Operation:     OperationCancel,
+		Tag:           "prod",
+		IssueDFU:      true,
+		APIBaseURL:    serverURL,
+		OAuthTokenURL: serverURL + "/oauth2/token",
+	}
+}
+
+func TestDeployFirmware_Cancel(t *testing.T) {
+	server := newCancelNotehub(t, false)
+
+	report, err := DeployFirmware(context.Background(), cancelConfig(server.URL))
+	if err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if !reflect.DeepEqual(report.PendingBeforeCancel, []string{"dev:1", "dev:3"}) {
+		t.Errorf("Expected the devices dev:1 and dev:3 pending before the cancel, got %v", report.PendingBeforeCancel)
+	}
+	if report.Status != StatusSuccess || report.DFUTriggered || report.UploadedFilename != "" {
+		t.Errorf("Expected a successful cancel that uploads and triggers nothing, got %+v", report)
+	}
+	for _, r := range server.requests() {
+		if strings.HasPrefix(r, "PUT") || strings.Contains(r, "/update") {
+			t.Errorf("Cancel must not upload or trigger a DFU, got %s", r)
+		}
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "| DFU Cancelled | 2 device(s) pending before cancel |") {
+		t.Error("Expected the summary to report the devices pending before the cancel")
+	}
+}
+
+func TestDeployFirmware_CancelNothingPending(t *testing.T) {
+	server := newCancelNotehub(t, true)
+
+	_, err := DeployFirmware(context.Background(), cancelConfig(server.URL))
+	if err == nil || !strings.Contains(err.Error(), "nothing to cancel: no device firmware update is pending") {
+		t.Fatalf("Expected a clear error when no DFU was pending, got %v", err)
+	}
+}
+
+func TestDeployFirmware_CancelRequiresTargeting(t *testing.T) {
+	server := newCancelNotehub(t, false)
+	config := cancelConfig(server.URL)
+	config.Tag = ""
+
+	_, err := DeployFirmware(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "allow_all_devices") {
+		t.Fatalf("Expected a project-wide cancel to be refused, got %v", err)
+	}
+	if requests := server.requests(); len(requests) != 0 {
+		t.Errorf("Expected no requests, got %v", requests)
+	}
+}
+
+// newAbortNotehub serves a deployment whose upload blocks until the request is cancelled
+// when slowUpload is set, and whose DFU status stays pending. It calls onDFU when the DFU
+// is issued. The returned function lists the upload, DFU and cancel requests made.
+func newAbortNotehub(t *testing.T, slowUpload bool, onDFU func()) (*fakeNotehub, func() []string) {
+	t.Helper()
+	routes := fakeRoutes{
+		"/projects/app:123/dfu/host/update": func(w http.ResponseWriter, r *http.Request) {
+			onDFU()
+			fmt.Fprint(w, `{}`)
+		},
+		"/projects/app:123/dfu/host/status": respond(`{"devices":[{"device_uid":"dev:1","status":"downloading"}]}`),
+	}
+	if slowUpload {
+		routes["PUT /projects/app:123/firmware/*"] = func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(io.Discard, r.Body)
+			select {
+			case <-r.Context().Done():
+			case <-time.After(10 * time.Second):
+			}
+		}
+	}
+	server := newFakeNotehub(t, routes)
+	return server, func() []string {
+		var requests []string
+		for _, r := range server.requests() {
+			if strings.HasPrefix(r, "PUT ") || strings.Contains(r, "/dfu/host/update") || strings.Contains(r, "/dfu/host/cancel") {
+				requests = append(requests, r)
+			}
+		}
+		return requests
+	}
+}
+
+// abortConfig deploys app.bin to dev:1, waiting for completion
+func abortConfig(t *testing.T, serverURL string) *DeploymentConfig {
+	t.Helper()
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &DeploymentConfig{
+		ProjectUID:        "app:123",
+		FirmwareFile:      firmwareFile,
+		DeviceUID:         "dev:1",
+		IssueDFU:          true,
+		WaitForCompletion: true,
+		WaitTimeout:       time.Minute,
+		PollInterval:      10 * time.Millisecond,
+		CancelDFUOnAbort:  true,
+		APIBaseURL:        serverURL,
+		OAuthTokenURL:     serverURL + "/oauth2/token",
+	}
+}
+
+func TestDeployFirmware_CancelledMidUpload(t *testing.T) {
+	server, recorded := newAbortNotehub(t, true, func() {})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+
+	started := time.Now()
+	report, err := DeployFirmware(ctx, abortConfig(t, server.URL))
+	if err == nil || !strings.Contains(err.Error(), "upload was cancelled before it finished") {
+		t.Fatalf("Expected the upload to be cancelled, got %v", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("Expected the in-flight upload to be aborted promptly, took %s", elapsed)
+	}
+	if requests := recorded(); report.DFUTriggered || report.DFUCancelledOnAbort || len(requests) != 1 {
+		t.Errorf("Expected only the aborted upload, got %v", requests)
+	}
+}
+
+func TestDeployFirmware_CancelDFUOnAbort(t *testing.T) {
+	for _, cancelOnAbort := range []bool{true, false} {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		server, recorded := newAbortNotehub(t, false, func() { time.AfterFunc(50*time.Millisecond, cancel) })
+		config := abortConfig(t, server.URL)
+		l := useRecordingLogger(config)
+		config.CancelDFUOnAbort = cancelOnAbort
+
+		report, err := DeployFirmware(ctx, config)
+		if err == nil || !strings.Contains(err.Error(), "wait_for_completion was cancelled before it finished") {
+			t.Fatalf("Expected the wait to be cancelled, got %v", err)
+		}
+
+		requests := recorded()
+		last := requests[len(requests)-1]
+		if !cancelOnAbort {
+			if strings.Contains(last, "/cancel") || report.DFUCancelledOnAbort {
+				t.Errorf("Expected no cleanup without cancel_dfu_on_abort, got %v", requests)
+			}
+			continue
+		}
+		if last != "POST /projects/app:123/dfu/host/cancel?deviceUID=dev%3A1" || !report.DFUCancelledOnAbort {
+			t.Errorf("Expected the DFU cancelled for its targeting, got %v", requests)
+		}
+		if !strings.Contains(strings.Join(l.messages, "\n"), "Cleanup: cancelled 1 of 1 DFU request(s) issued by this run") {
+			t.Errorf("Expected the cleanup logged, got %v", l.messages)
+		}
+	}
+}
+
+func TestDeployFirmware_CancelDFUOnAbortKeepsExtraParams(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server, recorded := newAbortNotehub(t, false, func() { time.AfterFunc(50*time.Millisecond, cancel) })
+	config := abortConfig(t, server.URL)
+	useRecordingLogger(config)
+	config.ExtraDFUParams = url.Values{"region": {"eu"}}
+
+	if _, err := DeployFirmware(ctx, config); err == nil {
+		t.Fatal("Expected the wait to be cancelled")
+	}
+	requests := recorded()
+	if len(requests) < 2 || requests[len(requests)-2] != "POST /projects/app:123/dfu/host/update?deviceUID=dev%3A1&region=eu" {
+		t.Fatalf("Expected the DFU sent with the extra param, got %v", requests)
+	}
+	if last := requests[len(requests)-1]; last != "POST /projects/app:123/dfu/host/cancel?deviceUID=dev%3A1&region=eu" {
+		t.Errorf("Expected the cancel narrowed by the same extra param as the DFU, got %v", requests)
+	}
+}
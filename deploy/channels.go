@@ -0,0 +1,168 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// PromotionRecord describes a firmware promotion between channels
+type PromotionRecord struct {
+	From     string `json:"from"`
+	To       string `json:"to"`
+	Strategy string `json:"strategy"`
+	SHA256   string `json:"sha256"`
+}
+
+// ParseChannel validates a channel name used as a filename prefix
+func ParseChannel(input, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if strings.ContainsAny(value, "/\\ \t") {
+		return "", fmt.Errorf("invalid %s %q: must not contain slashes or whitespace", input, value)
+	}
+	return value, nil
+}
+
+// channelFilename applies a channel's prefix to a firmware filename
+func channelFilename(channel, filename string) string {
+	if channel == "" {
+		return filename
+	}
+	return channel + "-" + filename
+}
+
+// firmwarePromoter copies uploaded firmware from one name to another
+type firmwarePromoter interface {
+	// name identifies the strategy in logs and the report
+	name() string
+
+	// promote stores sourceData, the firmware at source, under target and returns the
+	// filename Notehub assigned
+	promote(ctx context.Context, projectUID, firmwareType, source, target string, sourceData []byte) (string, error)
+}
+
+// serverCopyPromoter promotes firmware with a server-side copy, avoiding a re-upload
+type serverCopyPromoter struct {
+	client *notehub.Client
+}
+
+func (p *serverCopyPromoter) name() string { return "server_copy" }
+
+func (p *serverCopyPromoter) promote(ctx context.Context, projectUID, firmwareType, source, target string, _ []byte) (string, error) {
+	resp, err := p.client.CopyFirmware(ctx, projectUID, firmwareType, source, target)
+	if err != nil {
+		return "", err
+	}
+	return resp.Filename, nil
+}
+
+// reuploadPromoter promotes firmware by uploading the downloaded source under the new name
+type reuploadPromoter struct {
+	client *notehub.Client
+}
+
+func (p *reuploadPromoter) name() string { return "reupload" }
+
+func (p *reuploadPromoter) promote(ctx context.Context, projectUID, firmwareType, source, target string, sourceData []byte) (string, error) {
+	resp, err := p.client.UploadFirmwareData(ctx, projectUID, firmwareType, target, sourceData)
+	if err != nil {
+		return "", err
+	}
+	return resp.Filename, nil
+}
+
+// promoteBetweenChannels promotes firmware from source to target, preferring a server-side
+// copy and falling back to download-and-reupload. The promoted file is downloaded again
+// and its checksum compared with the source before the promotion is reported.
+func promoteBetweenChannels(ctx context.Context, client *notehub.Client, config *DeploymentConfig, source, target string) (*PromotionRecord, string, error) {
+	config.logf("Promoting firmware %s to %s...", source, target)
+
+	sourceData, err := client.DownloadFirmware(ctx, config.ProjectUID, config.FirmwareType, source)
+	if err != nil {
+		return nil, "", err
+	}
+	sourceSum := sha256.Sum256(sourceData)
+	sourceSHA256 := hex.EncodeToString(sourceSum[:])
+
+	var promoter firmwarePromoter = &serverCopyPromoter{client: client}
+	config.logf("  - Promotion strategy: %s", promoter.name())
+	promoted, err := promoter.promote(ctx, config.ProjectUID, config.FirmwareType, source, target, sourceData)
+	if errors.Is(err, notehub.ErrServerCopyUnsupported) {
+		promoter = &reuploadPromoter{client: client}
+		config.logf("  - Server-side copy unavailable, falling back to promotion strategy: %s", promoter.name())
+		promoted, err = promoter.promote(ctx, config.ProjectUID, config.FirmwareType, source, target, sourceData)
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("promotion via %s failed: %w", promoter.name(), err)
+	}
+
+	promotedData, err := client.DownloadFirmware(ctx, config.ProjectUID, config.FirmwareType, promoted)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to verify promoted firmware: %w", err)
+	}
+	promotedSum := sha256.Sum256(promotedData)
+	if promotedSHA256 := hex.EncodeToString(promotedSum[:]); promotedSHA256 != sourceSHA256 {
+		return nil, "", fmt.Errorf("promoted firmware SHA-256 mismatch: source %s, promoted %s", sourceSHA256, promotedSHA256)
+	}
+
+	config.logf("✅ Promoted %s to %s (SHA-256 %s verified)", source, promoted, sourceSHA256)
+
+	return &PromotionRecord{
+		From:     source,
+		To:       promoted,
+		Strategy: promoter.name(),
+		SHA256:   sourceSHA256,
+	}, promoted, nil
+}
+
+// promoteFirmware runs the promote operation: the firmware named by firmware_file is copied
+// from the promote_from channel to the target channel, and the DFU then targets the
+// promoted name
+func promoteFirmware(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport) (*DeploymentReport, error) {
+	base := filepath.Base(config.FirmwareFile)
+	source := channelFilename(config.PromoteFrom, base)
+	target := channelFilename(config.Channel, base)
+	if source == target {
+		return report, fmt.Errorf("promote requires different channels, got %q for both source and target", config.Channel)
+	}
+
+	if config.DryRun {
+		config.logf("DRY RUN: would promote %s to %s", source, target)
+		logDeploymentSummary(config, report)
+		report.Status = StatusSuccess
+		return report, nil
+	}
+
+	release, err := acquireLockIfEnabled(ctx, client, config, report)
+	if err != nil {
+		return report, err
+	}
+	defer release()
+
+	promotion, promoted, err := promoteBetweenChannels(ctx, client, config, source, target)
+	if err != nil {
+		return report, fmt.Errorf("firmware promotion failed: %w", err)
+	}
+	report.Promotion = promotion
+	report.UploadedFilename = promoted
+	report.FirmwareSHA256 = promotion.SHA256
+
+	if err := runDFUPhase(ctx, client, config, config, report, promoted); err != nil {
+		return report, err
+	}
+
+	logDeploymentSummary(config, report)
+
+	report.Status = StatusSuccess
+	if err := runHook(ctx, config, HookPhasePostCompletion, report); err != nil {
+		return report, fmt.Errorf("hook blocked deployment: %w", err)
+	}
+
+	return report, nil
+}
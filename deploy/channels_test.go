@@ -0,0 +1,106 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// newChannelNotehub fakes a project holding beta-app.bin. With supportsCopy it copies
+// files on the server, writing "corrupted" instead when corruptCopy is set.
+func newChannelNotehub(t *testing.T, supportsCopy, corruptCopy bool) (*fakeNotehub, *notehub.Client) {
+	t.Helper()
+	var server *fakeNotehub
+	routes := fakeRoutes{}
+	if supportsCopy {
+		routes["POST /projects/app:123/firmware/host/*"] = func(w http.ResponseWriter, r *http.Request) {
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			data, _ := server.firmware(path.Base(strings.TrimSuffix(r.URL.Path, "/copy")))
+			if corruptCopy {
+				data = []byte("corrupted")
+			}
+			server.addFirmware(body["filename"], data)
+			json.NewEncoder(w).Encode(notehub.FirmwareUploadResponse{Filename: body["filename"]})
+		}
+	}
+	server = newFakeNotehub(t, routes)
+	server.addFirmware("beta-app.bin", []byte("firmware"))
+	return server, newTestClient(server.URL)
+}
+
+func TestChannelFilename(t *testing.T) {
+	if got := channelFilename("", "app.bin"); got != "app.bin" {
+		t.Errorf("Expected no prefix without a channel, got %s", got)
+	}
+	if got := channelFilename("stable", "app.bin"); got != "stable-app.bin" {
+		t.Errorf("Expected stable-app.bin, got %s", got)
+	}
+	if _, err := ParseChannel("channel", "beta/1"); err == nil {
+		t.Error("Expected channel with a slash to be rejected")
+	}
+}
+
+func TestParseOperation(t *testing.T) {
+	for input, expected := range map[string]string{"": OperationDeploy, "deploy": OperationDeploy, "Promote": OperationPromote, "validate": OperationValidate, "cancel": OperationCancel} {
+		got, err := ParseOperation(input)
+		if err != nil || got != expected {
+			t.Errorf("parseOperation(%q) = %q, %v; expected %q", input, got, err, expected)
+		}
+	}
+	if _, err := ParseOperation("rollback"); err == nil {
+		t.Error("Expected error for unknown operation")
+	}
+}
+
+func TestPromoteBetweenChannels_ServerCopy(t *testing.T) {
+	server, client := newChannelNotehub(t, true, false)
+
+	record, promoted, err := promoteBetweenChannels(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", FirmwareType: notehub.FirmwareTypeHost}, "beta-app.bin", "stable-app.bin")
+	if err != nil {
+		t.Fatalf("Promotion failed: %v", err)
+	}
+	if promoted != "stable-app.bin" || record.Strategy != "server_copy" || record.SHA256 != testFirmwareSHA256 {
+		t.Errorf("Unexpected promotion %+v", record)
+	}
+	if uploads := server.uploaded(); len(uploads) != 0 {
+		t.Errorf("Server-side copy must not re-upload, got %v", uploads)
+	}
+}
+
+func TestPromoteBetweenChannels_ReuploadFallback(t *testing.T) {
+	server, client := newChannelNotehub(t, false, false)
+
+	record, promoted, err := promoteBetweenChannels(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", FirmwareType: notehub.FirmwareTypeHost}, "beta-app.bin", "stable-app.bin")
+	if err != nil {
+		t.Fatalf("Promotion failed: %v", err)
+	}
+	if promoted != "stable-app.bin" || record.Strategy != "reupload" {
+		t.Errorf("Unexpected promotion %+v", record)
+	}
+	if data, _ := server.firmware("stable-app.bin"); string(data) != "firmware" {
+		t.Errorf("Expected promoted file contents to match source, got %q", data)
+	}
+}
+
+func TestPromoteBetweenChannels_ChecksumMismatch(t *testing.T) {
+	_, client := newChannelNotehub(t, true, true)
+
+	_, _, err := promoteBetweenChannels(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", FirmwareType: notehub.FirmwareTypeHost}, "beta-app.bin", "stable-app.bin")
+	if err == nil || !strings.Contains(err.Error(), "SHA-256 mismatch") {
+		t.Errorf("Expected checksum mismatch, got %v", err)
+	}
+}
+
+func TestPromoteBetweenChannels_MissingSource(t *testing.T) {
+	_, client := newChannelNotehub(t, true, false)
+
+	if _, _, err := promoteBetweenChannels(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", FirmwareType: notehub.FirmwareTypeHost}, "rc-app.bin", "stable-app.bin"); err == nil {
+		t.Error("Expected error for missing source firmware")
+	}
+}
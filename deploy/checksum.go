@@ -0,0 +1,85 @@
+package deploy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// fileSHA256 returns the hex-encoded SHA-256 digest of a file
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open firmware file for checksum: %w", err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to checksum firmware file: %w", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ParseExpectedSHA256 validates the expected_sha256 input and normalizes it to lower case
+func ParseExpectedSHA256(value string) (string, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "" {
+		return "", nil
+	}
+	if len(value) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid expected_sha256: must be %d hex characters, got %d", sha256.Size*2, len(value))
+	}
+	if _, err := hex.DecodeString(value); err != nil {
+		return "", fmt.Errorf("invalid expected_sha256: not a hex string")
+	}
+	return value, nil
+}
+
+// verifyStoredFirmware fetches the metadata Notehub stored for the uploaded firmware and
+// compares it with the local file. The SHA-256 is compared when Notehub reports one, then
+// the MD5; without either, only the length is compared and a warning says so.
+func verifyStoredFirmware(ctx context.Context, client *notehub.Client, config *DeploymentConfig, filename string, identity *ArtifactIdentity) error {
+	files, err := client.ListFirmware(ctx, config.ProjectUID, config.FirmwareType, filename)
+	if err != nil {
+		return fmt.Errorf("failed to fetch uploaded firmware metadata: %w", err)
+	}
+	var stored *notehub.FirmwareInfo
+	for i := range files {
+		if files[i].Filename == filename {
+			stored = &files[i]
+			break
+		}
+	}
+	if stored == nil {
+		return fmt.Errorf("uploaded firmware %s is not listed on Notehub", filename)
+	}
+
+	if stored.Length != 0 && stored.Length != identity.Size {
+		return fmt.Errorf("uploaded firmware length mismatch: sent %d bytes, Notehub stored %d", identity.Size, stored.Length)
+	}
+	switch {
+	case stored.SHA256 != "":
+		if !strings.EqualFold(stored.SHA256, identity.SHA256) {
+			return fmt.Errorf("uploaded firmware SHA-256 mismatch: sent %s, Notehub stored %s", identity.SHA256, stored.SHA256)
+		}
+		config.logf("✅ Notehub stored the firmware with SHA-256 %s", identity.SHA256)
+	case stored.MD5 != "":
+		if !strings.EqualFold(stored.MD5, identity.MD5) {
+			return fmt.Errorf("uploaded firmware MD5 mismatch: sent %s, Notehub stored %s", identity.MD5, stored.MD5)
+		}
+		config.logf("✅ Notehub stored the firmware with MD5 %s", identity.MD5)
+	case stored.Length != 0:
+		config.Warnf("Notehub reports no checksum for %s; only its length (%d bytes) was verified", filename, stored.Length)
+	default:
+		config.Warnf("Notehub reports neither a checksum nor a length for %s; the stored firmware could not be verified", filename)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// sha256("firmware") and md5("firmware")
+const (
+	testFirmwareSHA256 = "c3bf47ea1f4a4a605470313cacb3a44f4a461f68c6faeab07e737610cb5ac835"
+	testFirmwareMD5    = "74b5b5e9570efc5c0553bb327cd41940"
+)
+
+func TestParseExpectedSHA256(t *testing.T) {
+	got, err := ParseExpectedSHA256("  " + strings.ToUpper(testFirmwareSHA256) + "\n")
+	if err != nil || got != testFirmwareSHA256 {
+		t.Errorf("Expected normalized digest, got %q, %v", got, err)
+	}
+	if got, err := ParseExpectedSHA256(""); err != nil || got != "" {
+		t.Errorf("Expected empty input to be accepted, got %q, %v", got, err)
+	}
+	for _, bad := range []string{"abc123", strings.Repeat("z", 64)} {
+		if _, err := ParseExpectedSHA256(bad); err == nil {
+			t.Errorf("Expected error for %q", bad)
+		}
+	}
+}
+
+func TestVerifyStoredFirmware(t *testing.T) {
+	identity := &ArtifactIdentity{Size: 8, SHA256: testFirmwareSHA256, MD5: testFirmwareMD5}
+
+	tests := []struct {
+		name        string
+		listing     string
+		expectError string
+	}{
+		{"sha256 matches", fmt.Sprintf(`[{"filename":"app.bin","length":8,"sha256":%q}]`, strings.ToUpper(testFirmwareSHA256)), ""},
+		{"sha256 differs", `[{"filename":"app.bin","length":8,"sha256":"0000"}]`, "SHA-256 mismatch"},
+		{"md5 matches", fmt.Sprintf(`[{"filename":"app.bin","length":8,"md5":%q}]`, testFirmwareMD5), ""},
+		{"md5 differs", `[{"filename":"app.bin","length":8,"md5":"0000"}]`, "MD5 mismatch"},
+		{"length only", `[{"filename":"app.bin","length":8}]`, ""},
+		{"length differs", fmt.Sprintf(`[{"filename":"app.bin","length":7,"sha256":%q}]`, testFirmwareSHA256), "length mismatch"},
+		{"nothing reported", `[{"filename":"app.bin"}]`, ""},
+		{"not listed", `[{"filename":"other.bin","length":8}]`, "not listed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeNotehub(t, fakeRoutes{"GET /projects/app:123/firmware": respond(tt.listing)})
+
+			err := verifyStoredFirmware(context.Background(), newTestClient(server.URL), &DeploymentConfig{ProjectUID: "app:123"}, "app.bin", identity)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+const (
+	// DefaultWaitTimeout bounds how long wait_for_completion polls DFU status
+	DefaultWaitTimeout = 30 * time.Minute
+
+	// DefaultPollInterval is the delay between DFU status polls
+	DefaultPollInterval = 30 * time.Second
+)
+
+// errWaitTimedOut is returned by waitForDFUCompletion when devices are still updating at
+// its timeout
+var errWaitTimedOut = errors.New("timed out")
+
+// waitForDFUCompletion polls DFU status for the targeted devices until every device has
+// completed or errored, or the timeout expires. The latest states are returned in both
+// cases. Waits can outlast the OAuth token, which the client refreshes as needed. Each
+// poll is passed to tracker, which may be nil.
+func waitForDFUCompletion(ctx context.Context, client *notehub.Client, config *DeploymentConfig, timeout, interval time.Duration, tracker *rolloutTracker) ([]notehub.DeviceDFUState, error) {
+	config.logf("Waiting up to %s for devices to complete the update...", timeout)
+
+	deadline := time.Now().Add(timeout)
+	filters := buildTargetingParams(config)
+	lastStatus := map[string]string{}
+
+	for {
+		states, err := client.GetDFUStatus(ctx, config.ProjectUID, config.FirmwareType, filters)
+		if err != nil {
+			return nil, err
+		}
+		logDFUProgress(config, states, lastStatus)
+		tracker.observe(states)
+
+		pending := 0
+		for _, s := range states {
+			if !s.Terminal() {
+				pending++
+			}
+		}
+		if len(states) == 0 {
+			config.Warnf("DFU status returned no devices for the deployment's targeting; nothing to wait for")
+			return states, nil
+		}
+		if pending == 0 {
+			config.logf("✅ All %d device(s) reached a final DFU state", len(states))
+			return states, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			return states, fmt.Errorf("%w after %s with %d of %d device(s) still updating", errWaitTimedOut, timeout, pending, len(states))
+		}
+
+		config.logf("  - %d of %d device(s) still updating; checking again in %s", pending, len(states), interval)
+		select {
+		case <-ctx.Done():
+			return states, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// logDFUProgress logs each device whose DFU status changed since the previous poll
+func logDFUProgress(config *DeploymentConfig, states []notehub.DeviceDFUState, lastStatus map[string]string) {
+	for _, s := range states {
+		if lastStatus[s.DeviceUID] == s.Status {
+			continue
+		}
+		lastStatus[s.DeviceUID] = s.Status
+		if s.Description != "" {
+			config.logf("  - %s: %s (%s)", s.DeviceUID, s.Status, s.Description)
+		} else {
+			config.logf("  - %s: %s", s.DeviceUID, s.Status)
+		}
+	}
+}
+
+// deviceStatesMarkdown renders the per-device final DFU states as a Markdown table
+func deviceStatesMarkdown(states []notehub.DeviceDFUState) string {
+	var b strings.Builder
+	b.WriteString("### Device Firmware Update Status\n\n")
+	b.WriteString("| Device | Status | Description |\n")
+	b.WriteString("| ------ | ------ | ----------- |\n")
+	for _, s := range states {
+		fmt.Fprintf(&b, "| %s | %s | %s |\n", s.DeviceUID, s.Status, escapeTableCell(s.Description))
+	}
+	return b.String()
+}
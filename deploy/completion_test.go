@@ -0,0 +1,153 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// newDFUStatusServer serves DFU status responses in turn, repeating the last one
+func newDFUStatusServer(t *testing.T, responses ...string) *fakeNotehub {
+	t.Helper()
+	status := respondInTurn(responses...)
+	return newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/status": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("deviceUID") == "" {
+				t.Errorf("Expected targeting filters, got %s", r.URL.RawQuery)
+			}
+			status(w, r)
+		},
+	})
+}
+
+func TestWaitForDFUCompletion_PollsUntilTerminal(t *testing.T) {
+	server := newDFUStatusServer(t,
+		`{"devices":[{"device_uid":"dev:1","status":"downloading"},{"device_uid":"dev:2","status":"pending"}]}`,
+		`{"devices":[{"device_uid":"dev:1","status":"completed"},{"device_uid":"dev:2","status":"updating"}]}`,
+		`{"devices":[{"device_uid":"dev:2","status":"error","description":"image rejected"},{"device_uid":"dev:1","status":"completed"}]}`,
+	)
+
+	client := newTestClient(server.URL)
+
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1,dev:2"}
+	states, err := waitForDFUCompletion(context.Background(), client, config, 5*time.Second, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := server.count("GET /projects/app:123/dfu/host/status"); n != 3 {
+		t.Errorf("Expected 3 polls, got %d", n)
+	}
+	if len(states) != 2 || states[0].DeviceUID != "dev:1" || states[1].Status != notehub.DFUStateError {
+		t.Errorf("Unexpected final states %+v", states)
+	}
+	if failed := failedDevices(buildDeviceReport(states)); len(failed) != 1 || failed[0] != "dev:2" {
+		t.Errorf("Expected dev:2 to be reported as failed, got %v", failed)
+	}
+}
+
+func TestWaitForDFUCompletion_TimesOut(t *testing.T) {
+	server := newDFUStatusServer(t, `{"devices":[{"device_uid":"dev:1","status":"downloading"}]}`)
+
+	client := newTestClient(server.URL)
+
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1"}
+	states, err := waitForDFUCompletion(context.Background(), client, config, 50*time.Millisecond, 10*time.Millisecond, nil)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout error, got %v", err)
+	}
+	if len(states) != 1 || states[0].Status != "downloading" {
+		t.Errorf("Expected latest states to be returned on timeout, got %+v", states)
+	}
+}
+
+func TestWaitForDFUCompletion_RefreshesToken(t *testing.T) {
+	// Tokens expire inside the refresh margin, so every poll refreshes first
+	server := newDFUStatusServer(t,
+		`{"devices":[{"device_uid":"dev:1","status":"downloading"}]}`,
+		`{"devices":[{"device_uid":"dev:1","status":"completed"}]}`,
+	)
+	server.handle("/oauth2/token", respond(`{"access_token":"token","token_type":"bearer","expires_in":30}`))
+
+	client := notehub.New(notehub.WithBaseURL(server.URL), notehub.WithOAuthURL(server.URL+"/oauth2/token"))
+
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1"}
+	if _, err := waitForDFUCompletion(ctx, client, config, 5*time.Second, 10*time.Millisecond, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if n := server.count("POST /oauth2/token"); n != 3 {
+		t.Errorf("Expected the token to be refreshed before each poll, got %d token requests", n)
+	}
+}
+
+func TestDeviceStatesMarkdown(t *testing.T) {
+	md := deviceStatesMarkdown([]notehub.DeviceDFUState{
+		{DeviceUID: "dev:1", Status: notehub.DFUStateCompleted},
+		{DeviceUID: "dev:2", Status: notehub.DFUStateError, Description: "bad | image"},
+	})
+
+	for _, row := range []string{"| dev:1 | completed |  |", `| dev:2 | error | bad \| image |`} {
+		if !strings.Contains(md, row) {
+			t.Errorf("Expected row %q in:\n%s", row, md)
+		}
+	}
+}
+
+func TestWaitForDFUCompletion_LogsPerDeviceProgress(t *testing.T) {
+	server := newDFUStatusServer(t,
+		`{"devices":[{"device_uid":"dev:1","status":"downloading"},{"device_uid":"dev:2","status":"pending"}]}`,
+		`{"devices":[{"device_uid":"dev:1","status":"downloading"},{"device_uid":"dev:2","status":"updating"}]}`,
+		`{"devices":[{"device_uid":"dev:1","status":"completed"},{"device_uid":"dev:2","status":"completed"}]}`,
+	)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	client := newTestClient(server.URL)
+
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1,dev:2"}
+	if _, err := waitForDFUCompletion(context.Background(), client, config, 5*time.Second, 10*time.Millisecond, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	output := logs.String()
+	for _, line := range []string{"dev:1: downloading", "dev:2: pending", "dev:2: updating", "dev:1: completed", "dev:2: completed"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("Expected progress line %q in:\n%s", line, output)
+		}
+	}
+	if n := strings.Count(output, "dev:1: downloading"); n != 1 {
+		t.Errorf("Expected unchanged status to be logged once, got %d times", n)
+	}
+}
+
+func TestWaitForDFUCompletion_HonorsCancellation(t *testing.T) {
+	server := newDFUStatusServer(t, `{"devices":[{"device_uid":"dev:1","status":"downloading"}]}`)
+
+	client := newTestClient(server.URL)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1"}
+	if _, err := waitForDFUCompletion(ctx, client, config, time.Hour, 10*time.Second, nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected context cancellation, got %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Polling did not stop on context cancellation")
+	}
+}
@@ -0,0 +1,26 @@
+package deploy
+
+import "crypto/subtle"
+
+// withholdUnconfirmedDFU downgrades a deployment to upload-only when require_confirmation_token
+// is set and confirmation_token does not match it, recording why in the report. The firmware
+// is still uploaded, so an approved re-run only needs to trigger the DFU.
+func withholdUnconfirmedDFU(config *DeploymentConfig, report *DeploymentReport) *DeploymentConfig {
+	if !config.IssueDFU || config.RequireConfirmationToken == "" {
+		return config
+	}
+	if subtle.ConstantTimeCompare([]byte(config.ConfirmationToken), []byte(config.RequireConfirmationToken)) == 1 {
+		config.logf("✅ Confirmation token accepted; the DFU may be issued")
+		return config
+	}
+
+	report.DFUWithheld = "confirmation token does not match"
+	if config.ConfirmationToken == "" {
+		report.DFUWithheld = "confirmation token missing"
+	}
+	config.Warnf("DFU withheld: %s; the firmware is uploaded only", report.DFUWithheld)
+
+	uploadOnly := *config
+	uploadOnly.IssueDFU = false
+	return &uploadOnly
+}
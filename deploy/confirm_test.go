@@ -0,0 +1,55 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDeployFirmware_ConfirmationToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		required       string
+		token          string
+		expectDFU      bool
+		expectWithheld string
+	}{
+		{"not required", "", "", true, ""},
+		{"matching token", "s3cret", "s3cret", true, ""},
+		{"missing token", "s3cret", "", false, "confirmation token missing"},
+		{"wrong token", "s3cret", "s3cre", false, "confirmation token does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeNotehub(t, nil)
+			config := server.config(t)
+			config.RequireConfirmationToken = tt.required
+			config.ConfirmationToken = tt.token
+			l := useRecordingLogger(config)
+			report, err := DeployFirmware(context.Background(), config)
+			if err != nil {
+				t.Fatalf("Deployment failed: %v", err)
+			}
+
+			expectDFUs := 0
+			if tt.expectDFU {
+				expectDFUs = 1
+			}
+			uploads, dfus := len(server.uploaded()), server.count("POST /projects/app:123/dfu/host/update")
+			if uploads != 1 || dfus != expectDFUs {
+				t.Errorf("Expected 1 upload and %d DFU(s), got %d and %d", expectDFUs, uploads, dfus)
+			}
+			if report.DFUTriggered != tt.expectDFU || report.DFUWithheld != tt.expectWithheld {
+				t.Errorf("Expected triggered %v and withheld %q, got %v and %q", tt.expectDFU, tt.expectWithheld, report.DFUTriggered, report.DFUWithheld)
+			}
+			if tt.expectWithheld != "" {
+				if len(l.warnings) == 0 || !strings.Contains(l.warnings[0], tt.expectWithheld) {
+					t.Errorf("Expected a warning that the DFU was withheld, got %v", l.warnings)
+				}
+				if !strings.Contains(DeploymentSummaryMarkdown(report), "| DFU Issued | no, withheld: "+tt.expectWithheld+" |") {
+					t.Errorf("Expected the withheld DFU in the summary, got:\n%s", DeploymentSummaryMarkdown(report))
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1050 @@
+// Package deploy uploads firmware to Notehub and triggers outboard device firmware updates,
+// the deployment logic behind the GitHub Action. DeployFirmwareFiles runs a deployment
+// described by a DeploymentConfig and returns its DeploymentReport; progress is logged
+// through the config's Logger, and failures are returned as errors.
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// DeploymentConfig contains all the configuration for firmware deployment
+type DeploymentConfig struct {
+	ProjectUID       string
+	FirmwareFile     string
+	FirmwareDir      string
+	FirmwareType     string
+	Operation        string
+	Channel          string
+	PromoteFrom      string
+	ExpectedSHA256   string
+	IssueDFU         bool
+	ScheduleAt       time.Time
+	SkipIfExists     bool
+	ForceUpload      bool
+	DryRun           bool
+	ClientID         string
+	ClientSecret     string
+	DeviceUID        string
+	Tag              string
+	NoMatchBehavior  string
+	SerialNumber     string
+	FleetUID         string
+	FleetName        string
+	ProductUID       string
+	NotecardFirmware string
+	Location         string
+	SKU              string
+	DeviceQuery      url.Values
+	Hook             *HookConfig
+	Lock             *LockConfig
+
+	APIBaseURL     string
+	OAuthTokenURL  string
+	HTTPTimeout    time.Duration
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+
+	InsecureSkipVerify bool
+
+	// ExcludeTags and ExcludeDeviceUIDs remove devices from the resolved targets
+	ExcludeTags       []string
+	ExcludeDeviceUIDs []string
+
+	// AllowedExtensions and CheckMagic guard against uploading a file that is not firmware,
+	// unless SkipFormatCheck is set
+	AllowedExtensions []string
+	CheckMagic        bool
+	SkipFormatCheck   bool
+
+	// MaxClockSkew bounds the difference between the local and Notehub clocks; zero
+	// disables the check
+	MaxClockSkew time.Duration
+
+	// ConfigProvenance records where each input's value came from, for the report
+	ConfigProvenance map[string]string
+
+	WaitForStableFile bool
+	StableFileTimeout time.Duration
+
+	MinUploadThroughputBps int64
+
+	SKUSizeLimits      map[string]int64
+	OnSizeExceeded     string
+	UnknownSKUBehavior string
+
+	FreezeTargets    bool
+	ResumeFromReport string
+
+	WaitForCompletion bool
+	WaitTimeout       time.Duration
+	PollInterval      time.Duration
+	FailOnDeviceError bool
+
+	Baseline          *BaselineCurve
+	FailOnSlowRollout bool
+
+	ValidateBudget time.Duration
+
+	AutoCleanupOnQuota bool
+	RetainLast         int
+
+	AllowAllDevices bool
+	// CountTargets looks up how many devices the targeting matches before the DFU
+	CountTargets bool
+
+	Follow         bool
+	FollowTimeout  time.Duration
+	FollowInterval time.Duration
+
+	// RandomSeed seeds every randomized behavior of the run, through random
+	RandomSeed int64
+	rng        *rand.Rand
+
+	// retries is shared by the copies of the config made for each firmware file, so it
+	// accounts for the whole invocation
+	retries *retryLedger
+
+	// retentionProtect names the firmware uploaded earlier in a multi-file run, which
+	// retention keeps along with the file being deployed
+	retentionProtect []string
+
+	// session is the Notehub sign-in and deployment lock a multi-file run shares across the
+	// copies of the config it deploys its files with
+	session *deploymentSession
+
+	// Clock supplies the run's start time and DFU trigger timestamps; nil means time.Now
+	Clock func() time.Time
+
+	// VerifyArtifactChain makes ExpectedSHA256 mandatory and explains a mismatch in detail
+	VerifyArtifactChain bool
+
+	// UploadTimeout bounds a firmware upload in place of HTTPTimeout; OverallTimeout bounds
+	// the whole invocation. Zero means no separate limit.
+	UploadTimeout  time.Duration
+	OverallTimeout time.Duration
+
+	// MinUploadBytesPerSec, when set, scales the upload deadline with the firmware size in
+	// place of UploadTimeout
+	MinUploadBytesPerSec int64
+
+	// MaxDevices fails the deployment before the DFU when the targeting reaches more
+	// devices, counted through the devices API; zero means no limit
+	MaxDevices int
+
+	// TokenHandle redeems the access token a previous step handed off, in place of
+	// authenticating; ExportTokenHandle hands this run's token off in turn
+	TokenHandle       string
+	ExportTokenHandle bool
+
+	// CohortA and CohortB are the device queries selecting the two arms of the ab
+	// operation; ABMinCohortSize is the cohort size below which the comparison is flagged
+	// as inconclusive
+	CohortA         url.Values
+	CohortB         url.Values
+	ABMinCohortSize int
+
+	// RolloutPercentage, from 1 to 99, limits the DFU to that share of the targeted
+	// devices, picked by a stable hash of their UIDs; zero updates every device
+	RolloutPercentage int
+
+	// ReuseIdentical skips the upload when the project already has byte-identical firmware
+	// under any name, and deploys that file instead
+	ReuseIdentical bool
+
+	// HTTPClient, when set, sends every Notehub request in place of the client built from
+	// HTTPTimeout and InsecureSkipVerify, e.g. to point a test at an httptest.Server
+	HTTPClient *http.Client
+
+	// MaxDFUQueryLength bounds the encoded query string of each DFU request, splitting long
+	// device UID and serial number lists across requests; zero uses DefaultMaxDFUQueryLength
+	MaxDFUQueryLength int
+
+	// ExtraDFUParams are passed through to the DFU request as query parameters without
+	// validation by the action, for targeting it does not support yet
+	ExtraDFUParams url.Values
+
+	// MaxFirmwareSize, when positive, is the largest host firmware image uploaded, in bytes;
+	// the action defaults it to DefaultMaxFirmwareSize and Notecard firmware is not limited
+	MaxFirmwareSize int64
+
+	// RetainFirmwareCount, when positive, deletes the project's firmware of the type beyond
+	// the newest this many after a successful deployment; RetentionDryRun only lists it
+	RetainFirmwareCount int
+	RetentionDryRun     bool
+
+	// TagMatch is TagMatchAny, the default, to target devices carrying any of the tags, or
+	// TagMatchAll to target only those carrying all of them
+	TagMatch string
+
+	// RequireConfirmationToken, when set, withholds the DFU and only uploads unless
+	// ConfirmationToken matches it
+	RequireConfirmationToken string
+	ConfirmationToken        string
+
+	// FirmwareVersion is the deployed firmware's version, compared against the newest in
+	// the project before the DFU; empty uses the version Notehub reads from the file
+	FirmwareVersion string
+	AllowDowngrade  bool
+
+	// UploadProgressInterval, when positive, logs the upload's progress at most this often
+	UploadProgressInterval time.Duration
+
+	// ResolveTargets looks up SerialNumber and DeviceName, which requires it, and targets
+	// the UIDs of the devices found, failing for any that match no device or several
+	ResolveTargets bool
+	DeviceName     string
+
+	// CancelDFUOnAbort cancels the DFU issued by a run that is then cancelled or reaches
+	// its overall deadline
+	CancelDFUOnAbort bool
+
+	// CleanupOnFailure deletes the firmware uploaded by the run when the DFU trigger fails
+	CleanupOnFailure bool
+
+	// SkipUpload deploys FirmwareFile as the name of firmware already in the project,
+	// without uploading anything
+	SkipUpload bool
+
+	// UploadAs, when set, is the name the firmware is uploaded and deployed under instead
+	// of the local file's name
+	UploadAs string
+
+	// APIToken, when set, is a Notehub API session token sent with every request in place
+	// of the OAuth2 flow, which ClientID and ClientSecret are then not needed for
+	APIToken string
+
+	// CompressUpload gzips the firmware upload, sending it uncompressed when Notehub
+	// rejects the encoding or the image does not compress
+	CompressUpload bool
+
+	// TreatPendingAsFailure counts devices still pending or not yet retrieved when the
+	// wait for completion times out as failed
+	TreatPendingAsFailure bool
+
+	// MaxFailedDevices, when positive, fails the deployment only when more devices than
+	// this failed the update, instead of on any device error
+	MaxFailedDevices int
+
+	// MinCompletedPercent, when positive, fails the deployment when fewer than this
+	// percentage of the targeted devices completed the update
+	MinCompletedPercent float64
+
+	// MaxRateLimitWait, when positive, is how long one request waits out Notehub's rate
+	// limit before failing; 429s are then not counted as retries
+	MaxRateLimitWait time.Duration
+
+	// AllowConflictingTargets sends targeting inputs that conflict, such as device_uid with
+	// fleet_uid, as given instead of refusing the DFU
+	AllowConflictingTargets bool
+
+	// Workspace, when set, is the directory every firmware file must resolve to, symlinks
+	// followed; the action sets it to GITHUB_WORKSPACE
+	Workspace string
+
+	// Logger receives the deployment's progress messages and warnings; nil logs through the
+	// standard library's log
+	Logger Logger
+
+	// Strict fails each phase of the deployment that emitted a warning, once the phase ends
+	Strict bool
+	// warnings holds the warnings emitted since the last strict checkpoint, shared by the
+	// copies of the config like retries
+	warnings *strictWarnings
+}
+
+// now returns the current time from the run's clock
+func (c *DeploymentConfig) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock()
+}
+
+// random returns the run's random number generator, seeded from RandomSeed. Randomized
+// components must draw from it rather than the global math/rand functions, so a run can
+// be replayed from its seed. Copies of the config made after the first call share it.
+func (c *DeploymentConfig) random() *rand.Rand {
+	if c.rng == nil {
+		c.rng = notehub.NewRand(c.RandomSeed)
+	}
+	return c.rng
+}
+
+// retryLedger returns the invocation's retry ledger, creating it on first use
+func (c *DeploymentConfig) retryLedger() *retryLedger {
+	if c.retries == nil {
+		c.retries = newRetryLedger()
+	}
+	return c.retries
+}
+
+// Notehub endpoints used by new clients unless the config overrides them. These are
+// variables so end-to-end tests can point the action at a fake server.
+var (
+	DefaultAPIBaseURL    = notehub.DefaultBaseURL
+	DefaultOAuthTokenURL = notehub.DefaultOAuthURL
+)
+
+// newNotehubClient creates a Notehub client configured from the deployment config. Access
+// tokens it obtains are masked in the workflow log.
+func newNotehubClient(config *DeploymentConfig) *notehub.Client {
+	baseURL, tokenURL := DefaultAPIBaseURL, DefaultOAuthTokenURL
+	if config.APIBaseURL != "" {
+		baseURL = config.APIBaseURL
+	}
+	if config.OAuthTokenURL != "" {
+		tokenURL = config.OAuthTokenURL
+	}
+
+	httpClient := []notehub.Option{
+		notehub.WithTimeout(config.HTTPTimeout),
+		notehub.WithTransport(newHTTPTransport(config.InsecureSkipVerify)),
+	}
+	if config.HTTPClient != nil {
+		httpClient = []notehub.Option{notehub.WithHTTPClient(config.HTTPClient)}
+	}
+	if config.APIToken != "" {
+		httpClient = append(httpClient, notehub.WithSessionToken(config.APIToken))
+	}
+
+	return notehub.New(append(httpClient,
+		notehub.WithBaseURL(baseURL),
+		notehub.WithOAuthURL(tokenURL),
+		notehub.WithUploadTimeout(config.UploadTimeout),
+		notehub.WithMinUploadRate(config.MinUploadBytesPerSec),
+		notehub.WithUploadProgress(config.UploadProgressInterval),
+		notehub.WithCompressedUpload(config.CompressUpload),
+		notehub.WithRetries(config.MaxRetries, config.RetryBaseDelay),
+		notehub.WithMaxRateLimitWait(config.MaxRateLimitWait),
+		notehub.WithRand(config.random()),
+		notehub.WithMaxClockSkew(config.MaxClockSkew),
+		notehub.WithLogger(config.logger()),
+		notehub.WithTokenObserver(config.logger().Mask),
+		notehub.WithRequestObserver(config.retryLedger().record),
+	)...)
+}
+
+// addCommaSeparatedParams adds the values of a list separated by commas or newlines as
+// multiple query parameters, trimmed and without empty or repeated values, and returns
+// the values it added
+func addCommaSeparatedParams(queryParams url.Values, paramName, value string) []string {
+	var added []string
+	for _, v := range splitList(value) {
+		if slices.Contains(queryParams[paramName], v) {
+			continue
+		}
+		queryParams.Add(paramName, v)
+		added = append(added, v)
+	}
+	return added
+}
+
+// targetingFields are the list targeting inputs, with the DFU query parameter each one
+// sets and, for UIDs, the prefix every value should start with
+var targetingFields = []struct {
+	param, input, prefix string
+	value                func(*DeploymentConfig) string
+}{
+	{"deviceUID", "device_uid", "dev:", func(c *DeploymentConfig) string { return c.DeviceUID }},
+	{"tags", "tag", "", func(c *DeploymentConfig) string { return c.Tag }},
+	{"serialNumber", "serial_number", "", func(c *DeploymentConfig) string { return c.SerialNumber }},
+	{"fleetUID", "fleet_uid", "fleet:", func(c *DeploymentConfig) string { return c.FleetUID }},
+	{"productUID", "product_uid", "", func(c *DeploymentConfig) string { return c.ProductUID }},
+	{"notecardFirmware", "notecard_firmware", "", func(c *DeploymentConfig) string { return c.NotecardFirmware }},
+	{"location", "location", "", func(c *DeploymentConfig) string { return c.Location }},
+	{"sku", "sku", "", func(c *DeploymentConfig) string { return c.SKU }},
+}
+
+// warnEmptyTargeting warns about each targeting input that is set but has no values once
+// empty entries are dropped, such as ",,", since it then narrows nothing, and about each
+// UID that looks mistyped, such as a device UID without its dev: prefix
+func warnEmptyTargeting(config *DeploymentConfig) {
+	for _, f := range targetingFields {
+		value := f.value(config)
+		values := addCommaSeparatedParams(url.Values{}, f.param, value)
+		if value != "" && len(values) == 0 {
+			config.Warnf("%s is set to %q, which has no values, so it does not narrow the DFU", f.input, value)
+		}
+		if f.prefix == "" {
+			continue
+		}
+		for _, v := range values {
+			if reason := suspiciousTarget(f.prefix, v); reason != "" {
+				config.Warnf("%s value %q %s, so it may not match any device", f.input, v, reason)
+			}
+		}
+	}
+}
+
+// buildTargetingParams builds the device targeting query parameters from the deployment config
+func buildTargetingParams(config *DeploymentConfig) url.Values {
+	queryParams := url.Values{}
+
+	for _, f := range targetingFields {
+		addCommaSeparatedParams(queryParams, f.param, f.value(config))
+	}
+
+	// Merge in any raw device query filters
+	for k, values := range config.DeviceQuery {
+		for _, v := range values {
+			queryParams.Add(k, v)
+		}
+	}
+
+	return queryParams
+}
+
+// TargetingInputs are the inputs that narrow a DFU to a subset of the project's devices
+var TargetingInputs = []string{"device_uid", "tag", "serial_number", "device_name", "fleet_uid", "fleet_name", "product_uid", "sku", "location", "notecard_firmware", "device_query_json"}
+
+// checkProjectWideDFU refuses a DFU with no targeting, which would update every device in
+// the project, unless allow_all_devices is set
+func checkProjectWideDFU(config *DeploymentConfig) error {
+	if !config.IssueDFU || config.AllowAllDevices || config.ResumeFromReport != "" || config.FleetName != "" || config.DeviceName != "" || len(buildTargetingParams(config)) > 0 {
+		return nil
+	}
+	return fmt.Errorf("no device targeting is set, so the DFU would update every device in the project; set one of %s, or set allow_all_devices: true to deploy project-wide",
+		strings.Join(TargetingInputs, ", "))
+}
+
+// DeployFirmware orchestrates the entire firmware deployment process
+func DeployFirmware(ctx context.Context, config *DeploymentConfig) (report *DeploymentReport, err error) {
+	started := config.now()
+	report = newDeploymentReport(config)
+	report.retries = config.retryLedger()
+	config.strictWarnings()
+	defer func() { report.RetrySummary = report.retries.summary() }()
+	defer report.endPhase()
+	defer func() { err = explainTimeout(ctx, err, report, config) }()
+	defer func() {
+		// Before endPhase clears the phase the deployment stopped in
+		if err != nil {
+			report.recordErrorPhase()
+		}
+	}()
+	config.random()
+
+	if config.Operation == OperationValidate {
+		return validateDeployment(ctx, config, report)
+	}
+	if config.Operation == OperationCancel {
+		return cancelDeployment(ctx, config, report)
+	}
+
+	// Upload only when the DFU has not been confirmed
+	config = withholdUnconfirmedDFU(config, report)
+
+	// Fail before any upload when the DFU would reach the whole project unintentionally
+	warnEmptyTargeting(config)
+	if err := checkProjectWideDFU(config); err != nil {
+		return report, err
+	}
+	if err := checkConflictingTargets(config); err != nil {
+		return report, err
+	}
+
+	// Step 1: Authenticate with Notehub, unless this is one file of a multi-file run, which
+	// signed in once for all of its files
+	var client *notehub.Client
+	if config.session != nil {
+		client = config.session.client
+		report.joinSession(config.session.report)
+	} else {
+		client = newNotehubClient(config)
+		report.startPhase("authenticate")
+		if err := authenticate(ctx, client, config, report); err != nil {
+			return report, fmt.Errorf("authentication failed: %w", err)
+		}
+		report.endPhase()
+	}
+
+	// Expand tag globs so every later step sees concrete tags; tag_match all still
+	// requires a device to match each tag as given
+	requiredTags := SplitTags(config.Tag)
+	if config.Tag != "" {
+		report.startPhase("expand_tags")
+		tags, err := resolveTagGlobs(ctx, client, config)
+		if err != nil {
+			return report, fmt.Errorf("tag expansion failed: %w", err)
+		}
+		if tags != config.Tag {
+			expanded := *config
+			expanded.Tag = tags
+			config = &expanded
+		}
+	}
+
+	// Resolve a fleet name to the UID the DFU targets
+	config, err = applyFleetName(ctx, client, config, report)
+	if err != nil {
+		return report, err
+	}
+
+	// Resolve serial numbers and device names to the UIDs the DFU targets
+	config, err = applyResolveTargets(ctx, client, config, report)
+	if err != nil {
+		return report, err
+	}
+
+	if config.Operation == OperationPromote {
+		report.startPhase("promote")
+		return promoteFirmware(ctx, client, config, report)
+	}
+
+	// Step 2: Validate firmware file exists, or with skip_upload that the project has it
+	report.startPhase("validate_file")
+	var firmwareFile string
+	var identity *ArtifactIdentity
+	var existing *notehub.FirmwareInfo
+	if config.SkipUpload {
+		existing, err = findUploadedFirmware(ctx, client, config)
+		if err != nil {
+			return report, err
+		}
+		firmwareFile = existing.Filename
+		identity = &ArtifactIdentity{Size: existing.Length, SHA256: existing.SHA256}
+		report.FirmwareSize = existing.Length
+		config.logf("✅ %s is already in the project (%d bytes)", existing.Filename, existing.Length)
+	} else {
+		firmwareFile = resolveFirmwarePath(config.FirmwareDir, config.FirmwareFile)
+		if IsFirmwareURL(config.FirmwareFile) {
+			path, cleanup, err := fetchFirmware(ctx, config, config.FirmwareFile, config.HTTPTimeout)
+			if err != nil {
+				return report, err
+			}
+			defer cleanup()
+			firmwareFile = path
+		} else if err := checkWithinWorkspace(config.Workspace, firmwareFile); err != nil {
+			return report, err
+		}
+		fileInfo, err := os.Stat(firmwareFile)
+		if os.IsNotExist(err) {
+			return report, fmt.Errorf("firmware file not found: %s", firmwareFile)
+		}
+		if err := checkFileReadable(firmwareFile); err != nil {
+			return report, err
+		}
+		if !config.SkipFormatCheck {
+			if err := checkFirmwareFormat(firmwareFile, config.AllowedExtensions, config.CheckMagic); err != nil {
+				return report, err
+			}
+		}
+		report.FirmwareSize = fileInfo.Size()
+		if config.WaitForStableFile && !IsFirmwareURL(config.FirmwareFile) {
+			if err := waitForStableFile(ctx, config, firmwareFile, stableFileInterval, config.StableFileTimeout); err != nil {
+				return report, err
+			}
+		}
+
+		identity, err = fileArtifactIdentity(firmwareFile)
+		if err != nil {
+			return report, err
+		}
+		report.ArtifactIdentity = identity
+		if err := checkFirmwareSize(config, firmwareFile, identity.Size); err != nil {
+			return report, err
+		}
+	}
+	firmwareSHA256 := identity.SHA256
+	report.FirmwareSHA256 = firmwareSHA256
+	config.logf("Firmware SHA-256: %s", firmwareSHA256)
+	if config.ExpectedSHA256 != "" && firmwareSHA256 != config.ExpectedSHA256 {
+		if config.VerifyArtifactChain {
+			return report, artifactChainError(firmwareFile, config.ExpectedSHA256, firmwareSHA256, started)
+		}
+		return report, fmt.Errorf("firmware SHA-256 mismatch: expected %s, file has %s", config.ExpectedSHA256, firmwareSHA256)
+	}
+	if config.VerifyArtifactChain {
+		config.logf("✅ Firmware matches the SHA-256 recorded by the build")
+	}
+
+	config.logf("✅ Input validation passed")
+	report.endPhase()
+
+	// Resolve targeting to concrete devices when a feature needs the device list
+	dfuConfig := config
+	var targets []notehub.Device
+	counted, exactTargets := false, false
+	if config.ResumeFromReport != "" {
+		report.startPhase("resolve_targets")
+		frozen, err := loadFrozenTargets(config.ResumeFromReport)
+		if err != nil {
+			return report, err
+		}
+		config.logf("Reusing %d frozen target device(s) from %s", len(frozen.DeviceUIDs), config.ResumeFromReport)
+
+		if frozen.FirmwareSHA256 != "" && firmwareSHA256 != frozen.FirmwareSHA256 {
+			config.Warnf("Firmware checksum %s differs from the frozen checksum %s", firmwareSHA256, frozen.FirmwareSHA256)
+		}
+
+		report.FrozenTargets = frozen
+		report.TargetDrift = checkTargetDrift(ctx, client, config, frozen)
+		report.ResolvedDevices = len(frozen.DeviceUIDs)
+		targets, counted, exactTargets = frozenDevices(frozen), true, true
+		dfuConfig = explicitTargetConfig(config, targets)
+	} else if len(config.DeviceQuery) > 0 || len(config.SKUSizeLimits) > 0 || config.FreezeTargets || hasExclusions(config) || ((config.RolloutPercentage > 0 || matchAllTags(config)) && config.IssueDFU) {
+		report.startPhase("resolve_targets")
+		if len(config.DeviceQuery) > 0 {
+			config.logf("Resolving device query: %s", config.DeviceQuery.Encode())
+		}
+		devices, err := client.ListDevices(ctx, config.ProjectUID, buildTargetingParams(config))
+		if err != nil {
+			return report, fmt.Errorf("device resolution failed: %w", err)
+		}
+		if matchAllTags(config) {
+			devices = devicesWithAllTags(devices, requiredTags)
+			if len(devices) == 0 {
+				return report, fmt.Errorf("tag_match all: no device carries all of the tags %s", strings.Join(requiredTags, ", "))
+			}
+			config.logf("Targeting the %d device(s) carrying all of the tags %s by device UID", len(devices), strings.Join(requiredTags, ", "))
+			dfuConfig = explicitTargetConfig(config, devices)
+		}
+		report.ResolvedDevices = len(devices)
+		config.logf("✅ Targeting matched %d device(s)", len(devices))
+
+		if hasExclusions(config) {
+			kept, excluded := excludeDevices(devices, config.ExcludeTags, config.ExcludeDeviceUIDs)
+			report.ExcludedDevices = append(report.ExcludedDevices, excluded...)
+			config.logf("Excluded %d device(s) by exclude_tags and exclude_device_uid", len(excluded))
+			devices = kept
+		}
+
+		if len(config.SKUSizeLimits) > 0 {
+			verdicts, kept, excluded, err := evaluateSKULimits(devices, report.FirmwareSize, config.SKUSizeLimits, config.OnSizeExceeded, config.UnknownSKUBehavior)
+			report.SKUVerdicts = verdicts
+			report.ExcludedDevices = append(report.ExcludedDevices, excluded...)
+			logSKUVerdicts(config, verdicts, report.FirmwareSize)
+			if err != nil {
+				return report, err
+			}
+			devices = kept
+		}
+
+		if len(report.ExcludedDevices) > 0 {
+			if len(devices) == 0 {
+				return report, fmt.Errorf("no target devices remain after excluding %d device(s)", len(report.ExcludedDevices))
+			}
+			config.logf("Targeting %d device(s) explicitly after excluding %d", len(devices), len(report.ExcludedDevices))
+			dfuConfig = explicitTargetConfig(config, devices)
+		}
+
+		if config.FreezeTargets {
+			if len(devices) == 0 {
+				return report, fmt.Errorf("freeze_targets: targeting matched no devices")
+			}
+			report.FrozenTargets = freezeTargets(devices, firmwareSHA256)
+			config.logf("Froze %d target device(s) for re-runs", len(devices))
+
+			// Deploy to exactly the frozen set so a resumed run matches this one
+			dfuConfig = explicitTargetConfig(config, devices)
+		}
+		targets, counted, exactTargets = devices, true, dfuConfig != config
+	} else if (config.CountTargets || config.MaxDevices > 0) && config.IssueDFU {
+		report.startPhase("resolve_targets")
+		devices, err := client.ListDevices(ctx, config.ProjectUID, buildTargetingParams(config))
+		if err != nil {
+			return report, fmt.Errorf("counting targeted devices failed: %w", err)
+		}
+		report.ResolvedDevices = len(devices)
+		if len(devices) == 0 {
+			config.Warnf("Targeting matches no devices, so the DFU will not update anything")
+		} else {
+			config.logf("✅ Targeting matches %d device(s)", len(devices))
+		}
+		targets, counted = devices, true
+	}
+	if config.RolloutPercentage > 0 && config.IssueDFU {
+		canary, canaryConfig, err := applyCanary(dfuConfig, report, targets)
+		if err != nil {
+			return report, err
+		}
+		targets, exactTargets, dfuConfig = canary, true, canaryConfig
+	}
+	if counted && config.IssueDFU {
+		if err := previewTargets(config, report, targets, exactTargets); err != nil {
+			return report, err
+		}
+	}
+
+	report.endPhase()
+	report.TargetingParams = buildTargetingParams(dfuConfig).Encode()
+	if len(config.ExtraDFUParams) > 0 {
+		report.ExtraDFUParams = config.ExtraDFUParams.Encode()
+		config.logf("⚠️ Passing unvalidated extra_dfu_params to the DFU request as is: %s", report.ExtraDFUParams)
+	}
+
+	if config.DryRun {
+		if err := logDryRunPlan(client, config, dfuConfig, firmwareFile, report.FirmwareSize, firmwareSHA256); err != nil {
+			return report, err
+		}
+		logDeploymentSummary(config, report)
+		report.Status = StatusSuccess
+		return report, nil
+	}
+
+	// Serialize deployments to this project across workflow runs
+	release, err := acquireLockIfEnabled(ctx, client, config, report)
+	if err != nil {
+		return report, err
+	}
+	defer release()
+	report.endPhase()
+
+	if err := config.StrictCheckpoint("validation"); err != nil {
+		return report, err
+	}
+
+	if err := runHook(ctx, config, HookPhasePreUpload, report); err != nil {
+		return report, fmt.Errorf("hook blocked deployment: %w", err)
+	}
+
+	// Step 3: Upload firmware to Notehub, unless an identical file is already there
+	uploadName := uploadFilename(config, firmwareFile)
+	skipIfExists := config.SkipIfExists && !config.ForceUpload && !config.SkipUpload
+	reuseIdentical := config.ReuseIdentical && !config.ForceUpload && !config.SkipUpload
+	if (config.SkipIfExists || config.ReuseIdentical) && config.ForceUpload {
+		config.logf("force_upload is set; uploading without checking Notehub for identical firmware")
+	}
+	if reuseIdentical {
+		report.startPhase("check_existing")
+		config.logf("Checking Notehub for firmware identical to %s under any name...", uploadName)
+		existing, err = findIdenticalFirmware(ctx, client, config, uploadName, identity)
+		if err != nil {
+			return report, err
+		}
+		report.endPhase()
+	} else if skipIfExists {
+		report.startPhase("check_existing")
+		config.logf("Checking Notehub for an identical %s...", uploadName)
+		existing, err = findExistingFirmware(ctx, client, config, uploadName, identity)
+		if err != nil {
+			return report, err
+		}
+		report.endPhase()
+	}
+
+	if existing != nil {
+		report.UploadSkipped = true
+		report.UploadedFilename = existing.Filename
+		identity.NotehubSHA256 = existing.SHA256
+		if config.SkipUpload {
+			config.logf("✅ Upload skipped (skip_upload): deploying %s as already uploaded", existing.Filename)
+		} else if existing.Filename != uploadName {
+			report.ReusedFirmware = &ReusedFirmware{Filename: uploadName, ReusedFilename: existing.Filename}
+			config.logf("✅ Upload skipped: reusing %s, which has the same content as %s", existing.Filename, uploadName)
+		} else {
+			config.logf("✅ Upload skipped: %s already exists on Notehub with the same size and checksum", existing.Filename)
+		}
+	} else {
+		if skipIfExists || reuseIdentical {
+			config.logf("No identical firmware found on Notehub; uploading")
+		}
+
+		report.startPhase("upload")
+		uploadStart := time.Now()
+		uploadResp, err := uploadWithQuotaCleanup(ctx, client, config, report, firmwareFile, uploadName)
+		if err != nil {
+			return report, fmt.Errorf("firmware upload failed: %w", err)
+		}
+		report.UploadedFilename = uploadResp.Filename
+		identity.recordNotehubDigests(uploadResp)
+		recordUploadThroughput(config, report, report.FirmwareSize, time.Since(uploadStart))
+		report.endPhase()
+
+		report.startPhase("verify_upload")
+		if err := verifyStoredFirmware(ctx, client, config, report.UploadedFilename, identity); err != nil {
+			return report, err
+		}
+		report.endPhase()
+
+		config.logf("✅ Firmware uploaded to Notehub")
+	}
+
+	// Step 4: Trigger Device Firmware Update, unless it would downgrade the firmware
+	if config.IssueDFU {
+		report.startPhase("version_check")
+		if err := checkDowngrade(ctx, client, config, report, report.UploadedFilename); err != nil {
+			return report, err
+		}
+		report.endPhase()
+	}
+	if err := config.StrictCheckpoint("upload"); err != nil {
+		return report, err
+	}
+	defer cancelDFUOnAbort(ctx, client, config, dfuConfig, report)
+	if err := runDFUPhase(ctx, client, config, dfuConfig, report, report.UploadedFilename); err != nil {
+		return report, rollBackFailedUpload(ctx, client, config, report, err)
+	}
+
+	// Step 5: Delete old firmware beyond retain_firmware_count
+	if config.RetainFirmwareCount > 0 {
+		report.startPhase("retention")
+		applyRetention(ctx, client, config, report)
+		report.endPhase()
+	}
+
+	// Step 6: Deployment Summary
+	logDeploymentSummary(config, report)
+
+	report.Status = StatusSuccess
+	if err := runHook(ctx, config, HookPhasePostCompletion, report); err != nil {
+		return report, fmt.Errorf("hook blocked deployment: %w", err)
+	}
+
+	return report, nil
+}
+
+// acquireLockIfEnabled takes the project deployment lock when configured, recording any
+// contention in the report. The returned release function is always safe to defer.
+func acquireLockIfEnabled(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport) (func(), error) {
+	// A multi-file run holds the lock around all of its files
+	if config.Lock == nil || !config.Lock.Enabled || config.session != nil {
+		return func() {}, nil
+	}
+
+	report.startPhase("lock")
+	lock, err := acquireDeploymentLock(ctx, client, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire deployment lock: %w", err)
+	}
+	report.RolloutID = lock.record.RolloutID
+	report.LockWaitMs = lock.waited.Milliseconds()
+	report.LockContenders = lock.contenders
+
+	// Release even when the deployment fails or the context is cancelled
+	return func() {
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 30*time.Second)
+		defer cancel()
+		if err := lock.Release(releaseCtx); err != nil {
+			config.Warnf("%v", err)
+		}
+	}, nil
+}
+
+// issueDFU triggers the DFU of filename for dfuConfig's targeting, recording Notehub's
+// response in the report, or schedules it when schedule_at is set
+func issueDFU(ctx context.Context, client *notehub.Client, config, dfuConfig *DeploymentConfig, report *DeploymentReport, filename string) error {
+	if config.ScheduleAt.IsZero() {
+		resp, err := client.TriggerDFU(ctx, dfuConfig.ProjectUID, dfuConfig.FirmwareType, dfuParams(dfuConfig), filename)
+		if err != nil {
+			return fmt.Errorf("DFU trigger failed: %w", err)
+		}
+		report.recordDFUResponse(resp)
+		return nil
+	}
+
+	err := client.ScheduleDFU(ctx, dfuConfig.ProjectUID, dfuConfig.FirmwareType, dfuParams(dfuConfig), filename, config.ScheduleAt)
+	if errors.Is(err, notehub.ErrDFUSchedulingUnsupported) {
+		return fmt.Errorf("schedule_at: %w by this Notehub, so no DFU was triggered; run the deployment at the desired time instead, e.g. from a workflow with an on.schedule trigger", err)
+	}
+	if err != nil {
+		return fmt.Errorf("DFU scheduling failed: %w", err)
+	}
+	return nil
+}
+
+// runDFUPhase triggers the device firmware update for filename and, when configured, waits
+// for the targeted devices to finish, running the pre_dfu and post_dfu hooks around it
+func runDFUPhase(ctx context.Context, client *notehub.Client, config, dfuConfig *DeploymentConfig, report *DeploymentReport, filename string) error {
+	if config.IssueDFU {
+		if err := runHook(ctx, config, HookPhasePreDFU, report); err != nil {
+			return fmt.Errorf("hook blocked deployment: %w", err)
+		}
+
+		report.startPhase("trigger_dfu")
+		batches := dfuTargetBatches(dfuConfig)
+		if len(batches) > 1 {
+			config.logf("Issuing the DFU in %d batches to keep each request within %d devices and a %d-character query", len(batches), maxDFUDeviceUIDs, dfuConfig.maxDFUQueryLength())
+		}
+		targeted := 0
+		for i, batch := range batches {
+			scope := "dfu"
+			if len(batches) > 1 {
+				scope = fmt.Sprintf("batch %d/%d", i+1, len(batches))
+			}
+			trigger := newTriggerTime(config, report, batch, scope)
+			config.retryLedger().setBatch(scope, SplitTags(batch.DeviceUID))
+			err := issueDFU(ctx, client, config, batch, report, filename)
+			config.retryLedger().setBatch("", nil)
+			if err != nil {
+				if i > 0 {
+					msg := fmt.Sprintf("DFU batch %d of %d failed after %s succeeded for %d device(s)", i+1, len(batches), batchRange(1, i), targeted)
+					if i+1 < len(batches) {
+						msg += fmt.Sprintf(", with %s not sent", batchRange(i+2, len(batches)))
+					}
+					return fmt.Errorf("%s: %w", msg, err)
+				}
+				return err
+			}
+			report.TriggerTimes = append(report.TriggerTimes, trigger)
+			targeted += batchDeviceCount(batch)
+		}
+		if !config.ScheduleAt.IsZero() {
+			report.ScheduledAt = config.ScheduleAt.Format(time.RFC3339)
+		}
+		report.endPhase()
+		report.DFUTriggered = true
+
+		if report.ScheduledAt != "" {
+			config.logf("✅ Device firmware update scheduled for %s", report.ScheduledAt)
+		} else {
+			config.logf("✅ Device firmware update triggered")
+		}
+
+		if config.Follow {
+			report.startPhase("follow")
+			state, stages, err := followDeviceDFU(ctx, client, dfuConfig, config.FollowTimeout, config.FollowInterval)
+			report.FollowStages = stages
+			if state != nil {
+				report.DeviceStates = []notehub.DeviceDFUState{*state}
+			}
+			if err != nil {
+				return fmt.Errorf("following the DFU failed: %w", err)
+			}
+			if state.Status == notehub.DFUStateError {
+				if config.FailOnDeviceError {
+					return fmt.Errorf("DFU failed on %s: %s", state.DeviceUID, dfuStateLabel(*state))
+				}
+				config.Warnf("DFU failed on %s: %s", state.DeviceUID, dfuStateLabel(*state))
+			}
+			report.endPhase()
+		}
+
+		if config.WaitForCompletion {
+			report.startPhase("wait_for_completion")
+			tracker := newRolloutTracker(config, config.Baseline)
+			states, err := waitForDFUCompletion(ctx, client, dfuConfig, config.WaitTimeout, config.PollInterval, tracker)
+			report.DeviceStates = states
+			report.DeviceReport = buildDeviceReport(states)
+			report.ProgressSamples = tracker.samples
+			report.BaselineAnomalies = tracker.anomalies
+			if err != nil && !errors.Is(err, errWaitTimedOut) {
+				return fmt.Errorf("waiting for DFU completion failed: %w", err)
+			}
+			if len(tracker.anomalies) > 0 && config.FailOnSlowRollout {
+				return fmt.Errorf("rollout fell behind the %dth percentile baseline at %d milestone(s)", config.Baseline.Percentile, len(tracker.anomalies))
+			}
+			if err := checkDeviceReport(config, report.DeviceReport, err); err != nil {
+				return err
+			}
+			report.endPhase()
+		}
+
+		if err := runHook(ctx, config, HookPhasePostDFU, report); err != nil {
+			return fmt.Errorf("hook blocked deployment: %w", err)
+		}
+	} else {
+		config.logf("Skipping device firmware update (issue_dfu is false)")
+	}
+
+	return nil
+}
+
+// logDeploymentSummary prints a comprehensive deployment summary
+func logDeploymentSummary(config *DeploymentConfig, report *DeploymentReport) {
+	if config.DryRun {
+		config.logf("=== Deployment Summary (DRY RUN) ===")
+	} else {
+		config.logf("=== Deployment Summary ===")
+	}
+	config.logf("Project UID: %s", config.ProjectUID)
+	config.logf("Firmware File: %s", DisplayFirmwareFile(config.FirmwareFile))
+	config.logf("Firmware Type: %s", notehub.FirmwareTypeOrDefault(config.FirmwareType))
+	if config.Channel != "" {
+		config.logf("Channel: %s", config.Channel)
+	}
+	config.logf("Uploaded Filename: %s", report.UploadedFilename)
+	if p := report.Promotion; p != nil {
+		config.logf("Promotion: %s -> %s via %s (SHA-256 %s)", p.From, p.To, p.Strategy, p.SHA256)
+	}
+	var timings []string
+	for _, step := range stepTimings {
+		if d, ok := report.phaseDuration(step.phase); ok {
+			timings = append(timings, fmt.Sprintf("%s %s", strings.TrimSuffix(step.output, "_ms"), d))
+		}
+	}
+	if len(timings) > 0 {
+		config.logf("Step Timings: %s", strings.Join(timings, ", "))
+	}
+	if report.UploadThroughputBps > 0 {
+		config.logf("Upload: %d bytes in %s (%s)", report.FirmwareSize,
+			(time.Duration(report.UploadDurationMs) * time.Millisecond).String(), formatThroughput(report.UploadThroughputBps))
+	}
+
+	// Log targeting parameters if specified
+	if config.DeviceUID != "" {
+		config.logf("Target Device UID: %s", formatTargetList(config.DeviceUID))
+	}
+	if config.Tag != "" {
+		config.logf("Target Tag: %s", formatTargetList(config.Tag))
+	}
+	if config.SerialNumber != "" {
+		config.logf("Target Serial: %s", formatTargetList(config.SerialNumber))
+	}
+	if config.FleetName != "" {
+		config.logf("Fleet Name: %s", config.FleetName)
+	}
+	if config.FleetUID != "" {
+		config.logf("Fleet UID: %s", formatTargetList(config.FleetUID))
+	}
+	if config.ProductUID != "" {
+		config.logf("Product UID: %s", config.ProductUID)
+	}
+	if config.NotecardFirmware != "" {
+		config.logf("Notecard Firmware: %s", config.NotecardFirmware)
+	}
+	if config.Location != "" {
+		config.logf("Location: %s", config.Location)
+	}
+	if config.SKU != "" {
+		config.logf("SKU: %s", config.SKU)
+	}
+	if len(config.DeviceQuery) > 0 {
+		config.logf("Device Query: %s", config.DeviceQuery.Encode())
+	}
+	if len(config.ExcludeTags) > 0 {
+		config.logf("Exclude Tags: %s", strings.Join(config.ExcludeTags, ","))
+	}
+	if len(config.ExcludeDeviceUIDs) > 0 {
+		config.logf("Exclude Device UIDs: %s", strings.Join(config.ExcludeDeviceUIDs, ","))
+	}
+	if len(report.LockContenders) > 0 {
+		config.logf("Lock Contention: waited %s for %s", (time.Duration(report.LockWaitMs) * time.Millisecond).Round(time.Second),
+			strings.Join(report.LockContenders, ", "))
+	}
+	if report.ResolvedDevices > 0 {
+		config.logf("Resolved Devices: %d", report.ResolvedDevices)
+	}
+	for _, v := range report.SKUVerdicts {
+		config.logf("SKU %s: %s (%d device(s))", skuLabel(v.SKU), v.Verdict, v.Devices)
+	}
+	logExcludedDevices(config, report.ExcludedDevices)
+	config.logf("DFU Triggered: %t", report.DFUTriggered)
+	for _, s := range report.DeviceStates {
+		config.logf("  - %s: %s", s.DeviceUID, s.Status)
+	}
+	if report.FrozenTargets != nil {
+		config.logf("Frozen Targets: %d device(s), firmware SHA-256 %s", len(report.FrozenTargets.DeviceUIDs), report.FrozenTargets.FirmwareSHA256)
+	}
+	if report.TargetDrift != nil && report.TargetDrift.HasDrift() {
+		config.logf("Target Drift: %d added, %d removed", len(report.TargetDrift.Added), len(report.TargetDrift.Removed))
+	}
+
+	if config.DryRun {
+		config.logf("Deployment Status: DRY RUN (no firmware uploaded, no DFU triggered)")
+	} else {
+		config.logf("Deployment Status: SUCCESS")
+	}
+}
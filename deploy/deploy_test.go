@@ -0,0 +1,873 @@
+package deploy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// fakeRoutes maps an endpoint of the fake Notehub to its handler. A key is "METHOD /path",
+// or "/path" for any method, and a path ending in "*" matches every path that starts with
+// the rest. The most specific key wins: an exact path before a prefix, the longer prefix
+// first, and a key with a method before one without.
+type fakeRoutes map[string]http.HandlerFunc
+
+// fakeNotehub is the Notehub API the deployment tests run against. Unless a test replaces
+// them, it answers the endpoints a deployment to project app:123 uses: the OAuth2 token;
+// the firmware upload, listing, download and deletion, against the files stored so far;
+// and the host DFU update, status and cancel requests, with no device reporting a state.
+// Anything else is a 404. Every request is recorded.
+type fakeNotehub struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	routes    fakeRoutes
+	received  []fakeRequest
+	files     []fakeFirmware
+	created   int64
+	changeLog []string
+}
+
+// fakeRequest is a request received by the fake Notehub, as "METHOD /path?query", with
+// its headers, and its body unless it is an upload
+type fakeRequest struct {
+	request string
+	header  http.Header
+	body    string
+}
+
+// fakeFirmware is a host firmware file stored in the fake Notehub, created at a time that
+// grows with each file stored
+type fakeFirmware struct {
+	name    string
+	data    []byte
+	created int64
+}
+
+// newFakeNotehub starts a fake Notehub with routes added to, or replacing, the default
+// endpoints, closed when the test ends
+func newFakeNotehub(t *testing.T, routes fakeRoutes) *fakeNotehub {
+	t.Helper()
+	f := &fakeNotehub{}
+	f.routes = fakeRoutes{
+		"/oauth2/token":                       respond(`{"access_token":"token","expires_in":3600}`),
+		"PUT /projects/app:123/firmware/*":    f.upload,
+		"GET /projects/app:123/firmware":      f.listFirmware,
+		"GET /projects/app:123/firmware/*":    f.downloadFirmware,
+		"DELETE /projects/app:123/firmware/*": f.deleteFirmware,
+		"/projects/app:123/dfu/host/update":   respond(`{}`),
+		"/projects/app:123/dfu/host/status":   respond(`{"devices":[]}`),
+		"/projects/app:123/dfu/host/cancel":   respond(`{}`),
+	}
+	for key, handler := range routes {
+		f.routes[key] = handler
+	}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+// handle adds or replaces the route for key
+func (f *fakeNotehub) handle(key string, handler http.HandlerFunc) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.routes[key] = handler
+}
+
+// addFirmware stores a firmware file as if an earlier deployment had uploaded it,
+// replacing any file of the same name
+func (f *fakeNotehub) addFirmware(name string, data []byte) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.created += 100
+	for i := range f.files {
+		if f.files[i].name == name {
+			f.files[i].data, f.files[i].created = data, f.created
+			return
+		}
+	}
+	f.files = append(f.files, fakeFirmware{name: name, data: data, created: f.created})
+}
+
+// firmware returns the contents of a stored firmware file
+func (f *fakeNotehub) firmware(name string) ([]byte, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, file := range f.files {
+		if file.name == name {
+			return file.data, true
+		}
+	}
+	return nil, false
+}
+
+// upload stores an uploaded firmware file, decompressing a gzipped upload, and answers
+// with its filename
+func (f *fakeNotehub) upload(w http.ResponseWriter, r *http.Request) {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body = gz
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := path.Base(r.URL.Path)
+	f.addFirmware(name, data)
+	f.mu.Lock()
+	f.changeLog = append(f.changeLog, "upload "+name)
+	f.mu.Unlock()
+	fmt.Fprintf(w, `{"filename":%q}`, name)
+}
+
+// listFirmware lists the stored files, or the one named by the filename parameter
+func (f *fakeNotehub) listFirmware(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	files := []notehub.FirmwareInfo{}
+	for _, file := range f.files {
+		if name := r.URL.Query().Get("filename"); name != "" && name != file.name {
+			continue
+		}
+		sha := sha256.Sum256(file.data)
+		sum := md5.Sum(file.data)
+		files = append(files, notehub.FirmwareInfo{Filename: file.name, Length: int64(len(file.data)),
+			SHA256: hex.EncodeToString(sha[:]), MD5: hex.EncodeToString(sum[:]), Created: file.created})
+	}
+	json.NewEncoder(w).Encode(files)
+}
+
+// downloadFirmware serves the contents of a stored file
+func (f *fakeNotehub) downloadFirmware(w http.ResponseWriter, r *http.Request) {
+	data, ok := f.firmware(path.Base(r.URL.Path))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write(data)
+}
+
+// deleteFirmware deletes a stored file
+func (f *fakeNotehub) deleteFirmware(w http.ResponseWriter, r *http.Request) {
+	name := path.Base(r.URL.Path)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i, file := range f.files {
+		if file.name == name {
+			f.files = slices.Delete(f.files, i, i+1)
+			f.changeLog = append(f.changeLog, "delete "+name)
+			fmt.Fprint(w, `{}`)
+			return
+		}
+	}
+	http.NotFound(w, r)
+}
+
+// changes returns the uploads and deletions so far, in order, as "upload name" and
+// "delete name"
+func (f *fakeNotehub) changes() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return slices.Clone(f.changeLog)
+}
+
+// uploaded returns the names of the files uploaded so far, in order, repeats included
+func (f *fakeNotehub) uploaded() []string {
+	var names []string
+	for _, change := range f.changes() {
+		if name, ok := strings.CutPrefix(change, "upload "); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// deleted returns the names of the files deleted so far, in order
+func (f *fakeNotehub) deleted() []string {
+	var names []string
+	for _, change := range f.changes() {
+		if name, ok := strings.CutPrefix(change, "delete "); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// serve records the request and passes it to the most specific matching route
+func (f *fakeNotehub) serve(w http.ResponseWriter, r *http.Request) {
+	received := fakeRequest{request: r.Method + " " + r.URL.RequestURI(), header: r.Header.Clone()}
+	if r.Method != "PUT" {
+		body, _ := io.ReadAll(r.Body)
+		received.body = string(body)
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	f.mu.Lock()
+	f.received = append(f.received, received)
+	var handler http.HandlerFunc
+	best := -1
+	for key, h := range f.routes {
+		method, pattern, hasMethod := strings.Cut(key, " ")
+		if !hasMethod {
+			method, pattern = "", key
+		}
+		if method != "" && method != r.Method {
+			continue
+		}
+		score := len(pattern) * 4
+		if prefix, isPrefix := strings.CutSuffix(pattern, "*"); isPrefix {
+			if !strings.HasPrefix(r.URL.Path, prefix) {
+				continue
+			}
+		} else if pattern != r.URL.Path {
+			continue
+		} else {
+			score += 2
+		}
+		if method != "" {
+			score++
+		}
+		if score > best {
+			handler, best = h, score
+		}
+	}
+	f.mu.Unlock()
+
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	handler(w, r)
+}
+
+// requests returns the requests received so far as "METHOD /path?query", in order. The
+// OAuth2 token request is left out unless withToken is set.
+func (f *fakeNotehub) requests(withToken ...bool) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var requests []string
+	for _, r := range f.received {
+		if strings.Contains(r.request, " /oauth2/token") && (len(withToken) == 0 || !withToken[0]) {
+			continue
+		}
+		requests = append(requests, r.request)
+	}
+	return requests
+}
+
+// bodies returns the body of each request received so far that starts with prefix, in
+// order
+func (f *fakeNotehub) bodies(prefix string) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var bodies []string
+	for _, r := range f.received {
+		if strings.HasPrefix(r.request, prefix) {
+			bodies = append(bodies, r.body)
+		}
+	}
+	return bodies
+}
+
+// unauthorized returns the requests received so far, other than for the OAuth2 token,
+// whose headers authorized rejects
+func (f *fakeNotehub) unauthorized(authorized func(http.Header) bool) []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var requests []string
+	for _, r := range f.received {
+		if !strings.Contains(r.request, " /oauth2/token") && !authorized(r.header) {
+			requests = append(requests, r.request)
+		}
+	}
+	return requests
+}
+
+// count returns how many of the requests received so far start with prefix, such as
+// "POST /projects/app:123/dfu/host/update" or "POST /oauth2/token"
+func (f *fakeNotehub) count(prefix string) int {
+	n := 0
+	for _, r := range f.requests(true) {
+		if strings.HasPrefix(r, prefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// queries returns the query parameters of each request received so far that starts with
+// prefix, in order
+func (f *fakeNotehub) queries(prefix string) []url.Values {
+	var queries []url.Values
+	for _, r := range f.requests() {
+		if !strings.HasPrefix(r, prefix) {
+			continue
+		}
+		query := ""
+		if _, after, ok := strings.Cut(r, "?"); ok {
+			query = after
+		}
+		values, _ := url.ParseQuery(query)
+		queries = append(queries, values)
+	}
+	return queries
+}
+
+// lastQuery returns the raw query of the last request received that starts with prefix,
+// or "" when there was none
+func (f *fakeNotehub) lastQuery(prefix string) string {
+	query := ""
+	for _, r := range f.requests() {
+		if strings.HasPrefix(r, prefix) {
+			_, query, _ = strings.Cut(r, "?")
+		}
+	}
+	return query
+}
+
+// config returns a deployment of app.bin, holding "firmware", to dev:1 in project app:123
+// against the fake
+func (f *fakeNotehub) config(t *testing.T) *DeploymentConfig {
+	t.Helper()
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &DeploymentConfig{
+		ProjectUID:    "app:123",
+		FirmwareFile:  firmwareFile,
+		DeviceUID:     "dev:1",
+		IssueDFU:      true,
+		APIBaseURL:    f.URL,
+		OAuthTokenURL: f.URL + "/oauth2/token",
+	}
+}
+
+// respond returns a route handler that answers with body
+func respond(body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}
+}
+
+// respondStatus returns a route handler that answers with status and body
+func respondStatus(status int, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}
+}
+
+// respondInTurn returns a route handler that answers with each body in turn, repeating
+// the last one
+func respondInTurn(bodies ...string) http.HandlerFunc {
+	var mu sync.Mutex
+	next := 0
+	return func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		body := bodies[next]
+		if next < len(bodies)-1 {
+			next++
+		}
+		mu.Unlock()
+		fmt.Fprint(w, body)
+	}
+}
+
+// newTestClient returns a Notehub client for a fake server that is already authenticated
+func newTestClient(serverURL string) *notehub.Client {
+	return notehub.New(notehub.WithBaseURL(serverURL), notehub.WithAccessToken("token"))
+}
+
+func TestNewNotehubClient_CustomEndpoints(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{"/v1/projects/app:123": respond(`{"uid":"app:123"}`)})
+
+	// The defaults must not be used when the config sets both endpoints
+	defer func(base, token string) { DefaultAPIBaseURL, DefaultOAuthTokenURL = base, token }(DefaultAPIBaseURL, DefaultOAuthTokenURL)
+	DefaultAPIBaseURL, DefaultOAuthTokenURL = "http://127.0.0.1:0", "http://127.0.0.1:0"
+
+	client := newNotehubClient(&DeploymentConfig{APIBaseURL: server.URL + "/v1/", OAuthTokenURL: server.URL + "/oauth2/token"})
+	if err := client.Authenticate(context.Background(), "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if _, err := client.GetProject(context.Background(), "app:123"); err != nil {
+		t.Fatalf("GetProject failed: %v", err)
+	}
+
+	if requests := server.requests(true); len(requests) != 2 || requests[0] != "POST /oauth2/token" || requests[1] != "GET /v1/projects/app:123" {
+		t.Errorf("Unexpected requests %v", requests)
+	}
+}
+
+func TestNewNotehubClient_HTTPClient(t *testing.T) {
+	// Only the server's own client trusts its certificate, so the request succeeds only
+	// if the injected client sends it
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+	}))
+	defer server.Close()
+
+	config := &DeploymentConfig{APIBaseURL: server.URL, OAuthTokenURL: server.URL + "/oauth2/token"}
+	if err := newNotehubClient(config).Authenticate(context.Background(), "id", "secret"); err == nil {
+		t.Fatal("Expected the default client to reject the test certificate")
+	}
+
+	config.HTTPClient = server.Client()
+	if err := newNotehubClient(config).Authenticate(context.Background(), "id", "secret"); err != nil {
+		t.Fatalf("Authenticate with the injected client failed: %v", err)
+	}
+}
+
+func TestDeploymentConfig_Validation(t *testing.T) {
+	config := &DeploymentConfig{
+		ProjectUID:   "test-project",
+		FirmwareFile: "test.bin",
+		ClientID:     "test-client",
+		ClientSecret: "test-secret",
+	}
+
+	if config.ProjectUID == "" {
+		t.Error("ProjectUID should not be empty")
+	}
+
+	if config.FirmwareFile == "" {
+		t.Error("FirmwareFile should not be empty")
+	}
+}
+
+func TestTriggerDFU_QueryParams(t *testing.T) {
+	// Test query parameter building (without making HTTP calls)
+	config := &DeploymentConfig{
+		ProjectUID:       "test-project",
+		DeviceUID:        "device-123",
+		Tag:              "production",
+		SerialNumber:     "SN123",
+		FleetUID:         "fleet-456",
+		ProductUID:       "product-789",
+		NotecardFirmware: "v1.0.0",
+		Location:         "factory",
+		SKU:              "SKU-ABC",
+	}
+
+	// Verify all fields are set
+	if config.DeviceUID == "" {
+		t.Error("DeviceUID should not be empty")
+	}
+	if config.Tag == "" {
+		t.Error("Tag should not be empty")
+	}
+	if config.SerialNumber == "" {
+		t.Error("SerialNumber should not be empty")
+	}
+	if config.FleetUID == "" {
+		t.Error("FleetUID should not be empty")
+	}
+	if config.ProductUID == "" {
+		t.Error("ProductUID should not be empty")
+	}
+	if config.NotecardFirmware == "" {
+		t.Error("NotecardFirmware should not be empty")
+	}
+	if config.Location == "" {
+		t.Error("Location should not be empty")
+	}
+	if config.SKU == "" {
+		t.Error("SKU should not be empty")
+	}
+}
+
+func TestAddCommaSeparatedParams(t *testing.T) {
+	tests := []struct {
+		name           string
+		paramName      string
+		value          string
+		expectedParams map[string][]string
+	}{
+		{
+			name:      "single value",
+			paramName: "deviceUID",
+			value:     "device-123",
+			expectedParams: map[string][]string{
+				"deviceUID": {"device-123"},
+			},
+		},
+		{
+			name:      "multiple values",
+			paramName: "tags",
+			value:     "production,sensor,outdoor",
+			expectedParams: map[string][]string{
+				"tags": {"production", "sensor", "outdoor"},
+			},
+		},
+		{
+			name:      "values with spaces",
+			paramName: "location",
+			value:     "warehouse, factory , office",
+			expectedParams: map[string][]string{
+				"location": {"warehouse", "factory", "office"},
+			},
+		},
+		{
+			name:           "empty value",
+			paramName:      "sku",
+			value:          "",
+			expectedParams: map[string][]string{},
+		},
+		{
+			name:      "values with empty segments",
+			paramName: "serialNumber",
+			value:     "SN001,,SN003,",
+			expectedParams: map[string][]string{
+				"serialNumber": {"SN001", "SN003"},
+			},
+		},
+		{
+			name:      "duplicate values",
+			paramName: "tags",
+			value:     "tagA,tagB, tagA ,tagB",
+			expectedParams: map[string][]string{
+				"tags": {"tagA", "tagB"},
+			},
+		},
+		{
+			name:      "single value with surrounding whitespace",
+			paramName: "deviceUID",
+			value:     "  device-123\t",
+			expectedParams: map[string][]string{
+				"deviceUID": {"device-123"},
+			},
+		},
+		{
+			name:           "only commas",
+			paramName:      "tags",
+			value:          " , ,, ",
+			expectedParams: map[string][]string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			queryParams := url.Values{}
+			addCommaSeparatedParams(queryParams, tt.paramName, tt.value)
+
+			// Check if we got the expected parameters
+			for expectedParam, expectedValues := range tt.expectedParams {
+				actualValues := queryParams[expectedParam]
+				if len(actualValues) != len(expectedValues) {
+					t.Errorf("Expected %d values for %s, got %d", len(expectedValues), expectedParam, len(actualValues))
+					continue
+				}
+				for i, expectedValue := range expectedValues {
+					if actualValues[i] != expectedValue {
+						t.Errorf("Expected value %s at index %d, got %s", expectedValue, i, actualValues[i])
+					}
+				}
+			}
+
+			// Check that we don't have unexpected parameters
+			for actualParam := range queryParams {
+				if _, expected := tt.expectedParams[actualParam]; !expected {
+					t.Errorf("Unexpected parameter %s found", actualParam)
+				}
+			}
+		})
+	}
+}
+
+func TestWarnEmptyTargeting(t *testing.T) {
+	config := &DeploymentConfig{Tag: ",,", DeviceUID: "dev:1,dev:1", SKU: " "}
+	l := useRecordingLogger(config)
+	warnEmptyTargeting(config)
+
+	expected := []string{
+		`tag is set to ",,", which has no values, so it does not narrow the DFU`,
+		`sku is set to " ", which has no values, so it does not narrow the DFU`,
+	}
+	if strings.Join(l.warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected warnings %q, got %q", expected, l.warnings)
+	}
+}
+
+func TestTriggerDFU_CommaSeparatedQueryParams(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         *DeploymentConfig
+		expectedParams map[string][]string
+	}{
+		{
+			name: "single values",
+			config: &DeploymentConfig{
+				ProjectUID:   "test-project",
+				DeviceUID:    "device-123",
+				Tag:          "production",
+				SerialNumber: "SN123",
+			},
+			expectedParams: map[string][]string{
+				"deviceUID":    {"device-123"},
+				"tags":         {"production"},
+				"serialNumber": {"SN123"},
+			},
+		},
+		{
+			name: "multiple comma-separated values",
+			config: &DeploymentConfig{
+				ProjectUID:   "test-project",
+				DeviceUID:    "device-123,device-456,device-789",
+				Tag:          "production,sensor,outdoor",
+				SerialNumber: "SN001,SN002,SN003",
+				FleetUID:     "fleet-1,fleet-2",
+				ProductUID:   "product-A,product-B",
+			},
+			expectedParams: map[string][]string{
+				"deviceUID":    {"device-123", "device-456", "device-789"},
+				"tags":         {"production", "sensor", "outdoor"},
+				"serialNumber": {"SN001", "SN002", "SN003"},
+				"fleetUID":     {"fleet-1", "fleet-2"},
+				"productUID":   {"product-A", "product-B"},
+			},
+		},
+		{
+			name: "values with spaces and empty segments",
+			config: &DeploymentConfig{
+				ProjectUID:       "test-project",
+				Tag:              "production, sensor , outdoor",
+				NotecardFirmware: "v1.0.0,,v1.0.2,",
+				Location:         "warehouse, factory",
+				SKU:              "SKU-A,, SKU-C",
+			},
+			expectedParams: map[string][]string{
+				"tags":             {"production", "sensor", "outdoor"},
+				"notecardFirmware": {"v1.0.0", "v1.0.2"},
+				"location":         {"warehouse", "factory"},
+				"sku":              {"SKU-A", "SKU-C"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// We'll test the query parameter building logic by examining what gets built
+			// without actually making HTTP calls
+			queryParams := url.Values{}
+
+			// Apply the same logic as TriggerDFU
+			addCommaSeparatedParams(queryParams, "deviceUID", tt.config.DeviceUID)
+			addCommaSeparatedParams(queryParams, "tags", tt.config.Tag)
+			addCommaSeparatedParams(queryParams, "serialNumber", tt.config.SerialNumber)
+			addCommaSeparatedParams(queryParams, "fleetUID", tt.config.FleetUID)
+			addCommaSeparatedParams(queryParams, "productUID", tt.config.ProductUID)
+			addCommaSeparatedParams(queryParams, "notecardFirmware", tt.config.NotecardFirmware)
+			addCommaSeparatedParams(queryParams, "location", tt.config.Location)
+			addCommaSeparatedParams(queryParams, "sku", tt.config.SKU)
+
+			// Verify expected parameters
+			for expectedParam, expectedValues := range tt.expectedParams {
+				actualValues := queryParams[expectedParam]
+				if len(actualValues) != len(expectedValues) {
+					t.Errorf("Expected %d values for %s, got %d", len(expectedValues), expectedParam, len(actualValues))
+					continue
+				}
+				for i, expectedValue := range expectedValues {
+					if actualValues[i] != expectedValue {
+						t.Errorf("Expected value %s at index %d for %s, got %s", expectedValue, i, expectedParam, actualValues[i])
+					}
+				}
+			}
+
+			// Verify we don't have unexpected parameters
+			for actualParam := range queryParams {
+				if _, expected := tt.expectedParams[actualParam]; !expected {
+					t.Errorf("Unexpected parameter %s found with values %v", actualParam, queryParams[actualParam])
+				}
+			}
+		})
+	}
+}
+
+func TestTriggerDFU_CompleteURLGeneration(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      *DeploymentConfig
+		expectedURL string
+	}{
+		{
+			name: "single tag",
+			config: &DeploymentConfig{
+				ProjectUID: "app:12345678-1234-1234-1234-123456789012",
+				Tag:        "production",
+			},
+			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?tags=production",
+		},
+		{
+			name: "multiple tags",
+			config: &DeploymentConfig{
+				ProjectUID: "app:12345678-1234-1234-1234-123456789012",
+				Tag:        "production,sensor,outdoor",
+			},
+			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?tags=production&tags=sensor&tags=outdoor",
+		},
+		{
+			name: "multiple device UIDs",
+			config: &DeploymentConfig{
+				ProjectUID: "app:12345678-1234-1234-1234-123456789012",
+				DeviceUID:  "device-123,device-456,device-789",
+			},
+			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?deviceUID=device-123&deviceUID=device-456&deviceUID=device-789",
+		},
+		{
+			name: "mixed parameters with comma-separated values",
+			config: &DeploymentConfig{
+				ProjectUID:   "app:12345678-1234-1234-1234-123456789012",
+				DeviceUID:    "device-123,device-456",
+				Tag:          "production,sensor",
+				SerialNumber: "SN001",
+				FleetUID:     "fleet-A,fleet-B",
+			},
+			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?deviceUID=device-123&deviceUID=device-456&fleetUID=fleet-A&fleetUID=fleet-B&serialNumber=SN001&tags=production&tags=sensor",
+		},
+		{
+			name: "all parameters with multiple values",
+			config: &DeploymentConfig{
+				ProjectUID:       "app:12345678-1234-1234-1234-123456789012",
+				DeviceUID:        "dev1,dev2",
+				Tag:              "tag1,tag2",
+				SerialNumber:     "SN1,SN2",
+				FleetUID:         "fleet1,fleet2",
+				ProductUID:       "prod1,prod2",
+				NotecardFirmware: "fw1,fw2",
+				Location:         "loc1,loc2",
+				SKU:              "sku1,sku2",
+			},
+			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?deviceUID=dev1&deviceUID=dev2&fleetUID=fleet1&fleetUID=fleet2&location=loc1&location=loc2&notecardFirmware=fw1&notecardFirmware=fw2&productUID=prod1&productUID=prod2&serialNumber=SN1&serialNumber=SN2&sku=sku1&sku=sku2&tags=tag1&tags=tag2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Build query parameters using the same logic as TriggerDFU
+			queryParams := url.Values{}
+
+			addCommaSeparatedParams(queryParams, "deviceUID", tt.config.DeviceUID)
+			addCommaSeparatedParams(queryParams, "tags", tt.config.Tag)
+			addCommaSeparatedParams(queryParams, "serialNumber", tt.config.SerialNumber)
+			addCommaSeparatedParams(queryParams, "fleetUID", tt.config.FleetUID)
+			addCommaSeparatedParams(queryParams, "productUID", tt.config.ProductUID)
+			addCommaSeparatedParams(queryParams, "notecardFirmware", tt.config.NotecardFirmware)
+			addCommaSeparatedParams(queryParams, "location", tt.config.Location)
+			addCommaSeparatedParams(queryParams, "sku", tt.config.SKU)
+
+			// Build the complete URL
+			baseURL := "https://api.notefile.net/v1"
+			dfuURL := fmt.Sprintf("%s/projects/%s/dfu/host/update", baseURL, tt.config.ProjectUID)
+			if len(queryParams) > 0 {
+				dfuURL += "?" + queryParams.Encode()
+			}
+
+			// Verify the complete URL matches expected
+			if dfuURL != tt.expectedURL {
+				t.Errorf("URL mismatch:\nExpected: %s\nActual:   %s", tt.expectedURL, dfuURL)
+			}
+
+			// Also log the URL for visual verification
+			t.Logf("Generated URL: %s", dfuURL)
+		})
+	}
+}
+
+func TestCheckProjectWideDFU(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      DeploymentConfig
+		expectError bool
+	}{
+		{"no targeting", DeploymentConfig{IssueDFU: true}, true},
+		{"only blank separators", DeploymentConfig{IssueDFU: true, DeviceUID: " , "}, true},
+		{"allowed", DeploymentConfig{IssueDFU: true, AllowAllDevices: true}, false},
+		{"no DFU", DeploymentConfig{}, false},
+		{"device targeted", DeploymentConfig{IssueDFU: true, DeviceUID: "dev:1"}, false},
+		{"fleet targeted", DeploymentConfig{IssueDFU: true, FleetUID: "fleet:1"}, false},
+		{"device query", DeploymentConfig{IssueDFU: true, DeviceQuery: url.Values{"sku": {"NOTE-WBNA"}}}, false},
+		{"frozen targets", DeploymentConfig{IssueDFU: true, ResumeFromReport: "report.json"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkProjectWideDFU(&tt.config)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Expected error %t, got %v", tt.expectError, err)
+			}
+			if err != nil {
+				for _, input := range TargetingInputs {
+					if !strings.Contains(err.Error(), input) {
+						t.Errorf("Expected the error to name %s, got %v", input, err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_RefusesProjectWideDFUBeforeUpload(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+	config := server.config(t)
+	config.DeviceUID = ""
+
+	report, err := DeployFirmware(context.Background(), config)
+	if err == nil || !strings.Contains(err.Error(), "allow_all_devices") {
+		t.Fatalf("Expected the project-wide DFU to be refused, got %v", err)
+	}
+	if requests := server.requests(true); len(requests) != 0 || report.DFUTriggered {
+		t.Errorf("Expected no requests to Notehub, got %v", requests)
+	}
+}
+
+func TestDeployFirmware_CountTargets(t *testing.T) {
+	var listQuery string
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": func(w http.ResponseWriter, r *http.Request) {
+			listQuery = r.URL.Query().Get("tags")
+			fmt.Fprint(w, `{"devices":[{"uid":"dev:1"},{"uid":"dev:2"},{"uid":"dev:3"}],"has_more":false}`)
+		},
+		"/projects/app:123/dfu/host/update": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("tags") != "prod" || r.URL.Query().Has("deviceUID") {
+				t.Errorf("Counting must not change the DFU targeting, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{}`)
+		},
+	})
+	config := server.config(t)
+	config.DeviceUID = ""
+	config.Tag = "prod"
+	config.CountTargets = true
+
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if listQuery != "prod" || report.ResolvedDevices != 3 || !report.DFUTriggered {
+		t.Errorf("Expected the 3 devices tagged prod counted before the DFU, got %d (tag %q)", report.ResolvedDevices, listQuery)
+	}
+}
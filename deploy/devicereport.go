@@ -0,0 +1,154 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// Outcomes of a device in the per-device DFU report
+const (
+	DeviceOutcomeCompleted    = "completed"
+	DeviceOutcomeError        = "error"
+	DeviceOutcomePending      = "pending"
+	DeviceOutcomeNotRetrieved = "not yet retrieved"
+)
+
+// DeviceReportEntry is one targeted device's outcome once wait_for_completion has finished
+type DeviceReportEntry struct {
+	DeviceUID       string `json:"device_uid"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	NewVersion      string `json:"new_version,omitempty"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+}
+
+// deviceOutcome classifies a device's last DFU state. A device still queued, with nothing
+// downloaded, never checked in during the wait to retrieve the firmware, so is not yet
+// retrieved rather than pending.
+func deviceOutcome(s notehub.DeviceDFUState) string {
+	switch s.Status {
+	case notehub.DFUStateCompleted:
+		return DeviceOutcomeCompleted
+	case notehub.DFUStateError:
+		return DeviceOutcomeError
+	case "", "queued", "pending":
+		if s.Percent == 0 {
+			return DeviceOutcomeNotRetrieved
+		}
+	}
+	return DeviceOutcomePending
+}
+
+// buildDeviceReport returns the per-device report of the final DFU states
+func buildDeviceReport(states []notehub.DeviceDFUState) []DeviceReportEntry {
+	entries := make([]DeviceReportEntry, 0, len(states))
+	for _, s := range states {
+		entry := DeviceReportEntry{
+			DeviceUID:       s.DeviceUID,
+			SerialNumber:    s.SerialNumber,
+			PreviousVersion: s.PreviousVersion,
+			NewVersion:      s.Version,
+			Status:          deviceOutcome(s),
+		}
+		if entry.Status == DeviceOutcomeError {
+			entry.Error = s.Description
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// deviceOutcomeCounts returns how many devices of the report ended in each outcome
+func deviceOutcomeCounts(entries []DeviceReportEntry) map[string]int {
+	counts := map[string]int{}
+	for _, e := range entries {
+		counts[e.Status]++
+	}
+	return counts
+}
+
+// failedDeviceCount returns how many devices of the report count as failed: those that
+// reported an error, and those that had not finished when unfinished is true
+func failedDeviceCount(counts map[string]int, unfinished bool) int {
+	failed := counts[DeviceOutcomeError]
+	if unfinished {
+		failed += counts[DeviceOutcomePending] + counts[DeviceOutcomeNotRetrieved]
+	}
+	return failed
+}
+
+// checkDeviceReport decides whether the per-device report fails the deployment. waitErr is
+// the wait's timeout, if it expired. With max_failed_devices or min_completed_percent set,
+// those thresholds decide; otherwise unfinished devices fail it when TreatPendingAsFailure
+// is set, and device errors when FailOnDeviceError is. Failures that do not fail the
+// deployment are warned about.
+func checkDeviceReport(config *DeploymentConfig, entries []DeviceReportEntry, waitErr error) error {
+	counts := deviceOutcomeCounts(entries)
+	failed := failedDeviceCount(counts, config.TreatPendingAsFailure)
+	unfinished := counts[DeviceOutcomePending] + counts[DeviceOutcomeNotRetrieved]
+
+	if config.MaxFailedDevices > 0 || config.MinCompletedPercent > 0 {
+		if waitErr != nil {
+			config.Warnf("Waiting for DFU completion %v", waitErr)
+		}
+		if config.MaxFailedDevices > 0 && failed > config.MaxFailedDevices {
+			return fmt.Errorf("%d of %d device(s) failed the update, more than max_failed_devices (%d)", failed, len(entries), config.MaxFailedDevices)
+		}
+		if completed := percentOf(counts[DeviceOutcomeCompleted], len(entries)); completed < config.MinCompletedPercent {
+			return fmt.Errorf("%.1f%% of %d device(s) completed the update, below min_completed_percent (%g%%)", completed, len(entries), config.MinCompletedPercent)
+		}
+		if failed > 0 {
+			config.Warnf("%d of %d device(s) failed the update, within the thresholds", failed, len(entries))
+		}
+		return nil
+	}
+
+	if waitErr != nil {
+		if config.TreatPendingAsFailure {
+			return fmt.Errorf("waiting for DFU completion failed: %w", waitErr)
+		}
+		config.Warnf("Waiting for DFU completion %v; %d device(s) are reported as pending or not yet retrieved", waitErr, unfinished)
+	}
+	if errored := failedDevices(entries); len(errored) > 0 {
+		if config.FailOnDeviceError {
+			return fmt.Errorf("DFU failed on %d device(s): %s", len(errored), strings.Join(errored, ", "))
+		}
+		config.Warnf("DFU failed on %d device(s): %s", len(errored), strings.Join(errored, ", "))
+	}
+	return nil
+}
+
+// percentOf returns n as a percentage of total, or 100 for no devices at all
+func percentOf(n, total int) float64 {
+	if total == 0 {
+		return 100
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// failedDevices returns the UIDs of the report's devices whose update ended in error
+func failedDevices(entries []DeviceReportEntry) []string {
+	var failed []string
+	for _, e := range entries {
+		if e.Status == DeviceOutcomeError {
+			failed = append(failed, e.DeviceUID)
+		}
+	}
+	return failed
+}
+
+// deviceReportMarkdown renders the per-device report as a Markdown table
+func deviceReportMarkdown(entries []DeviceReportEntry) string {
+	var b strings.Builder
+	b.WriteString("### Device Firmware Update Status\n\n")
+	b.WriteString("| Device | Serial | Previous Version | New Version | Status | Error |\n")
+	b.WriteString("| ------ | ------ | ---------------- | ----------- | ------ | ----- |\n")
+	for _, e := range entries {
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %s | %s |\n", e.DeviceUID, escapeTableCell(e.SerialNumber),
+			escapeTableCell(e.PreviousVersion), escapeTableCell(e.NewVersion), e.Status, escapeTableCell(e.Error))
+	}
+	return b.String()
+}
@@ -0,0 +1,135 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestBuildDeviceReport(t *testing.T) {
+	entries := buildDeviceReport([]notehub.DeviceDFUState{
+		{DeviceUID: "dev:1", SerialNumber: "sn-1", Status: notehub.DFUStateCompleted, PreviousVersion: "1.0.0", Version: "1.1.0"},
+		{DeviceUID: "dev:2", Status: notehub.DFUStateError, Description: "image rejected"},
+		{DeviceUID: "dev:3", Status: "downloading", Percent: 40},
+		{DeviceUID: "dev:4", Status: "queued"},
+		{DeviceUID: "dev:5", Status: "pending"},
+	})
+
+	expected := []DeviceReportEntry{
+		{DeviceUID: "dev:1", SerialNumber: "sn-1", PreviousVersion: "1.0.0", NewVersion: "1.1.0", Status: DeviceOutcomeCompleted},
+		{DeviceUID: "dev:2", Status: DeviceOutcomeError, Error: "image rejected"},
+		{DeviceUID: "dev:3", Status: DeviceOutcomePending},
+		{DeviceUID: "dev:4", Status: DeviceOutcomeNotRetrieved},
+		{DeviceUID: "dev:5", Status: DeviceOutcomeNotRetrieved},
+	}
+	if len(entries) != len(expected) {
+		t.Fatalf("Expected %d entries, got %+v", len(expected), entries)
+	}
+	for i := range expected {
+		if entries[i] != expected[i] {
+			t.Errorf("Entry %d: expected %+v, got %+v", i, expected[i], entries[i])
+		}
+	}
+}
+
+func TestCheckDeviceReport(t *testing.T) {
+	entries := func(outcomes ...string) []DeviceReportEntry {
+		var e []DeviceReportEntry
+		for i, o := range outcomes {
+			e = append(e, DeviceReportEntry{DeviceUID: fmt.Sprintf("dev:%d", i+1), Status: o})
+		}
+		return e
+	}
+	timeout := fmt.Errorf("%w after 30m with 1 of 4 device(s) still updating", errWaitTimedOut)
+	ok, failed, pending, retrieved := DeviceOutcomeCompleted, DeviceOutcomeError, DeviceOutcomePending, DeviceOutcomeNotRetrieved
+
+	tests := []struct {
+		name        string
+		config      DeploymentConfig
+		entries     []DeviceReportEntry
+		waitErr     error
+		expectError string
+		expectWarn  bool
+	}{
+		{"all completed", DeploymentConfig{FailOnDeviceError: true}, entries(ok, ok), nil, "", false},
+		{"device error", DeploymentConfig{FailOnDeviceError: true}, entries(ok, failed), nil, "DFU failed on 1 device(s): dev:2", false},
+		{"device error warned", DeploymentConfig{}, entries(ok, failed), nil, "", true},
+		{"timeout fails", DeploymentConfig{TreatPendingAsFailure: true}, entries(ok, pending), timeout, "timed out after 30m", false},
+		{"timeout tolerated", DeploymentConfig{FailOnDeviceError: true}, entries(ok, pending, retrieved), timeout, "", true},
+		{"within max failed", DeploymentConfig{FailOnDeviceError: true, MaxFailedDevices: 2}, entries(ok, failed, failed), nil, "", true},
+		{"over max failed", DeploymentConfig{MaxFailedDevices: 1}, entries(ok, failed, failed), nil, "2 of 3 device(s) failed the update, more than max_failed_devices (1)", false},
+		{"unfinished count as failed", DeploymentConfig{TreatPendingAsFailure: true, MaxFailedDevices: 1}, entries(ok, failed, retrieved), timeout, "more than max_failed_devices", true},
+		{"unfinished not counted", DeploymentConfig{MaxFailedDevices: 1}, entries(ok, failed, retrieved), timeout, "", true},
+		{"above min completed", DeploymentConfig{MinCompletedPercent: 75}, entries(ok, ok, ok, failed), nil, "", true},
+		{"below min completed", DeploymentConfig{MinCompletedPercent: 75}, entries(ok, ok, failed, retrieved), nil, "50.0% of 4 device(s) completed the update, below min_completed_percent (75%)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := useRecordingLogger(&tt.config)
+			err := checkDeviceReport(&tt.config, tt.entries, tt.waitErr)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+			if got := len(l.warnings) > 0; got != tt.expectWarn {
+				t.Errorf("Expected warning %t, got %v", tt.expectWarn, l.warnings)
+			}
+		})
+	}
+}
+
+func TestDeviceReportMarkdown(t *testing.T) {
+	md := deviceReportMarkdown([]DeviceReportEntry{
+		{DeviceUID: "dev:1", SerialNumber: "sn-1", PreviousVersion: "1.0.0", NewVersion: "1.1.0", Status: DeviceOutcomeCompleted},
+		{DeviceUID: "dev:2", Status: DeviceOutcomeError, Error: "bad | image"},
+	})
+
+	for _, row := range []string{"| dev:1 | sn-1 | 1.0.0 | 1.1.0 | completed |  |", `| dev:2 |  |  |  | error | bad \| image |`} {
+		if !strings.Contains(md, row) {
+			t.Errorf("Expected row %q in:\n%s", row, md)
+		}
+	}
+}
+
+func TestDeployFirmware_DeviceReportOutputs(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/status": respond(`{"devices":[
+			{"device_uid":"dev:1","serial_number":"sn-1","status":"completed","previous_version":"1.0.0","version":"1.1.0"},
+			{"device_uid":"dev:2","serial_number":"sn-2","status":"error","description":"image rejected"},
+			{"device_uid":"dev:3","serial_number":"sn-3","status":"queued"}]}`),
+	})
+	config := *server.config(t)
+	useRecordingLogger(&config)
+	config.DeviceUID = "dev:1,dev:2,dev:3"
+	config.WaitForCompletion = true
+	config.WaitTimeout = 30 * time.Millisecond
+	config.PollInterval = 10 * time.Millisecond
+	config.FailOnDeviceError = true
+	config.MaxFailedDevices = 1
+	tolerant := config
+	report, err := DeployFirmware(context.Background(), &tolerant)
+	if err != nil {
+		t.Fatalf("Expected the rollout within max_failed_devices to pass, got %v", err)
+	}
+	outputs := report.Outputs()
+	if outputs["devices_completed"] != "1" || outputs["devices_failed"] != "1" || outputs["devices_unfinished"] != "1" {
+		t.Errorf("Unexpected device counts %s/%s/%s", outputs["devices_completed"], outputs["devices_failed"], outputs["devices_unfinished"])
+	}
+	if !strings.Contains(outputs["device_report"], `"serial_number":"sn-3","status":"not yet retrieved"`) {
+		t.Errorf("Expected dev:3 not yet retrieved in the device_report output, got %s", outputs["device_report"])
+	}
+
+	strict := config
+	strict.TreatPendingAsFailure = true
+	if _, err := DeployFirmware(context.Background(), &strict); err == nil || !strings.Contains(err.Error(), "more than max_failed_devices (1)") {
+		t.Errorf("Expected the unfinished device to exceed max_failed_devices, got %v", err)
+	}
+}
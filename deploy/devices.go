@@ -0,0 +1,101 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// ParseDeviceQueryJSON parses a device query object into query parameters. The object maps
+// Notehub device filter names to a scalar or an array of scalars; arrays match any of their
+// values and separate keys must all match.
+func ParseDeviceQueryJSON(value string) (url.Values, error) {
+	return ParseDeviceQuery("device_query_json", value)
+}
+
+// ParseDeviceQuery parses the device query object given to input, which names the input in
+// errors
+func ParseDeviceQuery(input, value string) (url.Values, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	var raw map[string]any
+	if err := json.Unmarshal([]byte(value), &raw); err != nil {
+		return nil, fmt.Errorf("%s is not a valid JSON object: %w", input, err)
+	}
+
+	// Sort keys so the resulting query is deterministic
+	keys := make([]string, 0, len(raw))
+	for k := range raw {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	query := url.Values{}
+	for _, k := range keys {
+		if k == "" {
+			return nil, fmt.Errorf("%s contains an empty key", input)
+		}
+		switch v := raw[k].(type) {
+		case []any:
+			for _, item := range v {
+				s, err := deviceQueryScalar(input, k, item)
+				if err != nil {
+					return nil, err
+				}
+				query.Add(k, s)
+			}
+		default:
+			s, err := deviceQueryScalar(input, k, v)
+			if err != nil {
+				return nil, err
+			}
+			query.Add(k, s)
+		}
+	}
+
+	return query, nil
+}
+
+// deviceQueryScalar converts a single device query value to its query string form
+func deviceQueryScalar(input, key string, v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	default:
+		return "", fmt.Errorf("%s value for %q must be a string, number, boolean, or array of those", input, key)
+	}
+}
+
+// explicitTargetConfig returns a copy of config whose targeting is replaced by an explicit
+// list of device UIDs, used when resolved devices have been filtered client-side
+func explicitTargetConfig(config *DeploymentConfig, devices []notehub.Device) *DeploymentConfig {
+	uids := make([]string, 0, len(devices))
+	for _, d := range devices {
+		uids = append(uids, d.UID)
+	}
+
+	explicit := *config
+	explicit.DeviceUID = strings.Join(uids, ",")
+	explicit.Tag = ""
+	explicit.SerialNumber = ""
+	explicit.FleetUID = ""
+	explicit.FleetName = ""
+	explicit.ProductUID = ""
+	explicit.NotecardFirmware = ""
+	explicit.Location = ""
+	explicit.SKU = ""
+	explicit.DeviceQuery = nil
+
+	return &explicit
+}
@@ -0,0 +1,78 @@
+package deploy
+
+import (
+	"testing"
+)
+
+func TestParseDeviceQueryJSON(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    string
+		expectError bool
+	}{
+		{
+			name:     "empty",
+			value:    "",
+			expected: "",
+		},
+		{
+			name:     "scalar values",
+			value:    `{"tags":"production","sku":"NOTE-WBNAW"}`,
+			expected: "sku=NOTE-WBNAW&tags=production",
+		},
+		{
+			name:     "array values",
+			value:    `{"fleetUID":["fleet:a","fleet:b"],"pageLimit":10,"online":true}`,
+			expected: "fleetUID=fleet%3Aa&fleetUID=fleet%3Ab&online=true&pageLimit=10",
+		},
+		{
+			name:        "malformed JSON",
+			value:       `{"tags":`,
+			expectError: true,
+		},
+		{
+			name:        "not an object",
+			value:       `["tags"]`,
+			expectError: true,
+		},
+		{
+			name:        "nested object",
+			value:       `{"tags":{"any":["a"]}}`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := ParseDeviceQueryJSON(tt.value)
+			if tt.expectError {
+				if err == nil {
+					t.Error("Expected error, got nil")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := query.Encode(); got != tt.expected {
+				t.Errorf("Expected query %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestBuildTargetingParams_MergesDeviceQuery(t *testing.T) {
+	query, err := ParseDeviceQueryJSON(`{"tags":["eu"],"location":"Berlin"}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	config := &DeploymentConfig{Tag: "production", DeviceQuery: query}
+	params := buildTargetingParams(config)
+
+	expected := "location=Berlin&tags=production&tags=eu"
+	if got := params.Encode(); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
@@ -0,0 +1,166 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// Decisions of the downgrade check
+const (
+	VersionUpgrade          = "upgrade"
+	VersionSame             = "same version"
+	VersionDowngradeAllowed = "downgrade allowed"
+	VersionDowngradeRefused = "downgrade refused"
+)
+
+// VersionCheck records how the deployed firmware's version compared with the newest
+// version already in the project
+type VersionCheck struct {
+	Version        string `json:"version"`
+	NewestVersion  string `json:"newest_version"`
+	NewestFilename string `json:"newest_filename"`
+	Decision       string `json:"decision"`
+	Semver         bool   `json:"semver"`
+}
+
+// semverPattern matches a semantic version, with an optional leading "v"
+var semverPattern = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// compareVersions compares two versions as semantic versions, including prerelease
+// precedence, returning -1, 0 or 1. When either is not a semantic version they are
+// compared as strings, and semver is false.
+func compareVersions(a, b string) (cmp int, semver bool) {
+	ma, mb := semverPattern.FindStringSubmatch(a), semverPattern.FindStringSubmatch(b)
+	if ma == nil || mb == nil {
+		return strings.Compare(a, b), false
+	}
+	for i := 1; i <= 3; i++ {
+		x, _ := strconv.ParseUint(ma[i], 10, 64)
+		y, _ := strconv.ParseUint(mb[i], 10, 64)
+		if x != y {
+			if x < y {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return comparePrerelease(ma[4], mb[4]), true
+}
+
+// comparePrerelease compares semver prerelease suffixes: a version without one ranks
+// above one with, and identifiers compare numerically when both are numbers, with
+// numbers ranking below other identifiers
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		x, errX := strconv.ParseUint(pa[i], 10, 64)
+		y, errY := strconv.ParseUint(pb[i], 10, 64)
+		switch {
+		case errX == nil && errY == nil:
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+		case errX == nil:
+			return -1
+		case errY == nil:
+			return 1
+		default:
+			if c := strings.Compare(pa[i], pb[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	switch {
+	case len(pa) < len(pb):
+		return -1
+	case len(pa) > len(pb):
+		return 1
+	}
+	return 0
+}
+
+// newestFirmwareVersion returns the firmware with the highest version among files, other
+// than exclude, and whether every comparison was semantic. Files without a version are
+// ignored.
+func newestFirmwareVersion(files []notehub.FirmwareInfo, exclude string) (*notehub.FirmwareInfo, bool) {
+	var newest *notehub.FirmwareInfo
+	semver := true
+	for i := range files {
+		f := &files[i]
+		if f.Filename == exclude || f.Version == "" {
+			continue
+		}
+		if newest == nil {
+			newest = f
+			continue
+		}
+		cmp, ok := compareVersions(f.Version, newest.Version)
+		semver = semver && ok
+		if cmp > 0 {
+			newest = f
+		}
+	}
+	return newest, semver
+}
+
+// checkDowngrade refuses to deploy filename when its version, firmware_version or else the
+// version Notehub read from the uploaded file, is lower than the newest version of the
+// project's other firmware of the type, unless allow_downgrade is set. Without a version
+// on either side there is nothing to compare, and the check passes.
+func checkDowngrade(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport, filename string) error {
+	files, err := client.ListFirmware(ctx, config.ProjectUID, config.FirmwareType, "")
+	if err != nil {
+		return fmt.Errorf("failed to list firmware for the downgrade check: %w", err)
+	}
+
+	version := config.FirmwareVersion
+	if version == "" {
+		for _, f := range files {
+			if f.Filename == filename {
+				version = f.Version
+			}
+		}
+	}
+	newest, semver := newestFirmwareVersion(files, filename)
+	if version == "" || newest == nil {
+		config.logf("No firmware versions to compare; skipping the downgrade check")
+		return nil
+	}
+
+	cmp, ok := compareVersions(version, newest.Version)
+	check := &VersionCheck{Version: version, NewestVersion: newest.Version, NewestFilename: newest.Filename, Semver: semver && ok}
+	report.VersionCheck = check
+	if !check.Semver {
+		config.Warnf("Firmware versions are not all semantic versions, so %s and %s were compared as strings", version, newest.Version)
+	}
+
+	switch {
+	case cmp > 0:
+		check.Decision = VersionUpgrade
+	case cmp == 0:
+		check.Decision = VersionSame
+	case config.AllowDowngrade:
+		check.Decision = VersionDowngradeAllowed
+	default:
+		check.Decision = VersionDowngradeRefused
+		return fmt.Errorf("firmware version %s is lower than %s, the newest in the project (%s); set allow_downgrade: true to deploy it anyway", version, newest.Version, newest.Filename)
+	}
+	config.logf("Firmware version %s against the newest %s (%s): %s", version, newest.Version, newest.Filename, check.Decision)
+	return nil
+}
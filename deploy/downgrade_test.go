@@ -0,0 +1,113 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		cmp    int
+		semver bool
+	}{
+		{"1.2.3", "1.2.3", 0, true},
+		{"v1.2.3", "1.2.3", 0, true},
+		{"1.2.3", "1.2.10", -1, true},
+		{"2.0.0", "1.99.99", 1, true},
+		{"1.0.0-alpha", "1.0.0", -1, true},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1, true},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1, true},
+		{"1.0.0-beta.2", "1.0.0-beta.11", -1, true},
+		{"1.0.0-rc.1", "1.0.0-beta.11", 1, true},
+		{"1.0.0+build.5", "1.0.0+build.1", 0, true},
+		{"1.2", "1.10", 1, false},
+		{"build-42", "1.0.0", 1, false},
+	}
+	for _, tt := range tests {
+		cmp, semver := compareVersions(tt.a, tt.b)
+		if cmp != tt.cmp || semver != tt.semver {
+			t.Errorf("compareVersions(%q, %q) = %d, %v; expected %d, %v", tt.a, tt.b, cmp, semver, tt.cmp, tt.semver)
+		}
+	}
+}
+
+func TestNewestFirmwareVersion(t *testing.T) {
+	files := []notehub.FirmwareInfo{
+		{Filename: "a.bin", Version: "1.2.0"},
+		{Filename: "b.bin", Version: "1.10.0"},
+		{Filename: "c.bin"},
+		{Filename: "d.bin", Version: "1.10.0-rc.1"},
+		{Filename: "app.bin", Version: "9.9.9"},
+	}
+	newest, semver := newestFirmwareVersion(files, "app.bin")
+	if newest == nil || newest.Filename != "b.bin" || !semver {
+		t.Errorf("Expected b.bin as the newest semantic version, got %+v, %v", newest, semver)
+	}
+	if newest, _ := newestFirmwareVersion(files[2:3], ""); newest != nil {
+		t.Errorf("Expected no newest version among files without one, got %+v", newest)
+	}
+}
+
+func TestDeployFirmware_Downgrade(t *testing.T) {
+	tests := []struct {
+		name           string
+		version        string
+		allow          bool
+		uploadedMeta   string
+		expectError    string
+		expectDecision string
+		expectWarning  bool
+	}{
+		{name: "upgrade", version: "1.3.0", expectDecision: VersionUpgrade},
+		{name: "same version", version: "v1.2.0", expectDecision: VersionSame},
+		{name: "downgrade refused", version: "1.2.0-rc.1", expectError: "firmware version 1.2.0-rc.1 is lower than 1.2.0, the newest in the project (v1.2.0.bin)", expectDecision: VersionDowngradeRefused},
+		{name: "downgrade allowed", version: "1.1.9", allow: true, expectDecision: VersionDowngradeAllowed},
+		{name: "version from Notehub", uploadedMeta: "1.1.0", expectError: "firmware version 1.1.0 is lower", expectDecision: VersionDowngradeRefused},
+		{name: "no version", expectDecision: ""},
+		{name: "not semver", version: "build-7", expectDecision: VersionUpgrade, expectWarning: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeNotehub(t, fakeRoutes{
+				"GET /projects/app:123/firmware": respond(fmt.Sprintf(`[{"filename":"app.bin","length":8,"sha256":%q,"version":%q},{"filename":"v1.2.0.bin","version":"1.2.0"},{"filename":"v1.1.0.bin","version":"1.1.0"}]`, testFirmwareSHA256, tt.uploadedMeta)),
+			})
+			config := server.config(t)
+			config.FirmwareVersion = tt.version
+			config.AllowDowngrade = tt.allow
+			l := useRecordingLogger(config)
+			report, err := DeployFirmware(context.Background(), config)
+			dfuIssued := server.count("POST /projects/app:123/dfu/host/update") > 0
+
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				if dfuIssued {
+					t.Error("Expected no DFU for a refused downgrade")
+				}
+			} else if err != nil || !dfuIssued {
+				t.Fatalf("Expected the DFU to be issued, got %v", err)
+			}
+
+			decision := ""
+			if report.VersionCheck != nil {
+				decision = report.VersionCheck.Decision
+			}
+			if decision != tt.expectDecision {
+				t.Errorf("Expected decision %q, got %q", tt.expectDecision, decision)
+			}
+			if decision != "" && !strings.Contains(DeploymentSummaryMarkdown(report), "against the newest 1.2.0 (v1.2.0.bin): "+decision) {
+				t.Errorf("Expected both versions and the decision in the summary, got:\n%s", DeploymentSummaryMarkdown(report))
+			}
+			warned := strings.Contains(strings.Join(l.warnings, "\n"), "compared as strings")
+			if warned != tt.expectWarning {
+				t.Errorf("Expected a string comparison warning %v, got %v", tt.expectWarning, l.warnings)
+			}
+		})
+	}
+}
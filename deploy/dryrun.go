@@ -0,0 +1,42 @@
+package deploy
+
+import "github.com/blues/note-dfu-github/notehub"
+
+// logDryRunPlan prints the firmware details and the exact requests a real deployment would
+// send, without sending them. Authentication and read-only device resolution have already
+// run by this point, so credentials and targeting are validated.
+func logDryRunPlan(client *notehub.Client, config, dfuConfig *DeploymentConfig, firmwareFile string, size int64, sum string) error {
+	// Notehub may assign a different filename on upload; the local name is the best estimate
+	filename := uploadFilename(config, firmwareFile)
+
+	config.logf("DRY RUN: no firmware will be uploaded and no DFU will be triggered")
+	if config.SkipUpload {
+		// The firmware is already in the project under exactly this name
+		filename = firmwareFile
+		config.logf("  - Firmware: %s, already in the project (%d bytes)", firmwareFile, size)
+		config.logf("  - Would not upload it (skip_upload)")
+	} else {
+		config.logf("  - Firmware: %s (%d bytes, SHA-256 %s)", firmwareFile, size, sum)
+		config.logf("  - Would PUT %s", notehub.Redact(client.FirmwareURL(config.ProjectUID, config.FirmwareType, filename)))
+	}
+
+	if !config.IssueDFU {
+		config.logf("  - Would not trigger a DFU (issue_dfu is false)")
+		return nil
+	}
+
+	dfuURL, payload, err := client.DFUUpdateRequest(dfuConfig.ProjectUID, dfuConfig.FirmwareType, dfuParams(dfuConfig), filename)
+	if !config.ScheduleAt.IsZero() {
+		dfuURL, payload, err = client.DFUScheduleRequest(dfuConfig.ProjectUID, dfuConfig.FirmwareType, dfuParams(dfuConfig), filename, config.ScheduleAt)
+	}
+	if err != nil {
+		return err
+	}
+	config.logf("  - Would POST %s", notehub.Redact(dfuURL))
+	config.logf("  - Payload: %s", payload)
+	if batches := dfuTargetBatches(dfuConfig); len(batches) > 1 {
+		config.logf("  - The device list would be split across %d such requests", len(batches))
+	}
+
+	return nil
+}
@@ -0,0 +1,44 @@
+package deploy
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogDryRunPlan(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	path := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(path, []byte("firmware"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	client := newTestClient(server.URL)
+
+	config := &DeploymentConfig{ProjectUID: "app:123", Tag: "production,beta", IssueDFU: true, DryRun: true}
+	if err := logDryRunPlan(client, config, config, path, 8, "c3bf47ea1f4a4a605470313cacb3a44f4a461f68c6faeab07e737610cb5ac835"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if requests := server.requests(true); len(requests) != 0 {
+		t.Errorf("Dry run must not send requests, got %v", requests)
+	}
+	for _, expected := range []string{
+		"SHA-256 c3bf47ea1f4a4a605470313cacb3a44f4a461f68c6faeab07e737610cb5ac835",
+		"Would PUT " + server.URL + "/projects/app:123/firmware/host/app.bin",
+		"Would POST " + server.URL + "/projects/app:123/dfu/host/update?tags=production&tags=beta",
+		`Payload: {"filename":"app.bin"}`,
+	} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Expected %q in dry run output:\n%s", expected, logs.String())
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package deploy_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/blues/note-dfu-github/deploy"
+)
+
+// A deployment run against an in-process Notehub, with the server's HTTP client injected
+// so that no request leaves the test
+func ExampleDeployFirmware() {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth2/token", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+	})
+	mux.HandleFunc("/projects/app:123/firmware/host/app.bin", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"filename":"app.bin"}`)
+	})
+	mux.HandleFunc("/projects/app:123/firmware", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"filename":"app.bin","length":8}]`)
+	})
+	mux.HandleFunc("/projects/app:123/dfu/host/update", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Println("DFU issued for tags", r.URL.Query().Get("tags"))
+		fmt.Fprint(w, `{}`)
+	})
+	server := httptest.NewTLSServer(mux)
+	defer server.Close()
+
+	dir, err := os.MkdirTemp("", "example")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	firmwareFile := filepath.Join(dir, "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		panic(err)
+	}
+
+	report, err := deploy.DeployFirmware(context.Background(), &deploy.DeploymentConfig{
+		ProjectUID:    "app:123",
+		FirmwareFile:  firmwareFile,
+		ClientID:      "id",
+		ClientSecret:  "secret",
+		Tag:           "production",
+		IssueDFU:      true,
+		APIBaseURL:    server.URL,
+		OAuthTokenURL: server.URL + "/oauth2/token",
+		HTTPClient:    server.Client(),
+	})
+	if err != nil {
+		fmt.Println("deployment failed:", err)
+		return
+	}
+	fmt.Println(report.Status, report.UploadedFilename, report.DFUTriggered)
+
+	// Output:
+	// DFU issued for tags production
+	// success app.bin true
+}
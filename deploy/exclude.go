@@ -0,0 +1,130 @@
+package deploy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// excludeDevices removes from the resolved devices those carrying any of excludeTags, which
+// may be globs, or listed in excludeUIDs, returning the devices kept and why each other
+// device was excluded
+func excludeDevices(devices []notehub.Device, excludeTags, excludeUIDs []string) ([]notehub.Device, []ExcludedDevice) {
+	uids := map[string]bool{}
+	for _, uid := range excludeUIDs {
+		uids[uid] = true
+	}
+
+	var kept []notehub.Device
+	var excluded []ExcludedDevice
+	for _, d := range devices {
+		if uids[d.UID] {
+			excluded = append(excluded, ExcludedDevice{DeviceUID: d.UID, Reason: "listed in exclude_device_uid"})
+			continue
+		}
+		if tag := excludedTag(d, excludeTags); tag != "" {
+			excluded = append(excluded, ExcludedDevice{DeviceUID: d.UID, Reason: "tagged " + tag + ", matching exclude_tags"})
+			continue
+		}
+		kept = append(kept, d)
+	}
+	return kept, excluded
+}
+
+// excludedTag returns the first of the device's tags matching one of excludeTags, or ""
+func excludedTag(d notehub.Device, excludeTags []string) string {
+	for _, tag := range SplitTags(d.Tags) {
+		for _, pattern := range excludeTags {
+			if tagMatches(tag, pattern) {
+				return tag
+			}
+		}
+	}
+	return ""
+}
+
+// maxDFUDeviceUIDs bounds how many device UIDs or serial numbers are sent in one DFU
+// request, however short they are
+const maxDFUDeviceUIDs = 100
+
+// DefaultMaxDFUQueryLength is the longest encoded query string a DFU request is sent with,
+// keeping the request URL well within common server and proxy limits
+const DefaultMaxDFUQueryLength = 2000
+
+// maxDFUQueryLength returns the configured query length limit, or the default
+func (c *DeploymentConfig) maxDFUQueryLength() int {
+	if c.MaxDFUQueryLength > 0 {
+		return c.MaxDFUQueryLength
+	}
+	return DefaultMaxDFUQueryLength
+}
+
+// dfuTargetBatches splits a DFU whose explicit device UID or serial number list would not
+// fit in one request into one config per batch, each keeping the rest of the targeting.
+// Any other targeting is returned as is.
+func dfuTargetBatches(dfuConfig *DeploymentConfig) []*DeploymentConfig {
+	var batches []*DeploymentConfig
+	for _, batch := range splitTargetList(dfuConfig, "deviceUID", func(c *DeploymentConfig) *string { return &c.DeviceUID }) {
+		batches = append(batches, splitTargetList(batch, "serialNumber", func(c *DeploymentConfig) *string { return &c.SerialNumber })...)
+	}
+	return batches
+}
+
+// splitTargetList splits the comma-separated list field of config, sent as the param query
+// parameter, into batches of at most maxDFUDeviceUIDs values whose encoded query stays
+// within the length limit, extra_dfu_params included. A single value too long to fit on its own is sent alone.
+func splitTargetList(config *DeploymentConfig, param string, field func(*DeploymentConfig) *string) []*DeploymentConfig {
+	values := SplitTags(*field(config))
+	limit := config.maxDFUQueryLength()
+	if len(values) <= maxDFUDeviceUIDs && len(dfuParams(config).Encode()) <= limit {
+		return []*DeploymentConfig{config}
+	}
+
+	// Each value adds its encoded parameter and a separating '&' to the rest of the query
+	rest := *config
+	*field(&rest) = ""
+	base := len(dfuParams(&rest).Encode())
+
+	var batches []*DeploymentConfig
+	var current []string
+	length := base
+	flush := func() {
+		batch := *config
+		*field(&batch) = strings.Join(current, ",")
+		batches = append(batches, &batch)
+		current, length = nil, base
+	}
+	for _, v := range values {
+		n := len(url.Values{param: {v}}.Encode()) + 1
+		if len(current) > 0 && (len(current) == maxDFUDeviceUIDs || length+n > limit) {
+			flush()
+		}
+		current = append(current, v)
+		length += n
+	}
+	flush()
+	return batches
+}
+
+// batchRange describes DFU batches from to to, numbered from one
+func batchRange(from, to int) string {
+	if from == to {
+		return fmt.Sprintf("batch %d", from)
+	}
+	return fmt.Sprintf("batches %d-%d", from, to)
+}
+
+// batchDeviceCount returns how many devices a batch lists explicitly
+func batchDeviceCount(batch *DeploymentConfig) int {
+	if batch.DeviceUID != "" {
+		return len(SplitTags(batch.DeviceUID))
+	}
+	return len(SplitTags(batch.SerialNumber))
+}
+
+// hasExclusions reports whether devices are to be removed from the resolved targets
+func hasExclusions(config *DeploymentConfig) bool {
+	return len(config.ExcludeTags) > 0 || len(config.ExcludeDeviceUIDs) > 0
+}
@@ -0,0 +1,209 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestExcludeDevices(t *testing.T) {
+	devices := []notehub.Device{
+		{UID: "dev:1", Tags: "field,prod"},
+		{UID: "dev:2", Tags: "golden"},
+		{UID: "dev:3", Tags: "lab-bench-4"},
+		{UID: "dev:4"},
+	}
+
+	kept, excluded := excludeDevices(devices, []string{"golden", "lab-*"}, []string{"dev:4"})
+
+	if len(kept) != 1 || kept[0].UID != "dev:1" {
+		t.Errorf("Expected only dev:1 kept, got %+v", kept)
+	}
+	expected := []ExcludedDevice{
+		{DeviceUID: "dev:2", Reason: "tagged golden, matching exclude_tags"},
+		{DeviceUID: "dev:3", Reason: "tagged lab-bench-4, matching exclude_tags"},
+		{DeviceUID: "dev:4", Reason: "listed in exclude_device_uid"},
+	}
+	if !reflect.DeepEqual(excluded, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, excluded)
+	}
+}
+
+func TestDFUTargetBatches(t *testing.T) {
+	uids := make([]string, 250)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("dev:%d", i)
+	}
+
+	batches := dfuTargetBatches(&DeploymentConfig{DeviceUID: strings.Join(uids, ","), FirmwareType: "host"})
+	if len(batches) != 3 {
+		t.Fatalf("Expected 3 batches, got %d", len(batches))
+	}
+	var joined []string
+	for _, b := range batches {
+		joined = append(joined, SplitTags(b.DeviceUID)...)
+		if b.FirmwareType != "host" {
+			t.Errorf("Expected the rest of the config kept, got %+v", b)
+		}
+	}
+	if !reflect.DeepEqual(joined, uids) || len(SplitTags(batches[2].DeviceUID)) != 50 {
+		t.Errorf("Expected every UID once, in order, in batches of %d", maxDFUDeviceUIDs)
+	}
+
+	// Other targeting is sent in a single request
+	config := &DeploymentConfig{Tag: "prod"}
+	if batches := dfuTargetBatches(config); len(batches) != 1 || batches[0] != config {
+		t.Errorf("Expected the config unchanged, got %+v", batches)
+	}
+}
+
+// syntheticUIDs returns n device UIDs of realistic length
+func syntheticUIDs(n int) []string {
+	uids := make([]string, n)
+	for i := range uids {
+		uids[i] = fmt.Sprintf("dev:%015d", 864475044000000+i)
+	}
+	return uids
+}
+
+func TestDFUTargetBatches_QueryLength(t *testing.T) {
+	uids := syntheticUIDs(500)
+	config := &DeploymentConfig{DeviceUID: strings.Join(uids, ","), ProductUID: "com.example:sensor"}
+	batches := dfuTargetBatches(config)
+	if len(batches) < 9 {
+		t.Fatalf("Expected the 500 UIDs split by query length into at least 9 batches, got %d", len(batches))
+	}
+	var joined []string
+	for i, b := range batches {
+		params := buildTargetingParams(b)
+		if n := len(params.Encode()); n > DefaultMaxDFUQueryLength {
+			t.Errorf("Batch %d: query of %d characters exceeds the limit", i+1, n)
+		}
+		if params.Get("productUID") != "com.example:sensor" {
+			t.Errorf("Batch %d: expected the rest of the targeting kept, got %v", i+1, params)
+		}
+		joined = append(joined, SplitTags(b.DeviceUID)...)
+	}
+	if !reflect.DeepEqual(joined, uids) {
+		t.Error("Expected every UID once, in order")
+	}
+
+	// A lower limit makes for more, smaller batches
+	config.MaxDFUQueryLength = 500
+	if n := len(dfuTargetBatches(config)); n <= len(batches) {
+		t.Errorf("Expected more batches with a lower limit, got %d", n)
+	}
+
+	// Serial numbers are split the same way
+	serials := make([]string, 500)
+	for i := range serials {
+		serials[i] = fmt.Sprintf("SN-%012d", i)
+	}
+	batches = dfuTargetBatches(&DeploymentConfig{SerialNumber: strings.Join(serials, ",")})
+	joined = nil
+	for i, b := range batches {
+		if n := len(buildTargetingParams(b).Encode()); n > DefaultMaxDFUQueryLength {
+			t.Errorf("Serial batch %d: query of %d characters exceeds the limit", i+1, n)
+		}
+		joined = append(joined, SplitTags(b.SerialNumber)...)
+	}
+	if len(batches) < 2 || !reflect.DeepEqual(joined, serials) {
+		t.Errorf("Expected every serial number once, in order, across batches, got %d batch(es)", len(batches))
+	}
+}
+
+func TestDeployFirmware_DFUBatchFailure(t *testing.T) {
+	var dfus int
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/update": func(w http.ResponseWriter, r *http.Request) {
+			if len(r.URL.RawQuery) > DefaultMaxDFUQueryLength {
+				w.WriteHeader(http.StatusRequestURITooLong)
+				return
+			}
+			dfus++
+			if dfus == 3 {
+				http.Error(w, `{"err":"bad request"}`, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		},
+	})
+	uids := syntheticUIDs(500)
+	config := server.config(t)
+	config.DeviceUID = strings.Join(uids, ",")
+	report, err := DeployFirmware(context.Background(), config)
+	plan := dfuTargetBatches(&DeploymentConfig{DeviceUID: strings.Join(uids, ",")})
+	sent := len(SplitTags(plan[0].DeviceUID)) + len(SplitTags(plan[1].DeviceUID))
+	expected := fmt.Sprintf("DFU batch 3 of %d failed after batches 1-2 succeeded for %d device(s), with batches 4-%d not sent", len(plan), sent, len(plan))
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Fatalf("Expected %q, got %v", expected, err)
+	}
+	if dfus != 3 || len(report.TriggerTimes) != 2 || report.DFUTriggered {
+		t.Errorf("Expected the deployment to stop at the failed batch, got %d request(s) and %d trigger(s)", dfus, len(report.TriggerTimes))
+	}
+}
+
+func TestDeployFirmware_ExcludeTags(t *testing.T) {
+	// 160 devices across two pages, every tenth of them golden
+	var devices []notehub.Device
+	for i := 0; i < 160; i++ {
+		d := notehub.Device{UID: fmt.Sprintf("dev:%d", i), Tags: "prod"}
+		if i%10 == 0 {
+			d.Tags = "prod,golden"
+		}
+		devices = append(devices, d)
+	}
+
+	var listFilters string
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": func(w http.ResponseWriter, r *http.Request) {
+			listFilters = r.URL.Query().Get("fleetUID")
+			page := devices[:100]
+			if r.URL.Query().Get("pageNum") == "2" {
+				page = devices[100:]
+			}
+			body, _ := json.Marshal(notehub.DeviceListResponse{Devices: page, HasMore: r.URL.Query().Get("pageNum") == "1"})
+			w.Write(body)
+		},
+	})
+	config := server.config(t)
+	config.DeviceUID = ""
+	config.FleetUID = "fleet:prod"
+	config.ExcludeTags = []string{"golden"}
+	config.ExcludeDeviceUIDs = []string{"dev:1"}
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	if listFilters != "fleet:prod" {
+		t.Errorf("Expected the inclusive targeting to be resolved, got fleetUID %q", listFilters)
+	}
+	var targeted []string
+	for _, query := range server.queries("POST /projects/app:123/dfu/host/update") {
+		if query.Get("fleetUID") != "" {
+			t.Errorf("Expected explicit device UIDs instead of the fleet, got %v", query)
+		}
+		targeted = append(targeted, query["deviceUID"]...)
+	}
+	if len(targeted) != 143 {
+		t.Fatalf("Expected 143 devices targeted, got %d", len(targeted))
+	}
+	for _, uid := range targeted {
+		if uid == "dev:0" || uid == "dev:1" || uid == "dev:150" {
+			t.Errorf("Excluded device %s was targeted", uid)
+		}
+	}
+	if report.ResolvedDevices != 160 || len(report.ExcludedDevices) != 17 {
+		t.Errorf("Expected 160 resolved and 17 excluded devices, got %d and %d", report.ResolvedDevices, len(report.ExcludedDevices))
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "| Excluded Devices | 17 |") {
+		t.Error("Expected the summary to report the excluded devices")
+	}
+}
@@ -0,0 +1,113 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// findExistingFirmware looks for firmware already uploaded to the project under filename
+// with the same size and, when Notehub reports one, the same SHA-256. It returns nil when
+// there is no identical upload. Listings without a digest are matched on size alone.
+func findExistingFirmware(ctx context.Context, client *notehub.Client, config *DeploymentConfig, filename string, identity *ArtifactIdentity) (*notehub.FirmwareInfo, error) {
+	files, err := client.ListFirmware(ctx, config.ProjectUID, config.FirmwareType, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for existing firmware: %w", err)
+	}
+
+	for i := range files {
+		f := &files[i]
+		if f.Filename != filename {
+			continue
+		}
+		if f.Length != identity.Size {
+			config.logf("  - %s exists with a different size (%d bytes, local %d bytes)", f.Filename, f.Length, identity.Size)
+			continue
+		}
+		if f.SHA256 != "" && !strings.EqualFold(f.SHA256, identity.SHA256) {
+			config.logf("  - %s exists with a different SHA-256 (%s)", f.Filename, f.SHA256)
+			continue
+		}
+		return f, nil
+	}
+
+	return nil, nil
+}
+
+// ReusedFirmware records an upload skipped by reuse_identical because the project already
+// had the same firmware under another name
+type ReusedFirmware struct {
+	Filename       string `json:"filename"`
+	ReusedFilename string `json:"reused_filename"`
+}
+
+// findIdenticalFirmware lists all of the project's firmware of the configured type and
+// returns the entry with the same content as identity under any name, or nil
+func findIdenticalFirmware(ctx context.Context, client *notehub.Client, config *DeploymentConfig, filename string, identity *ArtifactIdentity) (*notehub.FirmwareInfo, error) {
+	files, err := client.ListFirmware(ctx, config.ProjectUID, config.FirmwareType, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to check for identical firmware: %w", err)
+	}
+	return identicalFirmware(config, files, filename, identity), nil
+}
+
+// identicalFirmware picks the entry of a firmware listing with the same content as
+// identity. An entry named filename is matched as skip_if_exists matches it, and one with
+// different content means the upload goes ahead as usual rather than deploying a
+// differently-named file. Entries under other names must report a matching MD5 or SHA-256,
+// since a matching size alone says little about the content.
+func identicalFirmware(config *DeploymentConfig, files []notehub.FirmwareInfo, filename string, identity *ArtifactIdentity) *notehub.FirmwareInfo {
+	var renamed *notehub.FirmwareInfo
+	for i := range files {
+		f := &files[i]
+		if f.Length != identity.Size || !digestsAgree(f, identity) {
+			if f.Filename == filename {
+				config.logf("  - %s exists with different content, so it will be replaced", f.Filename)
+				return nil
+			}
+			continue
+		}
+		if f.Filename == filename {
+			return f
+		}
+		if renamed == nil && (f.SHA256 != "" || f.MD5 != "") {
+			renamed = f
+		}
+	}
+	return renamed
+}
+
+// digestsAgree reports whether every digest Notehub lists for f matches identity
+func digestsAgree(f *notehub.FirmwareInfo, identity *ArtifactIdentity) bool {
+	if f.SHA256 != "" && !strings.EqualFold(f.SHA256, identity.SHA256) {
+		return false
+	}
+	return f.MD5 == "" || strings.EqualFold(f.MD5, identity.MD5)
+}
+
+// findUploadedFirmware looks up firmware_file among the project's firmware of the
+// configured type for skip_upload, failing with the filenames available when it is not
+// there
+func findUploadedFirmware(ctx context.Context, client *notehub.Client, config *DeploymentConfig) (*notehub.FirmwareInfo, error) {
+	files, err := client.ListFirmware(ctx, config.ProjectUID, config.FirmwareType, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up firmware for skip_upload: %w", err)
+	}
+
+	var available []string
+	for i := range files {
+		if files[i].Filename == config.FirmwareFile {
+			return &files[i], nil
+		}
+		available = append(available, files[i].Filename)
+	}
+	firmwareType := notehub.FirmwareTypeOrDefault(config.FirmwareType)
+	if len(available) == 0 {
+		return nil, fmt.Errorf("skip_upload: %s is not in the project, which has no %s firmware", config.FirmwareFile, firmwareType)
+	}
+	sort.Strings(available)
+	return nil, fmt.Errorf("skip_upload: %s is not in the project; its %s firmware is: %s", config.FirmwareFile, firmwareType, strings.Join(available, ", "))
+}
@@ -0,0 +1,205 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestFindExistingFirmware(t *testing.T) {
+	identity := &ArtifactIdentity{Size: 8, SHA256: testFirmwareSHA256}
+
+	tests := []struct {
+		name     string
+		listing  string
+		expected bool
+	}{
+		{"none uploaded", `[]`, false},
+		{"identical", fmt.Sprintf(`[{"filename":"app.bin","length":8,"sha256":%q}]`, strings.ToUpper(testFirmwareSHA256)), true},
+		{"identical without digest", `[{"filename":"app.bin","length":8}]`, true},
+		{"different size", `[{"filename":"app.bin","length":9}]`, false},
+		{"different checksum", `[{"filename":"app.bin","length":8,"sha256":"0000"}]`, false},
+		{"different name", `[{"filename":"other.bin","length":8}]`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeNotehub(t, fakeRoutes{
+				"GET /projects/app:123/firmware": func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Query().Get("filename") != "app.bin" {
+						t.Errorf("Unexpected request %s", r.URL)
+					}
+					fmt.Fprint(w, tt.listing)
+				},
+			})
+
+			config := &DeploymentConfig{ProjectUID: "app:123"}
+			existing, err := findExistingFirmware(context.Background(), newTestClient(server.URL), config, "app.bin", identity)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if (existing != nil) != tt.expected {
+				t.Errorf("Expected match %t, got %+v", tt.expected, existing)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_SkipIfExists(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+	server.addFirmware("app.bin", []byte("firmware"))
+	config := server.config(t)
+	config.SkipIfExists = true
+
+	skipped := *config
+	report, err := DeployFirmware(context.Background(), &skipped)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if uploads := server.uploaded(); len(uploads) != 0 {
+		t.Errorf("Expected the upload to be skipped, got %v", uploads)
+	}
+	if !report.UploadSkipped || report.UploadedFilename != "app.bin" || !report.DFUTriggered {
+		t.Errorf("Expected a DFU of the existing firmware, got %+v", report)
+	}
+	if dfuBodies := server.bodies("POST /projects/app:123/dfu/host/update"); len(dfuBodies) != 1 || dfuBodies[0] != `{"filename":"app.bin"}` {
+		t.Errorf("Expected the DFU to use the existing filename, got %v", dfuBodies)
+	}
+
+	// force_upload overrides skip_if_exists
+	forced := *config
+	forced.ForceUpload = true
+	report, err = DeployFirmware(context.Background(), &forced)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if uploads := server.uploaded(); len(uploads) != 1 || report.UploadSkipped {
+		t.Errorf("Expected force_upload to upload the firmware, got %v, skipped %t", uploads, report.UploadSkipped)
+	}
+}
+
+func TestIdenticalFirmware(t *testing.T) {
+	identity := &ArtifactIdentity{Size: 8, SHA256: testFirmwareSHA256, MD5: testFirmwareMD5}
+	same := notehub.FirmwareInfo{Filename: "app.bin", Length: 8, MD5: testFirmwareMD5}
+	renamed := notehub.FirmwareInfo{Filename: "app-20240101.bin", Length: 8, MD5: strings.ToUpper(testFirmwareMD5)}
+
+	tests := []struct {
+		name     string
+		files    []notehub.FirmwareInfo
+		expected string
+	}{
+		{"none uploaded", nil, ""},
+		{"same name, same content", []notehub.FirmwareInfo{same}, "app.bin"},
+		{"same name preferred", []notehub.FirmwareInfo{renamed, same}, "app.bin"},
+		{"different name, same content", []notehub.FirmwareInfo{renamed}, "app-20240101.bin"},
+		{"different name, sha256 only", []notehub.FirmwareInfo{{Filename: "a.bin", Length: 8, SHA256: testFirmwareSHA256}}, "a.bin"},
+		{"different name, size only", []notehub.FirmwareInfo{{Filename: "a.bin", Length: 8}}, ""},
+		{"different name, different content", []notehub.FirmwareInfo{{Filename: "a.bin", Length: 8, MD5: "0000"}}, ""},
+		{"different name, conflicting digests", []notehub.FirmwareInfo{{Filename: "a.bin", Length: 8, MD5: testFirmwareMD5, SHA256: "0000"}}, ""},
+		{"different size", []notehub.FirmwareInfo{{Filename: "a.bin", Length: 9, MD5: testFirmwareMD5}}, ""},
+		{"same name, different content", []notehub.FirmwareInfo{renamed, {Filename: "app.bin", Length: 8, MD5: "0000"}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := identicalFirmware(&DeploymentConfig{}, tt.files, "app.bin", identity)
+			name := ""
+			if got != nil {
+				name = got.Filename
+			}
+			if name != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, name)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_ReuseIdentical(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+	server.addFirmware("other.bin", []byte("software"))
+	server.addFirmware("app-1.bin", []byte("firmware"))
+	config := server.config(t)
+	config.FirmwareFile = filepath.Join(t.TempDir(), "app-2.bin")
+	if err := os.WriteFile(config.FirmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.ReuseIdentical = true
+
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	for _, query := range server.queries("GET /projects/app:123/firmware?") {
+		if query.Has("filename") {
+			t.Errorf("Expected the whole firmware inventory to be listed, got %v", query)
+		}
+	}
+	if uploads := server.uploaded(); len(uploads) != 0 || !report.UploadSkipped || report.UploadedFilename != "app-1.bin" {
+		t.Errorf("Expected the identical firmware to be reused, got %v, %+v", uploads, report)
+	}
+	if r := report.ReusedFirmware; r == nil || r.Filename != "app-2.bin" || r.ReusedFilename != "app-1.bin" {
+		t.Errorf("Expected both names in the report, got %+v", r)
+	}
+	if dfuBodies := server.bodies("POST /projects/app:123/dfu/host/update"); len(dfuBodies) != 1 || dfuBodies[0] != `{"filename":"app-1.bin"}` {
+		t.Errorf("Expected the DFU to use the reused filename, got %v", dfuBodies)
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "reusing identical firmware app-1.bin instead of app-2.bin") {
+		t.Errorf("Expected the reuse in the summary, got:\n%s", DeploymentSummaryMarkdown(report))
+	}
+}
+
+func TestDeployFirmware_SkipUpload(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"GET /projects/app:123/firmware": respond(fmt.Sprintf(`[{"filename":"v2.bin","length":2048},{"filename":"app-1.2.0.bin","length":4096,"sha256":%q}]`, testFirmwareSHA256)),
+	})
+	sent := func() (uploads int, dfuBodies []string) {
+		return len(server.uploaded()), server.bodies("POST /projects/app:123/dfu/host/update")
+	}
+	deploySkipped := func(filename string, dryRun bool) (*DeploymentReport, error) {
+		return DeployFirmware(context.Background(), &DeploymentConfig{
+			ProjectUID:       "app:123",
+			FirmwareFile:     filename,
+			DeviceUID:        "dev:1",
+			IssueDFU:         true,
+			SkipUpload:       true,
+			CleanupOnFailure: true,
+			DryRun:           dryRun,
+			APIBaseURL:       server.URL,
+			OAuthTokenURL:    server.URL + "/oauth2/token",
+		})
+	}
+
+	report, err := deploySkipped("app-1.2.0.bin", false)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if uploads, dfuBodies := sent(); uploads != 0 || len(dfuBodies) != 1 || dfuBodies[0] != `{"filename":"app-1.2.0.bin"}` {
+		t.Errorf("Expected only a DFU of the uploaded file, got %d upload(s) and DFU(s) %v", uploads, dfuBodies)
+	}
+	if !report.UploadSkipped || report.UploadedFilename != "app-1.2.0.bin" || report.FirmwareSize != 4096 || report.FirmwareSHA256 != testFirmwareSHA256 {
+		t.Errorf("Expected the report to describe the uploaded file, got %+v", report)
+	}
+
+	// A dry run still looks the file up, and issues nothing
+	if _, err := deploySkipped("app-1.2.0.bin", true); err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if uploads, dfuBodies := sent(); uploads != 0 || len(dfuBodies) != 1 {
+		t.Errorf("Expected the dry run to send nothing, got %d upload(s) and %d DFU(s)", uploads, len(dfuBodies))
+	}
+
+	for _, dryRun := range []bool{false, true} {
+		_, err = deploySkipped("app-1.3.0.bin", dryRun)
+		expected := "skip_upload: app-1.3.0.bin is not in the project; its host firmware is: app-1.2.0.bin, v2.bin"
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected %q, got %v", expected, err)
+		}
+	}
+	if uploads, dfuBodies := sent(); uploads != 0 || len(dfuBodies) != 1 {
+		t.Errorf("Expected a missing file to send nothing, got %d upload(s) and %d DFU(s)", uploads, len(dfuBodies))
+	}
+}
@@ -0,0 +1,78 @@
+package deploy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// managedDFUParams maps each DFU query parameter the action sets itself to the input that
+// sets it
+var managedDFUParams = map[string]string{
+	"deviceUID":        "device_uid",
+	"tags":             "tag",
+	"serialNumber":     "serial_number",
+	"fleetUID":         "fleet_uid or fleet_name",
+	"productUID":       "product_uid",
+	"notecardFirmware": "notecard_firmware",
+	"location":         "location",
+	"sku":              "sku",
+}
+
+// ParseExtraDFUParams parses the extra_dfu_params input: newline-separated key=value pairs
+// passed through to the DFU request as query parameters, for Notehub targeting the action
+// does not support yet. Blank lines and the space around keys and values are ignored, and
+// a key may repeat. Keys the action already manages, including those set by deviceQuery,
+// are rejected naming the input to use instead. Keys may not contain '&', '=', '?', '#',
+// whitespace or control characters; values are encoded when the request is built, and
+// only control characters are rejected.
+func ParseExtraDFUParams(value string, deviceQuery url.Values) (url.Values, error) {
+	params := url.Values{}
+	for i, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		key, v, ok := strings.Cut(line, "=")
+		key, v = strings.TrimSpace(key), strings.TrimSpace(v)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("extra_dfu_params line %d: expected key=value, got %q", i+1, line)
+		}
+		if strings.ContainsAny(key, "&=?#") || strings.IndexFunc(key, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0 {
+			return nil, fmt.Errorf("extra_dfu_params line %d: key %q may not contain '&', '=', '?', '#', whitespace or control characters", i+1, key)
+		}
+		if strings.IndexFunc(v, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("extra_dfu_params line %d: value for %q may not contain control characters", i+1, key)
+		}
+		for managed, input := range managedDFUParams {
+			if strings.EqualFold(key, managed) {
+				return nil, fmt.Errorf("extra_dfu_params line %d: %s is set by the action; use %s instead", i+1, key, input)
+			}
+		}
+		for k := range deviceQuery {
+			if strings.EqualFold(key, k) {
+				return nil, fmt.Errorf("extra_dfu_params line %d: %s is already set by device_query_json", i+1, key)
+			}
+		}
+		params.Add(key, v)
+	}
+
+	if len(params) == 0 {
+		return nil, nil
+	}
+	return params, nil
+}
+
+// dfuParams returns the query parameters of a DFU request: the targeting, then any
+// unvalidated extra_dfu_params
+func dfuParams(config *DeploymentConfig) url.Values {
+	params := buildTargetingParams(config)
+	for k, values := range config.ExtraDFUParams {
+		for _, v := range values {
+			params.Add(k, v)
+		}
+	}
+	return params
+}
@@ -0,0 +1,86 @@
+package deploy
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParseExtraDFUParams(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    string
+		expectError string
+	}{
+		{"empty", "", "", ""},
+		{"blank lines", "\n  \n", "", ""},
+		{"pairs", "newFilter=a\n\n  otherFilter = b ", "newFilter=a&otherFilter=b", ""},
+		{"repeated key", "zone=eu\nzone=us", "zone=eu&zone=us", ""},
+		{"value encoded", "q=a&b=c d#e", "q=a%26b%3Dc+d%23e", ""},
+		{"empty value", "flag=", "flag=", ""},
+		{"no separator", "flag", "", "line 1: expected key=value"},
+		{"empty key", "=x", "", "expected key=value"},
+		{"ampersand in key", "a&deviceUID=x", "", "may not contain"},
+		{"query in key", "a?b=x", "", "may not contain"},
+		{"space in key", "a b=x", "", "may not contain"},
+		{"control in key", "a\x00b=x", "", "may not contain"},
+		{"control in value", "a=b\x07", "", "value for \"a\" may not contain control characters"},
+		{"managed key", "x=1\ntags=prod", "", "line 2: tags is set by the action; use tag instead"},
+		{"managed key case", "DeviceUID=dev:1", "", "use device_uid instead"},
+		{"fleet key", "fleetUID=fleet:1", "", "use fleet_uid or fleet_name instead"},
+		{"device query key", "hostFirmware=1.2", "", "hostFirmware is already set by device_query_json"},
+	}
+	deviceQuery := url.Values{"hostFirmware": {"1.0"}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := ParseExtraDFUParams(tt.value, deviceQuery)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := params.Encode(); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_ExtraDFUParams(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": respond(`{"devices":[{"uid":"dev:1"}],"has_more":false}`),
+	})
+	config := server.config(t)
+	config.DeviceUID = ""
+	config.Tag = "prod"
+	config.CountTargets = true
+	config.ExtraDFUParams = url.Values{"newFilter": {"a b"}}
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	for _, r := range server.requests() {
+		if strings.Contains(r, "/dfu/host/update") && r != "POST /projects/app:123/dfu/host/update?newFilter=a+b&tags=prod" {
+			t.Errorf("Expected the extra parameters in the DFU request, got %q", r)
+		}
+		if strings.Contains(r, "/devices") && strings.Contains(r, "newFilter") {
+			t.Errorf("Expected the extra parameters only in the DFU request, got %q", r)
+		}
+	}
+	if dfus := server.count("POST /projects/app:123/dfu/host/update"); dfus != 1 {
+		t.Errorf("Expected one DFU request, got %d", dfus)
+	}
+	if report.TargetingParams != "tags=prod" || report.ExtraDFUParams != "newFilter=a+b" {
+		t.Errorf("Expected the extra parameters recorded apart from the targeting, got %q and %q", report.TargetingParams, report.ExtraDFUParams)
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "| Extra DFU Params (unvalidated) | `newFilter=a+b` |") {
+		t.Errorf("Expected the extra parameters marked unvalidated in the summary, got:\n%s", DeploymentSummaryMarkdown(report))
+	}
+}
@@ -0,0 +1,173 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// defaultFirmwareDir is the directory bare firmware filenames are resolved against
+const defaultFirmwareDir = "./firmware"
+
+// resolveFirmwarePath resolves the firmware_file input to a path on disk. Absolute paths and
+// paths that already contain a separator are used as-is; bare filenames are joined to dir.
+func resolveFirmwarePath(dir, file string) string {
+	if filepath.IsAbs(file) || strings.ContainsAny(file, `/`+string(filepath.Separator)) {
+		return filepath.Clean(file)
+	}
+	if dir == "" {
+		dir = defaultFirmwareDir
+	}
+	return filepath.Join(dir, file)
+}
+
+// checkWithinWorkspace rejects a firmware path that resolves outside workspace, e.g.
+// firmware_dir: ../other-repo, an absolute path elsewhere on the runner, or a symlink out
+// of the checkout, so the action cannot be pointed at files beyond the repository. The
+// path is made absolute and its symlinks followed before it is compared. Without a
+// workspace, only relative paths that climb out of the working directory are rejected.
+func checkWithinWorkspace(workspace, path string) error {
+	outside := fmt.Errorf("firmware path %s resolves outside the workspace; use a path within the repository", path)
+	if workspace == "" {
+		clean := filepath.Clean(path)
+		if !filepath.IsAbs(clean) && escapesDir(clean) {
+			return outside
+		}
+		return nil
+	}
+
+	root, err := resolveExisting(workspace)
+	if err != nil {
+		return fmt.Errorf("failed to resolve the workspace %s: %w", workspace, err)
+	}
+	resolved, err := resolveExisting(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve firmware path %s: %w", path, err)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || escapesDir(rel) {
+		return outside
+	}
+	return nil
+}
+
+// escapesDir reports whether a clean relative path climbs out of the directory it is
+// relative to
+func escapesDir(rel string) bool {
+	return rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolveExisting returns the absolute form of path with the symlinks in it followed. The
+// part of the path that does not exist yet, such as a file still to be globbed, is kept
+// as given after its deepest existing parent is resolved.
+func resolveExisting(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	var missing []string
+	for dir := abs; ; dir = filepath.Dir(dir) {
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return "", err
+		}
+		missing = append([]string{filepath.Base(dir)}, missing...)
+	}
+}
+
+// DefaultMaxFirmwareSize is the largest host firmware image uploaded unless
+// max_firmware_size says otherwise, about as much as the Notecard can stage for a host DFU
+const DefaultMaxFirmwareSize = 1536 * 1024
+
+// smallFirmwareSize is the size below which a firmware image is likely a placeholder
+// rather than a real build
+const smallFirmwareSize = 1024
+
+// checkFirmwareSize rejects an empty firmware image or, when MaxFirmwareSize is positive,
+// a host image larger than it, which a DFU would never finish, and warns about one so
+// small it is likely a placeholder. Notecard firmware is staged by Notehub rather than the
+// Notecard, so it is not held to the limit.
+func checkFirmwareSize(config *DeploymentConfig, path string, size int64) error {
+	maxSize := config.MaxFirmwareSize
+	if notehub.FirmwareTypeOrDefault(config.FirmwareType) != notehub.FirmwareTypeHost {
+		maxSize = 0
+	}
+	switch {
+	case size == 0:
+		return fmt.Errorf("firmware file %s is empty (0 bytes)", path)
+	case maxSize > 0 && size > maxSize:
+		return fmt.Errorf("firmware file %s is %d bytes, over the %d-byte max_firmware_size; the device could not stage it for a DFU", path, size, maxSize)
+	case size < smallFirmwareSize:
+		config.Warnf("Firmware file %s is only %d bytes, which usually means the build uploaded a placeholder", path, size)
+	}
+	return nil
+}
+
+// stableFileInterval is the delay between the two size checks of a stable-file probe
+const stableFileInterval = time.Second
+
+// DefaultStableFileTimeout bounds how long to wait for the firmware file to stop changing
+const DefaultStableFileTimeout = 30 * time.Second
+
+// checkFileReadable verifies the firmware file is a regular file that can be opened for reading
+func checkFileReadable(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("firmware file is not readable: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat firmware file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("firmware file is not a regular file: %s", path)
+	}
+
+	return nil
+}
+
+// waitForStableFile waits until the file's size and modification time are unchanged across
+// two reads taken interval apart, failing if that doesn't happen before timeout expires.
+// This guards against uploading a binary that a previous step is still writing.
+func waitForStableFile(ctx context.Context, config *DeploymentConfig, path string, interval, timeout time.Duration) error {
+	config.logf("Waiting for firmware file to be stable...")
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	prev, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("failed to stat firmware file: %w", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("firmware file %s did not stabilize within %s (last size %d bytes)", path, timeout, prev.Size())
+		case <-time.After(interval):
+		}
+
+		cur, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat firmware file: %w", err)
+		}
+
+		if cur.Size() == prev.Size() && cur.ModTime().Equal(prev.ModTime()) {
+			config.logf("✅ Firmware file is stable at %d bytes", cur.Size())
+			return nil
+		}
+
+		config.logf("  - File still changing (%d -> %d bytes)", prev.Size(), cur.Size())
+		prev = cur
+	}
+}
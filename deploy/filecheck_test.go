@@ -0,0 +1,245 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveFirmwarePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		dir      string
+		file     string
+		expected string
+	}{
+		{
+			name:     "bare filename uses default directory",
+			dir:      "",
+			file:     "app.bin",
+			expected: filepath.Join("firmware", "app.bin"),
+		},
+		{
+			name:     "bare filename uses custom directory",
+			dir:      "build/output",
+			file:     "app.bin",
+			expected: filepath.Join("build", "output", "app.bin"),
+		},
+		{
+			name:     "relative path is used as-is",
+			dir:      "./firmware",
+			file:     "build/output/app.bin",
+			expected: filepath.Join("build", "output", "app.bin"),
+		},
+		{
+			name:     "nested relative path is cleaned",
+			dir:      "./firmware",
+			file:     "./artifacts/rev-a/../rev-b/app.bin",
+			expected: filepath.Join("artifacts", "rev-b", "app.bin"),
+		},
+		{
+			name:     "absolute path is used as-is",
+			dir:      "./firmware",
+			file:     "/tmp/artifacts/app.bin",
+			expected: "/tmp/artifacts/app.bin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveFirmwarePath(tt.dir, tt.file); got != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestCheckWithinWorkspace_NoWorkspace(t *testing.T) {
+	tests := []struct {
+		name        string
+		dir         string
+		file        string
+		expectError bool
+	}{
+		{name: "bare filename joined to directory", dir: "build/output", file: "app.bin"},
+		{name: "absolute path bypasses the directory", dir: "./firmware", file: "/opt/artifacts/app.bin"},
+		{name: "dot-dot that stays inside", dir: "./firmware", file: "build/../firmware/app.bin"},
+		{name: "file climbs out", dir: "./firmware", file: "../secrets/app.bin", expectError: true},
+		{name: "directory climbs out", dir: "../other-repo/firmware", file: "app.bin", expectError: true},
+		{name: "directory cleans to parent", dir: "firmware/../..", file: "app.bin", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWithinWorkspace("", resolveFirmwarePath(tt.dir, tt.file))
+			if tt.expectError && (err == nil || !strings.Contains(err.Error(), "outside the workspace")) {
+				t.Errorf("Expected traversal to be rejected, got %v", err)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckWithinWorkspace(t *testing.T) {
+	workspace := t.TempDir()
+	outside := t.TempDir()
+	for _, dir := range []string{filepath.Join(workspace, "firmware"), filepath.Join(workspace, "other")} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []string{filepath.Join(workspace, "firmware", "app.bin"), filepath.Join(outside, "secret.bin")} {
+		if err := os.WriteFile(f, []byte("firmware"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		filepath.Join(workspace, "firmware", "escape.bin"): filepath.Join(outside, "secret.bin"),
+		filepath.Join(workspace, "firmware", "outdir"):     outside,
+		filepath.Join(workspace, "firmware", "inside.bin"): filepath.Join(workspace, "firmware", "app.bin"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Skipf("Symlinks are not supported here: %v", err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(workspace); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	tests := []struct {
+		name        string
+		path        string
+		expectError bool
+	}{
+		{name: "relative path inside", path: "firmware/app.bin"},
+		{name: "absolute path inside", path: filepath.Join(workspace, "firmware", "app.bin")},
+		{name: "file not created yet", path: "firmware/build/app.bin"},
+		{name: "glob pattern inside", path: "firmware/*.bin"},
+		{name: "dot-dot that stays inside", path: "other/../firmware/app.bin"},
+		{name: "symlink within the workspace", path: "firmware/inside.bin"},
+		{name: "absolute path outside", path: filepath.Join(outside, "secret.bin"), expectError: true},
+		{name: "dot-dot out of the workspace", path: "../" + filepath.Base(outside) + "/secret.bin", expectError: true},
+		{name: "symlinked file escapes", path: "firmware/escape.bin", expectError: true},
+		{name: "symlinked directory escapes", path: "firmware/outdir/secret.bin", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkWithinWorkspace(workspace, tt.path)
+			if tt.expectError && (err == nil || !strings.Contains(err.Error(), "outside the workspace")) {
+				t.Errorf("Expected %s to be rejected, got %v", tt.path, err)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestCheckFileReadable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "firmware.bin")
+	if err := os.WriteFile(path, []byte("firmware"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := checkFileReadable(path); err != nil {
+		t.Errorf("Expected file to be readable, got: %v", err)
+	}
+
+	if err := checkFileReadable(dir); err == nil {
+		t.Error("Expected directory to be rejected")
+	}
+
+	if err := checkFileReadable(filepath.Join(dir, "missing.bin")); err == nil {
+		t.Error("Expected missing file to be rejected")
+	}
+}
+
+func TestCheckFirmwareSize(t *testing.T) {
+	tests := []struct {
+		name          string
+		firmwareType  string
+		size          int64
+		maxSize       int64
+		expectError   string
+		expectWarning bool
+	}{
+		{"empty", "", 0, DefaultMaxFirmwareSize, "is empty (0 bytes)", false},
+		{"placeholder", "", 8, DefaultMaxFirmwareSize, "", true},
+		{"typical", "", 200 * 1024, DefaultMaxFirmwareSize, "", false},
+		{"at default limit", "host", DefaultMaxFirmwareSize, DefaultMaxFirmwareSize, "", false},
+		{"over default limit", "host", DefaultMaxFirmwareSize + 1, DefaultMaxFirmwareSize, "is 1572865 bytes, over the 1572864-byte max_firmware_size", false},
+		{"over configured limit", "", 4096, 2048, "is 4096 bytes, over the 2048-byte max_firmware_size", false},
+		{"configured limit above default", "host", 2 * 1024 * 1024, 4 * 1024 * 1024, "", false},
+		{"zero opts out", "host", 64 * 1024 * 1024, 0, "", false},
+		{"notecard not limited", "notecard", DefaultMaxFirmwareSize + 1, DefaultMaxFirmwareSize, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &DeploymentConfig{FirmwareType: tt.firmwareType, MaxFirmwareSize: tt.maxSize}
+			l := useRecordingLogger(config)
+			err := checkFirmwareSize(config, "app.bin", tt.size)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+			} else if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if warned := len(l.warnings) > 0; warned != tt.expectWarning {
+				t.Errorf("Expected warning %v, got %v", tt.expectWarning, l.warnings)
+			}
+		})
+	}
+}
+
+func TestWaitForStableFile_Stable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firmware.bin")
+	if err := os.WriteFile(path, []byte("firmware"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := waitForStableFile(context.Background(), &DeploymentConfig{}, path, 20*time.Millisecond, time.Second); err != nil {
+		t.Errorf("Expected stable file to pass, got: %v", err)
+	}
+}
+
+func TestWaitForStableFile_NeverStabilizes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "firmware.bin")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	defer f.Close()
+
+	// Keep appending to the file while the check runs
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-time.After(5 * time.Millisecond):
+				f.Write([]byte("more data"))
+			}
+		}
+	}()
+
+	err = waitForStableFile(context.Background(), &DeploymentConfig{}, path, 30*time.Millisecond, 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "did not stabilize") {
+		t.Errorf("Expected stabilization failure, got: %v", err)
+	}
+}
@@ -0,0 +1,20 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// ParseFirmwareType validates the firmware_type input
+func ParseFirmwareType(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", notehub.FirmwareTypeHost:
+		return notehub.FirmwareTypeHost, nil
+	case notehub.FirmwareTypeNotecard:
+		return notehub.FirmwareTypeNotecard, nil
+	default:
+		return "", fmt.Errorf("invalid firmware_type %q (accepted values: %s, %s)", value, notehub.FirmwareTypeHost, notehub.FirmwareTypeNotecard)
+	}
+}
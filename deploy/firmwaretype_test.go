@@ -0,0 +1,19 @@
+package deploy
+
+import (
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestParseFirmwareType(t *testing.T) {
+	for input, expected := range map[string]string{"": notehub.FirmwareTypeHost, "host": notehub.FirmwareTypeHost, "Notecard": notehub.FirmwareTypeNotecard} {
+		got, err := ParseFirmwareType(input)
+		if err != nil || got != expected {
+			t.Errorf("parseFirmwareType(%q) = %q, %v; expected %q", input, got, err, expected)
+		}
+	}
+	if _, err := ParseFirmwareType("modem"); err == nil {
+		t.Error("Expected error for unknown firmware_type")
+	}
+}
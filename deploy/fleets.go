@@ -0,0 +1,67 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// resolveFleetName returns the UID of the project's fleet named config.FleetName, matched
+// exactly but ignoring case. No match, or several, fails with the fleet names that do exist.
+func resolveFleetName(ctx context.Context, client *notehub.Client, config *DeploymentConfig) (string, error) {
+	projectUID, name := config.ProjectUID, config.FleetName
+	fleets, err := client.ListFleets(ctx, projectUID)
+	if err != nil {
+		return "", err
+	}
+
+	var matches []notehub.Fleet
+	names := make([]string, 0, len(fleets))
+	for _, f := range fleets {
+		names = append(names, f.Label)
+		if strings.EqualFold(f.Label, name) {
+			matches = append(matches, f)
+		}
+	}
+	sort.Strings(names)
+
+	switch len(matches) {
+	case 1:
+		config.logf("Resolved fleet %q to %s", name, matches[0].UID)
+		return matches[0].UID, nil
+	case 0:
+		if len(names) == 0 {
+			return "", fmt.Errorf("no fleet named %q: project %s has no fleets", name, projectUID)
+		}
+		return "", fmt.Errorf("no fleet named %q in project %s; available fleets: %s", name, projectUID, strings.Join(names, ", "))
+	default:
+		uids := make([]string, 0, len(matches))
+		for _, f := range matches {
+			uids = append(uids, fmt.Sprintf("%s (%s)", f.Label, f.UID))
+		}
+		return "", fmt.Errorf("fleet name %q is ambiguous in project %s, matching %s; set fleet_uid instead", name, projectUID, strings.Join(uids, ", "))
+	}
+}
+
+// applyFleetName resolves config.FleetName, returning a copy of config that targets the
+// fleet by its UID. A config without a fleet name is returned as-is.
+func applyFleetName(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport) (*DeploymentConfig, error) {
+	if config.FleetName == "" {
+		return config, nil
+	}
+	report.startPhase("resolve_fleet")
+	fleetUID, err := resolveFleetName(ctx, client, config)
+	if err != nil {
+		return config, fmt.Errorf("fleet resolution failed: %w", err)
+	}
+	report.endPhase()
+	report.ResolvedFleetUID = fleetUID
+
+	resolved := *config
+	resolved.FleetUID = fleetUID
+	resolved.FleetName = ""
+	return &resolved, nil
+}
@@ -0,0 +1,77 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// newFleetServer serves fleetsJSON as the project's fleets, alongside the endpoints a
+// deployment needs
+func newFleetServer(t *testing.T, fleetsJSON string) *fakeNotehub {
+	t.Helper()
+	return newFakeNotehub(t, fakeRoutes{"/projects/app:123/fleets": respond(fleetsJSON)})
+}
+
+func TestResolveFleetName(t *testing.T) {
+	const fleets = `{"fleets":[{"uid":"fleet:1","label":"Staging"},{"uid":"fleet:2","label":"Production"},{"uid":"fleet:3","label":"Lab"},{"uid":"fleet:4","label":"lab"}]}`
+
+	tests := []struct {
+		name        string
+		fleets      string
+		fleetName   string
+		expected    string
+		expectError string
+	}{
+		{name: "exact match", fleets: fleets, fleetName: "Production", expected: "fleet:2"},
+		{name: "case-insensitive match", fleets: fleets, fleetName: "staging", expected: "fleet:1"},
+		{name: "no partial match", fleets: fleets, fleetName: "Prod", expectError: `no fleet named "Prod" in project app:123; available fleets: Lab, Production, Staging, lab`},
+		{name: "ambiguous", fleets: fleets, fleetName: "LAB", expectError: `fleet name "LAB" is ambiguous in project app:123, matching Lab (fleet:3), lab (fleet:4)`},
+		{name: "no fleets", fleets: `{"fleets":[]}`, fleetName: "Production", expectError: "project app:123 has no fleets"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newFleetServer(t, tt.fleets).URL)
+
+			uid, err := resolveFleetName(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", FleetName: tt.fleetName})
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil || uid != tt.expected {
+				t.Errorf("Expected %s, got %q, %v", tt.expected, uid, err)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_FleetName(t *testing.T) {
+	server := newFleetServer(t, `{"fleets":[{"uid":"fleet:1","label":"Staging"},{"uid":"fleet:2","label":"Production"}]}`)
+	config := server.config(t)
+	config.DeviceUID = ""
+	config.FleetName = "production"
+
+	// A fleet name is targeting, even before it is resolved
+	if err := checkProjectWideDFU(config); err != nil {
+		t.Errorf("Expected fleet_name to count as targeting, got %v", err)
+	}
+
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if dfus := server.queries("POST /projects/app:123/dfu/host/update"); len(dfus) != 1 || dfus[0].Encode() != "fleetUID=fleet%3A2" {
+		t.Errorf("Expected the DFU to target the resolved fleet, got %v", dfus)
+	}
+	if outputs := report.Outputs(); outputs["resolved_fleet_uid"] != "fleet:2" {
+		t.Errorf("Expected the resolved_fleet_uid output, got %q", outputs["resolved_fleet_uid"])
+	}
+
+	config.FleetName = "Prod"
+	if _, err := DeployFirmware(context.Background(), config); err == nil || !strings.Contains(err.Error(), "available fleets: Production, Staging") {
+		t.Errorf("Expected an unknown fleet name to fail listing the fleets, got %v", err)
+	}
+}
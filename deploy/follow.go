@@ -0,0 +1,177 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+const (
+	// DefaultFollowTimeout bounds how long follow watches the device's DFU
+	DefaultFollowTimeout = 15 * time.Minute
+
+	// DefaultFollowInterval is the delay between DFU status polls while following, short
+	// enough for near-real-time progress in the developer loop
+	DefaultFollowInterval = 5 * time.Second
+)
+
+// followEventFiles are the notefiles whose events are printed while following a DFU, in
+// addition to any whose name mentions dfu
+var followEventFiles = []string{"_health.qo", "_log.qo", "_session.qo"}
+
+// DFUStage records how long a followed device spent in one DFU state
+type DFUStage struct {
+	Status    string `json:"status"`
+	ElapsedMs int64  `json:"elapsed_ms"`
+}
+
+// dfuStateLabel describes a DFU state for the follow log, e.g. "downloading 40%"
+func dfuStateLabel(s notehub.DeviceDFUState) string {
+	label := s.Status
+	if s.Percent > 0 && !s.Terminal() {
+		label += fmt.Sprintf(" %d%%", s.Percent)
+	}
+	if s.Description != "" {
+		label += " (" + s.Description + ")"
+	}
+	return label
+}
+
+// dfuFollower prints a single device's DFU state transitions as they are observed and
+// times each stage
+type dfuFollower struct {
+	config     *DeploymentConfig
+	deviceUID  string
+	last       *notehub.DeviceDFUState
+	stageStart time.Time
+	stages     []DFUStage
+}
+
+// observe prints s when the device's state or download progress changed since the last
+// poll, closing the previous stage when the state changed
+func (f *dfuFollower) observe(s notehub.DeviceDFUState, now time.Time) {
+	switch {
+	case f.last == nil:
+		f.config.logf("  - %s: %s", f.deviceUID, dfuStateLabel(s))
+		f.stageStart = now
+	case s.Status != f.last.Status:
+		f.stages = append(f.stages, DFUStage{Status: f.last.Status, ElapsedMs: now.Sub(f.stageStart).Milliseconds()})
+		f.config.logf("  - %s: %s → %s", f.deviceUID, f.last.Status, dfuStateLabel(s))
+		f.stageStart = now
+	case s.Percent != f.last.Percent || s.Description != f.last.Description:
+		f.config.logf("  - %s: %s", f.deviceUID, dfuStateLabel(s))
+	default:
+		return
+	}
+	f.last = &s
+}
+
+// finish closes the current stage at now, unless the device already reached a final state
+func (f *dfuFollower) finish(now time.Time) {
+	if f.last != nil && !f.last.Terminal() {
+		f.stages = append(f.stages, DFUStage{Status: f.last.Status, ElapsedMs: now.Sub(f.stageStart).Milliseconds()})
+	}
+}
+
+// relevantFollowEvent reports whether an event is worth printing while following a DFU
+func relevantFollowEvent(e notehub.Event) bool {
+	for _, file := range followEventFiles {
+		if e.File == file {
+			return true
+		}
+	}
+	return strings.Contains(strings.ToLower(e.File), "dfu")
+}
+
+// followDeviceDFU polls the DFU status of the single device in config.DeviceUID until it
+// completes or fails, or timeout expires, printing each state transition and the device's
+// relevant events when they can be read. It returns the last state seen, which is nil if
+// the device never appeared, and the time spent in each stage.
+func followDeviceDFU(ctx context.Context, client *notehub.Client, config *DeploymentConfig, timeout, interval time.Duration) (*notehub.DeviceDFUState, []DFUStage, error) {
+	deviceUID := strings.Join(SplitTags(config.DeviceUID), ",")
+	config.logf("Following the DFU of %s for up to %s...", deviceUID, timeout)
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	filters := url.Values{"deviceUID": {deviceUID}}
+	follower := &dfuFollower{config: config, deviceUID: deviceUID}
+
+	readEvents := true
+	since := start.Unix()
+	seenEvents := map[string]bool{}
+
+	for {
+		states, err := client.GetDFUStatus(ctx, config.ProjectUID, config.FirmwareType, filters)
+		if err != nil {
+			return follower.last, follower.stages, err
+		}
+		now := time.Now()
+		for _, s := range states {
+			if s.DeviceUID == deviceUID {
+				follower.observe(s, now)
+			}
+		}
+
+		if readEvents {
+			events, err := client.GetDeviceEvents(ctx, config.ProjectUID, deviceUID, since)
+			switch {
+			case errors.Is(err, notehub.ErrEventsUnsupported):
+				config.logf("  - Device events are not available; following DFU status only")
+				readEvents = false
+			case err != nil:
+				config.Warnf("Failed to read device events, following DFU status only: %v", err)
+				readEvents = false
+			}
+			for _, e := range events {
+				if seenEvents[e.UID] {
+					continue
+				}
+				seenEvents[e.UID] = true
+				if e.When > since {
+					since = e.When
+				}
+				if relevantFollowEvent(e) {
+					config.logf("    %s event: %s", e.File, e.Body)
+				}
+			}
+		}
+
+		if follower.last != nil && follower.last.Terminal() {
+			logFollowSummary(follower, time.Since(start))
+			return follower.last, follower.stages, nil
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			follower.finish(time.Now())
+			logFollowSummary(follower, time.Since(start))
+			state := "not yet reported"
+			if follower.last != nil {
+				state = follower.last.Status
+			}
+			return follower.last, follower.stages, fmt.Errorf("follow_timeout of %s expired with %s %s", timeout, deviceUID, state)
+		}
+
+		select {
+		case <-ctx.Done():
+			return follower.last, follower.stages, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// logFollowSummary prints the followed device's final state and the time spent in each stage
+func logFollowSummary(f *dfuFollower, elapsed time.Duration) {
+	final := "not yet reported"
+	if f.last != nil {
+		final = dfuStateLabel(*f.last)
+	}
+	f.config.logf("DFU of %s: %s after %s", f.deviceUID, final, elapsed.Round(time.Second))
+	for _, stage := range f.stages {
+		f.config.logf("  - %s: %s", stage.Status, (time.Duration(stage.ElapsedMs) * time.Millisecond).Round(time.Second))
+	}
+}
@@ -0,0 +1,135 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// newFollowServer fakes a DFU status endpoint that reports the next state in sequence on
+// each poll, repeating the last one, and an events endpoint answering with eventsStatus
+func newFollowServer(t *testing.T, sequence []string, eventsStatus int, events string) *fakeNotehub {
+	t.Helper()
+	var states []string
+	for _, state := range sequence {
+		states = append(states, `{"devices":[`+state+`]}`)
+	}
+	status := respondInTurn(states...)
+	return newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/status": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("deviceUID") != "dev:1" {
+				t.Errorf("Expected the status to be filtered to dev:1, got %s", r.URL.RawQuery)
+			}
+			status(w, r)
+		},
+		"/projects/app:123/events": respondStatus(eventsStatus, events),
+	})
+}
+
+// captureLog redirects the log to a buffer for the rest of the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &logs
+}
+
+func TestFollowDeviceDFU_PrintsTransitions(t *testing.T) {
+	server := newFollowServer(t, []string{
+		`{"device_uid":"dev:1","status":"queued"}`,
+		`{"device_uid":"dev:1","status":"queued"}`,
+		`{"device_uid":"dev:1","status":"downloading","percent":10}`,
+		`{"device_uid":"dev:1","status":"downloading","percent":60}`,
+		`{"device_uid":"dev:1","status":"applying"}`,
+		`{"device_uid":"dev:1","status":"completed"}`,
+	}, http.StatusOK, `{"events":[{"event":"e1","file":"_health.qo","body":{"text":"dfu started"}},{"event":"e2","file":"data.qo","body":{"temp":21}}]}`)
+	logs := captureLog(t)
+
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1"}
+	state, stages, err := followDeviceDFU(context.Background(), newTestClient(server.URL), config, time.Minute, time.Millisecond)
+	if err != nil {
+		t.Fatalf("followDeviceDFU failed: %v", err)
+	}
+	if state == nil || state.Status != notehub.DFUStateCompleted {
+		t.Errorf("Expected the device to complete, got %+v", state)
+	}
+
+	var statuses []string
+	for _, stage := range stages {
+		statuses = append(statuses, stage.Status)
+	}
+	if strings.Join(statuses, ",") != "queued,downloading,applying" {
+		t.Errorf("Expected a stage per non-final state, got %v", statuses)
+	}
+
+	expected := []string{
+		"dev:1: queued\n",
+		"dev:1: queued → downloading 10%\n",
+		"dev:1: downloading 60%\n",
+		"dev:1: downloading → applying\n",
+		"dev:1: applying → completed\n",
+	}
+	output := logs.String()
+	last := 0
+	for _, line := range expected {
+		i := strings.Index(output[last:], line)
+		if i < 0 {
+			t.Fatalf("Expected %q after position %d in log:\n%s", line, last, output)
+		}
+		last += i + len(line)
+	}
+	if strings.Count(output, "dev:1: queued\n") != 1 {
+		t.Errorf("Expected an unchanged state to be printed once:\n%s", output)
+	}
+	if !strings.Contains(output, `_health.qo event: {"text":"dfu started"}`) || strings.Contains(output, "data.qo") {
+		t.Errorf("Expected only the relevant event to be printed, once:\n%s", output)
+	}
+	if strings.Count(output, "_health.qo event") != 1 {
+		t.Errorf("Expected each event to be printed once:\n%s", output)
+	}
+}
+
+func TestFollowDeviceDFU_EventsUnavailable(t *testing.T) {
+	server := newFollowServer(t, []string{
+		`{"device_uid":"dev:1","status":"downloading"}`,
+		`{"device_uid":"dev:1","status":"error","description":"image rejected"}`,
+	}, http.StatusForbidden, `{"err":"forbidden"}`)
+	logs := captureLog(t)
+
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1"}
+	state, _, err := followDeviceDFU(context.Background(), newTestClient(server.URL), config, time.Minute, time.Millisecond)
+	if err != nil {
+		t.Fatalf("followDeviceDFU failed: %v", err)
+	}
+	if state.Status != notehub.DFUStateError {
+		t.Errorf("Expected the device to fail, got %+v", state)
+	}
+	if strings.Count(logs.String(), "Device events are not available") != 1 {
+		t.Errorf("Expected events to be given up on once:\n%s", logs.String())
+	}
+	if !strings.Contains(logs.String(), "downloading → error (image rejected)") {
+		t.Errorf("Expected the failure and its description:\n%s", logs.String())
+	}
+}
+
+func TestFollowDeviceDFU_Timeout(t *testing.T) {
+	server := newFollowServer(t, []string{`{"device_uid":"dev:1","status":"downloading","percent":5}`}, http.StatusNotFound, "")
+	captureLog(t)
+
+	config := &DeploymentConfig{ProjectUID: "app:123", DeviceUID: "dev:1"}
+	state, stages, err := followDeviceDFU(context.Background(), newTestClient(server.URL), config, 20*time.Millisecond, 5*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "follow_timeout") || !strings.Contains(err.Error(), "downloading") {
+		t.Fatalf("Expected a follow_timeout error naming the state, got %v", err)
+	}
+	if state == nil || len(stages) != 1 || stages[0].Status != "downloading" {
+		t.Errorf("Expected the unfinished stage to be timed, got %+v, %+v", state, stages)
+	}
+}
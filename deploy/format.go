@@ -0,0 +1,120 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultAllowedExtensions are the firmware file extensions accepted by default
+const DefaultAllowedExtensions = ".bin,.hex"
+
+// ParseAllowedExtensions parses the comma-separated allowed_extensions input into lower-case
+// extensions with a leading dot
+func ParseAllowedExtensions(value string) ([]string, error) {
+	var exts []string
+	for _, ext := range SplitTags(value) {
+		ext = strings.ToLower(ext)
+		if !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		if ext == "." || strings.ContainsAny(ext[1:], `./\`) {
+			return nil, fmt.Errorf("invalid allowed_extensions entry %q: must be an extension such as .bin", ext)
+		}
+		exts = append(exts, ext)
+	}
+	if len(exts) == 0 {
+		return nil, fmt.Errorf("allowed_extensions is empty; set skip_format_check: true to accept any file")
+	}
+	return exts, nil
+}
+
+// archiveSignatures are the leading bytes of formats that are never firmware images but are
+// easily uploaded by mistake, such as a build artifact that was never unpacked
+var archiveSignatures = []struct {
+	name  string
+	magic []byte
+}{
+	{"zip archive", []byte("PK\x03\x04")},
+	{"gzip archive", []byte{0x1f, 0x8b}},
+	{"7z archive", []byte("7z\xbc\xaf\x27\x1c")},
+	{"ELF executable", []byte("\x7fELF")},
+	{"PDF document", []byte("%PDF")},
+}
+
+// signatureBytes is how much of the firmware file is read to check its signature
+const signatureBytes = 512
+
+// checkFirmwareFormat rejects a firmware file whose extension is not allowed and, with
+// checkMagic, whose first bytes do not look like firmware of that type: an Intel HEX record
+// for .hex, and for .bin an ESP image header or a Cortex-M vector table. Other extensions
+// are only checked against archiveSignatures.
+func checkFirmwareFormat(path string, allowedExtensions []string, checkMagic bool) error {
+	ext := strings.ToLower(filepath.Ext(path))
+	if len(allowedExtensions) > 0 {
+		allowed := false
+		for _, a := range allowedExtensions {
+			if ext == a {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("firmware file %s has extension %q, which is not in allowed_extensions (%s); set allowed_extensions or skip_format_check: true for other formats",
+				filepath.Base(path), ext, strings.Join(allowedExtensions, ","))
+		}
+	}
+	if !checkMagic {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open firmware file for signature check: %w", err)
+	}
+	defer f.Close()
+	head := make([]byte, signatureBytes)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return fmt.Errorf("failed to read firmware file signature: %w", err)
+	}
+	head = head[:n]
+
+	for _, sig := range archiveSignatures {
+		if bytes.HasPrefix(head, sig.magic) {
+			return fmt.Errorf("firmware file %s is a %s, not a firmware image", filepath.Base(path), sig.name)
+		}
+	}
+
+	switch ext {
+	case ".hex":
+		if trimmed := bytes.TrimLeft(head, " \t\r\n\ufeff"); len(trimmed) == 0 || trimmed[0] != ':' {
+			return fmt.Errorf("firmware file %s does not start with an Intel HEX record", filepath.Base(path))
+		}
+	case ".bin":
+		if !isESPImage(head) && !isCortexMVectorTable(head) {
+			return fmt.Errorf("firmware file %s does not start with a recognized firmware signature (an ESP image header or a Cortex-M vector table); set check_magic: false for other formats", filepath.Base(path))
+		}
+	}
+	return nil
+}
+
+// isESPImage reports whether head starts with an Espressif application image header
+func isESPImage(head []byte) bool {
+	return len(head) >= 8 && head[0] == 0xe9
+}
+
+// isCortexMVectorTable reports whether head starts with a Cortex-M vector table: an initial
+// stack pointer that is word aligned and in a RAM region, then a Thumb reset handler address
+func isCortexMVectorTable(head []byte) bool {
+	if len(head) < 8 {
+		return false
+	}
+	sp := binary.LittleEndian.Uint32(head[0:4])
+	reset := binary.LittleEndian.Uint32(head[4:8])
+	return sp%4 == 0 && sp >= 0x10000000 && sp < 0x40000000 && reset&1 == 1 && reset < 0x20000000
+}
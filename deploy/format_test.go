@@ -0,0 +1,94 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseAllowedExtensions(t *testing.T) {
+	exts, err := ParseAllowedExtensions(" .BIN, hex ,.uf2")
+	if err != nil || !reflect.DeepEqual(exts, []string{".bin", ".hex", ".uf2"}) {
+		t.Errorf("Expected normalized extensions, got %v, %v", exts, err)
+	}
+	for _, value := range []string{"", " , ", ".", ".tar.gz", "../bin"} {
+		if _, err := ParseAllowedExtensions(value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestCheckFirmwareFormat(t *testing.T) {
+	cortexM := []byte{0x00, 0x80, 0x00, 0x20, 0xc1, 0x01, 0x00, 0x08, 0, 0, 0, 0}
+	espImage := []byte{0xe9, 0x05, 0x02, 0x20, 0x00, 0x00, 0x00, 0x00}
+
+	tests := []struct {
+		name        string
+		filename    string
+		content     []byte
+		checkMagic  bool
+		expectError string
+	}{
+		{"allowed extension", "app.bin", []byte("firmware"), false, ""},
+		{"extension case ignored", "APP.HEX", []byte("firmware"), false, ""},
+		{"disallowed extension", "app.zip", []byte("PK\x03\x04"), false, `extension ".zip", which is not in allowed_extensions`},
+		{"no extension", "app", cortexM, true, `extension ""`},
+		{"cortex-m vector table", "app.bin", cortexM, true, ""},
+		{"esp image", "app.bin", espImage, true, ""},
+		{"zip renamed to bin", "app.bin", []byte("PK\x03\x04rest"), true, "is a zip archive"},
+		{"elf renamed to bin", "app.bin", []byte("\x7fELF\x01\x01"), true, "is a ELF executable"},
+		{"unrecognized bin", "app.bin", []byte("firmware"), true, "does not start with a recognized firmware signature"},
+		{"short bin", "app.bin", []byte{0xe9}, true, "does not start with a recognized firmware signature"},
+		{"intel hex", "app.hex", []byte("\r\n:020000040800F2\n"), true, ""},
+		{"not intel hex", "app.hex", []byte("hello"), true, "does not start with an Intel HEX record"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.filename)
+			if err := os.WriteFile(path, tt.content, 0644); err != nil {
+				t.Fatal(err)
+			}
+			err := checkFirmwareFormat(path, []string{".bin", ".hex"}, tt.checkMagic)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_RejectsWrongFormatBeforeUpload(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+	firmwareFile := filepath.Join(t.TempDir(), "app.zip")
+	if err := os.WriteFile(firmwareFile, []byte("PK\x03\x04zip"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config := &DeploymentConfig{
+		ProjectUID:        "app:123",
+		FirmwareFile:      firmwareFile,
+		APIBaseURL:        server.URL,
+		OAuthTokenURL:     server.URL + "/oauth2/token",
+		AllowedExtensions: []string{".bin", ".hex"},
+	}
+
+	if _, err := DeployFirmware(context.Background(), config); err == nil || !strings.Contains(err.Error(), "allowed_extensions") {
+		t.Fatalf("Expected the .zip to be rejected, got %v", err)
+	}
+	if uploads := server.uploaded(); len(uploads) != 0 {
+		t.Errorf("The rejected file must not be uploaded, got %v", uploads)
+	}
+
+	// The override uploads it anyway
+	config.SkipFormatCheck = true
+	if _, err := DeployFirmware(context.Background(), config); err != nil || len(server.uploaded()) != 1 {
+		t.Errorf("Expected skip_format_check to allow the upload, got %v, %v", server.uploaded(), err)
+	}
+}
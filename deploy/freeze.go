@@ -0,0 +1,124 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// FrozenTargets is the resolved device set recorded by freeze_targets so that a re-run
+// can deploy to exactly the same devices
+type FrozenTargets struct {
+	DeviceUIDs     []string  `json:"device_uids"`
+	FirmwareSHA256 string    `json:"firmware_sha256"`
+	FrozenAt       time.Time `json:"frozen_at"`
+}
+
+// TargetDrift lists the differences between a frozen device set and the devices the
+// targeting inputs resolve to now
+type TargetDrift struct {
+	Added   []string `json:"added,omitempty"`
+	Removed []string `json:"removed,omitempty"`
+}
+
+// HasDrift reports whether the device sets differ
+func (d *TargetDrift) HasDrift() bool {
+	return len(d.Added) > 0 || len(d.Removed) > 0
+}
+
+// freezeTargets records the resolved devices and firmware checksum
+func freezeTargets(devices []notehub.Device, firmwareSHA256 string) *FrozenTargets {
+	uids := make([]string, 0, len(devices))
+	for _, d := range devices {
+		uids = append(uids, d.UID)
+	}
+	sort.Strings(uids)
+
+	return &FrozenTargets{
+		DeviceUIDs:     uids,
+		FirmwareSHA256: firmwareSHA256,
+		FrozenAt:       time.Now().UTC().Truncate(time.Second),
+	}
+}
+
+// loadFrozenTargets reads the frozen device set from a previous run's report
+func loadFrozenTargets(path string) (*FrozenTargets, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read resume_from_report: %w", err)
+	}
+
+	var previous DeploymentReport
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return nil, fmt.Errorf("failed to parse resume_from_report %s: %w", path, err)
+	}
+	if previous.FrozenTargets == nil || len(previous.FrozenTargets.DeviceUIDs) == 0 {
+		return nil, fmt.Errorf("report %s has no frozen targets (was it written with freeze_targets: true?)", path)
+	}
+
+	return previous.FrozenTargets, nil
+}
+
+// computeTargetDrift compares a frozen device set against freshly resolved devices
+func computeTargetDrift(frozen []string, fresh []notehub.Device) *TargetDrift {
+	frozenSet := make(map[string]bool, len(frozen))
+	for _, uid := range frozen {
+		frozenSet[uid] = true
+	}
+	freshSet := make(map[string]bool, len(fresh))
+	for _, d := range fresh {
+		freshSet[d.UID] = true
+	}
+
+	drift := &TargetDrift{}
+	for uid := range freshSet {
+		if !frozenSet[uid] {
+			drift.Added = append(drift.Added, uid)
+		}
+	}
+	for uid := range frozenSet {
+		if !freshSet[uid] {
+			drift.Removed = append(drift.Removed, uid)
+		}
+	}
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Removed)
+
+	return drift
+}
+
+// checkTargetDrift re-resolves the targeting inputs and reports how the project has drifted
+// from the frozen device set. The frozen set is still used; drift only produces warnings.
+func checkTargetDrift(ctx context.Context, client *notehub.Client, config *DeploymentConfig, frozen *FrozenTargets) *TargetDrift {
+	fresh, err := client.ListDevices(ctx, config.ProjectUID, buildTargetingParams(config))
+	if err != nil {
+		config.Warnf("Could not re-resolve targets to check for drift: %v", err)
+		return nil
+	}
+
+	drift := computeTargetDrift(frozen.DeviceUIDs, fresh)
+	if drift.HasDrift() {
+		config.Warnf("Targets have drifted since they were frozen at %s: %d device(s) added (%s), %d removed (%s); deploying to the frozen set",
+			frozen.FrozenAt.Format(time.RFC3339), len(drift.Added), strings.Join(drift.Added, ", "),
+			len(drift.Removed), strings.Join(drift.Removed, ", "))
+	} else {
+		config.logf("✅ Frozen targets match the current targeting (%d device(s))", len(frozen.DeviceUIDs))
+	}
+
+	return drift
+}
+
+// frozenDevices converts frozen device UIDs to devices for explicit targeting
+func frozenDevices(frozen *FrozenTargets) []notehub.Device {
+	devices := make([]notehub.Device, 0, len(frozen.DeviceUIDs))
+	for _, uid := range frozen.DeviceUIDs {
+		devices = append(devices, notehub.Device{UID: uid})
+	}
+	return devices
+}
@@ -0,0 +1,93 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestFreezeTargets_RoundTripThroughReport(t *testing.T) {
+	dir := t.TempDir()
+	firmware := filepath.Join(dir, "app.bin")
+	if err := os.WriteFile(firmware, []byte("firmware"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	sum, err := fileSHA256(firmware)
+	if err != nil {
+		t.Fatalf("Checksum failed: %v", err)
+	}
+	if sum != "c3bf47ea1f4a4a605470313cacb3a44f4a461f68c6faeab07e737610cb5ac835" {
+		t.Fatalf("Unexpected checksum %q", sum)
+	}
+
+	report := &DeploymentReport{
+		ProjectUID:    "app:123",
+		FrozenTargets: freezeTargets([]notehub.Device{{UID: "dev:2"}, {UID: "dev:1"}}, sum),
+	}
+	path := filepath.Join(dir, "report.json")
+	if err := WriteReport(path, report); err != nil {
+		t.Fatalf("writeReport failed: %v", err)
+	}
+
+	frozen, err := loadFrozenTargets(path)
+	if err != nil {
+		t.Fatalf("loadFrozenTargets failed: %v", err)
+	}
+	if strings.Join(frozen.DeviceUIDs, ",") != "dev:1,dev:2" {
+		t.Errorf("Expected sorted frozen UIDs, got %v", frozen.DeviceUIDs)
+	}
+	if frozen.FirmwareSHA256 != sum {
+		t.Errorf("Expected checksum %s, got %s", sum, frozen.FirmwareSHA256)
+	}
+
+	explicit := explicitTargetConfig(&DeploymentConfig{Tag: "production"}, frozenDevices(frozen))
+	if explicit.DeviceUID != "dev:1,dev:2" || explicit.Tag != "" {
+		t.Errorf("Expected frozen devices to be targeted verbatim, got %+v", explicit)
+	}
+}
+
+func TestLoadFrozenTargets_RequiresFrozenSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := WriteReport(path, &DeploymentReport{ProjectUID: "app:123"}); err != nil {
+		t.Fatalf("writeReport failed: %v", err)
+	}
+	if _, err := loadFrozenTargets(path); err == nil || !strings.Contains(err.Error(), "no frozen targets") {
+		t.Errorf("Expected missing frozen targets error, got %v", err)
+	}
+}
+
+func TestComputeTargetDrift(t *testing.T) {
+	drift := computeTargetDrift([]string{"dev:1", "dev:2", "dev:3"}, []notehub.Device{{UID: "dev:2"}, {UID: "dev:3"}, {UID: "dev:4"}})
+	if strings.Join(drift.Added, ",") != "dev:4" || strings.Join(drift.Removed, ",") != "dev:1" {
+		t.Errorf("Unexpected drift %+v", drift)
+	}
+
+	if computeTargetDrift([]string{"dev:1"}, []notehub.Device{{UID: "dev:1"}}).HasDrift() {
+		t.Error("Expected no drift for identical sets")
+	}
+}
+
+func TestCheckTargetDrift_ReResolvesTargeting(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("tags") != "production" {
+				t.Errorf("Expected original targeting to be re-resolved, got %s", r.URL.RawQuery)
+			}
+			fmt.Fprint(w, `{"devices":[{"uid":"dev:1"},{"uid":"dev:5"}],"has_more":false}`)
+		},
+	})
+
+	client := newTestClient(server.URL)
+
+	frozen := &FrozenTargets{DeviceUIDs: []string{"dev:1", "dev:2"}}
+	drift := checkTargetDrift(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", Tag: "production"}, frozen)
+	if drift == nil || strings.Join(drift.Added, ",") != "dev:5" || strings.Join(drift.Removed, ",") != "dev:2" {
+		t.Errorf("Unexpected drift %+v", drift)
+	}
+}
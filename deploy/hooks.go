@@ -0,0 +1,218 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Hook phases at which a user-provided hook command can be run
+const (
+	HookPhasePreUpload      = "pre_upload"
+	HookPhasePreDFU         = "pre_dfu"
+	HookPhasePostDFU        = "post_dfu"
+	HookPhasePostCompletion = "post_completion"
+)
+
+// validHookPhases lists the accepted hook_phases values in execution order
+var validHookPhases = []string{
+	HookPhasePreUpload,
+	HookPhasePreDFU,
+	HookPhasePostDFU,
+	HookPhasePostCompletion,
+}
+
+// DefaultHookTimeout bounds a single hook invocation when hook_timeout is not set
+const DefaultHookTimeout = 60 * time.Second
+
+// maxHookOutputBytes caps how much of a hook's stdout and stderr is retained
+const maxHookOutputBytes = 64 * 1024
+
+// hookSecretEnvVars are the action inputs that carry credentials. The runner exposes every
+// input to child processes, so they are always stripped from the hook environment; with
+// hook_pass_secrets the Notehub credentials are passed as NOTEHUB_* variables instead.
+var hookSecretEnvVars = []string{
+	"INPUT_CLIENT_SECRET",
+	"INPUT_API_TOKEN",
+	"INPUT_TOKEN_HANDLE",
+	"INPUT_REQUIRE_CONFIRMATION_TOKEN",
+	"INPUT_CONFIRMATION_TOKEN",
+}
+
+// HookConfig contains the configuration for the phase hook command
+type HookConfig struct {
+	Command      string
+	Phases       []string
+	Timeout      time.Duration
+	PassSecrets  bool
+	ClientID     string
+	ClientSecret string
+	APIToken     string
+}
+
+// ParseHookPhases parses a comma-separated list of hook phases
+func ParseHookPhases(value string) ([]string, error) {
+	var phases []string
+	for _, p := range strings.Split(value, ",") {
+		p = strings.ToLower(strings.TrimSpace(p))
+		if p == "" {
+			continue
+		}
+		valid := false
+		for _, v := range validHookPhases {
+			if p == v {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid hook phase %q (accepted values: %s)", p, strings.Join(validHookPhases, ", "))
+		}
+		phases = append(phases, p)
+	}
+	return phases, nil
+}
+
+// enabled reports whether the hook should run at the given phase
+func (h *HookConfig) enabled(phase string) bool {
+	if h == nil || h.Command == "" {
+		return false
+	}
+	for _, p := range h.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// cappedBuffer is an io.Writer that retains at most limit bytes and discards the rest
+type cappedBuffer struct {
+	buf       bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	remaining := b.limit - b.buf.Len()
+	if remaining <= 0 {
+		b.truncated = len(p) > 0 || b.truncated
+		return len(p), nil
+	}
+	if len(p) > remaining {
+		b.buf.Write(p[:remaining])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+func (b *cappedBuffer) String() string {
+	s := strings.TrimSpace(b.buf.String())
+	if b.truncated {
+		s += " ...(truncated)"
+	}
+	return s
+}
+
+// hookEnv builds the environment for a hook invocation
+func (h *HookConfig) hookEnv(phase string) []string {
+	env := make([]string, 0, len(os.Environ())+3)
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if isHookSecretEnvVar(name) {
+			continue
+		}
+		env = append(env, kv)
+	}
+
+	env = append(env, "NOTEHUB_ODFU_PHASE="+phase)
+	if h.PassSecrets {
+		env = append(env, "NOTEHUB_CLIENT_ID="+h.ClientID)
+		env = append(env, "NOTEHUB_CLIENT_SECRET="+h.ClientSecret)
+		if h.APIToken != "" {
+			env = append(env, "NOTEHUB_API_TOKEN="+h.APIToken)
+		}
+	}
+
+	return env
+}
+
+func isHookSecretEnvVar(name string) bool {
+	for _, s := range hookSecretEnvVars {
+		if strings.EqualFold(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// runHook executes config's hook command for the given phase with the report JSON on
+// stdin. A non-zero exit status or a timeout blocks progression of the deployment.
+func runHook(ctx context.Context, config *DeploymentConfig, phase string, report *DeploymentReport) error {
+	h := config.Hook
+	if !h.enabled(phase) {
+		return nil
+	}
+
+	args := strings.Fields(h.Command)
+	if len(args) == 0 {
+		return fmt.Errorf("hook command is empty")
+	}
+
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	// The hook sees the phase it runs in; the shared report keeps its own
+	hookReport := *report
+	hookReport.Phase = phase
+	payload, err := json.Marshal(&hookReport)
+	if err != nil {
+		return fmt.Errorf("failed to marshal report for hook: %w", err)
+	}
+
+	config.logf("Running %s hook: %s", phase, h.Command)
+
+	hookCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	stdout := &cappedBuffer{limit: maxHookOutputBytes}
+	stderr := &cappedBuffer{limit: maxHookOutputBytes}
+
+	cmd := exec.CommandContext(hookCtx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.Env = h.hookEnv(phase)
+	cmd.WaitDelay = time.Second
+
+	err = cmd.Run()
+
+	if out := stdout.String(); out != "" {
+		config.logf("  %s hook output: %s", phase, out)
+	}
+
+	if hookCtx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%s hook timed out after %s", phase, timeout)
+	}
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%s hook exited with status %d: %s", phase, exitErr.ExitCode(), stderr.String())
+		}
+		return fmt.Errorf("%s hook failed to run: %w", phase, err)
+	}
+
+	config.logf("✅ %s hook passed", phase)
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeHookScript writes an executable shell script fixture and returns its path
+func writeHookScript(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "hook.sh")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0755); err != nil {
+		t.Fatalf("Failed to write hook script: %v", err)
+	}
+	return path
+}
+
+func TestParseHookPhases(t *testing.T) {
+	phases, err := ParseHookPhases("pre_upload, PRE_DFU,,post_completion")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []string{HookPhasePreUpload, HookPhasePreDFU, HookPhasePostCompletion}
+	if strings.Join(phases, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected phases %v, got %v", expected, phases)
+	}
+
+	if _, err := ParseHookPhases("pre_upload,after_everything"); err == nil {
+		t.Error("Expected error for unknown hook phase")
+	}
+}
+
+func TestRunHook_ReceivesReportAndPhase(t *testing.T) {
+	outFile := filepath.Join(t.TempDir(), "out.txt")
+	script := writeHookScript(t, `cat > "$1"; echo "phase=$NOTEHUB_ODFU_PHASE" >> "$1"`)
+
+	hook := &HookConfig{
+		Command: script + " " + outFile,
+		Phases:  []string{HookPhasePreDFU},
+	}
+	report := &DeploymentReport{ProjectUID: "app:123", UploadedFilename: "fw.bin"}
+
+	if err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreDFU, report); err != nil {
+		t.Fatalf("Expected hook to pass, got: %v", err)
+	}
+
+	data, err := os.ReadFile(outFile)
+	if err != nil {
+		t.Fatalf("Failed to read hook output: %v", err)
+	}
+	out := string(data)
+	if !strings.Contains(out, `"project_uid":"app:123"`) || !strings.Contains(out, `"uploaded_filename":"fw.bin"`) {
+		t.Errorf("Expected report JSON on stdin, got: %s", out)
+	}
+	if !strings.Contains(out, "phase=pre_dfu") {
+		t.Errorf("Expected NOTEHUB_ODFU_PHASE to be set, got: %s", out)
+	}
+	if !strings.Contains(out, `"phase":"pre_dfu"`) {
+		t.Errorf("Expected the phase in the report JSON, got: %s", out)
+	}
+}
+
+func TestRunHook_LeavesReportPhase(t *testing.T) {
+	hook := &HookConfig{
+		Command: writeHookScript(t, `cat > /dev/null`),
+		Phases:  []string{HookPhasePreDFU},
+	}
+	report := &DeploymentReport{Phase: "earlier"}
+
+	if err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreDFU, report); err != nil {
+		t.Fatalf("Expected hook to pass, got: %v", err)
+	}
+	if report.Phase != "earlier" {
+		t.Errorf("Expected the report's phase to be left as %q, got %q", "earlier", report.Phase)
+	}
+}
+
+func TestRunHook_SkipsUnselectedPhase(t *testing.T) {
+	script := writeHookScript(t, "exit 1")
+	hook := &HookConfig{Command: script, Phases: []string{HookPhasePostDFU}}
+
+	if err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreUpload, &DeploymentReport{}); err != nil {
+		t.Errorf("Expected unselected phase to be skipped, got: %v", err)
+	}
+}
+
+func TestRunHook_NonZeroExitBlocks(t *testing.T) {
+	script := writeHookScript(t, `echo "change ticket CHG123 not approved" >&2; exit 3`)
+	hook := &HookConfig{Command: script, Phases: []string{HookPhasePreDFU}}
+
+	err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreDFU, &DeploymentReport{})
+	if err == nil {
+		t.Fatal("Expected non-zero exit to block")
+	}
+	if !strings.Contains(err.Error(), "status 3") || !strings.Contains(err.Error(), "CHG123 not approved") {
+		t.Errorf("Expected exit status and stderr in error, got: %v", err)
+	}
+}
+
+func TestRunHook_Timeout(t *testing.T) {
+	script := writeHookScript(t, "exec sleep 5")
+	hook := &HookConfig{Command: script, Phases: []string{HookPhasePreUpload}, Timeout: 200 * time.Millisecond}
+
+	start := time.Now()
+	err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreUpload, &DeploymentReport{})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Expected timeout error, got: %v", err)
+	}
+	if time.Since(start) > 3*time.Second {
+		t.Errorf("Hook was not stopped promptly after timeout")
+	}
+}
+
+func TestRunHook_OutputIsCapped(t *testing.T) {
+	script := writeHookScript(t, `head -c 200000 /dev/zero | tr '\0' 'x' >&2; exit 1`)
+	hook := &HookConfig{Command: script, Phases: []string{HookPhasePreUpload}}
+
+	err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreUpload, &DeploymentReport{})
+	if err == nil {
+		t.Fatal("Expected hook to fail")
+	}
+	if len(err.Error()) > maxHookOutputBytes+200 || !strings.Contains(err.Error(), "truncated") {
+		t.Errorf("Expected stderr to be capped, got error of length %d", len(err.Error()))
+	}
+}
+
+func TestRunHook_SecretsNotPassedByDefault(t *testing.T) {
+	t.Setenv("INPUT_CLIENT_SECRET", "super-secret")
+
+	script := writeHookScript(t, `if [ -n "$INPUT_CLIENT_SECRET$NOTEHUB_CLIENT_SECRET" ]; then echo leaked >&2; exit 1; fi`)
+	hook := &HookConfig{Command: script, Phases: []string{HookPhasePreUpload}, ClientSecret: "super-secret"}
+
+	if err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreUpload, &DeploymentReport{}); err != nil {
+		t.Errorf("Expected secrets to be withheld from hook, got: %v", err)
+	}
+
+	hook.PassSecrets = true
+	script = writeHookScript(t, `[ "$NOTEHUB_CLIENT_SECRET" = "super-secret" ]`)
+	hook.Command = script
+	if err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreUpload, &DeploymentReport{}); err != nil {
+		t.Errorf("Expected secrets to be passed with hook_pass_secrets, got: %v", err)
+	}
+}
+
+func TestRunHook_CredentialInputsNeverPassed(t *testing.T) {
+	for _, name := range hookSecretEnvVars {
+		t.Setenv(name, "leaked-"+name)
+	}
+	check := `env | grep leaked- >&2 && exit 1; `
+
+	for _, pass := range []bool{false, true} {
+		t.Run(fmt.Sprintf("hook_pass_secrets %t", pass), func(t *testing.T) {
+			script := check + `[ -z "$NOTEHUB_API_TOKEN" ]`
+			if pass {
+				script = check + `[ "$NOTEHUB_API_TOKEN" = "api-token" ]`
+			}
+			hook := &HookConfig{Command: writeHookScript(t, script), Phases: []string{HookPhasePreUpload}, PassSecrets: pass, APIToken: "api-token"}
+			if err := runHook(context.Background(), &DeploymentConfig{Hook: hook}, HookPhasePreUpload, &DeploymentReport{}); err != nil {
+				t.Errorf("Expected no credential input in the hook environment, and the API token only with hook_pass_secrets, got: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package deploy
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// identityEdgeBytes is how much of the start and end of the firmware is digested
+// separately, so a truncated or padded image is easy to spot
+const identityEdgeBytes = 1024
+
+// ArtifactIdentity pins down exactly which firmware bytes were deployed, independent of
+// the filename. The Notehub digests are those reported by the upload response, which are
+// checked against the local ones during upload.
+type ArtifactIdentity struct {
+	Size          int64  `json:"size"`
+	SHA256        string `json:"sha256"`
+	SHA1          string `json:"sha1"`
+	MD5           string `json:"md5"`
+	CRC32         string `json:"crc32"`
+	HeadSHA256    string `json:"head_sha256"`
+	TailSHA256    string `json:"tail_sha256"`
+	NotehubSHA256 string `json:"notehub_sha256,omitempty"`
+	NotehubMD5    string `json:"notehub_md5,omitempty"`
+	NotehubCRC32  string `json:"notehub_crc32,omitempty"`
+}
+
+// tailBuffer is an io.Writer that retains only the last limit bytes written to it
+type tailBuffer struct {
+	buf   []byte
+	limit int
+}
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.limit {
+		t.buf = append(t.buf[:0], t.buf[len(t.buf)-t.limit:]...)
+	}
+	return len(p), nil
+}
+
+// computeArtifactIdentity digests r in a single pass
+func computeArtifactIdentity(r io.Reader) (*ArtifactIdentity, error) {
+	sha256Hash, sha1Hash, md5Hash, crcHash := sha256.New(), sha1.New(), md5.New(), crc32.NewIEEE()
+	head := &cappedBuffer{limit: identityEdgeBytes}
+	tail := &tailBuffer{limit: identityEdgeBytes}
+
+	size, err := io.Copy(io.MultiWriter(sha256Hash, sha1Hash, md5Hash, crcHash, head, tail), r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to checksum firmware file: %w", err)
+	}
+
+	headSum := sha256.Sum256(head.buf.Bytes())
+	tailSum := sha256.Sum256(tail.buf)
+	return &ArtifactIdentity{
+		Size:       size,
+		SHA256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+		SHA1:       hex.EncodeToString(sha1Hash.Sum(nil)),
+		MD5:        hex.EncodeToString(md5Hash.Sum(nil)),
+		CRC32:      fmt.Sprintf("%08x", crcHash.Sum32()),
+		HeadSHA256: hex.EncodeToString(headSum[:]),
+		TailSHA256: hex.EncodeToString(tailSum[:]),
+	}, nil
+}
+
+// fileArtifactIdentity computes the identity of a firmware file
+func fileArtifactIdentity(path string) (*ArtifactIdentity, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open firmware file for checksum: %w", err)
+	}
+	defer f.Close()
+
+	return computeArtifactIdentity(f)
+}
+
+// recordNotehubDigests pairs the digests Notehub reported for the upload with the local
+// ones. Any reported digest has already been verified by the upload.
+func (id *ArtifactIdentity) recordNotehubDigests(resp *notehub.FirmwareUploadResponse) {
+	id.NotehubSHA256 = resp.SHA256
+	id.NotehubMD5 = resp.MD5
+	id.NotehubCRC32 = resp.CRC32
+}
@@ -0,0 +1,76 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// goldenIdentityJSON pins the artifact identity block for 3000 bytes of i%251, as written
+// to the report and the artifact_identity output
+const goldenIdentityJSON = `{"size":3000,` +
+	`"sha256":"e8ca4bf83f56152c01649f88bd7c91b15ae8137d9a709572e04fae55894ea75e",` +
+	`"sha1":"5e25a94c1eb80894140b670c6ae18f72d3358eec",` +
+	`"md5":"a216503cb86d01a23e71e047d4ccf001",` +
+	`"crc32":"4636a985",` +
+	`"head_sha256":"2bce1ba628720664be4b9fdd77aae0678e5f0f3f02fc6ff641ec879094f6a404",` +
+	`"tail_sha256":"08bc5216c1084bab81c4828bac7384e2190daeef35c517d6ad40c8f5018be008"}`
+
+func goldenFirmware() []byte {
+	data := make([]byte, 3000)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestComputeArtifactIdentity_Golden(t *testing.T) {
+	// The chunked reader splits the input across many writes, exercising the edge buffers
+	for name, r := range map[string]io.Reader{
+		"single write": bytes.NewReader(goldenFirmware()),
+		"chunked":      iotest.HalfReader(bytes.NewReader(goldenFirmware())),
+	} {
+		t.Run(name, func(t *testing.T) {
+			id, err := computeArtifactIdentity(r)
+			if err != nil {
+				t.Fatalf("computeArtifactIdentity failed: %v", err)
+			}
+			got, _ := json.Marshal(id)
+			if string(got) != goldenIdentityJSON {
+				t.Errorf("Identity JSON changed:\n got %s\nwant %s", got, goldenIdentityJSON)
+			}
+		})
+	}
+}
+
+func TestComputeArtifactIdentity_SmallFile(t *testing.T) {
+	id, err := computeArtifactIdentity(bytes.NewReader([]byte("firmware")))
+	if err != nil {
+		t.Fatalf("computeArtifactIdentity failed: %v", err)
+	}
+	if id.Size != 8 || id.SHA256 != testFirmwareSHA256 || id.SHA1 != "9bcf18e4b22c0710ed69d3e91fb8285b936cdea7" || id.CRC32 != "d5ecd7c4" {
+		t.Errorf("Unexpected identity %+v", id)
+	}
+	// A file shorter than the edge size is entirely both head and tail
+	if id.HeadSHA256 != testFirmwareSHA256 || id.TailSHA256 != testFirmwareSHA256 {
+		t.Errorf("Expected head and tail digests of the whole file, got %s and %s", id.HeadSHA256, id.TailSHA256)
+	}
+}
+
+func TestArtifactIdentity_RecordNotehubDigests(t *testing.T) {
+	var id ArtifactIdentity
+	if err := json.Unmarshal([]byte(goldenIdentityJSON), &id); err != nil {
+		t.Fatal(err)
+	}
+	id.recordNotehubDigests(&notehub.FirmwareUploadResponse{Filename: "app.bin", MD5: id.MD5, CRC32: id.CRC32})
+
+	got, _ := json.Marshal(id)
+	want := goldenIdentityJSON[:len(goldenIdentityJSON)-1] + `,"notehub_md5":"a216503cb86d01a23e71e047d4ccf001","notehub_crc32":"4636a985"}`
+	if string(got) != want {
+		t.Errorf("Identity JSON with Notehub digests changed:\n got %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,373 @@
+package deploy
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// lockEnvVar is the project environment variable holding the advisory deployment lock
+const lockEnvVar = "_odfu_lock"
+
+// Behaviours when the deployment lock is held by another run
+const (
+	LockOnHeldFail = "fail"
+	LockOnHeldWait = "wait"
+)
+
+const (
+	// DefaultLockTTL is how long a lock stays valid without renewal
+	DefaultLockTTL = 15 * time.Minute
+
+	// DefaultLockWaitTimeout bounds how long on_lock_held: wait keeps retrying
+	DefaultLockWaitTimeout = 10 * time.Minute
+
+	// defaultLockPollInterval is the delay between acquisition attempts while waiting
+	defaultLockPollInterval = 15 * time.Second
+
+	// DefaultLockSettleDelay is how long to wait after writing the lock before re-reading it
+	DefaultLockSettleDelay = 2 * time.Second
+
+	// lockSkewTolerance is added to another holder's expiry before the lock is treated as
+	// stale, absorbing clock differences between the runners that wrote it
+	lockSkewTolerance = 30 * time.Second
+)
+
+// LockConfig contains the configuration for the advisory deployment lock
+type LockConfig struct {
+	Enabled      bool
+	OnHeld       string
+	TTL          time.Duration
+	WaitTimeout  time.Duration
+	PollInterval time.Duration
+	SettleDelay  time.Duration
+	Holder       string
+}
+
+// lockRecord is the JSON value stored in the lock environment variable
+type lockRecord struct {
+	Holder    string    `json:"holder"`
+	RolloutID string    `json:"rollout_id"`
+	Expires   time.Time `json:"expires"`
+}
+
+// DeploymentLock is an advisory lock on a Notehub project held by this run
+type DeploymentLock struct {
+	deployment *DeploymentConfig
+	client     *notehub.Client
+	projectUID string
+	config     *LockConfig
+	record     lockRecord
+
+	// waited and contenders describe any contention seen while acquiring the lock
+	waited     time.Duration
+	contenders []string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// lockHeldError is returned when another run holds the deployment lock
+type lockHeldError struct {
+	holder lockRecord
+}
+
+func (e *lockHeldError) Error() string {
+	return fmt.Sprintf("deployment lock is held by %s (rollout %s) until %s",
+		e.holder.Holder, e.holder.RolloutID, e.holder.Expires.Format(time.RFC3339))
+}
+
+// ParseLockOnHeld validates the on_lock_held input
+func ParseLockOnHeld(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", LockOnHeldFail:
+		return LockOnHeldFail, nil
+	case LockOnHeldWait:
+		return LockOnHeldWait, nil
+	default:
+		return "", fmt.Errorf("invalid on_lock_held %q (accepted values: %s, %s)", value, LockOnHeldFail, LockOnHeldWait)
+	}
+}
+
+// defaultLockHolder describes the current workflow run for the lock record
+func defaultLockHolder() string {
+	repo := os.Getenv("GITHUB_REPOSITORY")
+	runID := os.Getenv("GITHUB_RUN_ID")
+	if repo != "" && runID != "" {
+		holder := fmt.Sprintf("%s run %s", repo, runID)
+		if attempt := os.Getenv("GITHUB_RUN_ATTEMPT"); attempt != "" {
+			holder += " attempt " + attempt
+		}
+		return holder
+	}
+
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s pid %d", host, os.Getpid())
+}
+
+// newRolloutID generates a random identifier for this run's lock
+func newRolloutID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate rollout ID: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// acquireDeploymentLock acquires the project's advisory deployment lock, waiting for another
+// holder to release it when configured to do so. The returned lock is renewed in the
+// background until Release is called.
+//
+// Acquisition is compare-and-set over a plain environment variable: read, verify absent or
+// expired, write, wait briefly, then re-read to confirm our write survived. Two runs writing
+// within the settle delay of each other can still both believe they won, so this narrows
+// rather than eliminates the race; it is an advisory guard, not a strict mutex.
+func acquireDeploymentLock(ctx context.Context, client *notehub.Client, deployment *DeploymentConfig) (*DeploymentLock, error) {
+	projectUID, config := deployment.ProjectUID, deployment.Lock
+	rolloutID, err := newRolloutID()
+	if err != nil {
+		return nil, err
+	}
+
+	holder := config.Holder
+	if holder == "" {
+		holder = defaultLockHolder()
+	}
+
+	l := &DeploymentLock{
+		deployment: deployment,
+		client:     client,
+		projectUID: projectUID,
+		config:     config,
+		record: lockRecord{
+			Holder:    holder,
+			RolloutID: rolloutID,
+		},
+	}
+
+	deployment.logf("Acquiring deployment lock for project %s as %s...", projectUID, holder)
+
+	waitTimeout := config.WaitTimeout
+	if waitTimeout <= 0 {
+		waitTimeout = DefaultLockWaitTimeout
+	}
+	pollInterval := config.PollInterval
+	if pollInterval <= 0 {
+		pollInterval = defaultLockPollInterval
+	}
+	start := time.Now()
+	deadline := start.Add(waitTimeout)
+
+	for {
+		err := l.tryAcquire(ctx)
+		if err == nil {
+			break
+		}
+
+		heldErr, ok := err.(*lockHeldError)
+		if !ok {
+			return nil, err
+		}
+		l.recordContender(heldErr.holder.Holder)
+		if config.OnHeld != LockOnHeldWait {
+			return nil, heldErr
+		}
+		if time.Now().Add(pollInterval).After(deadline) {
+			return nil, fmt.Errorf("timed out after %s waiting for lock: %w", waitTimeout, heldErr)
+		}
+
+		deployment.logf("  - %v; waiting %s...", heldErr, pollInterval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+
+	deployment.logf("✅ Deployment lock acquired (rollout %s, expires %s)", l.record.RolloutID, l.record.Expires.Format(time.RFC3339))
+	if len(l.contenders) > 0 {
+		l.waited = time.Since(start)
+		deployment.logf("  - Lock was contended: waited %s for %s", l.waited.Round(time.Second), strings.Join(l.contenders, ", "))
+	}
+
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.renewLoop()
+
+	return l, nil
+}
+
+// recordContender notes another run seen holding the lock, once per holder
+func (l *DeploymentLock) recordContender(holder string) {
+	for _, c := range l.contenders {
+		if c == holder {
+			return
+		}
+	}
+	l.contenders = append(l.contenders, holder)
+}
+
+// ttl returns the configured lock lifetime
+func (l *DeploymentLock) ttl() time.Duration {
+	if l.config.TTL > 0 {
+		return l.config.TTL
+	}
+	return DefaultLockTTL
+}
+
+// readLock returns the current lock record, or nil when the lock is absent
+func (l *DeploymentLock) readLock(ctx context.Context) (*lockRecord, error) {
+	vars, err := l.client.GetEnvironmentVariables(ctx, l.projectUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deployment lock: %w", err)
+	}
+
+	value, ok := vars[lockEnvVar]
+	if !ok || value == "" {
+		return nil, nil
+	}
+
+	var rec lockRecord
+	if err := json.Unmarshal([]byte(value), &rec); err != nil {
+		// A lock we can't parse can't be renewed or released by its owner either,
+		// so treat it as stale rather than blocking deployments forever
+		l.deployment.Warnf("Ignoring malformed deployment lock value: %s", value)
+		return nil, nil
+	}
+
+	return &rec, nil
+}
+
+// writeLock stores this run's lock record with a fresh expiry
+func (l *DeploymentLock) writeLock(ctx context.Context) error {
+	l.record.Expires = l.client.ServerNow().Add(l.ttl()).UTC().Truncate(time.Second)
+
+	value, err := json.Marshal(l.record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment lock: %w", err)
+	}
+
+	if err := l.client.SetEnvironmentVariables(ctx, l.projectUID, map[string]string{lockEnvVar: string(value)}); err != nil {
+		return fmt.Errorf("failed to write deployment lock: %w", err)
+	}
+
+	return nil
+}
+
+// expired reports whether another holder's lock can be considered stale
+func (l *DeploymentLock) expired(rec *lockRecord) bool {
+	return l.client.ServerNow().After(rec.Expires.Add(lockSkewTolerance))
+}
+
+// tryAcquire makes a single compare-and-set attempt at taking the lock
+func (l *DeploymentLock) tryAcquire(ctx context.Context) error {
+	current, err := l.readLock(ctx)
+	if err != nil {
+		return err
+	}
+	if current != nil && current.RolloutID != l.record.RolloutID && !l.expired(current) {
+		return &lockHeldError{holder: *current}
+	}
+	if current != nil && current.RolloutID != l.record.RolloutID {
+		l.deployment.logf("  - Taking over expired lock held by %s (expired %s)", current.Holder, current.Expires.Format(time.RFC3339))
+	}
+
+	if err := l.writeLock(ctx); err != nil {
+		return err
+	}
+
+	if l.config.SettleDelay > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(l.config.SettleDelay):
+		}
+	}
+
+	// Re-read to confirm no other run overwrote our write
+	confirmed, err := l.readLock(ctx)
+	if err != nil {
+		return err
+	}
+	if confirmed == nil || confirmed.RolloutID != l.record.RolloutID {
+		if confirmed == nil {
+			return fmt.Errorf("deployment lock disappeared while acquiring it")
+		}
+		return &lockHeldError{holder: *confirmed}
+	}
+
+	return nil
+}
+
+// renewLoop periodically extends the lock expiry until the lock is released
+func (l *DeploymentLock) renewLoop() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl() / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			if err := l.renew(context.Background()); err != nil {
+				l.deployment.Warnf("Failed to renew deployment lock: %v", err)
+			}
+		}
+	}
+}
+
+// renew extends the lock expiry if this run still holds it
+func (l *DeploymentLock) renew(ctx context.Context) error {
+	current, err := l.readLock(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.RolloutID != l.record.RolloutID {
+		holder := "nobody"
+		if current != nil {
+			holder = current.Holder
+		}
+		return fmt.Errorf("deployment lock is no longer held by this run (now held by %s)", holder)
+	}
+
+	if err := l.writeLock(ctx); err != nil {
+		return err
+	}
+
+	l.deployment.logf("Deployment lock renewed until %s", l.record.Expires.Format(time.RFC3339))
+	return nil
+}
+
+// Release stops renewal and removes the lock if this run still holds it
+func (l *DeploymentLock) Release(ctx context.Context) error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+		l.stop = nil
+	}
+
+	current, err := l.readLock(ctx)
+	if err != nil {
+		return err
+	}
+	if current == nil || current.RolloutID != l.record.RolloutID {
+		l.deployment.logf("Deployment lock is no longer held by this run, nothing to release")
+		return nil
+	}
+
+	if err := l.client.DeleteEnvironmentVariable(ctx, l.projectUID, lockEnvVar); err != nil {
+		return fmt.Errorf("failed to release deployment lock: %w", err)
+	}
+
+	l.deployment.logf("✅ Deployment lock released")
+	return nil
+}
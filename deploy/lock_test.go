@@ -0,0 +1,270 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// fakeEnvServer is an in-memory stand-in for the project environment variables API
+type fakeEnvServer struct {
+	mu   sync.Mutex
+	vars map[string]string
+
+	// onPut, when set, runs after each successful PUT while the lock is held
+	onPut func(vars map[string]string)
+	puts  int
+}
+
+func newFakeEnvServer(t *testing.T) (*fakeEnvServer, *notehub.Client) {
+	t.Helper()
+	f := &fakeEnvServer{vars: map[string]string{}}
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/environment_variables":   f.handle,
+		"/projects/app:123/environment_variables/*": f.handle,
+	})
+
+	client := newTestClient(server.URL)
+	return f, client
+}
+
+func (f *fakeEnvServer) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	const prefix = "/projects/app:123/environment_variables"
+	switch {
+	case r.Method == "GET" && r.URL.Path == prefix:
+		json.NewEncoder(w).Encode(notehub.EnvironmentVariables{EnvironmentVariables: f.vars})
+	case r.Method == "PUT" && r.URL.Path == prefix:
+		var body notehub.EnvironmentVariables
+		json.NewDecoder(r.Body).Decode(&body)
+		for k, v := range body.EnvironmentVariables {
+			f.vars[k] = v
+		}
+		f.puts++
+		if f.onPut != nil {
+			f.onPut(f.vars)
+		}
+		w.Write([]byte(`{}`))
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, prefix+"/"):
+		delete(f.vars, strings.TrimPrefix(r.URL.Path, prefix+"/"))
+		w.Write([]byte(`{}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeEnvServer) lock() *lockRecord {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, ok := f.vars[lockEnvVar]
+	if !ok {
+		return nil
+	}
+	var rec lockRecord
+	json.Unmarshal([]byte(value), &rec)
+	return &rec
+}
+
+func (f *fakeEnvServer) setLock(rec lockRecord) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	value, _ := json.Marshal(rec)
+	f.vars[lockEnvVar] = string(value)
+}
+
+func TestParseLockOnHeld(t *testing.T) {
+	for input, expected := range map[string]string{"": LockOnHeldFail, "fail": LockOnHeldFail, "WAIT": LockOnHeldWait} {
+		got, err := ParseLockOnHeld(input)
+		if err != nil || got != expected {
+			t.Errorf("parseLockOnHeld(%q) = %q, %v; expected %q", input, got, err, expected)
+		}
+	}
+	if _, err := ParseLockOnHeld("steal"); err == nil {
+		t.Error("Expected error for unknown on_lock_held value")
+	}
+}
+
+func TestDeploymentLock_AcquireAndRelease(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	ctx := context.Background()
+
+	lock, err := acquireDeploymentLock(ctx, client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{Enabled: true, Holder: "repo-a run 1"}})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	rec := fake.lock()
+	if rec == nil || rec.Holder != "repo-a run 1" || rec.RolloutID != lock.record.RolloutID {
+		t.Fatalf("Expected lock record for this run, got %+v", rec)
+	}
+	if time.Until(rec.Expires) < DefaultLockTTL-time.Minute {
+		t.Errorf("Expected lock to expire ~%s from now, got %s", DefaultLockTTL, rec.Expires)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+	if fake.lock() != nil {
+		t.Error("Expected lock to be removed on release")
+	}
+	if len(lock.contenders) != 0 || lock.waited != 0 {
+		t.Errorf("Expected no contention for an uncontended lock, got %v after %v", lock.contenders, lock.waited)
+	}
+}
+
+func TestDeploymentLock_HeldFailsNamingHolder(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	fake.setLock(lockRecord{Holder: "repo-b run 7", RolloutID: "other", Expires: time.Now().Add(time.Hour)})
+
+	_, err := acquireDeploymentLock(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{Enabled: true, OnHeld: LockOnHeldFail}})
+	if err == nil {
+		t.Fatal("Expected acquisition to fail while lock is held")
+	}
+	if !strings.Contains(err.Error(), "repo-b run 7") {
+		t.Errorf("Expected error to name the holder, got: %v", err)
+	}
+	if rec := fake.lock(); rec.RolloutID != "other" {
+		t.Error("Held lock must not be overwritten")
+	}
+}
+
+func TestDeploymentLock_WaitsForRelease(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	fake.setLock(lockRecord{Holder: "repo-b run 7", RolloutID: "other", Expires: time.Now().Add(time.Hour)})
+
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		fake.mu.Lock()
+		delete(fake.vars, lockEnvVar)
+		fake.mu.Unlock()
+	}()
+
+	lock, err := acquireDeploymentLock(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{
+		Enabled:      true,
+		OnHeld:       LockOnHeldWait,
+		WaitTimeout:  5 * time.Second,
+		PollInterval: 20 * time.Millisecond,
+	}})
+	if err != nil {
+		t.Fatalf("Expected lock to be acquired after release, got: %v", err)
+	}
+	defer lock.Release(context.Background())
+
+	if len(lock.contenders) != 1 || lock.contenders[0] != "repo-b run 7" {
+		t.Errorf("Expected contention with repo-b run 7 to be recorded, got %v", lock.contenders)
+	}
+	if lock.waited < 100*time.Millisecond {
+		t.Errorf("Expected recorded wait of at least 100ms, got %v", lock.waited)
+	}
+}
+
+func TestDeploymentLock_WaitTimesOut(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	fake.setLock(lockRecord{Holder: "repo-b run 7", RolloutID: "other", Expires: time.Now().Add(time.Hour)})
+
+	_, err := acquireDeploymentLock(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{
+		Enabled:      true,
+		OnHeld:       LockOnHeldWait,
+		WaitTimeout:  100 * time.Millisecond,
+		PollInterval: 20 * time.Millisecond,
+	}})
+	if err == nil || !strings.Contains(err.Error(), "timed out") || !strings.Contains(err.Error(), "repo-b run 7") {
+		t.Errorf("Expected wait timeout naming holder, got: %v", err)
+	}
+}
+
+func TestDeploymentLock_ExpiredLockTakenOver(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	fake.setLock(lockRecord{Holder: "crashed run", RolloutID: "other", Expires: time.Now().Add(-time.Hour)})
+
+	lock, err := acquireDeploymentLock(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{Enabled: true}})
+	if err != nil {
+		t.Fatalf("Expected expired lock to be taken over, got: %v", err)
+	}
+	defer lock.Release(context.Background())
+
+	if rec := fake.lock(); rec.RolloutID != lock.record.RolloutID {
+		t.Errorf("Expected lock to be owned by this run, got %+v", rec)
+	}
+}
+
+func TestDeploymentLock_RecentlyExpiredLockWithinSkewTolerance(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	fake.setLock(lockRecord{Holder: "repo-b run 7", RolloutID: "other", Expires: time.Now().Add(-5 * time.Second)})
+
+	if _, err := acquireDeploymentLock(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{Enabled: true}}); err == nil {
+		t.Error("Expected a lock expired by less than the skew tolerance to still be honoured")
+	}
+}
+
+func TestDeploymentLock_LostRace(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+
+	// Another run writes its own lock immediately after ours lands
+	fake.onPut = func(vars map[string]string) {
+		value, _ := json.Marshal(lockRecord{Holder: "repo-b run 8", RolloutID: "racer", Expires: time.Now().Add(time.Hour)})
+		vars[lockEnvVar] = string(value)
+	}
+
+	_, err := acquireDeploymentLock(context.Background(), client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{Enabled: true, OnHeld: LockOnHeldFail}})
+	if err == nil || !strings.Contains(err.Error(), "repo-b run 8") {
+		t.Errorf("Expected lost race to report the winner, got: %v", err)
+	}
+}
+
+func TestDeploymentLock_Renew(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	ctx := context.Background()
+
+	lock, err := acquireDeploymentLock(ctx, client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{Enabled: true, TTL: 150 * time.Millisecond}})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+	first := fake.lock().Expires
+
+	// Background renewal runs every TTL/3
+	time.Sleep(1200 * time.Millisecond)
+
+	fake.mu.Lock()
+	puts := fake.puts
+	fake.mu.Unlock()
+	if puts < 2 {
+		t.Errorf("Expected lock to be renewed, got %d writes", puts)
+	}
+	if !fake.lock().Expires.After(first) {
+		t.Errorf("Expected renewed expiry after %s, got %s", first, fake.lock().Expires)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Failed to release lock: %v", err)
+	}
+}
+
+func TestDeploymentLock_ReleaseLeavesOtherHolder(t *testing.T) {
+	fake, client := newFakeEnvServer(t)
+	ctx := context.Background()
+
+	lock, err := acquireDeploymentLock(ctx, client, &DeploymentConfig{ProjectUID: "app:123", Lock: &LockConfig{Enabled: true}})
+	if err != nil {
+		t.Fatalf("Failed to acquire lock: %v", err)
+	}
+
+	// Simulate our lock expiring and another run taking over
+	fake.setLock(lockRecord{Holder: "repo-b run 9", RolloutID: "other", Expires: time.Now().Add(time.Hour)})
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if rec := fake.lock(); rec == nil || rec.RolloutID != "other" {
+		t.Error("Release must not remove a lock held by another run")
+	}
+}
@@ -0,0 +1,44 @@
+package deploy
+
+import "log"
+
+// Logger receives a deployment's progress messages and warnings. The action logs through
+// the runner's workflow commands; a program using the package can supply its own.
+type Logger interface {
+	// Printf logs a progress message
+	Printf(format string, args ...any)
+	// Warnf logs a warning
+	Warnf(format string, args ...any)
+	// Mask asks for a secret, such as an access token, to be hidden from any later output
+	Mask(secret string)
+}
+
+// stdLogger logs through the standard library's default logger and masks nothing
+type stdLogger struct{}
+
+func (stdLogger) Printf(format string, args ...any) { log.Default().Printf(format, args...) }
+func (stdLogger) Warnf(format string, args ...any) {
+	log.Default().Printf("Warning: "+format, args...)
+}
+func (stdLogger) Mask(string) {}
+
+// orStdLogger returns l, or the standard library's log when l is nil
+func orStdLogger(l Logger) Logger {
+	if l == nil {
+		return stdLogger{}
+	}
+	return l
+}
+
+// logger returns where every message of the deployment goes
+func (c *DeploymentConfig) logger() Logger {
+	if c == nil {
+		return stdLogger{}
+	}
+	return orStdLogger(c.Logger)
+}
+
+// logf logs a progress message
+func (c *DeploymentConfig) logf(format string, args ...any) {
+	c.logger().Printf(format, args...)
+}
@@ -0,0 +1,82 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recordingLogger records what the package logs
+type recordingLogger struct {
+	mu       sync.Mutex
+	messages []string
+	warnings []string
+	masked   []string
+}
+
+func (l *recordingLogger) Printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.messages = append(l.messages, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Warnf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warnings = append(l.warnings, fmt.Sprintf(format, args...))
+}
+
+func (l *recordingLogger) Mask(secret string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.masked = append(l.masked, secret)
+}
+
+// useRecordingLogger makes config log through a new recordingLogger
+func useRecordingLogger(config *DeploymentConfig) *recordingLogger {
+	l := &recordingLogger{}
+	config.Logger = l
+	return l
+}
+
+func TestDeploymentConfig_Logger(t *testing.T) {
+	config := &DeploymentConfig{}
+	l := useRecordingLogger(config)
+	config.logf("uploading %s", "app.bin")
+	config.Warnf("quota at %d%%", 90)
+
+	if len(l.messages) != 1 || l.messages[0] != "uploading app.bin" {
+		t.Errorf("Expected the message logged through the logger, got %v", l.messages)
+	}
+	if len(l.warnings) != 1 || !strings.Contains(l.warnings[0], "quota at 90%") {
+		t.Errorf("Expected the warning logged through the logger, got %v", l.warnings)
+	}
+
+	if _, ok := (&DeploymentConfig{}).logger().(stdLogger); !ok {
+		t.Errorf("Expected a nil Logger to log through the standard library, got %T", (&DeploymentConfig{}).logger())
+	}
+}
+
+func TestNewNotehubClient_MasksAccessToken(t *testing.T) {
+	const token = "tok-8f14e45fceea167a"
+
+	config := &DeploymentConfig{}
+	l := useRecordingLogger(config)
+
+	server := newFakeNotehub(t, fakeRoutes{
+		"/oauth2/token": respond(fmt.Sprintf(`{"access_token":%q,"token_type":"bearer","expires_in":3600}`, token)),
+	})
+
+	defer func(orig string) { DefaultOAuthTokenURL = orig }(DefaultOAuthTokenURL)
+	DefaultOAuthTokenURL = server.URL + "/oauth2/token"
+
+	client := newNotehubClient(config)
+	if err := client.Authenticate(context.Background(), "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if len(l.masked) != 1 || l.masked[0] != token {
+		t.Errorf("Expected access token to be masked, masked %v", l.masked)
+	}
+}
@@ -0,0 +1,297 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// FileResult records the outcome of deploying one firmware file of a multi-file run
+type FileResult struct {
+	FirmwareFile     string `json:"firmware_file"`
+	UploadedFilename string `json:"uploaded_filename,omitempty"`
+	FirmwareSHA256   string `json:"firmware_sha256,omitempty"`
+	FirmwareSize     int64  `json:"firmware_size,omitempty"`
+	DFU              bool   `json:"dfu,omitempty"`
+	Status           string `json:"status"`
+	Error            string `json:"error,omitempty"`
+}
+
+// splitFirmwareFiles splits the firmware_file input on newlines and commas
+func splitFirmwareFiles(value string) []string {
+	var entries []string
+	for _, line := range strings.Split(value, "\n") {
+		for _, entry := range strings.Split(line, ",") {
+			if entry = strings.TrimSpace(entry); entry != "" {
+				entries = append(entries, entry)
+			}
+		}
+	}
+	return entries
+}
+
+// ExpandFirmwareFiles resolves the firmware_file input to the files to deploy. Entries may
+// be paths, names within dir, URLs, or glob patterns, which must match at least one file.
+// A single plain entry is returned as given, so a single-file run behaves as before. Each
+// entry, and each file a pattern matches, must resolve within workspace when it is set.
+func ExpandFirmwareFiles(workspace, dir, value string) ([]string, error) {
+	entries := splitFirmwareFiles(value)
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("firmware_file is required")
+	}
+
+	var files []string
+	seen := map[string]bool{}
+	for _, entry := range entries {
+		matches := []string{entry}
+		if !IsFirmwareURL(entry) {
+			if err := checkWithinWorkspace(workspace, resolveFirmwarePath(dir, entry)); err != nil {
+				return nil, err
+			}
+		}
+		if !IsFirmwareURL(entry) && strings.ContainsAny(entry, "*?[") {
+			var err error
+			matches, err = filepath.Glob(resolveFirmwarePath(dir, entry))
+			if err != nil {
+				return nil, fmt.Errorf("invalid firmware_file pattern %q: %w", entry, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("no firmware files match %q", entry)
+			}
+			for _, m := range matches {
+				if err := checkWithinWorkspace(workspace, m); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for _, m := range matches {
+			if !seen[m] {
+				seen[m] = true
+				files = append(files, m)
+			}
+		}
+	}
+	return files, nil
+}
+
+// dfuFileLast is the dfu_file value that selects the last firmware file listed, unless a
+// file is named "last"
+const dfuFileLast = "last"
+
+// SelectDFUFile returns which of files drives the DFU. dfuFile may name it by path, as
+// listed, or by base name. With a single file, dfuFile may be empty.
+func SelectDFUFile(files []string, dfuFile string) (int, error) {
+	if dfuFile == "" {
+		if len(files) == 1 {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("issue_dfu with %d firmware files requires dfu_file to select which one the DFU uses: %s", len(files), strings.Join(files, ", "))
+	}
+
+	match := -1
+	for i, f := range files {
+		if f == dfuFile || firmwareBaseName(f) == dfuFile {
+			if match >= 0 {
+				return 0, fmt.Errorf("dfu_file %q matches more than one firmware file", dfuFile)
+			}
+			match = i
+		}
+	}
+	if match < 0 && dfuFile == dfuFileLast {
+		return len(files) - 1, nil
+	}
+	if match < 0 {
+		return 0, fmt.Errorf("dfu_file %q is not one of the firmware files: %s", dfuFile, strings.Join(files, ", "))
+	}
+	return match, nil
+}
+
+// uploadOnlyConfig returns the config for deploying one file of a multi-file run that does
+// not drive the DFU: it is uploaded, but nothing about the DFU is resolved or triggered
+func uploadOnlyConfig(config *DeploymentConfig, file string) *DeploymentConfig {
+	c := *config
+	c.FirmwareFile = file
+	c.IssueDFU = false
+	c.SKUSizeLimits = nil
+	c.FreezeTargets = false
+	c.ResumeFromReport = ""
+	c.WaitForCompletion = false
+	c.Follow = false
+	return &c
+}
+
+// DeployFirmwareFiles deploys each of files in turn. Every file is uploaded; when issue_dfu
+// is set, the file selected by dfuFile is deployed last and alone triggers the DFU, so the
+// DFU starts only once every file is on Notehub. A failure stops the run, and the report
+// lists the files deployed before it. A single file, or none for operations that upload
+// nothing, is deployed exactly as before.
+func DeployFirmwareFiles(ctx context.Context, config *DeploymentConfig, files []string, dfuFile string) (*DeploymentReport, error) {
+	// Created before the config is copied, so every file's deployment shares them
+	config.retryLedger()
+	config.strictWarnings()
+
+	if config.OverallTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.OverallTimeout)
+		defer cancel()
+	}
+
+	if config.Operation == OperationAB {
+		return deployAB(ctx, config, files)
+	}
+
+	if len(files) <= 1 {
+		single := *config
+		if len(files) == 1 {
+			single.FirmwareFile = files[0]
+		}
+		return DeployFirmware(ctx, &single)
+	}
+
+	order := append([]string(nil), files...)
+	dfuIndex := -1
+	if config.IssueDFU {
+		i, err := SelectDFUFile(files, dfuFile)
+		if err != nil {
+			report := newDeploymentReport(config)
+			return report, err
+		}
+		order = append(append(order[:i:i], order[i+1:]...), files[i])
+		dfuIndex = len(order) - 1
+	}
+
+	session, release, err := startSession(ctx, config)
+	if err != nil {
+		return session.report, err
+	}
+	defer release()
+
+	var results []FileResult
+	var report *DeploymentReport
+	for i, file := range order {
+		fileConfig := uploadOnlyConfig(config, file)
+		if i == dfuIndex {
+			fileConfig = &DeploymentConfig{}
+			*fileConfig = *config
+			fileConfig.FirmwareFile = file
+		}
+		// Retention runs once, after the last file, and keeps every file of the run
+		if i < len(order)-1 {
+			fileConfig.RetainFirmwareCount = 0
+		}
+		for _, r := range results {
+			fileConfig.retentionProtect = append(fileConfig.retentionProtect, r.UploadedFilename)
+		}
+		fileConfig.session = session
+
+		report, err = DeployFirmware(ctx, fileConfig)
+		result := FileResult{
+			FirmwareFile:     DisplayFirmwareFile(file),
+			UploadedFilename: report.UploadedFilename,
+			FirmwareSHA256:   report.FirmwareSHA256,
+			FirmwareSize:     report.FirmwareSize,
+			DFU:              i == dfuIndex,
+			Status:           StatusSuccess,
+		}
+		if err != nil {
+			result.Status = StatusFailed
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+		report.Files = results
+
+		if err != nil {
+			var done []string
+			for _, r := range results[:i] {
+				done = append(done, r.UploadedFilename)
+			}
+			if len(done) == 0 {
+				return report, fmt.Errorf("firmware file %d of %d (%s) failed: %w", i+1, len(order), result.FirmwareFile, err)
+			}
+			return report, fmt.Errorf("firmware file %d of %d (%s) failed after uploading %s: %w", i+1, len(order), result.FirmwareFile, strings.Join(done, ", "), err)
+		}
+	}
+
+	config.logf("=== Firmware Files ===")
+	for i, r := range results {
+		dfu := ""
+		if r.DFU {
+			dfu = " (DFU)"
+		}
+		config.logf("%d. %s uploaded as %s%s", i+1, r.FirmwareFile, r.UploadedFilename, dfu)
+	}
+	return report, nil
+}
+
+// deploymentSession is what a multi-file run sets up once for all of its files: the
+// authenticated Notehub client and, unless it is a dry run, the deployment lock
+type deploymentSession struct {
+	client *notehub.Client
+	// report records signing in and taking the lock, which each file's report then shares
+	report *DeploymentReport
+}
+
+// startSession signs in to Notehub and takes the deployment lock for a multi-file run, so
+// its files are deployed without each signing in and locking again. The returned function
+// releases the lock. On failure, the session's report describes where it stopped.
+func startSession(ctx context.Context, config *DeploymentConfig) (session *deploymentSession, release func(), err error) {
+	report := newDeploymentReport(config)
+	report.retries = config.retryLedger()
+	session = &deploymentSession{client: newNotehubClient(config), report: report}
+	release = func() {}
+	defer report.endPhase()
+	defer func() {
+		if err != nil {
+			err = explainTimeout(ctx, err, report, config)
+			report.recordErrorPhase()
+			report.RetrySummary = report.retries.summary()
+		}
+	}()
+
+	report.startPhase("authenticate")
+	if err := authenticate(ctx, session.client, config, report); err != nil {
+		return session, release, fmt.Errorf("authentication failed: %w", err)
+	}
+	report.endPhase()
+
+	// A dry run changes nothing, so needs no lock
+	if config.DryRun {
+		return session, release, nil
+	}
+	release, err = acquireLockIfEnabled(ctx, session.client, config, report)
+	if err != nil {
+		return session, func() {}, err
+	}
+	return session, release, nil
+}
+
+// joinSession records in a file's report what its run recorded while signing in and
+// taking the lock
+func (r *DeploymentReport) joinSession(session *DeploymentReport) {
+	r.PhaseTimings = append(append([]PhaseTiming(nil), session.PhaseTimings...), r.PhaseTimings...)
+	r.tokenHandle = session.tokenHandle
+	r.RolloutID = session.RolloutID
+	r.LockWaitMs = session.LockWaitMs
+	r.LockContenders = session.LockContenders
+}
+
+// uploadedFilenames returns the names the run's firmware files were uploaded under, in
+// upload order, including a file whose later steps failed once it reached Notehub
+func (r *DeploymentReport) uploadedFilenames() []string {
+	if len(r.Files) == 0 {
+		if r.UploadedFilename == "" {
+			return nil
+		}
+		return []string{r.UploadedFilename}
+	}
+	var names []string
+	for _, f := range r.Files {
+		if f.UploadedFilename != "" {
+			names = append(names, f.UploadedFilename)
+		}
+	}
+	return names
+}
@@ -0,0 +1,238 @@
+package deploy
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeFirmwareFiles writes each named firmware file into a temporary directory and
+// returns the directory
+func writeFirmwareFiles(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("firmware"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestExpandFirmwareFiles(t *testing.T) {
+	dir := writeFirmwareFiles(t, "a.bin", "b.bin", "notes.txt")
+
+	tests := []struct {
+		name        string
+		value       string
+		expected    []string
+		expectError string
+	}{
+		{"single", "app.bin", []string{"app.bin"}, ""},
+		{"comma separated", "a.bin, b.bin", []string{"a.bin", "b.bin"}, ""},
+		{"newline separated", "a.bin\n\nb.bin\n", []string{"a.bin", "b.bin"}, ""},
+		{"glob", "*.bin", []string{filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")}, ""},
+		{"glob deduplicated", "*.bin," + filepath.Join(dir, "a.bin"), []string{filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")}, ""},
+		{"url not globbed", "https://example.com/app.bin?v=[1]", []string{"https://example.com/app.bin?v=[1]"}, ""},
+		{"no match", "*.hex", nil, `no firmware files match "*.hex"`},
+		{"empty", " , \n", nil, "firmware_file is required"},
+		{"traversal rejected", "a.bin, ../../etc/passwd", nil, "resolves outside the workspace"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := ExpandFirmwareFiles(dir, dir, tt.value)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(files, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, files)
+			}
+		})
+	}
+}
+
+func TestSelectDFUFile(t *testing.T) {
+	files := []string{"build/app.bin", "build/bootloader.bin", "other/app.bin"}
+
+	if i, err := SelectDFUFile(files, "build/bootloader.bin"); err != nil || i != 1 {
+		t.Errorf("Expected the path to select file 1, got %d, %v", i, err)
+	}
+	if i, err := SelectDFUFile(files, "bootloader.bin"); err != nil || i != 1 {
+		t.Errorf("Expected the base name to select file 1, got %d, %v", i, err)
+	}
+	if i, err := SelectDFUFile(files, "last"); err != nil || i != 2 {
+		t.Errorf("Expected last to select the last file, got %d, %v", i, err)
+	}
+	if i, err := SelectDFUFile([]string{"last", "app.bin"}, "last"); err != nil || i != 0 {
+		t.Errorf("Expected a file named last to take precedence, got %d, %v", i, err)
+	}
+	if i, err := SelectDFUFile(files[:1], ""); err != nil || i != 0 {
+		t.Errorf("Expected a single file to need no dfu_file, got %d, %v", i, err)
+	}
+	for dfuFile, expectError := range map[string]string{
+		"":           "requires dfu_file",
+		"app.bin":    "matches more than one",
+		"radio.bin":  "is not one of the firmware files",
+		"build/app":  "is not one of the firmware files",
+		"other/x.bi": "is not one of the firmware files",
+	} {
+		if _, err := SelectDFUFile(files, dfuFile); err == nil || !strings.Contains(err.Error(), expectError) {
+			t.Errorf("selectDFUFile(%q): expected error containing %q, got %v", dfuFile, expectError, err)
+		}
+	}
+}
+
+// newMultiFileNotehub serves uploads, the firmware listing and DFU requests. Uploads of
+// failName fail.
+func newMultiFileNotehub(t *testing.T, failName string) *fakeNotehub {
+	t.Helper()
+	routes := fakeRoutes{}
+	if failName != "" {
+		routes["PUT /projects/app:123/firmware/host/"+failName] = respondStatus(http.StatusBadRequest, `{"err":"invalid firmware"}`)
+	}
+	return newFakeNotehub(t, routes)
+}
+
+// multiFileCalls returns the successful uploads and the DFU requests received, in order
+func multiFileCalls(server *fakeNotehub) []string {
+	var calls []string
+	uploads := server.uploaded()
+	dfuBodies := server.bodies("POST /projects/app:123/dfu/host/update")
+	for _, r := range server.requests() {
+		switch {
+		case strings.HasPrefix(r, "PUT ") && len(uploads) > 0 && strings.HasSuffix(r, "/"+uploads[0]):
+			calls = append(calls, "upload "+uploads[0])
+			uploads = uploads[1:]
+		case strings.HasPrefix(r, "POST /projects/app:123/dfu/host/update"):
+			calls = append(calls, "dfu "+dfuBodies[0])
+			dfuBodies = dfuBodies[1:]
+		}
+	}
+	return calls
+}
+
+func multiFileDeployConfig(dir, serverURL string) *DeploymentConfig {
+	return &DeploymentConfig{
+		ProjectUID:    "app:123",
+		FirmwareDir:   dir,
+		DeviceUID:     "dev:1",
+		IssueDFU:      true,
+		APIBaseURL:    serverURL,
+		OAuthTokenURL: serverURL + "/oauth2/token",
+	}
+}
+
+func TestDeployFirmwareFiles_DFUFileDeployedLast(t *testing.T) {
+	dir := writeFirmwareFiles(t, "app.bin", "assets.bin", "bootloader.bin")
+	server := newMultiFileNotehub(t, "")
+
+	files, err := ExpandFirmwareFiles(dir, dir, "*.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := DeployFirmwareFiles(context.Background(), multiFileDeployConfig(dir, server.URL), files, "app.bin")
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	if calls := multiFileCalls(server); len(calls) != 4 || calls[0] != "upload assets.bin" || calls[1] != "upload bootloader.bin" || calls[2] != "upload app.bin" || !strings.Contains(calls[3], "app.bin") {
+		t.Errorf("Expected every upload, then a single DFU of app.bin, got %v", calls)
+	}
+	if got := report.uploadedFilenames(); !reflect.DeepEqual(got, []string{"assets.bin", "bootloader.bin", "app.bin"}) {
+		t.Errorf("Unexpected uploaded filenames %v", got)
+	}
+	if len(report.Files) != 3 || !report.Files[2].DFU || report.Files[0].DFU || report.Files[0].Status != StatusSuccess {
+		t.Errorf("Unexpected per-file results %+v", report.Files)
+	}
+	if !report.DFUTriggered || report.UploadedFilename != "app.bin" {
+		t.Errorf("Expected the report to describe the DFU of app.bin, got %+v", report)
+	}
+
+	outputs := report.Outputs()
+	for name, value := range map[string]string{
+		"uploaded_filenames":  `["assets.bin","bootloader.bin","app.bin"]`,
+		"uploaded_filename_1": "assets.bin",
+		"uploaded_filename_3": "app.bin",
+	} {
+		if outputs[name] != value {
+			t.Errorf("Output %s: expected %q, got %q", name, value, outputs[name])
+		}
+	}
+}
+
+func TestDeployFirmwareFiles_RequiresDFUFile(t *testing.T) {
+	dir := writeFirmwareFiles(t, "app.bin", "bootloader.bin")
+	server := newMultiFileNotehub(t, "")
+
+	_, err := DeployFirmwareFiles(context.Background(), multiFileDeployConfig(dir, server.URL), []string{"app.bin", "bootloader.bin"}, "")
+	if err == nil || !strings.Contains(err.Error(), "requires dfu_file") {
+		t.Fatalf("Expected dfu_file to be required, got %v", err)
+	}
+	if calls := multiFileCalls(server); len(calls) != 0 {
+		t.Errorf("Expected nothing uploaded before dfu_file was checked, got %v", calls)
+	}
+
+	// Without a DFU, every file is simply uploaded
+	config := multiFileDeployConfig(dir, server.URL)
+	config.IssueDFU = false
+	if _, err := DeployFirmwareFiles(context.Background(), config, []string{"app.bin", "bootloader.bin"}, ""); err != nil {
+		t.Fatalf("Upload-only deployment failed: %v", err)
+	}
+	if calls := multiFileCalls(server); !reflect.DeepEqual(calls, []string{"upload app.bin", "upload bootloader.bin"}) {
+		t.Errorf("Expected both files uploaded and no DFU, got %v", calls)
+	}
+}
+
+func TestDeployFirmwareFiles_FailureReportsEarlierUploads(t *testing.T) {
+	dir := writeFirmwareFiles(t, "a.bin", "b.bin", "c.bin")
+	server := newMultiFileNotehub(t, "b.bin")
+
+	report, err := DeployFirmwareFiles(context.Background(), multiFileDeployConfig(dir, server.URL), []string{"a.bin", "b.bin", "c.bin"}, "c.bin")
+	if err == nil || !strings.Contains(err.Error(), "firmware file 2 of 3 (b.bin) failed after uploading a.bin") {
+		t.Fatalf("Expected the failure to name the file and the earlier uploads, got %v", err)
+	}
+	if calls := multiFileCalls(server); !reflect.DeepEqual(calls, []string{"upload a.bin"}) {
+		t.Errorf("Expected the run to stop at the failed file, got %v", calls)
+	}
+	if len(report.Files) != 2 || report.Files[0].Status != StatusSuccess || report.Files[1].Status != StatusFailed || report.Files[1].Error == "" {
+		t.Errorf("Expected per-file results up to the failure, got %+v", report.Files)
+	}
+	if report.DFUTriggered {
+		t.Error("The DFU must not be issued when an earlier file failed")
+	}
+}
+
+func TestDeployFirmwareFiles_SignsInAndLocksOnce(t *testing.T) {
+	dir := writeFirmwareFiles(t, "a.bin", "b.bin", "c.bin")
+	server := newMultiFileNotehub(t, "")
+	env := &fakeEnvServer{vars: map[string]string{}}
+	server.handle("/projects/app:123/environment_variables", env.handle)
+	server.handle("/projects/app:123/environment_variables/*", env.handle)
+
+	config := multiFileDeployConfig(dir, server.URL)
+	config.Lock = &LockConfig{Enabled: true}
+	report, err := DeployFirmwareFiles(context.Background(), config, []string{"a.bin", "b.bin", "c.bin"}, "c.bin")
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	if tokens := server.count("POST /oauth2/token"); tokens != 1 {
+		t.Errorf("Expected one sign-in for the whole run, got %d", tokens)
+	}
+	if env.puts != 1 || server.count("DELETE /projects/app:123/environment_variables/") != 1 {
+		t.Errorf("Expected the lock taken and released once, got %d write(s) and %d release(s)", env.puts, server.count("DELETE /projects/app:123/environment_variables/"))
+	}
+	if report.RolloutID == "" || report.Outputs()["auth_ms"] == "" {
+		t.Errorf("Expected the report to record the run's sign-in and lock, got rollout %q and outputs %v", report.RolloutID, report.Outputs())
+	}
+}
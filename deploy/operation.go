@@ -0,0 +1,37 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Operations the action can perform
+const (
+	OperationDeploy   = "deploy"
+	OperationPromote  = "promote"
+	OperationValidate = "validate"
+	OperationCancel   = "cancel"
+	OperationAB       = "ab"
+
+	OperationExportBaseline = "export-baseline"
+)
+
+// ParseOperation validates the operation input
+func ParseOperation(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", OperationDeploy:
+		return OperationDeploy, nil
+	case OperationPromote:
+		return OperationPromote, nil
+	case OperationValidate:
+		return OperationValidate, nil
+	case OperationCancel:
+		return OperationCancel, nil
+	case OperationExportBaseline:
+		return OperationExportBaseline, nil
+	case OperationAB:
+		return OperationAB, nil
+	default:
+		return "", fmt.Errorf("invalid operation %q (accepted values: %s, %s, %s, %s, %s, %s)", value, OperationDeploy, OperationPromote, OperationValidate, OperationCancel, OperationExportBaseline, OperationAB)
+	}
+}
@@ -0,0 +1,129 @@
+package deploy
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Outputs returns the deployment results as the action's step outputs, by name. It
+// reflects how far the deployment got, whether or not it succeeded.
+func (r *DeploymentReport) Outputs() map[string]string {
+	outputs := map[string]string{}
+	outputs["deployment_status"] = r.Status
+	outputs["dfu_triggered"] = strconv.FormatBool(r.DFUTriggered)
+	outputs["dry_run"] = strconv.FormatBool(r.DryRun)
+	outputs["upload_skipped"] = strconv.FormatBool(r.UploadSkipped)
+	outputs["result_json"] = r.resultJSONOutput()
+	if r.ErrorPhase != "" {
+		outputs["error_phase"] = r.ErrorPhase
+	}
+	if len(r.ConfigProvenance) > 0 {
+		provenance, _ := json.Marshal(r.ConfigProvenance)
+		outputs["config_provenance"] = string(provenance)
+	}
+	if r.PendingBeforeCancel != nil {
+		outputs["pending_before_cancel"] = strconv.Itoa(len(r.PendingBeforeCancel))
+	}
+	if r.TargetPreview != nil {
+		outputs["target_device_count"] = strconv.Itoa(r.TargetPreview.Count)
+	}
+	if c := r.Canary; c != nil {
+		canary, _ := json.Marshal(c.DeviceUIDs)
+		remaining, _ := json.Marshal(c.RemainingDeviceUIDs)
+		outputs["canary_devices"] = string(canary)
+		outputs["remaining_devices"] = string(remaining)
+	}
+	if r.ResolvedFleetUID != "" {
+		outputs["resolved_fleet_uid"] = r.ResolvedFleetUID
+	}
+	if len(r.ResolvedTargets) > 0 {
+		resolved, _ := json.Marshal(r.ResolvedTargets)
+		outputs["resolved_targets"] = string(resolved)
+	}
+	if r.ABComparison != nil {
+		comparison, _ := json.Marshal(r.ABComparison)
+		outputs["ab_comparison"] = string(comparison)
+	}
+	if r.tokenHandle != "" {
+		outputs["token_handle"] = r.tokenHandle
+	}
+	if r.ScheduledAt != "" {
+		outputs["scheduled_at"] = r.ScheduledAt
+	}
+	if summary := r.RetrySummary; summary != nil {
+		outputs["total_retries"] = strconv.Itoa(summary.TotalRetries)
+		outputs["retried_devices"] = strconv.Itoa(summary.RetriedDevices)
+	}
+	if r.DFUDeviceCount > 0 {
+		outputs["dfu_device_count"] = strconv.Itoa(r.DFUDeviceCount)
+	}
+	if len(r.TriggerTimes) > 0 {
+		triggers, _ := json.Marshal(r.TriggerTimes)
+		outputs["trigger_times"] = string(triggers)
+	}
+	if r.UploadedFilename != "" {
+		outputs["uploaded_filename"] = r.UploadedFilename
+		// firmware_filename is the original name of uploaded_filename
+		outputs["firmware_filename"] = r.UploadedFilename
+	}
+	if names := r.uploadedFilenames(); len(names) > 0 {
+		uploaded, _ := json.Marshal(names)
+		outputs["uploaded_filenames"] = string(uploaded)
+		// Numbered outputs save workflows parsing the JSON for a multi-file run
+		if len(r.Files) > 1 {
+			for i, name := range names {
+				outputs["uploaded_filename_"+strconv.Itoa(i+1)] = name
+			}
+		}
+	}
+	if len(r.DeletedFirmware) > 0 {
+		outputs["deleted_firmware"] = strings.Join(r.DeletedFirmware, ",")
+	}
+	if id := r.ArtifactIdentity; id != nil {
+		identity, _ := json.Marshal(id)
+		outputs["artifact_identity"] = string(identity)
+		outputs["firmware_size"] = strconv.FormatInt(id.Size, 10)
+		outputs["firmware_sha256"] = id.SHA256
+		outputs["firmware_sha1"] = id.SHA1
+		outputs["firmware_md5"] = id.MD5
+		outputs["firmware_crc32"] = id.CRC32
+	}
+	if len(r.LockContenders) > 0 {
+		outputs["lock_wait_seconds"] = strconv.FormatInt(r.LockWaitMs/1000, 10)
+	}
+	if len(r.DeviceStates) > 0 {
+		states, _ := json.Marshal(r.DeviceStates)
+		outputs["device_states"] = string(states)
+	}
+	if len(r.DeviceReport) > 0 {
+		entries, _ := json.Marshal(r.DeviceReport)
+		outputs["device_report"] = string(entries)
+		counts := deviceOutcomeCounts(r.DeviceReport)
+		outputs["devices_completed"] = strconv.Itoa(counts[DeviceOutcomeCompleted])
+		outputs["devices_failed"] = strconv.Itoa(counts[DeviceOutcomeError])
+		outputs["devices_unfinished"] = strconv.Itoa(counts[DeviceOutcomePending] + counts[DeviceOutcomeNotRetrieved])
+	}
+	if len(r.ProgressSamples) > 0 {
+		outputs["slow_rollout"] = strconv.FormatBool(len(r.BaselineAnomalies) > 0)
+	}
+	if r.Validation != nil {
+		checks, _ := json.Marshal(r.Validation.Checks)
+		outputs["validation_checks"] = string(checks)
+		outputs["checks_performed"] = strings.Join(r.Validation.performed(), ",")
+		outputs["checks_skipped"] = strings.Join(r.Validation.skipped(), ",")
+		outputs["validated"] = strconv.FormatBool(len(r.Validation.failed()) == 0)
+		if r.Validation.ProjectName != "" {
+			outputs["project_name"] = r.Validation.ProjectName
+		}
+	}
+	for _, step := range stepTimings {
+		if d, ok := r.phaseDuration(step.phase); ok {
+			outputs[step.output] = strconv.FormatInt(d.Milliseconds(), 10)
+		}
+	}
+	if r.UploadThroughputBps > 0 {
+		outputs["upload_throughput_bps"] = strconv.FormatInt(r.UploadThroughputBps, 10)
+	}
+	return outputs
+}
@@ -0,0 +1,178 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestOutputs_Deployed(t *testing.T) {
+	report := &DeploymentReport{
+		UploadedFilename:    "app$20250101.bin",
+		DFUTriggered:        true,
+		Status:              StatusSuccess,
+		UploadThroughputBps: 2048,
+		DFUDeviceCount:      12,
+		DeviceStates:        []notehub.DeviceDFUState{{DeviceUID: "dev:1", Status: notehub.DFUStateCompleted}},
+	}
+	outputs := report.Outputs()
+
+	expected := map[string]string{
+		"deployment_status":     "success",
+		"dfu_triggered":         "true",
+		"uploaded_filename":     "app$20250101.bin",
+		"firmware_filename":     "app$20250101.bin",
+		"upload_throughput_bps": "2048",
+		"dfu_device_count":      "12",
+		"device_states":         `[{"device_uid":"dev:1","status":"completed"}]`,
+	}
+	for name, value := range expected {
+		if outputs[name] != value {
+			t.Errorf("Output %s: expected %q, got %q", name, value, outputs[name])
+		}
+	}
+	if _, ok := outputs["lock_wait_seconds"]; ok {
+		t.Error("lock_wait_seconds should only be set when the lock was contended")
+	}
+}
+
+func TestOutputs_Scheduled(t *testing.T) {
+	outputs := (&DeploymentReport{DFUTriggered: true, ScheduledAt: "2025-06-02T02:00:00Z", Status: StatusSuccess}).Outputs()
+
+	if outputs["scheduled_at"] != "2025-06-02T02:00:00Z" {
+		t.Errorf("Expected scheduled_at output, got %q", outputs["scheduled_at"])
+	}
+}
+
+func TestOutputs_UploadOnly(t *testing.T) {
+	outputs := (&DeploymentReport{UploadedFilename: "app.bin", Status: StatusSuccess}).Outputs()
+
+	if outputs["uploaded_filename"] != "app.bin" {
+		t.Errorf("Expected uploaded_filename on the upload-only path, got %q", outputs["uploaded_filename"])
+	}
+	if outputs["dfu_triggered"] != "false" {
+		t.Errorf("Expected dfu_triggered=false, got %q", outputs["dfu_triggered"])
+	}
+}
+
+func TestOutputs_DryRun(t *testing.T) {
+	outputs := (&DeploymentReport{DryRun: true, Status: StatusSuccess}).Outputs()
+
+	if outputs["dry_run"] != "true" || outputs["dfu_triggered"] != "false" || outputs["deployment_status"] != "success" {
+		t.Errorf("Unexpected dry run outputs %v", outputs)
+	}
+}
+
+func TestOutputs_FailedBeforeUpload(t *testing.T) {
+	outputs := (&DeploymentReport{Status: StatusFailed}).Outputs()
+
+	if outputs["deployment_status"] != "failed" || outputs["dfu_triggered"] != "false" {
+		t.Errorf("Unexpected outputs %v", outputs)
+	}
+	if _, ok := outputs["uploaded_filename"]; ok {
+		t.Error("uploaded_filename should not be set when nothing was uploaded")
+	}
+}
+
+func TestOutputs_Validation(t *testing.T) {
+	report := &DeploymentReport{
+		Status: StatusSuccess,
+		Validation: &ValidationResult{Checks: []ValidationCheck{
+			{Name: "firmware_file", Status: CheckPassed},
+			{Name: "authentication", Status: CheckPassed},
+			{Name: "device_targeting", Status: CheckSkipped, Detail: "too expensive"},
+		}},
+	}
+	outputs := report.Outputs()
+
+	if outputs["checks_performed"] != "firmware_file,authentication" {
+		t.Errorf("Unexpected checks_performed %q", outputs["checks_performed"])
+	}
+	if outputs["checks_skipped"] != "device_targeting" {
+		t.Errorf("Unexpected checks_skipped %q", outputs["checks_skipped"])
+	}
+	if !strings.Contains(outputs["validation_checks"], `"detail":"too expensive"`) {
+		t.Errorf("Expected validation_checks to include skip reasons, got %q", outputs["validation_checks"])
+	}
+}
+
+func TestOutputs_ArtifactIdentity(t *testing.T) {
+	id, err := computeArtifactIdentity(strings.NewReader("firmware"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := (&DeploymentReport{Status: StatusSuccess, ArtifactIdentity: id}).Outputs()
+
+	expected := map[string]string{
+		"firmware_size":   "8",
+		"firmware_sha256": testFirmwareSHA256,
+		"firmware_crc32":  "d5ecd7c4",
+	}
+	for name, value := range expected {
+		if outputs[name] != value {
+			t.Errorf("Output %s: expected %q, got %q", name, value, outputs[name])
+		}
+	}
+	if !strings.HasPrefix(outputs["artifact_identity"], `{"size":8,"sha256":"`+testFirmwareSHA256) {
+		t.Errorf("Unexpected artifact_identity %q", outputs["artifact_identity"])
+	}
+}
+
+func TestOutputs_StepTimings(t *testing.T) {
+	report := &DeploymentReport{PhaseTimings: []PhaseTiming{
+		{Phase: "authenticate", DurationMs: 120},
+		{Phase: "upload", DurationMs: 3000},
+		{Phase: "verify_upload", DurationMs: 40},
+		{Phase: "upload", DurationMs: 500},
+	}}
+	outputs := report.Outputs()
+
+	if outputs["auth_ms"] != "120" || outputs["upload_ms"] != "3500" {
+		t.Errorf("Expected auth_ms=120 and upload_ms summed across files, got %v", outputs)
+	}
+	if _, ok := outputs["dfu_ms"]; ok {
+		t.Error("dfu_ms should not be set when no DFU was issued")
+	}
+}
+
+func TestDeployFirmware_StepTimingOutputs(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+	report, err := DeployFirmware(context.Background(), server.config(t))
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	outputs := report.Outputs()
+	for _, name := range []string{"auth_ms", "upload_ms", "dfu_ms"} {
+		if ms, err := strconv.ParseInt(outputs[name], 10, 64); err != nil || ms < 0 {
+			t.Errorf("Expected %s to be a number of milliseconds, got %q", name, outputs[name])
+		}
+	}
+}
+
+func TestOutputs_ErrorPhase(t *testing.T) {
+	tests := []struct {
+		name     string
+		report   *DeploymentReport
+		expected string
+	}{
+		{"in a phase", &DeploymentReport{timedPhase: "upload"}, "upload"},
+		{"between phases", &DeploymentReport{PhaseTimings: []PhaseTiming{{Phase: "authenticate"}, {Phase: "verify_upload"}}}, "verify_upload"},
+		{"before any phase", &DeploymentReport{}, PhaseConfiguration},
+		{"already recorded", &DeploymentReport{ErrorPhase: "trigger_dfu", timedPhase: "retention"}, "trigger_dfu"},
+	}
+	for _, tt := range tests {
+		tt.report.RecordFailure(errors.New("failed"))
+		if got := tt.report.Outputs()["error_phase"]; got != tt.expected || tt.report.Status != StatusFailed {
+			t.Errorf("%s: expected error_phase %q on a failed report, got %q", tt.name, tt.expected, got)
+		}
+	}
+
+	if _, ok := (&DeploymentReport{Status: StatusSuccess}).Outputs()["error_phase"]; ok {
+		t.Error("error_phase should not be set when the deployment succeeded")
+	}
+}
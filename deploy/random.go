@@ -0,0 +1,32 @@
+package deploy
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// newRandomSeed returns a seed for the run's random number generator from crypto/rand, so
+// unseeded runs differ while any run can still be replayed from its logged seed
+func newRandomSeed() (int64, error) {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("failed to generate random seed: %w", err)
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]) >> 1), nil
+}
+
+// ParseRandomSeed parses the random_seed input, generating a seed when it is empty
+func ParseRandomSeed(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return newRandomSeed()
+	}
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid random_seed %q: must be an integer", value)
+	}
+	return seed, nil
+}
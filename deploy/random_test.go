@@ -0,0 +1,103 @@
+package deploy
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseRandomSeed(t *testing.T) {
+	if seed, err := ParseRandomSeed(" 42 "); err != nil || seed != 42 {
+		t.Errorf("Expected seed 42, got %d, %v", seed, err)
+	}
+	if _, err := ParseRandomSeed("forty-two"); err == nil {
+		t.Error("Expected an error for a non-integer seed")
+	}
+
+	a, errA := ParseRandomSeed("")
+	b, errB := ParseRandomSeed("")
+	if errA != nil || errB != nil || a < 0 || a == b {
+		t.Errorf("Expected distinct non-negative generated seeds, got %d, %d (%v, %v)", a, b, errA, errB)
+	}
+}
+
+func TestDeploymentConfigRandom_DeterministicForSeed(t *testing.T) {
+	draw := func(seed int64) []int64 {
+		config := &DeploymentConfig{RandomSeed: seed}
+		rng := config.random()
+
+		// A copy made afterwards shares the generator rather than restarting it
+		copied := *config
+		return []int64{rng.Int63(), copied.random().Int63(), rng.Int63()}
+	}
+
+	a, b := draw(7), draw(7)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("Expected the same sequence for the same seed, got %v and %v", a, b)
+		}
+	}
+	if a[0] == a[1] {
+		t.Errorf("Expected the copied config to continue the sequence, got %v", a)
+	}
+}
+
+// seedableRandFuncs are the math/rand identifiers that don't use the global source
+var seedableRandFuncs = map[string]bool{"New": true, "NewSource": true, "NewZipf": true, "Rand": true, "Source": true, "Source64": true, "Zipf": true}
+
+// TestNoGlobalRand enforces that randomized behavior draws from the run's seeded
+// generator: no non-test source file may call the global math/rand functions
+func TestNoGlobalRand(t *testing.T) {
+	var files []string
+	for _, dir := range []string{".", filepath.Join("..", "internal")} {
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() && strings.HasSuffix(path, ".go") && !strings.HasSuffix(path, "_test.go") {
+				files = append(files, path)
+			}
+			return err
+		})
+	}
+	if len(files) == 0 {
+		t.Fatal("Found no source files to check")
+	}
+
+	fset := token.NewFileSet()
+	for _, path := range files {
+		file, err := parser.ParseFile(fset, path, nil, parser.ImportsOnly|parser.ParseComments)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		name := ""
+		for _, spec := range file.Imports {
+			if p, _ := strconv.Unquote(spec.Path.Value); p == "math/rand" || p == "math/rand/v2" {
+				name = "rand"
+				if spec.Name != nil {
+					name = spec.Name.Name
+				}
+			}
+		}
+		if name == "" {
+			continue
+		}
+
+		file, err = parser.ParseFile(fset, path, nil, 0)
+		if err != nil {
+			t.Fatalf("Failed to parse %s: %v", path, err)
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			sel, ok := n.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if pkg, ok := sel.X.(*ast.Ident); ok && pkg.Name == name && pkg.Obj == nil && !seedableRandFuncs[sel.Sel.Name] {
+				t.Errorf("%s: global %s.%s; draw from the run's seeded generator instead", fset.Position(sel.Pos()), name, sel.Sel.Name)
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// IsFirmwareURL reports whether firmware_file names an http(s) URL rather than a local path
+func IsFirmwareURL(value string) bool {
+	lower := strings.ToLower(value)
+	return strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://")
+}
+
+// DisplayFirmwareFile returns firmware_file as it may be logged and reported. URLs lose
+// their query and credentials, which for presigned URLs grant access to the artifact.
+func DisplayFirmwareFile(value string) string {
+	if !IsFirmwareURL(value) {
+		return value
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return notehub.Redact(value)
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
+
+// firmwareBaseName returns the name firmware_file is uploaded under, before any channel
+// prefix: the last element of the local path or of the URL path
+func firmwareBaseName(value string) string {
+	if IsFirmwareURL(value) {
+		if u, err := url.Parse(value); err == nil {
+			return path.Base(u.Path)
+		}
+	}
+	return filepath.Base(value)
+}
+
+// fetchFirmware streams the firmware at rawURL into a temporary file named after the URL
+// path, so it can be checked and uploaded like a local file. The returned cleanup removes
+// the file. timeout bounds the whole download.
+func fetchFirmware(ctx context.Context, config *DeploymentConfig, rawURL string, timeout time.Duration) (string, func(), error) {
+	display := DisplayFirmwareFile(rawURL)
+	name := firmwareBaseName(rawURL)
+	if name == "" || name == "/" || name == "." {
+		return "", nil, fmt.Errorf("cannot determine the firmware filename from %s; the URL path must end in the filename", display)
+	}
+	if timeout <= 0 {
+		timeout = notehub.DefaultTimeout
+	}
+
+	config.logf("Downloading firmware from %s...", display)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid firmware URL %s: %w", display, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		// Transport errors include the full URL, which may be presigned
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			urlErr.URL = display
+		}
+		return "", nil, fmt.Errorf("firmware download failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", nil, fmt.Errorf("firmware download from %s failed with status %d", display, resp.StatusCode)
+	}
+
+	dir, err := os.MkdirTemp("", "firmware-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create download directory: %w", err)
+	}
+	cleanup := func() { os.RemoveAll(dir) }
+
+	firmwarePath := filepath.Join(dir, name)
+	f, err := os.Create(firmwarePath)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to create download file: %w", err)
+	}
+	size, err := io.Copy(f, resp.Body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("firmware download from %s failed after %d bytes: %w", display, size, err)
+	}
+	if resp.ContentLength >= 0 && size != resp.ContentLength {
+		cleanup()
+		return "", nil, fmt.Errorf("firmware download from %s was truncated: got %d of %d bytes", display, size, resp.ContentLength)
+	}
+
+	config.logf("✅ Downloaded %d bytes", size)
+	return firmwarePath, cleanup, nil
+}
@@ -0,0 +1,134 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIsFirmwareURL(t *testing.T) {
+	for value, expected := range map[string]bool{
+		"https://bucket.s3.amazonaws.com/app.bin": true,
+		"HTTP://example.com/app.bin":              true,
+		"app.bin":                                 false,
+		"build/https-app.bin":                     false,
+		"/tmp/http://app.bin":                     false,
+	} {
+		if got := IsFirmwareURL(value); got != expected {
+			t.Errorf("isFirmwareURL(%q) = %t, expected %t", value, got, expected)
+		}
+	}
+}
+
+func TestDisplayFirmwareFile(t *testing.T) {
+	tests := map[string]string{
+		"https://user:pw@bucket.example.com/builds/app.bin?X-Amz-Signature=abc#x": "https://bucket.example.com/builds/app.bin",
+		"build/app.bin": "build/app.bin",
+	}
+	for value, expected := range tests {
+		if got := DisplayFirmwareFile(value); got != expected {
+			t.Errorf("displayFirmwareFile(%q) = %q, expected %q", value, got, expected)
+		}
+	}
+	if got := firmwareBaseName("https://bucket.example.com/builds/app%20v2.bin?sig=1"); got != "app v2.bin" {
+		t.Errorf("Expected the URL's last path element, got %q", got)
+	}
+}
+
+func TestFetchFirmware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/builds/app.bin":
+			fmt.Fprint(w, "firmware")
+		case "/slow.bin":
+			time.Sleep(200 * time.Millisecond)
+		default:
+			http.Error(w, "AccessDenied", http.StatusForbidden)
+		}
+	}))
+	defer server.Close()
+
+	path, cleanup, err := fetchFirmware(context.Background(), &DeploymentConfig{}, server.URL+"/builds/app.bin?X-Amz-Signature=s3cr3t", time.Second)
+	if err != nil {
+		t.Fatalf("fetchFirmware failed: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if filepath.Base(path) != "app.bin" || string(data) != "firmware" {
+		t.Errorf("Expected app.bin containing the firmware, got %s containing %q", path, data)
+	}
+	cleanup()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected cleanup to remove the download, got %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		url         string
+		expectError string
+	}{
+		{"forbidden", server.URL + "/private.bin?X-Amz-Signature=s3cr3t", "status 403"},
+		{"timeout", server.URL + "/slow.bin?X-Amz-Signature=s3cr3t", "firmware download failed"},
+		{"no filename", server.URL + "/?X-Amz-Signature=s3cr3t", "cannot determine the firmware filename"},
+		{"unreachable", "http://127.0.0.1:0/app.bin?X-Amz-Signature=s3cr3t", "firmware download failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := fetchFirmware(context.Background(), &DeploymentConfig{}, tt.url, 50*time.Millisecond)
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+			if strings.Contains(err.Error(), "s3cr3t") {
+				t.Errorf("Presigned URL leaked into error: %v", err)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_FromURL(t *testing.T) {
+	artifacts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "firmware")
+	}))
+	defer artifacts.Close()
+
+	server := newFakeNotehub(t, nil)
+
+	report, err := DeployFirmware(context.Background(), &DeploymentConfig{
+		ProjectUID:    "app:123",
+		FirmwareFile:  artifacts.URL + "/builds/app.bin?X-Amz-Signature=s3cr3t",
+		APIBaseURL:    server.URL,
+		OAuthTokenURL: server.URL + "/oauth2/token",
+	})
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if data, _ := server.firmware("app.bin"); server.count("PUT /projects/app:123/firmware/host/app.bin") != 1 || string(data) != "firmware" {
+		t.Errorf("Expected the downloaded firmware uploaded as app.bin, got %v with %q", server.requests(), data)
+	}
+	if report.FirmwareSHA256 != testFirmwareSHA256 || strings.Contains(report.FirmwareFile, "s3cr3t") {
+		t.Errorf("Expected the checksum of the download and no presigned query in the report, got %+v", report)
+	}
+
+	// A local path is still read from disk
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	server.addFirmware("app.bin", nil)
+	if _, err := DeployFirmware(context.Background(), &DeploymentConfig{
+		ProjectUID:    "app:123",
+		FirmwareFile:  firmwareFile,
+		APIBaseURL:    server.URL,
+		OAuthTokenURL: server.URL + "/oauth2/token",
+	}); err != nil || len(server.uploaded()) != 2 {
+		t.Errorf("Expected the local file to be uploaded, got %v, %v", server.uploaded(), err)
+	}
+	if data, _ := server.firmware("app.bin"); string(data) != "firmware" {
+		t.Errorf("Expected the local file's contents uploaded, got %q", data)
+	}
+}
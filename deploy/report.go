@@ -0,0 +1,230 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// DeploymentReport captures the progress and results of a deployment run
+type DeploymentReport struct {
+	Phase               string                   `json:"phase"`
+	ProjectUID          string                   `json:"project_uid"`
+	FirmwareFile        string                   `json:"firmware_file"`
+	FirmwareType        string                   `json:"firmware_type"`
+	DryRun              bool                     `json:"dry_run,omitempty"`
+	RandomSeed          int64                    `json:"random_seed"`
+	ConfigProvenance    map[string]string        `json:"config_provenance,omitempty"`
+	RolloutID           string                   `json:"rollout_id,omitempty"`
+	LockWaitMs          int64                    `json:"lock_wait_ms,omitempty"`
+	LockContenders      []string                 `json:"lock_contenders,omitempty"`
+	UploadedFilename    string                   `json:"uploaded_filename,omitempty"`
+	UploadSkipped       bool                     `json:"upload_skipped,omitempty"`
+	ReusedFirmware      *ReusedFirmware          `json:"reused_firmware,omitempty"`
+	VersionCheck        *VersionCheck            `json:"version_check,omitempty"`
+	Files               []FileResult             `json:"files,omitempty"`
+	DeletedFirmware     []string                 `json:"deleted_firmware,omitempty"`
+	WouldDeleteFirmware []string                 `json:"would_delete_firmware,omitempty"`
+	Promotion           *PromotionRecord         `json:"promotion,omitempty"`
+	FirmwareSize        int64                    `json:"firmware_size,omitempty"`
+	FirmwareSHA256      string                   `json:"firmware_sha256,omitempty"`
+	ArtifactIdentity    *ArtifactIdentity        `json:"artifact_identity,omitempty"`
+	TargetingParams     string                   `json:"targeting_params,omitempty"`
+	ExtraDFUParams      string                   `json:"unvalidated_dfu_params,omitempty"`
+	ResolvedFleetUID    string                   `json:"resolved_fleet_uid,omitempty"`
+	ResolvedTargets     []ResolvedTarget         `json:"resolved_targets,omitempty"`
+	UploadDurationMs    int64                    `json:"upload_duration_ms,omitempty"`
+	UploadThroughputBps int64                    `json:"upload_throughput_bps,omitempty"`
+	ResolvedDevices     int                      `json:"resolved_devices,omitempty"`
+	TargetPreview       *TargetPreview           `json:"target_preview,omitempty"`
+	Canary              *CanarySelection         `json:"canary,omitempty"`
+	SKUVerdicts         []SKUVerdict             `json:"sku_verdicts,omitempty"`
+	ExcludedDevices     []ExcludedDevice         `json:"excluded_devices,omitempty"`
+	FrozenTargets       *FrozenTargets           `json:"frozen_targets,omitempty"`
+	TargetDrift         *TargetDrift             `json:"target_drift,omitempty"`
+	DFUTriggered        bool                     `json:"dfu_triggered"`
+	DFUWithheld         string                   `json:"dfu_withheld,omitempty"`
+	ScheduledAt         string                   `json:"scheduled_at,omitempty"`
+	TriggerTimes        []TriggerTime            `json:"trigger_times,omitempty"`
+	DFURequestIDs       []string                 `json:"dfu_request_ids,omitempty"`
+	DFUDeviceCount      int                      `json:"dfu_device_count,omitempty"`
+	DFUResponses        []notehub.DFUResponse    `json:"dfu_responses,omitempty"`
+	PendingBeforeCancel []string                 `json:"pending_before_cancel,omitempty"`
+	DFUCancelledOnAbort bool                     `json:"dfu_cancelled_on_abort,omitempty"`
+	DeviceStates        []notehub.DeviceDFUState `json:"device_states,omitempty"`
+	DeviceReport        []DeviceReportEntry      `json:"device_report,omitempty"`
+	FollowStages        []DFUStage               `json:"follow_stages,omitempty"`
+	ProgressSamples     []ProgressSample         `json:"progress_samples,omitempty"`
+	ABComparison        *ABComparison            `json:"ab_comparison,omitempty"`
+	BaselineAnomalies   []BaselineAnomaly        `json:"baseline_anomalies,omitempty"`
+	Validation          *ValidationResult        `json:"validation,omitempty"`
+	PhaseTimings        []PhaseTiming            `json:"phase_timings,omitempty"`
+	RetrySummary        *RetrySummary            `json:"retry_summary,omitempty"`
+	Status              string                   `json:"status"`
+	Error               string                   `json:"error,omitempty"`
+	ErrorPhase          string                   `json:"error_phase,omitempty"`
+
+	timedPhase      string
+	timedPhaseStart time.Time
+	retries         *retryLedger
+
+	// tokenHandle is set as an output only; the report file has no use for it
+	tokenHandle string
+}
+
+// PhaseTiming records when a deployment phase started and how long it took
+type PhaseTiming struct {
+	Phase      string `json:"phase"`
+	StartedAt  string `json:"started_at,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// startPhase ends the phase being timed, if any, and starts timing phase
+func (r *DeploymentReport) startPhase(phase string) {
+	r.endPhase()
+	r.timedPhase = phase
+	r.timedPhaseStart = time.Now()
+	if r.retries != nil {
+		r.retries.setPhase(phase)
+	}
+}
+
+// endPhase records the duration of the phase being timed. Deferring it records the phase
+// a failed deployment stopped in, so the report shows where its time went.
+func (r *DeploymentReport) endPhase() {
+	if r.timedPhase == "" {
+		return
+	}
+	r.PhaseTimings = append(r.PhaseTimings, PhaseTiming{
+		Phase:      r.timedPhase,
+		StartedAt:  r.timedPhaseStart.UTC().Format(triggerTimeFormat),
+		DurationMs: time.Since(r.timedPhaseStart).Milliseconds(),
+	})
+	r.timedPhase = ""
+	if r.retries != nil {
+		r.retries.setPhase("")
+	}
+}
+
+// PhaseConfiguration is the error_phase of a run that failed before its first phase
+const PhaseConfiguration = "configuration"
+
+// RecordFailure marks the report failed with err
+func (r *DeploymentReport) RecordFailure(err error) {
+	r.Status = StatusFailed
+	r.Error = err.Error()
+	r.recordErrorPhase()
+}
+
+// recordErrorPhase notes the phase a failed deployment stopped in, or else the last phase
+// it finished, unless one is already recorded
+func (r *DeploymentReport) recordErrorPhase() {
+	switch {
+	case r.ErrorPhase != "":
+	case r.timedPhase != "":
+		r.ErrorPhase = r.timedPhase
+	case len(r.PhaseTimings) > 0:
+		r.ErrorPhase = r.PhaseTimings[len(r.PhaseTimings)-1].Phase
+	default:
+		r.ErrorPhase = PhaseConfiguration
+	}
+}
+
+// stepTimings names the phases whose durations are set as the auth_ms, upload_ms and
+// dfu_ms outputs, in that order
+var stepTimings = []struct{ output, phase string }{
+	{"auth_ms", "authenticate"},
+	{"upload_ms", "upload"},
+	{"dfu_ms", "trigger_dfu"},
+}
+
+// phaseDuration returns the total time spent in phase, which a multi-file deployment
+// may enter once per file, and whether the run reached it
+func (r *DeploymentReport) phaseDuration(phase string) (time.Duration, bool) {
+	var total time.Duration
+	found := false
+	for _, p := range r.PhaseTimings {
+		if p.Phase == phase {
+			total += time.Duration(p.DurationMs) * time.Millisecond
+			found = true
+		}
+	}
+	return total, found
+}
+
+// recordDFUResponse adds what Notehub reported about a DFU trigger to the report, keeping
+// each response in full. Device counts are summed, since a large device list is triggered
+// in batches.
+func (r *DeploymentReport) recordDFUResponse(resp *notehub.DFUResponse) {
+	r.DFUResponses = append(r.DFUResponses, *resp)
+	if resp.RequestID != "" {
+		r.DFURequestIDs = append(r.DFURequestIDs, resp.RequestID)
+	}
+	r.DFUDeviceCount += resp.DeviceCount
+}
+
+// Deployment status values recorded in the report
+const (
+	StatusInProgress = "in_progress"
+	StatusSuccess    = "success"
+	StatusFailed     = "failed"
+)
+
+// newDeploymentReport creates a report seeded from the deployment configuration
+func newDeploymentReport(config *DeploymentConfig) *DeploymentReport {
+	return &DeploymentReport{
+		ProjectUID:   config.ProjectUID,
+		FirmwareFile: DisplayFirmwareFile(config.FirmwareFile),
+		FirmwareType: notehub.FirmwareTypeOrDefault(config.FirmwareType),
+		DryRun:       config.DryRun,
+		RandomSeed:   config.RandomSeed,
+		Status:       StatusInProgress,
+
+		ConfigProvenance: config.ConfigProvenance,
+	}
+}
+
+// logExcludedDevices prints the devices removed from the DFU and why
+func logExcludedDevices(config *DeploymentConfig, excluded []ExcludedDevice) {
+	if len(excluded) == 0 {
+		return
+	}
+
+	config.logf("Excluded Devices: %d", len(excluded))
+	for _, e := range excluded {
+		config.logf("  - %s: %s", e.DeviceUID, e.Reason)
+	}
+}
+
+// WriteReport saves the report as JSON so it can be kept as a workflow artifact
+func WriteReport(path string, report *DeploymentReport) error {
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment report: %w", err)
+	}
+	if err := writeFileSynced(path, data); err != nil {
+		return fmt.Errorf("failed to write deployment report: %w", err)
+	}
+	return nil
+}
+
+// writeFileSynced writes data to path and syncs it before closing, so the contents survive
+// an immediate process exit
+func writeFileSynced(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,48 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteReport_RoundTrip(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/update": respond(`{"success":true,"message":"queued","request_id":"dfu:1","device_count":2}`),
+	})
+	config := server.config(t)
+	useRecordingLogger(config)
+	config.DeviceUID = "dev:1,dev:2"
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := WriteReport(path, report); err != nil {
+		t.Fatalf("WriteReport failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Report was not written: %v", err)
+	}
+	var written DeploymentReport
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatalf("Report does not round-trip: %v", err)
+	}
+
+	if written.ProjectUID != "app:123" || written.UploadedFilename != "app.bin" || written.FirmwareSHA256 != testFirmwareSHA256 {
+		t.Errorf("Unexpected identity in the report: %+v", written)
+	}
+	if written.TargetingParams != report.TargetingParams || written.TargetingParams == "" {
+		t.Errorf("Expected targeting params %q, got %q", report.TargetingParams, written.TargetingParams)
+	}
+	if written.Status != StatusSuccess || len(written.PhaseTimings) == 0 || written.PhaseTimings[0].StartedAt == "" {
+		t.Errorf("Expected a successful status and timestamped phases, got %s and %+v", written.Status, written.PhaseTimings)
+	}
+	if len(written.DFUResponses) != 1 || written.DFUResponses[0].Message != "queued" || written.DFUResponses[0].RequestID != "dfu:1" {
+		t.Errorf("Expected the DFU response in the report, got %+v", written.DFUResponses)
+	}
+}
@@ -0,0 +1,77 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// ResolvedTarget records the device UID a serial number or device name resolved to
+type ResolvedTarget struct {
+	Input     string `json:"input"`
+	Value     string `json:"value"`
+	DeviceUID string `json:"device_uid"`
+}
+
+// resolveDeviceIdentifiers maps each of values to the UID of the one device whose field
+// equals it, returning the values that matched no device or several
+func resolveDeviceIdentifiers(devices []notehub.Device, input string, values []string, field func(notehub.Device) string) ([]ResolvedTarget, []string) {
+	var resolved []ResolvedTarget
+	var problems []string
+	for _, v := range values {
+		var uids []string
+		for _, d := range devices {
+			if field(d) == v {
+				uids = append(uids, d.UID)
+			}
+		}
+		switch len(uids) {
+		case 0:
+			problems = append(problems, fmt.Sprintf("%s %q matches no device", input, v))
+		case 1:
+			resolved = append(resolved, ResolvedTarget{Input: input, Value: v, DeviceUID: uids[0]})
+		default:
+			problems = append(problems, fmt.Sprintf("%s %q matches %d devices (%s)", input, v, len(uids), strings.Join(uids, ", ")))
+		}
+	}
+	return resolved, problems
+}
+
+// applyResolveTargets looks up the serial numbers and device names of a resolve_targets
+// deployment in the project's devices and targets their UIDs instead, so a serial number
+// that exists nowhere fails the deployment rather than silently updating nothing. It
+// fails listing every value that matched no device or several.
+func applyResolveTargets(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport) (*DeploymentConfig, error) {
+	if !config.ResolveTargets || (config.SerialNumber == "" && config.DeviceName == "") {
+		return config, nil
+	}
+
+	report.startPhase("resolve_identifiers")
+	devices, err := client.ListDevices(ctx, config.ProjectUID, url.Values{})
+	if err != nil {
+		return config, fmt.Errorf("device lookup failed: %w", err)
+	}
+	serials, serialProblems := resolveDeviceIdentifiers(devices, "serial_number", SplitTags(config.SerialNumber), func(d notehub.Device) string { return d.SerialNumber })
+	names, nameProblems := resolveDeviceIdentifiers(devices, "device_name", SplitTags(config.DeviceName), func(d notehub.Device) string { return d.Name })
+	if problems := append(serialProblems, nameProblems...); len(problems) > 0 {
+		return config, fmt.Errorf("resolve_targets: %d target(s) did not resolve to exactly one device:\n  - %s", len(problems), strings.Join(problems, "\n  - "))
+	}
+	report.endPhase()
+
+	report.ResolvedTargets = append(serials, names...)
+	uids := SplitTags(config.DeviceUID)
+	for _, t := range report.ResolvedTargets {
+		config.logf("  - %s %s → %s", t.Input, t.Value, t.DeviceUID)
+		uids = append(uids, t.DeviceUID)
+	}
+	config.logf("✅ Resolved %d serial number(s) and device name(s) to device UIDs", len(report.ResolvedTargets))
+
+	resolved := *config
+	resolved.DeviceUID = strings.Join(uids, ",")
+	resolved.SerialNumber = ""
+	resolved.DeviceName = ""
+	return &resolved, nil
+}
@@ -0,0 +1,81 @@
+package deploy
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestResolveDeviceIdentifiers(t *testing.T) {
+	devices := []notehub.Device{
+		{UID: "dev:1", SerialNumber: "SN1"},
+		{UID: "dev:2", SerialNumber: "SN2"},
+		{UID: "dev:3", SerialNumber: "SN2"},
+	}
+	resolved, problems := resolveDeviceIdentifiers(devices, "serial_number", []string{"SN1", "SN2", "SN9"}, func(d notehub.Device) string { return d.SerialNumber })
+
+	if !reflect.DeepEqual(resolved, []ResolvedTarget{{Input: "serial_number", Value: "SN1", DeviceUID: "dev:1"}}) {
+		t.Errorf("Expected only SN1 resolved, got %+v", resolved)
+	}
+	expected := []string{`serial_number "SN2" matches 2 devices (dev:2, dev:3)`, `serial_number "SN9" matches no device`}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Errorf("Expected %q, got %q", expected, problems)
+	}
+}
+
+// newResolveServer returns a Notehub whose project has devices with serial numbers and
+// names
+func newResolveServer(t *testing.T) *fakeNotehub {
+	t.Helper()
+	return newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": respond(`{"devices":[{"uid":"dev:1","serial_number":"SN1","name":"pump-1"},{"uid":"dev:2","serial_number":"SN2","name":"pump-2"},{"uid":"dev:3","serial_number":"SN2"}],"has_more":false}`),
+	})
+}
+
+func TestDeployFirmware_ResolveTargets(t *testing.T) {
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deploy := func(server *fakeNotehub, serials, names string) (*DeploymentReport, error) {
+		return DeployFirmware(context.Background(), &DeploymentConfig{
+			ProjectUID:     "app:123",
+			FirmwareFile:   firmwareFile,
+			SerialNumber:   serials,
+			DeviceName:     names,
+			ResolveTargets: true,
+			IssueDFU:       true,
+			APIBaseURL:     server.URL,
+			OAuthTokenURL:  server.URL + "/oauth2/token",
+		})
+	}
+
+	server := newResolveServer(t)
+	report, err := deploy(server, "SN1", "pump-2")
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if dfus := server.queries("POST /projects/app:123/dfu/host/update"); len(dfus) != 1 || dfus[0].Encode() != "deviceUID=dev%3A1&deviceUID=dev%3A2" {
+		t.Errorf("Expected the DFU to target the resolved UIDs, got %v", dfus)
+	}
+	expected := `[{"input":"serial_number","value":"SN1","device_uid":"dev:1"},{"input":"device_name","value":"pump-2","device_uid":"dev:2"}]`
+	if got := report.Outputs()["resolved_targets"]; got != expected {
+		t.Errorf("Expected resolved_targets %s, got %s", expected, got)
+	}
+
+	server = newResolveServer(t)
+	_, err = deploy(server, "SN2,SN9", "pump-3")
+	for _, want := range []string{"3 target(s) did not resolve", `serial_number "SN2" matches 2 devices`, `serial_number "SN9" matches no device`, `device_name "pump-3" matches no device`} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error containing %q, got %v", want, err)
+		}
+	}
+	if dfus := server.queries("POST /projects/app:123/dfu/host/update"); len(dfus) != 0 {
+		t.Errorf("Expected no DFU when targets do not resolve, got %v", dfus)
+	}
+}
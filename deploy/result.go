@@ -0,0 +1,84 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ResultSchemaVersion is the schema_version of the result document. It is raised whenever a
+// field is removed or changes meaning; new fields may be added without raising it.
+const ResultSchemaVersion = 1
+
+// maxResultJSONOutput bounds the result_json output. A larger result is set without its
+// per-device results, which stay in the result file.
+const maxResultJSONOutput = 64 * 1024
+
+// DeploymentResult is the result document written to result_file and set as the
+// result_json output: a stable subset of the report for release tooling to consume
+type DeploymentResult struct {
+	SchemaVersion    int            `json:"schema_version"`
+	Status           string         `json:"status"`
+	Error            string         `json:"error,omitempty"`
+	ProjectUID       string         `json:"project_uid"`
+	FirmwareFile     string         `json:"firmware_file"`
+	FirmwareFilename string         `json:"firmware_filename,omitempty"`
+	FirmwareSize     int64          `json:"firmware_size,omitempty"`
+	FirmwareSHA256   string         `json:"firmware_sha256,omitempty"`
+	TargetingParams  string         `json:"targeting_params"`
+	DFUTriggered     bool           `json:"dfu_triggered"`
+	Devices          []DeviceResult `json:"devices,omitempty"`
+	DevicesOmitted   int            `json:"devices_omitted,omitempty"`
+	Phases           []PhaseTiming  `json:"phases"`
+}
+
+// DeviceResult is the final DFU state of one device, when the deployment polled for it
+type DeviceResult struct {
+	DeviceUID   string `json:"device_uid"`
+	Status      string `json:"status"`
+	Description string `json:"description,omitempty"`
+}
+
+// Result returns the report's result document
+func (r *DeploymentReport) Result() *DeploymentResult {
+	result := &DeploymentResult{
+		SchemaVersion:    ResultSchemaVersion,
+		Status:           r.Status,
+		Error:            r.Error,
+		ProjectUID:       r.ProjectUID,
+		FirmwareFile:     r.FirmwareFile,
+		FirmwareFilename: r.UploadedFilename,
+		FirmwareSize:     r.FirmwareSize,
+		FirmwareSHA256:   r.FirmwareSHA256,
+		TargetingParams:  r.TargetingParams,
+		DFUTriggered:     r.DFUTriggered,
+		Phases:           append([]PhaseTiming{}, r.PhaseTimings...),
+	}
+	for _, s := range r.DeviceStates {
+		result.Devices = append(result.Devices, DeviceResult{DeviceUID: s.DeviceUID, Status: s.Status, Description: s.Description})
+	}
+	return result
+}
+
+// resultJSONOutput returns the compact result document for the result_json output,
+// leaving out the per-device results when they would make it too large
+func (r *DeploymentReport) resultJSONOutput() string {
+	result := r.Result()
+	data, _ := json.Marshal(result)
+	if len(data) > maxResultJSONOutput && len(result.Devices) > 0 {
+		result.DevicesOmitted, result.Devices = len(result.Devices), nil
+		data, _ = json.Marshal(result)
+	}
+	return string(data)
+}
+
+// WriteResult saves the report's result document as JSON
+func WriteResult(path string, report *DeploymentReport) error {
+	data, err := json.MarshalIndent(report.Result(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal deployment result: %w", err)
+	}
+	if err := writeFileSynced(path, data); err != nil {
+		return fmt.Errorf("failed to write deployment result: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestWriteResult(t *testing.T) {
+	report := &DeploymentReport{
+		Status:           StatusSuccess,
+		ProjectUID:       "app:123",
+		FirmwareFile:     "build/app.bin",
+		UploadedFilename: "app$20250101.bin",
+		FirmwareSize:     8,
+		FirmwareSHA256:   testFirmwareSHA256,
+		TargetingParams:  "tags=prod",
+		DFUTriggered:     true,
+		DeviceStates:     []notehub.DeviceDFUState{{DeviceUID: "dev:1", Status: "completed", Percent: 100}},
+		PhaseTimings:     []PhaseTiming{{Phase: "upload", StartedAt: "2025-06-02T00:00:00.000Z", DurationMs: 1500}},
+	}
+
+	path := filepath.Join(t.TempDir(), "result.json")
+	if err := WriteResult(path, report); err != nil {
+		t.Fatalf("WriteResult failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Release tooling depends on these names, so they are pinned here
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Result is not valid JSON: %v\n%s", err, data)
+	}
+	expected := map[string]any{
+		"schema_version":    float64(ResultSchemaVersion),
+		"status":            "success",
+		"project_uid":       "app:123",
+		"firmware_file":     "build/app.bin",
+		"firmware_filename": "app$20250101.bin",
+		"firmware_size":     float64(8),
+		"firmware_sha256":   testFirmwareSHA256,
+		"targeting_params":  "tags=prod",
+		"dfu_triggered":     true,
+	}
+	for key, value := range expected {
+		if doc[key] != value {
+			t.Errorf("Expected %s %v, got %v", key, value, doc[key])
+		}
+	}
+	if fmt.Sprint(doc["devices"]) != "[map[device_uid:dev:1 status:completed]]" {
+		t.Errorf("Unexpected devices %v", doc["devices"])
+	}
+	if fmt.Sprint(doc["phases"]) != "[map[duration_ms:1500 phase:upload started_at:2025-06-02T00:00:00.000Z]]" {
+		t.Errorf("Unexpected phases %v", doc["phases"])
+	}
+
+	// The output carries the same document, compactly
+	var output DeploymentResult
+	if err := json.Unmarshal([]byte(report.Outputs()["result_json"]), &output); err != nil || output.FirmwareFilename != "app$20250101.bin" || len(output.Devices) != 1 {
+		t.Errorf("Expected the result in the result_json output, got %+v, %v", output, err)
+	}
+}
+
+func TestResultJSONOutput_OmitsDevicesWhenLarge(t *testing.T) {
+	report := &DeploymentReport{Status: StatusSuccess}
+	for i := 0; i < 2000; i++ {
+		report.DeviceStates = append(report.DeviceStates, notehub.DeviceDFUState{DeviceUID: fmt.Sprintf("dev:%015d", i), Status: "completed"})
+	}
+	output := report.Outputs()["result_json"]
+	if len(output) > maxResultJSONOutput || strings.Contains(output, `"devices":`) || !strings.Contains(output, `"devices_omitted":2000`) {
+		t.Errorf("Expected the devices left out of a large result_json, got %d bytes", len(output))
+	}
+	if len(report.Result().Devices) != 2000 {
+		t.Error("Expected the result document itself to keep every device")
+	}
+}
@@ -0,0 +1,164 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// DefaultRetainLast is how many of the newest firmware files a cleanup keeps
+const DefaultRetainLast = 10
+
+// selectFirmwareForDeletion returns the files beyond the newest keep, oldest first. Files
+// named in protected are never selected, but still count towards those kept.
+func selectFirmwareForDeletion(files []notehub.FirmwareInfo, keep int, protected map[string]bool) []notehub.FirmwareInfo {
+	sorted := append([]notehub.FirmwareInfo(nil), files...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Created > sorted[j].Created })
+
+	var selected []notehub.FirmwareInfo
+	for i := len(sorted) - 1; i >= keep; i-- {
+		if !protected[sorted[i].Filename] {
+			selected = append(selected, sorted[i])
+		}
+	}
+	return selected
+}
+
+// dfuReferencedFirmware returns the firmware that devices are still updating to. It fails
+// when an update in progress does not say which firmware it uses, since any file could
+// then be in use.
+func dfuReferencedFirmware(states []notehub.DeviceDFUState) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	for _, s := range states {
+		if s.Terminal() {
+			continue
+		}
+		if s.Filename == "" {
+			return nil, fmt.Errorf("cannot tell which firmware the DFU in progress on %s uses", s.DeviceUID)
+		}
+		referenced[s.Filename] = true
+	}
+	return referenced, nil
+}
+
+// cleanupFirmware deletes the project's older firmware of the deployment's type, keeping
+// the newest keep files, the files named in protect, and any firmware referenced by a DFU
+// still in progress. It returns the deleted filenames, including when a deletion fails.
+// With dryRun, nothing is deleted and the files that would be are returned.
+func cleanupFirmware(ctx context.Context, client *notehub.Client, config *DeploymentConfig, keep int, dryRun bool, protect ...string) ([]string, error) {
+	files, err := client.ListFirmware(ctx, config.ProjectUID, config.FirmwareType, "")
+	if err != nil {
+		return nil, err
+	}
+
+	states, err := client.GetDFUStatus(ctx, config.ProjectUID, config.FirmwareType, nil)
+	if err != nil {
+		return nil, err
+	}
+	protected, err := dfuReferencedFirmware(states)
+	if err != nil {
+		return nil, fmt.Errorf("refusing to delete firmware: %w", err)
+	}
+	for _, name := range protect {
+		protected[name] = true
+	}
+
+	var deleted []string
+	for _, f := range selectFirmwareForDeletion(files, keep, protected) {
+		if dryRun {
+			config.logf("  - Would delete %s (%d bytes)", f.Filename, f.Length)
+			deleted = append(deleted, f.Filename)
+			continue
+		}
+		if err := client.DeleteFirmware(ctx, config.ProjectUID, config.FirmwareType, f.Filename); err != nil {
+			return deleted, err
+		}
+		config.logf("  - Deleted %s (%d bytes)", f.Filename, f.Length)
+		deleted = append(deleted, f.Filename)
+	}
+	if dryRun {
+		config.logf("Would delete %d firmware file(s), keeping the newest %d", len(deleted), keep)
+	} else {
+		config.logf("Deleted %d firmware file(s), keeping the newest %d", len(deleted), keep)
+	}
+
+	return deleted, nil
+}
+
+// applyRetention deletes the project's firmware of the deployment's type beyond the newest
+// retain_firmware_count once the deployment has succeeded, keeping the deployed firmware
+// and any firmware a DFU in progress uses. The deployment has already succeeded, so a
+// failure is a warning rather than an error.
+func applyRetention(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport) {
+	protect := append([]string{report.UploadedFilename}, config.retentionProtect...)
+	if config.RetentionDryRun {
+		config.logf("Listing firmware beyond the newest %d that retention would delete (retention_dry_run)...", config.RetainFirmwareCount)
+	} else {
+		config.logf("Deleting firmware beyond the newest %d...", config.RetainFirmwareCount)
+	}
+
+	names, err := cleanupFirmware(ctx, client, config, config.RetainFirmwareCount, config.RetentionDryRun, protect...)
+	if config.RetentionDryRun {
+		report.WouldDeleteFirmware = names
+	} else {
+		report.DeletedFirmware = append(report.DeletedFirmware, names...)
+	}
+	if err != nil {
+		config.Warnf("Firmware retention stopped after %d file(s): %v", len(names), err)
+	}
+}
+
+// uploadWithQuotaCleanup uploads the firmware file as filename. When the project is over
+// its firmware storage quota and auto_cleanup_on_quota is set, old firmware is cleaned up
+// and the upload retried once.
+func uploadWithQuotaCleanup(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport, firmwareFile, filename string) (*notehub.FirmwareUploadResponse, error) {
+	uploadResp, err := client.UploadFirmwareAs(ctx, config.ProjectUID, config.FirmwareType, firmwareFile, filename)
+
+	var quotaErr *notehub.QuotaError
+	if !errors.As(err, &quotaErr) {
+		return uploadResp, err
+	}
+	if quotaErr.Limit > 0 {
+		config.logf("Firmware storage: %d of %d bytes used", quotaErr.Used, quotaErr.Limit)
+	}
+	if !config.AutoCleanupOnQuota {
+		return nil, fmt.Errorf("%w; delete old firmware in Notehub, or set auto_cleanup_on_quota to do so automatically", err)
+	}
+
+	config.logf("Firmware storage quota exceeded; deleting old firmware beyond the newest %d...", config.RetainLast)
+	deleted, cerr := cleanupFirmware(ctx, client, config, config.RetainLast, false, filename)
+	report.DeletedFirmware = append(report.DeletedFirmware, deleted...)
+	if cerr != nil {
+		return nil, fmt.Errorf("%w; automatic cleanup failed: %v", err, cerr)
+	}
+	if len(deleted) == 0 {
+		return nil, fmt.Errorf("%w; automatic cleanup found nothing to delete beyond the newest %d file(s)", err, config.RetainLast)
+	}
+
+	config.logf("Retrying the upload after cleanup...")
+	return client.UploadFirmwareAs(ctx, config.ProjectUID, config.FirmwareType, firmwareFile, filename)
+}
+
+// rollBackFailedUpload deletes the firmware this run uploaded when the DFU trigger failed
+// and cleanup_on_failure is set, so a retry starts from a clean project. Firmware reused
+// from an earlier upload, or left in use by a DFU batch already sent, is kept. The
+// returned error carries dfuErr and, when the deletion fails too, that failure.
+func rollBackFailedUpload(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport, dfuErr error) error {
+	if !config.CleanupOnFailure || report.UploadSkipped || report.UploadedFilename == "" ||
+		report.timedPhase != "trigger_dfu" || len(report.TriggerTimes) > 0 {
+		return dfuErr
+	}
+
+	config.logf("DFU failed; deleting the uploaded %s (cleanup_on_failure)...", report.UploadedFilename)
+	cleanupCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), abortCleanupTimeout)
+	defer cancel()
+	if err := client.DeleteFirmware(cleanupCtx, config.ProjectUID, config.FirmwareType, report.UploadedFilename); err != nil {
+		return errors.Join(dfuErr, fmt.Errorf("cleanup_on_failure: failed to delete %s: %w", report.UploadedFilename, err))
+	}
+	report.DeletedFirmware = append(report.DeletedFirmware, report.UploadedFilename)
+	config.logf("Cleanup: deleted %s", report.UploadedFilename)
+	return dfuErr
+}
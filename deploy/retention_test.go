@@ -0,0 +1,291 @@
+package deploy
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestSelectFirmwareForDeletion(t *testing.T) {
+	files := []notehub.FirmwareInfo{
+		{Filename: "v2.bin", Created: 200},
+		{Filename: "v4.bin", Created: 400},
+		{Filename: "v1.bin", Created: 100},
+		{Filename: "v3.bin", Created: 300},
+	}
+
+	names := func(files []notehub.FirmwareInfo) []string {
+		var names []string
+		for _, f := range files {
+			names = append(names, f.Filename)
+		}
+		return names
+	}
+
+	if got := names(selectFirmwareForDeletion(files, 2, nil)); !reflect.DeepEqual(got, []string{"v1.bin", "v2.bin"}) {
+		t.Errorf("Expected the two oldest, oldest first, got %v", got)
+	}
+	if got := names(selectFirmwareForDeletion(files, 2, map[string]bool{"v1.bin": true})); !reflect.DeepEqual(got, []string{"v2.bin"}) {
+		t.Errorf("Expected protected firmware to be kept, got %v", got)
+	}
+	if got := selectFirmwareForDeletion(files, 10, nil); len(got) != 0 {
+		t.Errorf("Expected nothing to delete when keeping more than exist, got %v", names(got))
+	}
+}
+
+func TestDFUReferencedFirmware(t *testing.T) {
+	referenced, err := dfuReferencedFirmware([]notehub.DeviceDFUState{
+		{DeviceUID: "dev:1", Status: "downloading", Filename: "v1.bin"},
+		{DeviceUID: "dev:2", Status: notehub.DFUStateCompleted},
+	})
+	if err != nil || !reflect.DeepEqual(referenced, map[string]bool{"v1.bin": true}) {
+		t.Errorf("Expected v1.bin to be referenced, got %v, %v", referenced, err)
+	}
+
+	if _, err := dfuReferencedFirmware([]notehub.DeviceDFUState{{DeviceUID: "dev:1", Status: "pending"}}); err == nil {
+		t.Error("Expected an error when an update in progress does not name its firmware")
+	}
+}
+
+// newQuotaServer fakes a project that is over its storage quota until firmware is deleted.
+// It holds v1.bin to v3.bin, oldest first, and reports the DFU states in dfuStatus.
+func newQuotaServer(t *testing.T, dfuStatus string) *fakeNotehub {
+	t.Helper()
+	var server *fakeNotehub
+	server = newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/status": respond(dfuStatus),
+		"PUT /projects/app:123/firmware/*": func(w http.ResponseWriter, r *http.Request) {
+			if len(server.deleted()) == 0 {
+				w.WriteHeader(http.StatusInsufficientStorage)
+				fmt.Fprint(w, `{"err":"firmware storage quota exceeded","used":1000,"limit":1000}`)
+				return
+			}
+			server.upload(w, r)
+		},
+	})
+	for _, name := range []string{"v1.bin", "v2.bin", "v3.bin"} {
+		server.addFirmware(name, bytes.Repeat([]byte{0}, 100))
+	}
+	return server
+}
+
+// deployOverQuota deploys a firmware file to the quota server
+func deployOverQuota(t *testing.T, server *fakeNotehub, autoCleanup bool) (*DeploymentReport, error) {
+	t.Helper()
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return DeployFirmware(context.Background(), &DeploymentConfig{
+		ProjectUID:         "app:123",
+		FirmwareFile:       firmwareFile,
+		DeviceUID:          "dev:1",
+		IssueDFU:           true,
+		APIBaseURL:         server.URL,
+		OAuthTokenURL:      server.URL + "/oauth2/token",
+		AutoCleanupOnQuota: autoCleanup,
+		RetainLast:         1,
+	})
+}
+
+func TestDeployFirmware_QuotaCleanupThenRetry(t *testing.T) {
+	server := newQuotaServer(t, `{"devices":[]}`)
+
+	report, err := deployOverQuota(t, server, true)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if deleted := server.deleted(); !reflect.DeepEqual(deleted, []string{"v1.bin", "v2.bin"}) {
+		t.Errorf("Expected all but the newest firmware deleted, oldest first, got %v", deleted)
+	}
+	if uploads := server.count("PUT "); uploads != 2 {
+		t.Errorf("Expected the upload to be retried once, got %d upload(s)", uploads)
+	}
+	if !reflect.DeepEqual(report.DeletedFirmware, []string{"v1.bin", "v2.bin"}) || !report.DFUTriggered {
+		t.Errorf("Expected the deletions in a successful report, got %+v", report)
+	}
+}
+
+func TestDeployFirmware_QuotaCleanupSparesDFUReferencedFirmware(t *testing.T) {
+	server := newQuotaServer(t, `{"devices":[{"device_uid":"dev:9","status":"downloading","filename":"v1.bin"}]}`)
+
+	if _, err := deployOverQuota(t, server, true); err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if deleted := server.deleted(); !reflect.DeepEqual(deleted, []string{"v2.bin"}) {
+		t.Errorf("Expected v1.bin, still being downloaded, to be kept, got %v deleted", deleted)
+	}
+
+	server = newQuotaServer(t, `{"devices":[{"device_uid":"dev:9","status":"downloading"}]}`)
+	_, err := deployOverQuota(t, server, true)
+	if err == nil || !strings.Contains(err.Error(), "refusing to delete firmware") {
+		t.Errorf("Expected cleanup to be refused when an update's firmware is unknown, got %v", err)
+	}
+	if deleted := server.deleted(); len(deleted) != 0 {
+		t.Errorf("Expected nothing deleted, got %v", deleted)
+	}
+}
+
+func TestDeployFirmware_QuotaExceededWithoutCleanup(t *testing.T) {
+	server := newQuotaServer(t, `{"devices":[]}`)
+
+	_, err := deployOverQuota(t, server, false)
+	var qerr *notehub.QuotaError
+	if !errors.As(err, &qerr) || qerr.Used != 1000 || qerr.Limit != 1000 {
+		t.Fatalf("Expected a quota error with usage, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "auto_cleanup_on_quota") {
+		t.Errorf("Expected the error to suggest auto_cleanup_on_quota, got %v", err)
+	}
+	if deleted, uploads := server.deleted(), server.count("PUT "); len(deleted) != 0 || uploads != 1 {
+		t.Errorf("Expected a single upload and no deletions, got %d upload(s) and %v deleted", uploads, deleted)
+	}
+}
+
+// newRetentionServer returns a Notehub with stale firmware v1.bin to v3.bin, oldest first
+func newRetentionServer(t *testing.T) *fakeNotehub {
+	t.Helper()
+	server := newFakeNotehub(t, nil)
+	for _, name := range []string{"v1.bin", "v2.bin", "v3.bin"} {
+		server.addFirmware(name, []byte("firmware"))
+	}
+	return server
+}
+
+func TestDeployFirmware_Retention(t *testing.T) {
+	for _, dryRun := range []bool{false, true} {
+		server := newRetentionServer(t)
+		dir := t.TempDir()
+		if err := os.WriteFile(filepath.Join(dir, "app.bin"), []byte("firmware"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := DeployFirmware(context.Background(), &DeploymentConfig{
+			ProjectUID:          "app:123",
+			FirmwareFile:        filepath.Join(dir, "app.bin"),
+			DeviceUID:           "dev:1",
+			IssueDFU:            true,
+			APIBaseURL:          server.URL,
+			OAuthTokenURL:       server.URL + "/oauth2/token",
+			RetainFirmwareCount: 2,
+			RetentionDryRun:     dryRun,
+		})
+		if err != nil {
+			t.Fatalf("Deployment failed: %v", err)
+		}
+
+		if dryRun {
+			if changes := server.changes(); !reflect.DeepEqual(changes, []string{"upload app.bin"}) || len(report.DeletedFirmware) != 0 {
+				t.Errorf("Expected nothing deleted in a retention dry run, got %v", changes)
+			}
+			if !reflect.DeepEqual(report.WouldDeleteFirmware, []string{"v1.bin", "v2.bin"}) {
+				t.Errorf("Expected the files retention would delete in the report, got %v", report.WouldDeleteFirmware)
+			}
+			continue
+		}
+		if changes := server.changes(); !reflect.DeepEqual(changes, []string{"upload app.bin", "delete v1.bin", "delete v2.bin"}) {
+			t.Errorf("Expected all but the newest 2 deleted after the upload, got %v", changes)
+		}
+		if got := report.Outputs()["deleted_firmware"]; got != "v1.bin,v2.bin" {
+			t.Errorf("Expected the deletions in deleted_firmware, got %q", got)
+		}
+		if !strings.Contains(DeploymentSummaryMarkdown(report), "| Deleted Firmware | v1.bin, v2.bin |") {
+			t.Errorf("Expected the deletions in the summary, got:\n%s", DeploymentSummaryMarkdown(report))
+		}
+	}
+}
+
+func TestDeployFirmwareFiles_RetentionKeepsEveryFile(t *testing.T) {
+	server := newRetentionServer(t)
+	dir := t.TempDir()
+	for _, name := range []string{"app.bin", "bootloader.bin"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("firmware"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := DeployFirmwareFiles(context.Background(), &DeploymentConfig{
+		ProjectUID:          "app:123",
+		FirmwareDir:         dir,
+		DeviceUID:           "dev:1",
+		IssueDFU:            true,
+		APIBaseURL:          server.URL,
+		OAuthTokenURL:       server.URL + "/oauth2/token",
+		RetainFirmwareCount: 1,
+	}, []string{"app.bin", "bootloader.bin"}, "app.bin")
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	expected := []string{"upload bootloader.bin", "upload app.bin", "delete v1.bin", "delete v2.bin", "delete v3.bin"}
+	if changes := server.changes(); !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected one retention pass keeping both files, got %v", changes)
+	}
+}
+
+func TestDeployFirmware_CleanupOnFailure(t *testing.T) {
+	tests := []struct {
+		name          string
+		cleanup       bool
+		dfuStatus     int
+		deleteStatus  int
+		expectEvents  []string
+		expectErr     []string
+		expectDeleted []string
+	}{
+		{"DFU fails", true, http.StatusBadRequest, http.StatusOK, []string{"upload app.bin", "dfu", "delete app.bin"}, []string{"DFU trigger failed"}, []string{"app.bin"}},
+		{"DFU succeeds", true, http.StatusOK, http.StatusOK, []string{"upload app.bin", "dfu"}, nil, nil},
+		{"cleanup off", false, http.StatusBadRequest, http.StatusOK, []string{"upload app.bin", "dfu"}, []string{"DFU trigger failed"}, nil},
+		{"delete fails too", true, http.StatusBadRequest, http.StatusForbidden, []string{"upload app.bin", "dfu", "delete app.bin"}, []string{"DFU trigger failed", "cleanup_on_failure: failed to delete app.bin"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			routes := fakeRoutes{"/projects/app:123/dfu/host/update": respondStatus(tt.dfuStatus, `{}`)}
+			if tt.deleteStatus != http.StatusOK {
+				routes["DELETE /projects/app:123/firmware/*"] = respondStatus(tt.deleteStatus, "")
+			}
+			server := newFakeNotehub(t, routes)
+			config := server.config(t)
+			config.CleanupOnFailure = tt.cleanup
+
+			report, err := DeployFirmware(context.Background(), config)
+			if tt.expectErr == nil && err != nil {
+				t.Fatalf("Deployment failed: %v", err)
+			}
+			for _, want := range tt.expectErr {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Expected error containing %q, got %v", want, err)
+				}
+			}
+			var events []string
+			for _, r := range server.requests() {
+				switch method, uri, _ := strings.Cut(r, " "); {
+				case method == "PUT":
+					events = append(events, "upload "+path.Base(uri))
+				case strings.HasPrefix(uri, "/projects/app:123/dfu/host/update"):
+					events = append(events, "dfu")
+				case method == "DELETE":
+					events = append(events, "delete "+path.Base(uri))
+				}
+			}
+			if !reflect.DeepEqual(events, tt.expectEvents) {
+				t.Errorf("Expected requests %v, got %v", tt.expectEvents, events)
+			}
+			if !reflect.DeepEqual(report.DeletedFirmware, tt.expectDeleted) {
+				t.Errorf("Expected deleted firmware %v, got %v", tt.expectDeleted, report.DeletedFirmware)
+			}
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package deploy
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// Retry ledger scope kinds. Every request is counted under its endpoint, and also under
+// the phase it ran in and, for DFU triggers, the batch and each device it targeted.
+const (
+	RetryScopePhase    = "phase"
+	RetryScopeEndpoint = "endpoint"
+	RetryScopeBatch    = "batch"
+	RetryScopeDevice   = "device"
+)
+
+// RetryScope counts the requests made within one scope, the attempts they took, and how
+// many still failed after their retries
+type RetryScope struct {
+	Kind     string `json:"kind"`
+	Name     string `json:"name"`
+	Requests int    `json:"requests"`
+	Attempts int    `json:"attempts"`
+	Retries  int    `json:"retries"`
+	Failed   int    `json:"failed,omitempty"`
+}
+
+// RetrySummary is the run's retrying at a glance: the total retries of every request, how
+// many devices had their DFU trigger retried, and the scopes that saw any retry or failure
+type RetrySummary struct {
+	TotalRetries   int          `json:"total_retries"`
+	RetriedDevices int          `json:"retried_devices"`
+	Scopes         []RetryScope `json:"scopes,omitempty"`
+}
+
+// retryLedger accounts for every Notehub request of an action invocation, across all
+// the deployments it runs. It is fed by the client's request observer and told the
+// current phase and DFU batch by the report's phase timing and the DFU phase.
+type retryLedger struct {
+	mu      sync.Mutex
+	phase   string
+	batch   string
+	devices []string
+	scopes  map[string]*RetryScope
+}
+
+func newRetryLedger() *retryLedger {
+	return &retryLedger{scopes: map[string]*RetryScope{}}
+}
+
+// setPhase attributes later requests to phase, or to no phase when it is ""
+func (l *retryLedger) setPhase(phase string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.phase = phase
+}
+
+// setBatch attributes later requests to the DFU batch and its devices, or to none when
+// batch is ""
+func (l *retryLedger) setBatch(batch string, devices []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.batch, l.devices = batch, devices
+}
+
+// record counts a finished request in each scope it belongs to
+func (l *retryLedger) record(outcome notehub.RequestOutcome) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	add := func(kind, name string) {
+		key := kind + " " + name
+		s := l.scopes[key]
+		if s == nil {
+			s = &RetryScope{Kind: kind, Name: name}
+			l.scopes[key] = s
+		}
+		s.Requests++
+		s.Attempts += outcome.Attempts
+		s.Retries += outcome.Attempts - 1
+		if outcome.Failed() {
+			s.Failed++
+		}
+	}
+	add(RetryScopeEndpoint, outcome.Method+" "+outcome.Path)
+	if l.phase != "" {
+		add(RetryScopePhase, l.phase)
+	}
+	if l.batch != "" {
+		add(RetryScopeBatch, l.batch)
+		for _, uid := range l.devices {
+			add(RetryScopeDevice, uid)
+		}
+	}
+}
+
+// summary returns the ledger's totals and the scopes that were retried or failed, ordered
+// by kind and then name
+func (l *retryLedger) summary() *RetrySummary {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	summary := &RetrySummary{}
+	for _, s := range l.scopes {
+		if s.Kind == RetryScopeEndpoint {
+			summary.TotalRetries += s.Retries
+		}
+		if s.Kind == RetryScopeDevice && s.Retries > 0 {
+			summary.RetriedDevices++
+		}
+		if s.Retries > 0 || s.Failed > 0 {
+			summary.Scopes = append(summary.Scopes, *s)
+		}
+	}
+	kindOrder := map[string]int{RetryScopePhase: 0, RetryScopeEndpoint: 1, RetryScopeBatch: 2, RetryScopeDevice: 3}
+	sort.Slice(summary.Scopes, func(i, j int) bool {
+		a, b := summary.Scopes[i], summary.Scopes[j]
+		if a.Kind != b.Kind {
+			return kindOrder[a.Kind] < kindOrder[b.Kind]
+		}
+		return a.Name < b.Name
+	})
+	return summary
+}
+
+// LogRetrySummary prints the compact retry summary block that ends the run's log.
+// Devices are only counted, since a retried batch may cover hundreds of them. nil logger
+// logs through the standard library's log.
+func LogRetrySummary(summary *RetrySummary, logger Logger) {
+	if summary == nil {
+		return
+	}
+	logger = orStdLogger(logger)
+	if summary.TotalRetries == 0 && len(summary.Scopes) == 0 {
+		logger.Printf("Retry summary: no requests were retried")
+		return
+	}
+	logger.Printf("Retry summary: %d retries in total, %d device(s) retried", summary.TotalRetries, summary.RetriedDevices)
+	for _, s := range summary.Scopes {
+		if s.Kind == RetryScopeDevice {
+			continue
+		}
+		line := fmt.Sprintf("  - %s %s: %d request(s), %d attempt(s)", s.Kind, s.Name, s.Requests, s.Attempts)
+		if s.Failed > 0 {
+			line += fmt.Sprintf(", %d failed", s.Failed)
+		}
+		logger.Printf("%s", line)
+	}
+}
@@ -0,0 +1,126 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestRetryLedger(t *testing.T) {
+	ledger := newRetryLedger()
+	ledger.record(notehub.RequestOutcome{Method: "POST", Path: "/oauth2/token", Attempts: 1, StatusCode: 200})
+	ledger.setPhase("upload")
+	ledger.record(notehub.RequestOutcome{Method: "PUT", Path: "/fw", Attempts: 3, StatusCode: 200})
+	ledger.setPhase("trigger_dfu")
+	ledger.setBatch("batch 1/2", []string{"dev:1", "dev:2"})
+	ledger.record(notehub.RequestOutcome{Method: "POST", Path: "/dfu", Attempts: 1, StatusCode: 200})
+	ledger.setBatch("batch 2/2", []string{"dev:3"})
+	ledger.record(notehub.RequestOutcome{Method: "POST", Path: "/dfu", Attempts: 4, StatusCode: 503})
+	ledger.setBatch("", nil)
+
+	expected := &RetrySummary{
+		TotalRetries:   5,
+		RetriedDevices: 1,
+		Scopes: []RetryScope{
+			{Kind: RetryScopePhase, Name: "trigger_dfu", Requests: 2, Attempts: 5, Retries: 3, Failed: 1},
+			{Kind: RetryScopePhase, Name: "upload", Requests: 1, Attempts: 3, Retries: 2},
+			{Kind: RetryScopeEndpoint, Name: "POST /dfu", Requests: 2, Attempts: 5, Retries: 3, Failed: 1},
+			{Kind: RetryScopeEndpoint, Name: "PUT /fw", Requests: 1, Attempts: 3, Retries: 2},
+			{Kind: RetryScopeBatch, Name: "batch 2/2", Requests: 1, Attempts: 4, Retries: 3, Failed: 1},
+			{Kind: RetryScopeDevice, Name: "dev:3", Requests: 1, Attempts: 4, Retries: 3, Failed: 1},
+		},
+	}
+	if summary := ledger.summary(); !reflect.DeepEqual(summary, expected) {
+		t.Errorf("Unexpected summary:\ngot:      %+v\nexpected: %+v", summary, expected)
+	}
+}
+
+func TestDeployFirmware_RetryLedgerAcrossFilesAndBatches(t *testing.T) {
+	var uploads, dfus int32
+	var server *fakeNotehub
+	server = newFakeNotehub(t, fakeRoutes{
+		"PUT /projects/app:123/firmware/*": func(w http.ResponseWriter, r *http.Request) {
+			// The first upload of the run fails once
+			if atomic.AddInt32(&uploads, 1) == 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			server.upload(w, r)
+		},
+		"/projects/app:123/dfu/host/update": func(w http.ResponseWriter, r *http.Request) {
+			// The second batch fails twice before going through
+			if n := atomic.AddInt32(&dfus, 1); n == 2 || n == 3 {
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		},
+	})
+
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"boot.bin", "app.bin"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("firmware"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+	}
+	var uids []string
+	for i := 0; i < 130; i++ {
+		uids = append(uids, fmt.Sprintf("dev:%d", i))
+	}
+
+	report, err := DeployFirmwareFiles(context.Background(), &DeploymentConfig{
+		ProjectUID:     "app:123",
+		DeviceUID:      strings.Join(uids, ","),
+		IssueDFU:       true,
+		APIBaseURL:     server.URL,
+		OAuthTokenURL:  server.URL + "/oauth2/token",
+		MaxRetries:     3,
+		RetryBaseDelay: time.Millisecond,
+	}, files, "app.bin")
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	summary := report.RetrySummary
+	if summary == nil || summary.TotalRetries != 3 || summary.RetriedDevices != 30 {
+		t.Fatalf("Expected 3 retries and 30 retried devices across both files, got %+v", summary)
+	}
+	scopes := map[string]int{}
+	for _, s := range summary.Scopes {
+		scopes[s.Kind+" "+s.Name] = s.Retries
+	}
+	for scope, retries := range map[string]int{
+		"phase upload":      1,
+		"phase trigger_dfu": 2,
+		"endpoint PUT /projects/app:123/firmware/host/boot.bin": 1,
+		"batch batch 2/2": 2,
+		"device dev:129":  2,
+	} {
+		if scopes[scope] != retries {
+			t.Errorf("Expected %d retries for %s, got %d (%v)", retries, scope, scopes[scope], scopes)
+		}
+	}
+	if _, ok := scopes["batch batch 1/2"]; ok {
+		t.Error("The batch that went through first time should not be listed")
+	}
+
+	outputs := report.Outputs()
+	if outputs["total_retries"] != "3" || outputs["retried_devices"] != "30" {
+		t.Errorf("Unexpected retry outputs %q and %q", outputs["total_retries"], outputs["retried_devices"])
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "| batch `batch 2/2` | 1 | 3 | 0 |") {
+		t.Error("Expected the summary to list the retried batch")
+	}
+}
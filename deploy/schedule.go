@@ -0,0 +1,45 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// minScheduleLead is how far in the future a scheduled DFU must start, leaving time for
+	// the request to reach Notehub
+	minScheduleLead = time.Minute
+
+	// maxScheduleHorizon is the furthest ahead a DFU may be scheduled. Anything later is more
+	// likely a typo than a plan.
+	maxScheduleHorizon = 14 * 24 * time.Hour
+)
+
+// ParseScheduleAt parses the schedule_at input, either an RFC3339 time or a duration from
+// now such as 6h, and checks the time is in the future and within the schedule horizon.
+// An empty value returns the zero time.
+func ParseScheduleAt(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	startAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		delay, derr := time.ParseDuration(value)
+		if derr != nil {
+			return time.Time{}, fmt.Errorf("invalid schedule_at %q: must be an RFC3339 time such as 2025-06-01T02:00:00Z or a duration from now such as 6h", value)
+		}
+		startAt = now.Add(delay)
+	}
+
+	if startAt.Before(now.Add(minScheduleLead)) {
+		return time.Time{}, fmt.Errorf("invalid schedule_at %q: must be at least %s in the future", value, minScheduleLead)
+	}
+	if startAt.After(now.Add(maxScheduleHorizon)) {
+		return time.Time{}, fmt.Errorf("invalid schedule_at %q: must be within %s from now", value, maxScheduleHorizon)
+	}
+
+	return startAt.UTC(), nil
+}
@@ -0,0 +1,101 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestParseScheduleAt(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	accepted := map[string]time.Time{
+		"":                          {},
+		"6h":                        now.Add(6 * time.Hour),
+		" 2025-06-02T02:00:00Z ":    time.Date(2025, 6, 2, 2, 0, 0, 0, time.UTC),
+		"2025-06-02T04:00:00+02:00": time.Date(2025, 6, 2, 2, 0, 0, 0, time.UTC),
+	}
+	for value, expected := range accepted {
+		got, err := ParseScheduleAt(value, now)
+		if err != nil || !got.Equal(expected) {
+			t.Errorf("parseScheduleAt(%q) = %s, %v; expected %s", value, got, err, expected)
+		}
+	}
+
+	for value, reason := range map[string]string{
+		"tonight":              "RFC3339",
+		"2025-06-01T11:00:00Z": "in the future",
+		"30s":                  "in the future",
+		"-1h":                  "in the future",
+		"720h":                 "within",
+	} {
+		if _, err := ParseScheduleAt(value, now); err == nil || !strings.Contains(err.Error(), reason) {
+			t.Errorf("parseScheduleAt(%q): expected error containing %q, got %v", value, reason, err)
+		}
+	}
+}
+
+// newSchedulingNotehub returns a fake Notehub that accepts uploads and, when supported,
+// scheduled DFUs
+func newSchedulingNotehub(t *testing.T, supported bool) *fakeNotehub {
+	t.Helper()
+	routes := fakeRoutes{}
+	if supported {
+		routes["/projects/app:123/dfu/host/schedule"] = respond(`{}`)
+	}
+	return newFakeNotehub(t, routes)
+}
+
+func scheduledDeployConfig(t *testing.T, serverURL string, startAt time.Time) *DeploymentConfig {
+	t.Helper()
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return &DeploymentConfig{
+		ProjectUID:    "app:123",
+		FirmwareFile:  firmwareFile,
+		DeviceUID:     "dev:1",
+		IssueDFU:      true,
+		ScheduleAt:    startAt,
+		APIBaseURL:    serverURL,
+		OAuthTokenURL: serverURL + "/oauth2/token",
+	}
+}
+
+func TestDeployFirmware_ScheduleAt(t *testing.T) {
+	server := newSchedulingNotehub(t, true)
+	startAt := time.Date(2025, 6, 2, 2, 0, 0, 0, time.UTC)
+
+	report, err := DeployFirmware(context.Background(), scheduledDeployConfig(t, server.URL, startAt))
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if server.count("POST /projects/app:123/dfu/host/update") != 0 {
+		t.Error("A scheduled deployment must not trigger an immediate DFU")
+	}
+	if payloads := server.bodies("POST /projects/app:123/dfu/host/schedule"); len(payloads) != 1 || payloads[0] != `{"filename":"app.bin","start_at":"2025-06-02T02:00:00Z"}` {
+		t.Errorf("Unexpected schedule payload %v", payloads)
+	}
+	if report.ScheduledAt != "2025-06-02T02:00:00Z" || !report.DFUTriggered {
+		t.Errorf("Expected the scheduled time in the report, got %+v", report)
+	}
+}
+
+func TestDeployFirmware_ScheduleAtUnsupported(t *testing.T) {
+	server := newSchedulingNotehub(t, false)
+
+	report, err := DeployFirmware(context.Background(), scheduledDeployConfig(t, server.URL, time.Now().Add(time.Hour)))
+	if !errors.Is(err, notehub.ErrDFUSchedulingUnsupported) || !strings.Contains(err.Error(), "on.schedule") {
+		t.Fatalf("Expected unsupported scheduling to fail with guidance, got %v", err)
+	}
+	if server.count("POST /projects/app:123/dfu/host/update") != 0 || report.DFUTriggered || report.ScheduledAt != "" {
+		t.Errorf("Unsupported scheduling must not fall back to an immediate DFU, got %+v", report)
+	}
+}
@@ -0,0 +1,182 @@
+package deploy
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// Behaviours when the firmware exceeds a SKU's size limit
+const (
+	OnSizeExceededFail    = "fail"
+	OnSizeExceededExclude = "exclude"
+)
+
+// Behaviours for devices whose SKU has no configured size limit
+const (
+	UnknownSKUAllow   = "allow"
+	UnknownSKUExclude = "exclude"
+	UnknownSKUFail    = "fail"
+)
+
+// SKU limit verdicts
+const (
+	SKUVerdictWithinLimit = "within_limit"
+	SKUVerdictExceeded    = "exceeded"
+	SKUVerdictUnknown     = "unknown"
+)
+
+// SKUVerdict records how the firmware size compares against one SKU's limit
+type SKUVerdict struct {
+	SKU      string `json:"sku"`
+	Limit    int64  `json:"limit,omitempty"`
+	Devices  int    `json:"devices"`
+	Verdict  string `json:"verdict"`
+	Excluded bool   `json:"excluded"`
+}
+
+// ExcludedDevice is a resolved target device removed from the DFU, with the reason why
+type ExcludedDevice struct {
+	DeviceUID string `json:"device_uid"`
+	Reason    string `json:"reason"`
+}
+
+// ParseSKUSizeLimits parses a JSON object mapping SKU to maximum firmware size in bytes
+func ParseSKUSizeLimits(value string) (map[string]int64, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+
+	var limits map[string]int64
+	if err := json.Unmarshal([]byte(value), &limits); err != nil {
+		return nil, fmt.Errorf("sku_size_limits must be a JSON object of SKU to byte limit: %w", err)
+	}
+	for sku, limit := range limits {
+		if limit <= 0 {
+			return nil, fmt.Errorf("sku_size_limits value for %q must be a positive byte count", sku)
+		}
+	}
+
+	return limits, nil
+}
+
+// ParseOnSizeExceeded validates the on_size_exceeded input
+func ParseOnSizeExceeded(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", OnSizeExceededFail:
+		return OnSizeExceededFail, nil
+	case OnSizeExceededExclude:
+		return OnSizeExceededExclude, nil
+	default:
+		return "", fmt.Errorf("invalid on_size_exceeded %q (accepted values: %s, %s)", value, OnSizeExceededFail, OnSizeExceededExclude)
+	}
+}
+
+// ParseUnknownSKUBehavior validates the unknown_sku_behavior input
+func ParseUnknownSKUBehavior(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", UnknownSKUAllow:
+		return UnknownSKUAllow, nil
+	case UnknownSKUExclude:
+		return UnknownSKUExclude, nil
+	case UnknownSKUFail:
+		return UnknownSKUFail, nil
+	default:
+		return "", fmt.Errorf("invalid unknown_sku_behavior %q (accepted values: %s, %s, %s)",
+			value, UnknownSKUAllow, UnknownSKUExclude, UnknownSKUFail)
+	}
+}
+
+// evaluateSKULimits compares the firmware size against each target device's SKU limit. It
+// returns a verdict per SKU, the devices that remain targeted, and the devices excluded.
+// An error is returned when a verdict's configured behaviour is to fail the deployment.
+func evaluateSKULimits(devices []notehub.Device, size int64, limits map[string]int64, onExceeded, unknownBehavior string) ([]SKUVerdict, []notehub.Device, []ExcludedDevice, error) {
+	bySKU := map[string][]notehub.Device{}
+	for _, d := range devices {
+		bySKU[d.SKU] = append(bySKU[d.SKU], d)
+	}
+
+	skus := make([]string, 0, len(bySKU))
+	for sku := range bySKU {
+		skus = append(skus, sku)
+	}
+	sort.Strings(skus)
+
+	var verdicts []SKUVerdict
+	var kept []notehub.Device
+	var excluded []ExcludedDevice
+	var failures []string
+
+	for _, sku := range skus {
+		group := bySKU[sku]
+		v := SKUVerdict{SKU: sku, Devices: len(group)}
+
+		limit, known := limits[sku]
+		var reason string
+		switch {
+		case !known:
+			v.Verdict = SKUVerdictUnknown
+			switch unknownBehavior {
+			case UnknownSKUExclude:
+				v.Excluded = true
+				reason = fmt.Sprintf("no size limit configured for SKU %q", sku)
+			case UnknownSKUFail:
+				failures = append(failures, fmt.Sprintf("SKU %q has no configured size limit (%d device(s))", sku, len(group)))
+			}
+		case size > limit:
+			v.Limit = limit
+			v.Verdict = SKUVerdictExceeded
+			if onExceeded == OnSizeExceededExclude {
+				v.Excluded = true
+				reason = fmt.Sprintf("firmware size %d bytes exceeds SKU %q limit of %d bytes", size, sku, limit)
+			} else {
+				failures = append(failures, fmt.Sprintf("firmware size %d bytes exceeds SKU %q limit of %d bytes (%d device(s))", size, sku, limit, len(group)))
+			}
+		default:
+			v.Limit = limit
+			v.Verdict = SKUVerdictWithinLimit
+		}
+
+		verdicts = append(verdicts, v)
+		for _, d := range group {
+			if v.Excluded {
+				excluded = append(excluded, ExcludedDevice{DeviceUID: d.UID, Reason: reason})
+			} else {
+				kept = append(kept, d)
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return verdicts, kept, excluded, fmt.Errorf("firmware size check failed: %s", strings.Join(failures, "; "))
+	}
+
+	return verdicts, kept, excluded, nil
+}
+
+// skuLabel renders a SKU for logs, naming devices that don't report one
+func skuLabel(sku string) string {
+	if sku == "" {
+		return "(none reported)"
+	}
+	return sku
+}
+
+// logSKUVerdicts prints the per-SKU firmware size verdicts
+func logSKUVerdicts(config *DeploymentConfig, verdicts []SKUVerdict, size int64) {
+	config.logf("Firmware size check (%d bytes):", size)
+	for _, v := range verdicts {
+		limit := "no limit configured"
+		if v.Limit > 0 {
+			limit = fmt.Sprintf("limit %d bytes", v.Limit)
+		}
+		action := "included"
+		if v.Excluded {
+			action = "excluded"
+		}
+		config.logf("  - %s: %s, %s, %d device(s) %s", skuLabel(v.SKU), v.Verdict, limit, v.Devices, action)
+	}
+}
@@ -0,0 +1,142 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestParseSKUSizeLimits(t *testing.T) {
+	limits, err := ParseSKUSizeLimits(`{"NOTE-WBNAW": 1048576, "NOTE-NBGL": 524288}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if limits["NOTE-WBNAW"] != 1048576 || limits["NOTE-NBGL"] != 524288 {
+		t.Errorf("Unexpected limits %v", limits)
+	}
+
+	for _, bad := range []string{`{"NOTE-WBNAW": "1MB"}`, `{"NOTE-WBNAW": 0}`, `[1]`} {
+		if _, err := ParseSKUSizeLimits(bad); err == nil {
+			t.Errorf("Expected error for %s", bad)
+		}
+	}
+}
+
+func TestEvaluateSKULimits(t *testing.T) {
+	devices := []notehub.Device{
+		{UID: "dev:1", SKU: "BIG"},
+		{UID: "dev:2", SKU: "SMALL"},
+		{UID: "dev:3", SKU: "SMALL"},
+		{UID: "dev:4", SKU: "MYSTERY"},
+	}
+	limits := map[string]int64{"BIG": 2000, "SMALL": 500}
+
+	tests := []struct {
+		name            string
+		size            int64
+		onExceeded      string
+		unknownBehavior string
+		expectedKept    []string
+		expectedExcl    []string
+		expectedVerdict map[string]string
+		expectError     string
+	}{
+		{
+			name:            "all within limits, unknown allowed",
+			size:            400,
+			onExceeded:      OnSizeExceededFail,
+			unknownBehavior: UnknownSKUAllow,
+			expectedKept:    []string{"dev:1", "dev:4", "dev:2", "dev:3"},
+			expectedVerdict: map[string]string{"BIG": SKUVerdictWithinLimit, "SMALL": SKUVerdictWithinLimit, "MYSTERY": SKUVerdictUnknown},
+		},
+		{
+			name:            "exceeded SKU excluded",
+			size:            1000,
+			onExceeded:      OnSizeExceededExclude,
+			unknownBehavior: UnknownSKUAllow,
+			expectedKept:    []string{"dev:1", "dev:4"},
+			expectedExcl:    []string{"dev:2", "dev:3"},
+			expectedVerdict: map[string]string{"BIG": SKUVerdictWithinLimit, "SMALL": SKUVerdictExceeded},
+		},
+		{
+			name:            "exceeded SKU fails",
+			size:            1000,
+			onExceeded:      OnSizeExceededFail,
+			unknownBehavior: UnknownSKUAllow,
+			expectError:     `SKU "SMALL" limit of 500 bytes`,
+		},
+		{
+			name:            "unknown SKU excluded",
+			size:            400,
+			onExceeded:      OnSizeExceededFail,
+			unknownBehavior: UnknownSKUExclude,
+			expectedKept:    []string{"dev:1", "dev:2", "dev:3"},
+			expectedExcl:    []string{"dev:4"},
+		},
+		{
+			name:            "unknown SKU fails",
+			size:            400,
+			onExceeded:      OnSizeExceededFail,
+			unknownBehavior: UnknownSKUFail,
+			expectError:     `SKU "MYSTERY" has no configured size limit`,
+		},
+		{
+			name:            "size equal to limit is allowed",
+			size:            500,
+			onExceeded:      OnSizeExceededFail,
+			unknownBehavior: UnknownSKUAllow,
+			expectedKept:    []string{"dev:1", "dev:4", "dev:2", "dev:3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdicts, kept, excluded, err := evaluateSKULimits(devices, tt.size, limits, tt.onExceeded, tt.unknownBehavior)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var keptUIDs, exclUIDs []string
+			for _, d := range kept {
+				keptUIDs = append(keptUIDs, d.UID)
+			}
+			for _, e := range excluded {
+				exclUIDs = append(exclUIDs, e.DeviceUID)
+				if e.Reason == "" {
+					t.Errorf("Excluded device %s has no reason", e.DeviceUID)
+				}
+			}
+			if strings.Join(keptUIDs, ",") != strings.Join(tt.expectedKept, ",") {
+				t.Errorf("Expected kept %v, got %v", tt.expectedKept, keptUIDs)
+			}
+			if strings.Join(exclUIDs, ",") != strings.Join(tt.expectedExcl, ",") {
+				t.Errorf("Expected excluded %v, got %v", tt.expectedExcl, exclUIDs)
+			}
+
+			for _, v := range verdicts {
+				if expected, ok := tt.expectedVerdict[v.SKU]; ok && v.Verdict != expected {
+					t.Errorf("SKU %s: expected verdict %s, got %s", v.SKU, expected, v.Verdict)
+				}
+			}
+		})
+	}
+}
+
+func TestExplicitTargetConfig(t *testing.T) {
+	config := &DeploymentConfig{ProjectUID: "app:123", Tag: "production", FleetUID: "fleet:1"}
+	explicit := explicitTargetConfig(config, []notehub.Device{{UID: "dev:1"}, {UID: "dev:2"}})
+
+	if got := buildTargetingParams(explicit).Encode(); got != "deviceUID=dev%3A1&deviceUID=dev%3A2" {
+		t.Errorf("Expected explicit device targeting, got %s", got)
+	}
+	if config.Tag != "production" {
+		t.Error("Original config must not be modified")
+	}
+}
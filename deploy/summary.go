@@ -0,0 +1,223 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// escapeTableCell makes a value safe to place in a Markdown table cell
+func escapeTableCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.ReplaceAll(value, "\n", " ")
+}
+
+// DeploymentSummaryMarkdown renders the deployment report for the job summary. It is
+// written whether or not the deployment succeeded, so a failed run shows the reason and
+// how far it got.
+func DeploymentSummaryMarkdown(report *DeploymentReport) string {
+	var b strings.Builder
+
+	title := "Notehub Firmware Deployment"
+	if report.DryRun {
+		title += " (Dry Run)"
+	}
+	switch report.Status {
+	case StatusSuccess:
+		title = "✅ " + title
+	case StatusFailed:
+		title = "❌ " + title
+	}
+	fmt.Fprintf(&b, "### %s\n\n", title)
+
+	b.WriteString("| | |\n")
+	b.WriteString("| --- | --- |\n")
+	row := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(&b, "| %s | %s |\n", name, escapeTableCell(value))
+		}
+	}
+	row("Status", report.Status)
+	row("Failure", report.Error)
+	row("Failed During", report.ErrorPhase)
+	row("Project UID", report.ProjectUID)
+	row("Firmware File", report.FirmwareFile)
+	row("Firmware Type", report.FirmwareType)
+	row("Uploaded Filename", report.UploadedFilename)
+	if r := report.ReusedFirmware; r != nil {
+		row("Upload", fmt.Sprintf("skipped, reusing identical firmware %s instead of %s", r.ReusedFilename, r.Filename))
+	} else if report.UploadSkipped {
+		row("Upload", "skipped, identical firmware already on Notehub")
+	}
+	if report.FirmwareSize > 0 {
+		row("Size", fmt.Sprintf("%d bytes", report.FirmwareSize))
+	}
+	if v := report.VersionCheck; v != nil {
+		row("Version", fmt.Sprintf("%s against the newest %s (%s): %s", v.Version, v.NewestVersion, v.NewestFilename, v.Decision))
+	}
+	if len(report.DeletedFirmware) > 0 {
+		row("Deleted Firmware", strings.Join(report.DeletedFirmware, ", "))
+	}
+	if len(report.WouldDeleteFirmware) > 0 {
+		row("Retention (dry run)", "would delete "+strings.Join(report.WouldDeleteFirmware, ", "))
+	}
+	if report.FirmwareSHA256 != "" {
+		row("SHA-256", "`"+report.FirmwareSHA256+"`")
+	}
+	if report.TargetingParams != "" {
+		row("Targeting", "`"+report.TargetingParams+"`")
+	} else if report.DFUTriggered {
+		row("Targeting", "all devices")
+	}
+	if report.ExtraDFUParams != "" {
+		row("Extra DFU Params (unvalidated)", "`"+report.ExtraDFUParams+"`")
+	}
+	if report.ResolvedDevices > 0 {
+		row("Resolved Devices", fmt.Sprintf("%d", report.ResolvedDevices))
+	}
+	if p := report.TargetPreview; p != nil {
+		targets := fmt.Sprintf("%d", p.Count)
+		if p.BestEffort {
+			targets += " (best-effort)"
+		}
+		if len(p.DeviceUIDs) > 0 {
+			targets += ": " + strings.Join(p.DeviceUIDs, ", ")
+			if p.Count > len(p.DeviceUIDs) {
+				targets += fmt.Sprintf(" and %d more", p.Count-len(p.DeviceUIDs))
+			}
+		}
+		row("Target Devices", targets)
+	}
+	if c := report.Canary; c != nil {
+		row("Canary", fmt.Sprintf("%d%%: %d device(s) updated, %d remaining", c.Percentage, len(c.DeviceUIDs), len(c.RemainingDeviceUIDs)))
+	}
+	if len(report.ExcludedDevices) > 0 {
+		row("Excluded Devices", fmt.Sprintf("%d", len(report.ExcludedDevices)))
+	}
+	if report.DFUDeviceCount > 0 {
+		row("DFU Devices", fmt.Sprintf("%d (reported by Notehub)", report.DFUDeviceCount))
+	}
+	row("DFU Request ID", strings.Join(report.DFURequestIDs, ", "))
+	if report.PendingBeforeCancel != nil {
+		row("DFU Cancelled", fmt.Sprintf("%d device(s) pending before cancel", len(report.PendingBeforeCancel)))
+	}
+	if report.DFUCancelledOnAbort {
+		row("DFU Cancelled", "yes, the run was aborted (cancel_dfu_on_abort)")
+	}
+	if report.ScheduledAt != "" {
+		row("DFU Issued", "scheduled for "+report.ScheduledAt)
+	} else if report.DFUTriggered {
+		row("DFU Issued", "yes")
+	} else if report.DFUWithheld != "" {
+		row("DFU Issued", "no, withheld: "+report.DFUWithheld)
+	} else {
+		row("DFU Issued", "no")
+	}
+
+	if len(report.Files) > 0 {
+		b.WriteString("\n#### Firmware Files\n\n")
+		b.WriteString("| File | Uploaded As | Size | DFU | Status |\n")
+		b.WriteString("| ---- | ----------- | ---- | --- | ------ |\n")
+		for _, f := range report.Files {
+			status := f.Status
+			if f.Error != "" {
+				status += ": " + f.Error
+			}
+			dfu := ""
+			if f.DFU {
+				dfu = "✅"
+			}
+			fmt.Fprintf(&b, "| %s | %s | %d bytes | %s | %s |\n", escapeTableCell(f.FirmwareFile), escapeTableCell(f.UploadedFilename), f.FirmwareSize, dfu, escapeTableCell(status))
+		}
+	}
+
+	if len(report.TriggerTimes) > 0 {
+		b.WriteString("\n#### DFU Triggers\n\n")
+		b.WriteString("| Scope | Targeting | Sent At | Devices |\n")
+		b.WriteString("| ----- | --------- | ------- | ------- |\n")
+		for _, tr := range report.TriggerTimes {
+			filters, devices := "all devices", ""
+			if tr.Filters != "" {
+				filters = "`" + tr.Filters + "`"
+			}
+			if tr.DeviceCount > 0 {
+				devices = fmt.Sprintf("%d", tr.DeviceCount)
+			}
+			fmt.Fprintf(&b, "| %s | %s | %s | %s |\n", escapeTableCell(tr.Scope), escapeTableCell(filters), tr.Timestamp, devices)
+		}
+	}
+
+	if id := report.ArtifactIdentity; id != nil {
+		b.WriteString("\n")
+		b.WriteString(artifactIdentityMarkdown(id))
+	}
+
+	if len(report.PhaseTimings) > 0 {
+		b.WriteString("\n#### Phase Timings\n\n")
+		b.WriteString("| Phase | Duration |\n")
+		b.WriteString("| ----- | -------- |\n")
+		for _, p := range report.PhaseTimings {
+			fmt.Fprintf(&b, "| %s | %s |\n", p.Phase, (time.Duration(p.DurationMs) * time.Millisecond).String())
+		}
+	}
+
+	if r := report.RetrySummary; r != nil && len(r.Scopes) > 0 {
+		fmt.Fprintf(&b, "\n#### Retries\n\n%d retries in total, %d device(s) retried.\n\n", r.TotalRetries, r.RetriedDevices)
+		b.WriteString("| Scope | Requests | Attempts | Failed |\n")
+		b.WriteString("| ----- | -------- | -------- | ------ |\n")
+		for _, s := range r.Scopes {
+			if s.Kind == RetryScopeDevice {
+				continue
+			}
+			fmt.Fprintf(&b, "| %s `%s` | %d | %d | %d |\n", s.Kind, escapeTableCell(s.Name), s.Requests, s.Attempts, s.Failed)
+		}
+	}
+
+	if len(report.FollowStages) > 0 {
+		b.WriteString("\n#### DFU Stages\n\n")
+		b.WriteString("| Stage | Duration |\n")
+		b.WriteString("| ----- | -------- |\n")
+		for _, stage := range report.FollowStages {
+			fmt.Fprintf(&b, "| %s | %s |\n", stage.Status, (time.Duration(stage.ElapsedMs) * time.Millisecond).String())
+		}
+	}
+
+	if report.ABComparison != nil {
+		b.WriteString(abComparisonMarkdown(report.ABComparison))
+	}
+
+	if len(report.DeviceReport) > 0 {
+		b.WriteString("\n")
+		b.WriteString(deviceReportMarkdown(report.DeviceReport))
+	} else if len(report.DeviceStates) > 0 {
+		b.WriteString("\n")
+		b.WriteString(deviceStatesMarkdown(report.DeviceStates))
+	}
+
+	return b.String()
+}
+
+// artifactIdentityMarkdown renders the firmware digests, paired with those Notehub
+// reported for the upload, as a Markdown table
+func artifactIdentityMarkdown(id *ArtifactIdentity) string {
+	var b strings.Builder
+	b.WriteString("#### Artifact Identity\n\n")
+	b.WriteString("| Digest | Local | Notehub |\n")
+	b.WriteString("| ------ | ----- | ------- |\n")
+	row := func(name, local, reported string) {
+		if reported == "" {
+			reported = "not reported"
+		} else {
+			reported = "`" + reported + "` ✅"
+		}
+		fmt.Fprintf(&b, "| %s | `%s` | %s |\n", name, local, reported)
+	}
+	fmt.Fprintf(&b, "| Size | %d bytes | |\n", id.Size)
+	row("SHA-256", id.SHA256, id.NotehubSHA256)
+	fmt.Fprintf(&b, "| SHA-1 | `%s` | |\n", id.SHA1)
+	row("MD5", id.MD5, id.NotehubMD5)
+	row("CRC32", id.CRC32, id.NotehubCRC32)
+	fmt.Fprintf(&b, "| SHA-256 of first %d bytes | `%s` | |\n", identityEdgeBytes, id.HeadSHA256)
+	fmt.Fprintf(&b, "| SHA-256 of last %d bytes | `%s` | |\n", identityEdgeBytes, id.TailSHA256)
+	return b.String()
+}
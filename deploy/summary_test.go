@@ -0,0 +1,100 @@
+package deploy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestDeploymentSummaryMarkdown_Success(t *testing.T) {
+	md := DeploymentSummaryMarkdown(&DeploymentReport{
+		ProjectUID:       "app:123",
+		FirmwareFile:     "build/app.bin",
+		FirmwareType:     notehub.FirmwareTypeHost,
+		UploadedFilename: "app$20250101.bin",
+		FirmwareSize:     2048,
+		FirmwareSHA256:   testFirmwareSHA256,
+		TargetingParams:  "deviceUID=dev%3A1",
+		DFUTriggered:     true,
+		PhaseTimings:     []PhaseTiming{{Phase: "authenticate", DurationMs: 120}, {Phase: "upload", DurationMs: 1500}},
+		DeviceStates:     []notehub.DeviceDFUState{{DeviceUID: "dev:1", Status: notehub.DFUStateCompleted}},
+		Status:           StatusSuccess,
+	})
+
+	for _, line := range []string{
+		"### ✅ Notehub Firmware Deployment",
+		"| Project UID | app:123 |",
+		"| Uploaded Filename | app$20250101.bin |",
+		"| Size | 2048 bytes |",
+		"| SHA-256 | `" + testFirmwareSHA256 + "` |",
+		"| Targeting | `deviceUID=dev%3A1` |",
+		"| DFU Issued | yes |",
+		"| authenticate | 120ms |",
+		"| upload | 1.5s |",
+		"| dev:1 | completed |",
+	} {
+		if !strings.Contains(md, line) {
+			t.Errorf("Expected %q in summary:\n%s", line, md)
+		}
+	}
+	if strings.Contains(md, "Failure") {
+		t.Errorf("Successful summary should not include a failure row:\n%s", md)
+	}
+}
+
+func TestDeploymentSummaryMarkdown_Failure(t *testing.T) {
+	md := DeploymentSummaryMarkdown(&DeploymentReport{
+		ProjectUID:   "app:123",
+		FirmwareType: notehub.FirmwareTypeNotecard,
+		PhaseTimings: []PhaseTiming{{Phase: "authenticate", DurationMs: 30}},
+		Status:       StatusFailed,
+		Error:        "authentication failed: status 401 | invalid\nclient",
+	})
+
+	for _, line := range []string{
+		"### ❌ Notehub Firmware Deployment",
+		`| Failure | authentication failed: status 401 \| invalid client |`,
+		"| DFU Issued | no |",
+		"| authenticate | 30ms |",
+	} {
+		if !strings.Contains(md, line) {
+			t.Errorf("Expected %q in summary:\n%s", line, md)
+		}
+	}
+	for _, absent := range []string{"Uploaded Filename", "SHA-256", "Targeting"} {
+		if strings.Contains(md, absent) {
+			t.Errorf("Expected no %s row before upload:\n%s", absent, md)
+		}
+	}
+}
+
+func TestDeploymentReportPhases(t *testing.T) {
+	report := &DeploymentReport{}
+	report.endPhase()
+	report.startPhase("authenticate")
+	report.startPhase("upload")
+	report.endPhase()
+	report.endPhase()
+
+	if len(report.PhaseTimings) != 2 || report.PhaseTimings[0].Phase != "authenticate" || report.PhaseTimings[1].Phase != "upload" {
+		t.Errorf("Expected each phase to be recorded once, got %+v", report.PhaseTimings)
+	}
+}
+
+func TestArtifactIdentityMarkdown(t *testing.T) {
+	md := artifactIdentityMarkdown(&ArtifactIdentity{Size: 8, SHA256: "aa", SHA1: "bb", MD5: "cc", CRC32: "dd", HeadSHA256: "ee", TailSHA256: "ff", NotehubMD5: "cc"})
+
+	for _, line := range []string{
+		"| Size | 8 bytes | |",
+		"| SHA-256 | `aa` | not reported |",
+		"| MD5 | `cc` | `cc` ✅ |",
+		"| CRC32 | `dd` | not reported |",
+		"| SHA-256 of first 1024 bytes | `ee` | |",
+		"| SHA-256 of last 1024 bytes | `ff` | |",
+	} {
+		if !strings.Contains(md, line) {
+			t.Errorf("Expected %q in:\n%s", line, md)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// Behaviours when a tag glob matches no tags in the project
+const (
+	NoMatchFail = "fail"
+	NoMatchWarn = "warn"
+)
+
+// ParseNoMatchBehavior validates the no_match_behavior input
+func ParseNoMatchBehavior(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", NoMatchFail:
+		return NoMatchFail, nil
+	case NoMatchWarn:
+		return NoMatchWarn, nil
+	default:
+		return "", fmt.Errorf("invalid no_match_behavior %q (accepted values: %s, %s)", value, NoMatchFail, NoMatchWarn)
+	}
+}
+
+// How a DFU targeting several tags matches devices
+const (
+	TagMatchAny = "any"
+	TagMatchAll = "all"
+)
+
+// ParseTagMatch validates the tag_match input
+func ParseTagMatch(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", TagMatchAny:
+		return TagMatchAny, nil
+	case TagMatchAll:
+		return TagMatchAll, nil
+	default:
+		return "", fmt.Errorf("invalid tag_match %q (accepted values: %s, %s)", value, TagMatchAny, TagMatchAll)
+	}
+}
+
+// matchAllTags reports whether the DFU must reach only devices carrying every one of
+// several tags. Notehub matches a device carrying any of the tags in the query, so these
+// devices are resolved and targeted by UID instead.
+func matchAllTags(config *DeploymentConfig) bool {
+	return config.TagMatch == TagMatchAll && len(SplitTags(config.Tag)) > 1
+}
+
+// devicesWithAllTags returns the devices carrying a tag matching each of patterns, which
+// may be globs
+func devicesWithAllTags(devices []notehub.Device, patterns []string) []notehub.Device {
+	var kept []notehub.Device
+	for _, d := range devices {
+		tags := SplitTags(d.Tags)
+		all := true
+		for _, pattern := range patterns {
+			if !slices.ContainsFunc(tags, func(tag string) bool { return tagMatches(tag, pattern) }) {
+				all = false
+				break
+			}
+		}
+		if all {
+			kept = append(kept, d)
+		}
+	}
+	return kept
+}
+
+// tagMatches reports whether tag is pattern, or matches it as a glob
+func tagMatches(tag, pattern string) bool {
+	if tag == pattern {
+		return true
+	}
+	if !isTagGlob(pattern) {
+		return false
+	}
+	ok, _ := path.Match(pattern, tag)
+	return ok
+}
+
+// isTagGlob reports whether a tag contains path.Match metacharacters
+func isTagGlob(tag string) bool {
+	return strings.ContainsAny(tag, "*?[")
+}
+
+// SplitTags splits a tag list, or any other list input, separated by commas or newlines,
+// dropping empty and repeated entries
+func SplitTags(value string) []string {
+	return splitList(value)
+}
+
+// tagInventory returns the distinct tags present on the given devices, sorted
+func tagInventory(devices []notehub.Device) []string {
+	seen := map[string]bool{}
+	for _, d := range devices {
+		for _, t := range SplitTags(d.Tags) {
+			seen[t] = true
+		}
+	}
+
+	inventory := make([]string, 0, len(seen))
+	for t := range seen {
+		inventory = append(inventory, t)
+	}
+	sort.Strings(inventory)
+	return inventory
+}
+
+// expandTagGlobs replaces each glob in tags with the inventory tags it matches. Exact tags
+// pass through unchanged. A glob matching nothing fails when config.NoMatchBehavior is
+// NoMatchFail and is dropped with a warning under NoMatchWarn; if nothing at all is left
+// the expansion fails anyway, since an empty tag filter would widen the deployment to
+// every device.
+func expandTagGlobs(config *DeploymentConfig, tags []string, inventory []string) ([]string, error) {
+	var expanded []string
+	seen := map[string]bool{}
+	add := func(t string) {
+		if !seen[t] {
+			seen[t] = true
+			expanded = append(expanded, t)
+		}
+	}
+
+	for _, tag := range tags {
+		if !isTagGlob(tag) {
+			add(tag)
+			continue
+		}
+
+		var matches []string
+		for _, t := range inventory {
+			ok, err := path.Match(tag, t)
+			if err != nil {
+				return nil, fmt.Errorf("invalid tag glob %q: %w", tag, err)
+			}
+			if ok {
+				matches = append(matches, t)
+			}
+		}
+
+		if len(matches) == 0 {
+			if config.NoMatchBehavior != NoMatchWarn {
+				return nil, fmt.Errorf("tag glob %q matched no tags in the project", tag)
+			}
+			config.Warnf("Tag glob %q matched no tags in the project; ignoring it", tag)
+			continue
+		}
+
+		config.logf("  - Tag glob %q expanded to: %s", tag, strings.Join(matches, ", "))
+		for _, m := range matches {
+			add(m)
+		}
+	}
+
+	if len(expanded) == 0 {
+		return nil, fmt.Errorf("tag globs matched no tags in the project")
+	}
+
+	return expanded, nil
+}
+
+// resolveTagGlobs expands any globs in config.Tag against the project's tag inventory,
+// aggregated from the devices listing. Tag inputs without globs are returned unchanged
+// without listing devices.
+func resolveTagGlobs(ctx context.Context, client *notehub.Client, config *DeploymentConfig) (string, error) {
+	tagInput := config.Tag
+	tags := SplitTags(tagInput)
+
+	hasGlob := false
+	for _, t := range tags {
+		if isTagGlob(t) {
+			hasGlob = true
+			break
+		}
+	}
+	if !hasGlob {
+		return tagInput, nil
+	}
+
+	config.logf("Expanding tag globs against project tags...")
+	devices, err := client.ListDevices(ctx, config.ProjectUID, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to list project tags: %w", err)
+	}
+
+	expanded, err := expandTagGlobs(config, tags, tagInventory(devices))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.Join(expanded, ","), nil
+}
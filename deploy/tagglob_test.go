@@ -0,0 +1,149 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestTagInventory(t *testing.T) {
+	inventory := tagInventory([]notehub.Device{
+		{UID: "dev:1", Tags: "ring-1-eu,production"},
+		{UID: "dev:2", Tags: "ring-1-us, production"},
+		{UID: "dev:3"},
+		{UID: "dev:4", Tags: "ring-2-eu,"},
+	})
+
+	expected := "production,ring-1-eu,ring-1-us,ring-2-eu"
+	if got := strings.Join(inventory, ","); got != expected {
+		t.Errorf("Expected inventory %s, got %s", expected, got)
+	}
+}
+
+func TestExpandTagGlobs(t *testing.T) {
+	inventory := []string{"production", "ring-1-eu", "ring-1-us", "ring-2-eu", "staging"}
+
+	tests := []struct {
+		name        string
+		tags        []string
+		noMatch     string
+		expected    string
+		expectError bool
+	}{
+		{"exact tags pass through", []string{"production", "not-in-inventory"}, NoMatchFail, "production,not-in-inventory", false},
+		{"star glob", []string{"ring-1-*"}, NoMatchFail, "ring-1-eu,ring-1-us", false},
+		{"question mark glob", []string{"ring-?-eu"}, NoMatchFail, "ring-1-eu,ring-2-eu", false},
+		{"class glob", []string{"ring-[2]-*"}, NoMatchFail, "ring-2-eu", false},
+		{"overlapping globs deduplicated", []string{"ring-1-eu", "ring-*-eu"}, NoMatchFail, "ring-1-eu,ring-2-eu", false},
+		{"unmatched glob fails", []string{"ring-3-*"}, NoMatchFail, "", true},
+		{"unmatched glob warned and dropped", []string{"ring-3-*", "staging"}, NoMatchWarn, "staging", false},
+		{"nothing left fails even when warning", []string{"ring-3-*"}, NoMatchWarn, "", true},
+		{"malformed glob", []string{"ring-[-*"}, NoMatchFail, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := expandTagGlobs(&DeploymentConfig{NoMatchBehavior: tt.noMatch}, tt.tags, inventory)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Join(got, ",") != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, strings.Join(got, ","))
+			}
+		})
+	}
+}
+
+func TestResolveTagGlobs(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": respond(`{"devices":[{"uid":"dev:1","tags":"ring-1-eu"},{"uid":"dev:2","tags":"ring-1-us,beta"}],"has_more":false}`),
+	})
+
+	client := newTestClient(server.URL)
+	ctx := context.Background()
+
+	got, err := resolveTagGlobs(ctx, client, &DeploymentConfig{ProjectUID: "app:123", Tag: "beta,ring-1-*", NoMatchBehavior: NoMatchFail})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got != "beta,ring-1-eu,ring-1-us" {
+		t.Errorf("Unexpected expansion %s", got)
+	}
+
+	if got, err := resolveTagGlobs(ctx, client, &DeploymentConfig{ProjectUID: "app:123", Tag: "production", NoMatchBehavior: NoMatchFail}); err != nil || got != "production" {
+		t.Errorf("Expected exact tags to bypass expansion, got %q, %v", got, err)
+	}
+	if listed := server.count("GET /projects/app:123/devices"); listed != 1 {
+		t.Errorf("Expected exact tags not to list devices, got %d listings", listed)
+	}
+}
+
+func TestParseTagMatch(t *testing.T) {
+	for value, expected := range map[string]string{"": TagMatchAny, "any": TagMatchAny, " ALL ": TagMatchAll} {
+		if got, err := ParseTagMatch(value); err != nil || got != expected {
+			t.Errorf("ParseTagMatch(%q) = %q, %v; expected %q", value, got, err, expected)
+		}
+	}
+	if _, err := ParseTagMatch("both"); err == nil || !strings.Contains(err.Error(), "accepted values: any, all") {
+		t.Errorf("Expected an invalid tag_match error, got %v", err)
+	}
+}
+
+func TestDevicesWithAllTags(t *testing.T) {
+	devices := []notehub.Device{
+		{UID: "dev:1", Tags: "prod,ring-1-eu"},
+		{UID: "dev:2", Tags: "prod"},
+		{UID: "dev:3", Tags: "ring-1-us, prod"},
+		{UID: "dev:4", Tags: "ring-2-eu,prod"},
+	}
+
+	var uids []string
+	for _, d := range devicesWithAllTags(devices, []string{"prod", "ring-1-*"}) {
+		uids = append(uids, d.UID)
+	}
+	if strings.Join(uids, ",") != "dev:1,dev:3" {
+		t.Errorf("Expected the devices matching every tag, got %v", uids)
+	}
+}
+
+func TestDeployFirmware_TagMatch(t *testing.T) {
+	tests := []struct {
+		tagMatch    string
+		expectedDFU string
+		expectList  bool
+	}{
+		{TagMatchAny, "tags=prod&tags=sensor", false},
+		{TagMatchAll, "deviceUID=dev%3A1&deviceUID=dev%3A3", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tagMatch, func(t *testing.T) {
+			server := newFakeNotehub(t, fakeRoutes{
+				"/projects/app:123/devices": respond(`{"devices":[{"uid":"dev:1","tags":"prod,sensor"},{"uid":"dev:2","tags":"prod"},{"uid":"dev:3","tags":"sensor,prod,beta"},{"uid":"dev:4","tags":"sensor"}],"has_more":false}`),
+			})
+			config := server.config(t)
+			config.DeviceUID = ""
+			config.Tag = "prod, sensor"
+			config.TagMatch = tt.tagMatch
+			_, err := DeployFirmware(context.Background(), config)
+			if err != nil {
+				t.Fatalf("Deployment failed: %v", err)
+			}
+
+			dfuQuery, listQuery := server.lastQuery("POST /projects/app:123/dfu/host/update"), server.lastQuery("GET /projects/app:123/devices")
+			if dfuQuery != tt.expectedDFU {
+				t.Errorf("Expected DFU query %q, got %q", tt.expectedDFU, dfuQuery)
+			}
+			if tt.expectList != strings.HasSuffix(listQuery, "&tags=prod&tags=sensor") {
+				t.Errorf("Expected devices listed by any tag only for tag_match all, got listing %q", listQuery)
+			}
+		})
+	}
+}
@@ -0,0 +1,76 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Targeting inputs that name individual devices, and those that select a group of them.
+// Combining the two makes it unclear whether the group narrows the listed devices or adds
+// to them. Filters on device attributes, such as product_uid or sku, combine with either.
+var (
+	individualTargetInputs = []string{"device_uid", "serial_number", "device_name"}
+	groupTargetInputs      = []string{"fleet_uid", "fleet_name", "tag"}
+)
+
+// targetInputValue returns the value of a targeting input named in the conflict rules
+func targetInputValue(config *DeploymentConfig, input string) string {
+	switch input {
+	case "device_uid":
+		return config.DeviceUID
+	case "serial_number":
+		return config.SerialNumber
+	case "device_name":
+		return config.DeviceName
+	case "fleet_uid":
+		return config.FleetUID
+	case "fleet_name":
+		return config.FleetName
+	case "tag":
+		return config.Tag
+	}
+	return ""
+}
+
+// targetConflicts returns each pair of targeting inputs set together whose combination is
+// ambiguous: a device list with a group, two ways of naming individual devices, or two
+// ways of naming fleets. With resolve_targets, serial numbers and device names are merged
+// into the device UIDs, so naming devices several ways is then allowed.
+func targetConflicts(config *DeploymentConfig) []string {
+	set := func(input string) bool { return strings.TrimSpace(targetInputValue(config, input)) != "" }
+
+	var conflicts []string
+	for i, a := range individualTargetInputs {
+		if !set(a) {
+			continue
+		}
+		for _, b := range individualTargetInputs[i+1:] {
+			if set(b) && !config.ResolveTargets {
+				conflicts = append(conflicts, fmt.Sprintf("%s and %s both name individual devices", a, b))
+			}
+		}
+		for _, b := range groupTargetInputs {
+			if set(b) {
+				conflicts = append(conflicts, fmt.Sprintf("%s names individual devices but %s selects a group", a, b))
+			}
+		}
+	}
+	if set("fleet_uid") && set("fleet_name") {
+		conflicts = append(conflicts, "fleet_uid and fleet_name both name fleets")
+	}
+	return conflicts
+}
+
+// checkConflictingTargets refuses a DFU whose targeting inputs conflict, so it is unclear
+// which devices it would reach, unless allow_conflicting_targets is set
+func checkConflictingTargets(config *DeploymentConfig) error {
+	if !config.IssueDFU || config.AllowConflictingTargets {
+		return nil
+	}
+	conflicts := targetConflicts(config)
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return fmt.Errorf("conflicting targeting inputs make it unclear which devices the DFU would reach: %s; target the devices one way, or set allow_conflicting_targets: true to send them as given",
+		strings.Join(conflicts, "; "))
+}
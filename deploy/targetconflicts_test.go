@@ -0,0 +1,67 @@
+package deploy
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestCheckConflictingTargets(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      DeploymentConfig
+		expectError string
+	}{
+		{"device with fleet", DeploymentConfig{DeviceUID: "dev:1", FleetUID: "fleet:1"}, "device_uid names individual devices but fleet_uid selects a group"},
+		{"serial number with tag", DeploymentConfig{SerialNumber: "sn-1", Tag: "beta"}, "serial_number names individual devices but tag selects a group"},
+		{"device with serial number", DeploymentConfig{DeviceUID: "dev:1", SerialNumber: "sn-1"}, "device_uid and serial_number both name individual devices"},
+		{"fleet uid with fleet name", DeploymentConfig{FleetUID: "fleet:1", FleetName: "Beta"}, "fleet_uid and fleet_name both name fleets"},
+		{"several conflicts", DeploymentConfig{DeviceUID: "dev:1", DeviceName: "pump", FleetName: "Beta"}, "device_uid and device_name both name individual devices; device_uid names individual devices but fleet_name"},
+		{"resolved device lists", DeploymentConfig{DeviceUID: "dev:1", SerialNumber: "sn-1", ResolveTargets: true}, ""},
+		{"fleet with tag", DeploymentConfig{FleetUID: "fleet:1", Tag: "beta"}, ""},
+		{"device with filters", DeploymentConfig{DeviceUID: "dev:1", ProductUID: "product:1", SKU: "NOTE-WBNA"}, ""},
+		{"overridden", DeploymentConfig{DeviceUID: "dev:1", FleetUID: "fleet:1", AllowConflictingTargets: true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.IssueDFU = true
+			err := checkConflictingTargets(&tt.config)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+			if !strings.Contains(err.Error(), "allow_conflicting_targets: true") {
+				t.Errorf("Expected the error to name the override, got %v", err)
+			}
+		})
+	}
+}
+
+func TestDeployFirmware_ConflictingTargets(t *testing.T) {
+	server := newFakeNotehub(t, nil)
+	config := *server.config(t)
+	useRecordingLogger(&config)
+	config.FleetUID = "fleet:1"
+	rejected := config
+	if _, err := DeployFirmware(context.Background(), &rejected); err == nil || !strings.Contains(err.Error(), "conflicting targeting inputs") {
+		t.Fatalf("Expected the conflicting targets to be rejected, got %v", err)
+	}
+	if requests := server.requests(); len(requests) != 0 {
+		t.Errorf("Expected no upload or DFU after the rejection, got %v", requests)
+	}
+
+	overridden := config
+	overridden.AllowConflictingTargets = true
+	if _, err := DeployFirmware(context.Background(), &overridden); err != nil {
+		t.Fatalf("Expected allow_conflicting_targets to send the DFU, got %v", err)
+	}
+	if dfus := server.count("POST /projects/app:123/dfu/host/update"); dfus != 1 {
+		t.Errorf("Expected one DFU request, got %d", dfus)
+	}
+}
@@ -0,0 +1,79 @@
+package deploy
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// targetPreviewSize is how many of the target device UIDs are listed in the log and the
+// job summary
+const targetPreviewSize = 10
+
+// listableDeviceFilters are the targeting parameters the devices listing filters on.
+// Others, which device_query_json can add, are ignored by the listing, so a count of
+// devices targeted with them is best-effort.
+var listableDeviceFilters = map[string]bool{
+	"deviceUID":        true,
+	"tags":             true,
+	"serialNumber":     true,
+	"fleetUID":         true,
+	"productUID":       true,
+	"notecardFirmware": true,
+	"location":         true,
+	"sku":              true,
+}
+
+// TargetPreview records the devices a DFU is about to reach, counted before it is issued
+type TargetPreview struct {
+	Count      int      `json:"count"`
+	DeviceUIDs []string `json:"device_uids,omitempty"`
+	BestEffort bool     `json:"best_effort,omitempty"`
+}
+
+// unlistableFilters returns the targeting parameters the devices listing cannot filter on
+func unlistableFilters(filters url.Values) []string {
+	var keys []string
+	for k := range filters {
+		if !listableDeviceFilters[k] {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// previewTargets records how many devices the DFU will reach and the first few of them,
+// and fails when there are more than config.MaxDevices, e.g. because a mistyped tag
+// matched the whole fleet. exact is false when the devices came from a listing filtered
+// on the targeting parameters, which may ignore some of them.
+func previewTargets(config *DeploymentConfig, report *DeploymentReport, devices []notehub.Device, exact bool) error {
+	preview := &TargetPreview{Count: len(devices)}
+	for i := 0; i < len(devices) && i < targetPreviewSize; i++ {
+		preview.DeviceUIDs = append(preview.DeviceUIDs, devices[i].UID)
+	}
+	if !exact {
+		if keys := unlistableFilters(buildTargetingParams(config)); len(keys) > 0 {
+			preview.BestEffort = true
+			config.logf("The devices listing cannot filter on %s, so the target count is best-effort", strings.Join(keys, ", "))
+		}
+	}
+	report.TargetPreview = preview
+
+	if len(devices) > 0 {
+		more := ""
+		if len(devices) > len(preview.DeviceUIDs) {
+			more = fmt.Sprintf(" and %d more", len(devices)-len(preview.DeviceUIDs))
+		}
+		config.logf("The DFU will reach %d device(s): %s%s", len(devices), strings.Join(preview.DeviceUIDs, ", "), more)
+	}
+
+	if config.MaxDevices > 0 && len(devices) > config.MaxDevices {
+		return fmt.Errorf("targeting matches %d devices, more than max_devices (%d), so the DFU was not triggered; check the targeting for a typo, or raise max_devices",
+			len(devices), config.MaxDevices)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+func TestPreviewTargets(t *testing.T) {
+	devices := make([]notehub.Device, 12)
+	for i := range devices {
+		devices[i].UID = fmt.Sprintf("dev:%d", i+1)
+	}
+
+	report := &DeploymentReport{}
+	if err := previewTargets(&DeploymentConfig{Tag: "prod"}, report, devices, false); err != nil {
+		t.Fatalf("Unexpected error without max_devices: %v", err)
+	}
+	p := report.TargetPreview
+	if p.Count != 12 || len(p.DeviceUIDs) != targetPreviewSize || p.DeviceUIDs[0] != "dev:1" || p.BestEffort {
+		t.Errorf("Unexpected preview %+v", p)
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "| Target Devices | 12: dev:1, dev:2, dev:3, dev:4, dev:5, dev:6, dev:7, dev:8, dev:9, dev:10 and 2 more |") {
+		t.Errorf("Expected the count and first devices in the summary, got:\n%s", DeploymentSummaryMarkdown(report))
+	}
+
+	// Parameters the devices listing ignores make the count best-effort
+	query := &DeploymentConfig{DeviceQuery: url.Values{"hostFirmware": {"1.2.3"}, "tags": {"prod"}}}
+	if err := previewTargets(query, report, devices, false); err != nil || !report.TargetPreview.BestEffort {
+		t.Errorf("Expected a best-effort count, got %+v, %v", report.TargetPreview, err)
+	}
+	if err := previewTargets(query, report, devices, true); err != nil || report.TargetPreview.BestEffort {
+		t.Errorf("Expected an explicit device list to be counted exactly, got %+v, %v", report.TargetPreview, err)
+	}
+
+	err := previewTargets(&DeploymentConfig{MaxDevices: 10}, report, devices, false)
+	if err == nil || !strings.Contains(err.Error(), "targeting matches 12 devices, more than max_devices (10)") {
+		t.Errorf("Expected max_devices to be enforced, got %v", err)
+	}
+	if err := previewTargets(&DeploymentConfig{MaxDevices: 12}, report, devices, false); err != nil {
+		t.Errorf("Expected a count equal to max_devices to pass, got %v", err)
+	}
+}
+
+func TestDeployFirmware_MaxDevices(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": func(w http.ResponseWriter, r *http.Request) {
+			// The matching devices span two pages
+			if r.URL.Query().Get("pageNum") == "1" {
+				fmt.Fprint(w, `{"devices":[{"uid":"dev:1"},{"uid":"dev:2"}],"has_more":true}`)
+			} else {
+				fmt.Fprint(w, `{"devices":[{"uid":"dev:3"}],"has_more":false}`)
+			}
+		},
+	})
+	deploy := func(maxDevices int) (*DeploymentReport, error) {
+		config := server.config(t)
+		config.DeviceUID = ""
+		config.Tag = "prod"
+		config.MaxDevices = maxDevices
+		return DeployFirmware(context.Background(), config)
+	}
+	dfus := func() int { return server.count("POST /projects/app:123/dfu/host/update") }
+
+	report, err := deploy(2)
+	if err == nil || !strings.Contains(err.Error(), "targeting matches 3 devices, more than max_devices (2)") {
+		t.Fatalf("Expected the deployment to stop at max_devices, got %v", err)
+	}
+	if uploads := len(server.uploaded()); uploads != 0 || dfus() != 0 || report.DFUTriggered {
+		t.Errorf("Expected nothing uploaded or triggered, got %d upload(s) and %d DFU(s)", uploads, dfus())
+	}
+	if outputs := report.Outputs(); outputs["target_device_count"] != "3" {
+		t.Errorf("Expected target_device_count 3 on failure too, got %q", outputs["target_device_count"])
+	}
+
+	report, err = deploy(3)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if dfus() != 1 || report.TargetPreview.Count != 3 || strings.Join(report.TargetPreview.DeviceUIDs, ",") != "dev:1,dev:2,dev:3" {
+		t.Errorf("Expected the DFU issued to the 3 previewed devices, got %+v", report.TargetPreview)
+	}
+}
@@ -0,0 +1,43 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// splitList splits a list input on commas and newlines, so values may be given on one line
+// or as a YAML block scalar, trimming each value and dropping empty and repeated ones
+func splitList(value string) []string {
+	var values []string
+	seen := map[string]bool{}
+	for _, v := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		if v = strings.TrimSpace(v); v != "" && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// suspiciousTarget returns why a value of a targeting input whose values carry prefix, such
+// as "dev:" for device UIDs, looks mistyped, or "" if it looks fine
+func suspiciousTarget(prefix, value string) string {
+	if strings.IndexFunc(value, unicode.IsSpace) >= 0 {
+		return "contains whitespace; separate values with commas or newlines"
+	}
+	if !strings.HasPrefix(value, prefix) {
+		return fmt.Sprintf("does not start with %q", prefix)
+	}
+	return ""
+}
+
+// formatTargetList formats the values of a targeting input for the log, with their count
+// when there are several
+func formatTargetList(value string) string {
+	values := splitList(value)
+	if len(values) < 2 {
+		return strings.Join(values, ",")
+	}
+	return fmt.Sprintf("%s (%d values)", strings.Join(values, ","), len(values))
+}
@@ -0,0 +1,92 @@
+package deploy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitList(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{"comma separated", "dev:1,dev:2", []string{"dev:1", "dev:2"}},
+		{"stray spaces", "dev:123 ,dev:456 , dev:789", []string{"dev:123", "dev:456", "dev:789"}},
+		{"block scalar", "dev:1\ndev:2\n", []string{"dev:1", "dev:2"}},
+		{"indented block scalar with CRLF", "  dev:1\r\n  dev:2\r\n", []string{"dev:1", "dev:2"}},
+		{"commas and newlines mixed", "dev:1, dev:2,\ndev:3\n\n", []string{"dev:1", "dev:2", "dev:3"}},
+		{"duplicates", "beta,alpha, beta\nalpha", []string{"beta", "alpha"}},
+		{"spaces inside a value kept", "San Francisco, London", []string{"San Francisco", "London"}},
+		{"only separators", " ,\n, \n", nil},
+		{"empty", "", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := splitList(tt.value); !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("splitList(%q) = %q, expected %q", tt.value, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestBuildTargetingParams_MessyLists(t *testing.T) {
+	params := buildTargetingParams(&DeploymentConfig{
+		DeviceUID: "dev:123 ,dev:456\ndev:123\n",
+		Tag:       "\n  beta\n  canary\n",
+		FleetUID:  "fleet:1,,",
+	})
+
+	expected := map[string][]string{
+		"deviceUID": {"dev:123", "dev:456"},
+		"tags":      {"beta", "canary"},
+		"fleetUID":  {"fleet:1"},
+	}
+	for param, values := range expected {
+		if !reflect.DeepEqual(params[param], values) {
+			t.Errorf("Expected %s %q, got %q", param, values, params[param])
+		}
+	}
+}
+
+func TestWarnEmptyTargeting_SuspiciousValues(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       DeploymentConfig
+		expectWarned []string
+	}{
+		{"well formed", DeploymentConfig{DeviceUID: "dev:1\ndev:2", FleetUID: "fleet:1", Tag: "beta"}, nil},
+		{"missing device prefix", DeploymentConfig{DeviceUID: "dev:1,12345"}, []string{`device_uid value "12345" does not start with "dev:"`}},
+		{"fleet name as fleet uid", DeploymentConfig{FleetUID: "Production"}, []string{`fleet_uid value "Production" does not start with "fleet:"`}},
+		{"space separated", DeploymentConfig{DeviceUID: "dev:1 dev:2"}, []string{`device_uid value "dev:1 dev:2" contains whitespace`}},
+		{"no values", DeploymentConfig{Tag: ",\n,"}, []string{"tag is set to", "which has no values"}},
+		{"prefix not checked for tags", DeploymentConfig{Tag: "dev-units"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := useRecordingLogger(&tt.config)
+			warnEmptyTargeting(&tt.config)
+			warnings := strings.Join(l.warnings, "\n")
+			if len(tt.expectWarned) == 0 && len(l.warnings) > 0 {
+				t.Errorf("Expected no warnings, got %v", l.warnings)
+			}
+			for _, want := range tt.expectWarned {
+				if !strings.Contains(warnings, want) {
+					t.Errorf("Expected a warning containing %q, got %v", want, l.warnings)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatTargetList(t *testing.T) {
+	if got := formatTargetList("dev:1\n dev:2 ,dev:1"); got != "dev:1,dev:2 (2 values)" {
+		t.Errorf("Expected the normalized list with its count, got %q", got)
+	}
+	if got := formatTargetList(" dev:1 "); got != "dev:1" {
+		t.Errorf("Expected a single value without a count, got %q", got)
+	}
+}
@@ -0,0 +1,58 @@
+package deploy
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// DefaultMinUploadThroughputBps is the upload speed below which a warning is emitted
+	DefaultMinUploadThroughputBps = 10 * 1024
+
+	// minThroughputSampleBytes is the smallest upload whose throughput is judged; smaller
+	// uploads are dominated by request latency rather than bandwidth
+	minThroughputSampleBytes = 64 * 1024
+)
+
+// uploadThroughput returns the effective upload speed in bytes per second
+func uploadThroughput(size int64, elapsed time.Duration) int64 {
+	if size <= 0 {
+		return 0
+	}
+	if elapsed <= 0 {
+		elapsed = time.Millisecond
+	}
+	return int64(float64(size) / elapsed.Seconds())
+}
+
+// isSlowUpload reports whether an upload was large enough to measure and slower than minBps.
+// A minBps of zero disables the check.
+func isSlowUpload(size, bps, minBps int64) bool {
+	return minBps > 0 && size >= minThroughputSampleBytes && bps < minBps
+}
+
+// formatThroughput renders a bytes-per-second figure for humans
+func formatThroughput(bps int64) string {
+	switch {
+	case bps >= 1024*1024:
+		return fmt.Sprintf("%.1f MB/s", float64(bps)/(1024*1024))
+	case bps >= 1024:
+		return fmt.Sprintf("%.1f KB/s", float64(bps)/1024)
+	default:
+		return fmt.Sprintf("%d B/s", bps)
+	}
+}
+
+// recordUploadThroughput stores the upload timing in the report and warns about uploads
+// slower than config.MinUploadThroughputBps
+func recordUploadThroughput(config *DeploymentConfig, report *DeploymentReport, size int64, elapsed time.Duration) {
+	minBps := config.MinUploadThroughputBps
+	report.FirmwareSize = size
+	report.UploadDurationMs = elapsed.Milliseconds()
+	report.UploadThroughputBps = uploadThroughput(size, elapsed)
+
+	if isSlowUpload(size, report.UploadThroughputBps, minBps) {
+		config.Warnf("Firmware upload was slow: %s for %d bytes (threshold %s). Consider investigating runner network performance.",
+			formatThroughput(report.UploadThroughputBps), size, formatThroughput(minBps))
+	}
+}
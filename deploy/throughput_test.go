@@ -0,0 +1,69 @@
+package deploy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUploadThroughput(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		elapsed  time.Duration
+		expected int64
+	}{
+		{"one MB in one second", 1024 * 1024, time.Second, 1024 * 1024},
+		{"half second", 1000, 500 * time.Millisecond, 2000},
+		{"zero size", 0, time.Second, 0},
+		{"zero duration", 1000, 0, 1000000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uploadThroughput(tt.size, tt.elapsed); got != tt.expected {
+				t.Errorf("Expected %d B/s, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestIsSlowUpload(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		bps      int64
+		minBps   int64
+		expected bool
+	}{
+		{"slow large upload", 1024 * 1024, 1024, 10 * 1024, true},
+		{"fast large upload", 1024 * 1024, 1024 * 1024, 10 * 1024, false},
+		{"slow small upload ignored", 1024, 100, 10 * 1024, false},
+		{"check disabled", 1024 * 1024, 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isSlowUpload(tt.size, tt.bps, tt.minBps); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestRecordUploadThroughput(t *testing.T) {
+	report := &DeploymentReport{}
+	recordUploadThroughput(&DeploymentConfig{}, report, 2*1024*1024, 2*time.Second)
+
+	if report.FirmwareSize != 2*1024*1024 {
+		t.Errorf("Expected size to be recorded, got %d", report.FirmwareSize)
+	}
+	if report.UploadDurationMs != 2000 {
+		t.Errorf("Expected duration 2000ms, got %d", report.UploadDurationMs)
+	}
+	if report.UploadThroughputBps != 1024*1024 {
+		t.Errorf("Expected 1 MB/s, got %d", report.UploadThroughputBps)
+	}
+	if got := formatThroughput(report.UploadThroughputBps); got != "1.0 MB/s" {
+		t.Errorf("Expected formatted throughput 1.0 MB/s, got %s", got)
+	}
+}
@@ -0,0 +1,59 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// DefaultUploadTimeout bounds a firmware upload, which for a large image on a slow runner
+// takes far longer than any other request
+const DefaultUploadTimeout = 10 * time.Minute
+
+// DefaultUploadProgressInterval is how often the action logs a long upload's progress
+const DefaultUploadProgressInterval = 10 * time.Second
+
+// isTimeout reports whether err was caused by a deadline rather than a failure
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// explainTimeout names the phase a deadline cut short and the limit that was in effect, so
+// a timed out run says which input to raise, and the phase a cancelled run stopped in.
+// Other errors are returned unchanged.
+func explainTimeout(ctx context.Context, err error, report *DeploymentReport, config *DeploymentConfig) error {
+	phase := report.timedPhase
+	if phase == "" {
+		phase = "the deployment"
+	}
+	if errors.Is(err, context.Canceled) && errors.Is(ctx.Err(), context.Canceled) {
+		return fmt.Errorf("%s was cancelled before it finished: %w", phase, err)
+	}
+	if err == nil || !isTimeout(err) {
+		return err
+	}
+	if config.OverallTimeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s timed out: the overall_timeout of %s was reached: %w", phase, config.OverallTimeout, err)
+	}
+	requestTimeout := config.HTTPTimeout
+	if requestTimeout <= 0 {
+		requestTimeout = notehub.DefaultTimeout
+	}
+	if phase == "upload" && config.MinUploadBytesPerSec > 0 {
+		deadline := notehub.ScaledUploadTimeout(report.FirmwareSize, config.MinUploadBytesPerSec, requestTimeout)
+		return fmt.Errorf("upload timed out: the deadline of %s for %d bytes at min_upload_bytes_per_sec %d was reached: %w",
+			deadline.Round(time.Second), report.FirmwareSize, config.MinUploadBytesPerSec, err)
+	}
+	if phase == "upload" && config.UploadTimeout > 0 {
+		return fmt.Errorf("upload timed out: the upload_timeout of %s was reached: %w", config.UploadTimeout, err)
+	}
+	return fmt.Errorf("%s timed out: a request exceeded the request_timeout of %s: %w", phase, requestTimeout, err)
+}
@@ -0,0 +1,139 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestExplainTimeout(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	cancelled, cancelRun := context.WithCancel(context.Background())
+	cancelRun()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		err      error
+		phase    string
+		config   DeploymentConfig
+		expected string
+	}{
+		{
+			name:     "other errors unchanged",
+			ctx:      context.Background(),
+			err:      errors.New("status 500"),
+			phase:    "upload",
+			expected: "status 500",
+		},
+		{
+			name:     "upload names upload_timeout",
+			ctx:      context.Background(),
+			err:      context.DeadlineExceeded,
+			phase:    "upload",
+			config:   DeploymentConfig{HTTPTimeout: 30 * time.Second, UploadTimeout: 10 * time.Minute},
+			expected: "upload timed out: the upload_timeout of 10m0s was reached",
+		},
+		{
+			name:     "scaled upload deadline names min_upload_bytes_per_sec",
+			ctx:      context.Background(),
+			err:      context.DeadlineExceeded,
+			phase:    "upload",
+			config:   DeploymentConfig{UploadTimeout: 10 * time.Minute, MinUploadBytesPerSec: 10 * 1024},
+			expected: "upload timed out: the deadline of 17m34s for 10485760 bytes at min_upload_bytes_per_sec 10240 was reached",
+		},
+		{
+			name:     "other phases name request_timeout",
+			ctx:      context.Background(),
+			err:      context.DeadlineExceeded,
+			phase:    "resolve_targets",
+			config:   DeploymentConfig{HTTPTimeout: time.Minute, UploadTimeout: 10 * time.Minute},
+			expected: "resolve_targets timed out: a request exceeded the request_timeout of 1m0s",
+		},
+		{
+			name:     "default request timeout",
+			ctx:      context.Background(),
+			err:      fmt.Errorf("request cancelled while waiting to retry: %w", context.DeadlineExceeded),
+			phase:    "authenticate",
+			expected: "authenticate timed out: a request exceeded the request_timeout of 30s",
+		},
+		{
+			name:     "overall deadline takes precedence",
+			ctx:      expired,
+			err:      context.DeadlineExceeded,
+			phase:    "upload",
+			config:   DeploymentConfig{UploadTimeout: 10 * time.Minute, OverallTimeout: 45 * time.Minute},
+			expected: "upload timed out: the overall_timeout of 45m0s was reached",
+		},
+		{
+			name:     "cancelled run names the phase",
+			ctx:      cancelled,
+			err:      fmt.Errorf("firmware upload request failed: %w", context.Canceled),
+			phase:    "upload",
+			expected: "upload was cancelled before it finished",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := &DeploymentReport{FirmwareSize: 10 * 1024 * 1024, timedPhase: tt.phase}
+			err := explainTimeout(tt.ctx, tt.err, report, &tt.config)
+			if !strings.HasPrefix(err.Error(), tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, err)
+			}
+			if !errors.Is(err, tt.err) {
+				t.Error("Expected the original error to stay wrapped")
+			}
+		})
+	}
+}
+
+func TestDeployFirmwareFiles_Timeouts(t *testing.T) {
+	// The upload stub takes ~300ms, like a large image on a slow runner
+	var server *fakeNotehub
+	server = newFakeNotehub(t, fakeRoutes{
+		"PUT /projects/app:123/firmware/*": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-time.After(300 * time.Millisecond):
+			case <-r.Context().Done():
+				return
+			}
+			server.upload(w, r)
+		},
+	})
+
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	deploy := func(requestTimeout, uploadTimeout, overallTimeout time.Duration) error {
+		_, err := DeployFirmwareFiles(context.Background(), &DeploymentConfig{
+			ProjectUID:     "app:123",
+			FirmwareFile:   firmwareFile,
+			APIBaseURL:     server.URL,
+			OAuthTokenURL:  server.URL + "/oauth2/token",
+			HTTPTimeout:    requestTimeout,
+			UploadTimeout:  uploadTimeout,
+			OverallTimeout: overallTimeout,
+			MaxRetries:     0,
+		}, []string{firmwareFile}, "")
+		return err
+	}
+
+	if err := deploy(100*time.Millisecond, 5*time.Second, 0); err != nil {
+		t.Errorf("Expected upload_timeout to outlast request_timeout for the upload, got: %v", err)
+	}
+	if err := deploy(5*time.Second, 100*time.Millisecond, 0); err == nil || !strings.Contains(err.Error(), "upload timed out: the upload_timeout of 100ms was reached") {
+		t.Errorf("Expected the upload to time out on upload_timeout, got: %v", err)
+	}
+	if err := deploy(5*time.Second, 5*time.Second, 150*time.Millisecond); err == nil || !strings.Contains(err.Error(), "upload timed out: the overall_timeout of 150ms was reached") {
+		t.Errorf("Expected the deployment to hit overall_timeout during the upload, got: %v", err)
+	}
+}
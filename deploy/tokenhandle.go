@@ -0,0 +1,208 @@
+package deploy
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// tokenHandleTTL bounds how long a token handle can be redeemed, so a handle is only good
+// for the steps that follow shortly after in the same job
+const tokenHandleTTL = 15 * time.Minute
+
+// tokenHandleMargin is how long before the token itself expires a handle stops being
+// accepted, so the next step never starts with a token about to lapse
+const tokenHandleMargin = 2 * time.Minute
+
+// tokenHandlePattern matches the handles issueTokenHandle generates, which name a file
+var tokenHandlePattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// tokenHandoff is what a token handle refers to. It is only ever stored encrypted.
+type tokenHandoff struct {
+	Token       string    `json:"token"`
+	TokenExpiry time.Time `json:"token_expiry,omitempty"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	APIBaseURL  string    `json:"api_base_url"`
+}
+
+// tokenHandleRun identifies the workflow run a handle may be redeemed in, from which its
+// key is derived; dir is where the encrypted token is stored
+type tokenHandleRun struct {
+	runID   string
+	attempt string
+	dir     string
+}
+
+// currentTokenHandleRun describes the run the action is executing in
+func currentTokenHandleRun() (tokenHandleRun, error) {
+	run := tokenHandleRun{
+		runID:   os.Getenv("GITHUB_RUN_ID"),
+		attempt: os.Getenv("GITHUB_RUN_ATTEMPT"),
+		dir:     os.Getenv("RUNNER_TEMP"),
+	}
+	if run.runID == "" || run.dir == "" {
+		return run, fmt.Errorf("token handles need GITHUB_RUN_ID and RUNNER_TEMP, which are only set within a workflow run")
+	}
+	return run, nil
+}
+
+// key derives the encryption key for handle from the run, so the stored token cannot be
+// decrypted by another run or with another handle
+func (r tokenHandleRun) key(handle string) []byte {
+	sum := sha256.Sum256([]byte("note-dfu-github token handle\x00" + r.runID + "\x00" + r.attempt + "\x00" + handle))
+	return sum[:]
+}
+
+// path is where the encrypted token for handle is stored
+func (r tokenHandleRun) path(handle string) string {
+	return filepath.Join(r.dir, "notehub-token-"+handle)
+}
+
+// issueTokenHandle encrypts the client's access token into the runner's temporary
+// directory and returns the handle a later step redeems it with. The handle itself
+// carries no part of the token.
+func issueTokenHandle(run tokenHandleRun, client *notehub.Client, apiBaseURL string, now time.Time) (string, error) {
+	token, tokenExpiry := client.Session()
+	if token == "" {
+		return "", fmt.Errorf("no access token to hand off")
+	}
+	expiresAt := now.Add(tokenHandleTTL)
+	if !tokenExpiry.IsZero() && tokenExpiry.Add(-tokenHandleMargin).Before(expiresAt) {
+		expiresAt = tokenExpiry.Add(-tokenHandleMargin)
+	}
+	if !expiresAt.After(now) {
+		return "", fmt.Errorf("the access token expires too soon to hand off")
+	}
+
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("failed to generate token handle: %w", err)
+	}
+	handle := hex.EncodeToString(id)
+
+	plaintext, err := json.Marshal(tokenHandoff{Token: token, TokenExpiry: tokenExpiry, ExpiresAt: expiresAt, APIBaseURL: apiBaseURL})
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newTokenHandleCipher(run.key(handle))
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate token handle nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(handle))
+	if err := os.WriteFile(run.path(handle), sealed, 0600); err != nil {
+		return "", fmt.Errorf("failed to store token handle: %w", err)
+	}
+	return handle, nil
+}
+
+// redeemTokenHandle decrypts the token a previous step stored under handle, failing when
+// the handle is malformed, from another run, expired, or for another Notehub
+func redeemTokenHandle(run tokenHandleRun, handle, apiBaseURL string, now time.Time) (*tokenHandoff, error) {
+	if !tokenHandlePattern.MatchString(handle) {
+		return nil, fmt.Errorf("malformed token handle")
+	}
+	sealed, err := os.ReadFile(run.path(handle))
+	if err != nil {
+		return nil, fmt.Errorf("token handle not found in RUNNER_TEMP: %w", err)
+	}
+	gcm, err := newTokenHandleCipher(run.key(handle))
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("token handle is corrupt")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(handle))
+	if err != nil {
+		return nil, fmt.Errorf("token handle could not be decrypted; it was issued in another run or has been altered")
+	}
+
+	var handoff tokenHandoff
+	if err := json.Unmarshal(plaintext, &handoff); err != nil {
+		return nil, fmt.Errorf("token handle is corrupt: %w", err)
+	}
+	if !now.Before(handoff.ExpiresAt) {
+		return nil, fmt.Errorf("token handle expired at %s", handoff.ExpiresAt.UTC().Format(time.RFC3339))
+	}
+	if handoff.APIBaseURL != apiBaseURL {
+		return nil, fmt.Errorf("token handle was issued for %s, not %s", handoff.APIBaseURL, apiBaseURL)
+	}
+	return &handoff, nil
+}
+
+// newTokenHandleCipher returns the AES-GCM cipher for a handle's key
+func newTokenHandleCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// authenticate signs the client in, reusing the token behind config.TokenHandle when it
+// can be redeemed and falling back to the OAuth2 exchange otherwise. With
+// ExportTokenHandle set, the token is then handed off for a later step. With an APIToken
+// there is nothing to do: the client sends it with every request.
+func authenticate(ctx context.Context, client *notehub.Client, config *DeploymentConfig, report *DeploymentReport) error {
+	if config.APIToken != "" {
+		config.logf("✅ Using api_token; skipping the OAuth2 token exchange")
+		return nil
+	}
+
+	apiBaseURL := config.APIBaseURL
+	if apiBaseURL == "" {
+		apiBaseURL = DefaultAPIBaseURL
+	}
+	run, runErr := currentTokenHandleRun()
+
+	resumed := false
+	if config.TokenHandle != "" {
+		var handoff *tokenHandoff
+		err := runErr
+		if err == nil {
+			handoff, err = redeemTokenHandle(run, config.TokenHandle, apiBaseURL, config.now())
+		}
+		if err != nil {
+			config.logf("token_handle cannot be used (%v); authenticating with the client credentials instead", err)
+		} else {
+			config.logger().Mask(handoff.Token)
+			client.ResumeSession(handoff.Token, handoff.TokenExpiry, config.ClientID, config.ClientSecret)
+			config.logf("✅ Reusing the OAuth2 token from token_handle, valid until %s", handoff.ExpiresAt.UTC().Format(time.RFC3339))
+			resumed = true
+		}
+	}
+	if !resumed {
+		if err := client.Authenticate(ctx, config.ClientID, config.ClientSecret); err != nil {
+			return err
+		}
+	}
+
+	if config.ExportTokenHandle {
+		if runErr != nil {
+			config.Warnf("No token_handle was issued: %v", runErr)
+			return nil
+		}
+		handle, err := issueTokenHandle(run, client, apiBaseURL, config.now())
+		if err != nil {
+			config.Warnf("No token_handle was issued: %v", err)
+			return nil
+		}
+		report.tokenHandle = handle
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package deploy
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// newSessionClient returns a client holding token, as if it had authenticated
+func newSessionClient(token string, expiry time.Time) *notehub.Client {
+	client := notehub.New()
+	client.ResumeSession(token, expiry, "id", "secret")
+	return client
+}
+
+func TestTokenHandle_RoundTrip(t *testing.T) {
+	run := tokenHandleRun{runID: "1234", attempt: "1", dir: t.TempDir()}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	tokenExpiry := now.Add(time.Hour)
+
+	handle, err := issueTokenHandle(run, newSessionClient("plaintext-token", tokenExpiry), DefaultAPIBaseURL, now)
+	if err != nil {
+		t.Fatalf("issueTokenHandle failed: %v", err)
+	}
+	if strings.Contains(handle, "plaintext-token") {
+		t.Error("The handle must not carry the token")
+	}
+	stored, err := os.ReadFile(run.path(handle))
+	if err != nil {
+		t.Fatalf("Expected the token stored in RUNNER_TEMP: %v", err)
+	}
+	if strings.Contains(string(stored), "plaintext-token") {
+		t.Error("The stored token must be encrypted")
+	}
+	if info, _ := os.Stat(run.path(handle)); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the stored token readable only by its owner, got %v", info.Mode().Perm())
+	}
+
+	handoff, err := redeemTokenHandle(run, handle, DefaultAPIBaseURL, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("redeemTokenHandle failed: %v", err)
+	}
+	if handoff.Token != "plaintext-token" || !handoff.TokenExpiry.Equal(tokenExpiry) {
+		t.Errorf("Unexpected handoff %+v", handoff)
+	}
+	if !handoff.ExpiresAt.Equal(now.Add(tokenHandleTTL)) {
+		t.Errorf("Expected the handle to expire after %s, got %s", tokenHandleTTL, handoff.ExpiresAt)
+	}
+}
+
+func TestTokenHandle_Rejected(t *testing.T) {
+	run := tokenHandleRun{runID: "1234", attempt: "1", dir: t.TempDir()}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	handle, err := issueTokenHandle(run, newSessionClient("token", now.Add(time.Hour)), DefaultAPIBaseURL, now)
+	if err != nil {
+		t.Fatalf("issueTokenHandle failed: %v", err)
+	}
+
+	otherRun, otherAttempt := run, run
+	otherRun.runID = "5678"
+	otherAttempt.attempt = "2"
+
+	tests := []struct {
+		name        string
+		run         tokenHandleRun
+		handle      string
+		apiBaseURL  string
+		at          time.Time
+		expectError string
+	}{
+		{"expired", run, handle, DefaultAPIBaseURL, now.Add(tokenHandleTTL), "token handle expired at 2026-10-16T12:15:00Z"},
+		{"another run", otherRun, handle, DefaultAPIBaseURL, now, "issued in another run"},
+		{"another attempt", otherAttempt, handle, DefaultAPIBaseURL, now, "issued in another run"},
+		{"another Notehub", run, handle, "https://notehub.example.com/v1", now, "was issued for https://api.notefile.net/v1"},
+		{"unknown handle", run, strings.Repeat("0", 32), DefaultAPIBaseURL, now, "not found"},
+		{"path traversal", run, "../../etc/passwd", DefaultAPIBaseURL, now, "malformed token handle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := redeemTokenHandle(tt.run, tt.handle, tt.apiBaseURL, tt.at)
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+
+	// A tampered file fails authentication rather than yielding a token
+	path := run.path(handle)
+	sealed, _ := os.ReadFile(path)
+	sealed[len(sealed)-1] ^= 0xff
+	os.WriteFile(path, sealed, 0600)
+	if _, err := redeemTokenHandle(run, handle, DefaultAPIBaseURL, now); err == nil || !strings.Contains(err.Error(), "altered") {
+		t.Errorf("Expected a tampered handle to be rejected, got %v", err)
+	}
+}
+
+func TestIssueTokenHandle_BoundedByTokenExpiry(t *testing.T) {
+	run := tokenHandleRun{runID: "1234", dir: t.TempDir()}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	handle, err := issueTokenHandle(run, newSessionClient("token", now.Add(5*time.Minute)), DefaultAPIBaseURL, now)
+	if err != nil {
+		t.Fatalf("issueTokenHandle failed: %v", err)
+	}
+	handoff, err := redeemTokenHandle(run, handle, DefaultAPIBaseURL, now)
+	if err != nil || !handoff.ExpiresAt.Equal(now.Add(3*time.Minute)) {
+		t.Errorf("Expected the handle to lapse 2m before the token, got %+v, %v", handoff, err)
+	}
+
+	if _, err := issueTokenHandle(run, newSessionClient("token", now.Add(time.Minute)), DefaultAPIBaseURL, now); err == nil {
+		t.Error("Expected a token about to expire not to be handed off")
+	}
+}
+
+func TestDeployFirmware_TokenHandoff(t *testing.T) {
+	t.Setenv("GITHUB_RUN_ID", "1234")
+	t.Setenv("GITHUB_RUN_ATTEMPT", "1")
+	t.Setenv("RUNNER_TEMP", t.TempDir())
+
+	server := newFakeNotehub(t, fakeRoutes{
+		"/oauth2/token": respond(`{"access_token":"plaintext-token","expires_in":3600}`),
+	})
+	deploy := func(tokenHandle string, export bool) *DeploymentReport {
+		t.Helper()
+		config := server.config(t)
+		config.DeviceUID = ""
+		config.IssueDFU = false
+		config.ClientID = "id"
+		config.ClientSecret = "secret"
+		config.TokenHandle = tokenHandle
+		config.ExportTokenHandle = export
+		report, err := DeployFirmware(context.Background(), config)
+		if err != nil {
+			t.Fatalf("Deployment failed: %v", err)
+		}
+		if unauthorized := server.unauthorized(func(h http.Header) bool { return h.Get("Authorization") == "Bearer plaintext-token" }); len(unauthorized) > 0 {
+			t.Fatalf("Expected every request to carry the token, got %v", unauthorized)
+		}
+		return report
+	}
+	tokenRequests := func() int { return server.count("POST /oauth2/token") }
+
+	// The upload step authenticates and hands its token off
+	report := deploy("", true)
+	handle := report.Outputs()["token_handle"]
+	if handle == "" || strings.Contains(handle, "plaintext-token") {
+		t.Fatalf("Expected a token_handle output without the token, got %q", handle)
+	}
+	if n := tokenRequests(); n != 1 {
+		t.Fatalf("Expected one OAuth2 exchange, got %d", n)
+	}
+
+	// The DFU step reuses it without authenticating
+	deploy(handle, false)
+	if n := tokenRequests(); n != 1 {
+		t.Errorf("Expected the handle to skip authentication, got %d OAuth2 exchanges", n)
+	}
+
+	// An unusable handle falls back to authenticating
+	deploy("not-a-handle", false)
+	if n := tokenRequests(); n != 2 {
+		t.Errorf("Expected an invalid handle to fall back to authenticating, got %d OAuth2 exchanges", n)
+	}
+}
+
+func TestDeployFirmware_APIToken(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/oauth2/token": respondStatus(http.StatusUnauthorized, `{"error":"invalid_client"}`),
+	})
+	config := server.config(t)
+	config.APIToken = "api-token"
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+	if !report.DFUTriggered {
+		t.Error("Expected the DFU to be triggered")
+	}
+	if n := server.count("POST /oauth2/token"); n != 0 {
+		t.Errorf("Expected no OAuth2 exchange with api_token, got %d token request(s)", n)
+	}
+	unauthorized := server.unauthorized(func(h http.Header) bool {
+		return h.Get("X-Session-Token") == "api-token" && h.Get("Authorization") == ""
+	})
+	if len(unauthorized) > 0 {
+		t.Errorf("Expected every request to carry only the session token, got %v", unauthorized)
+	}
+}
@@ -0,0 +1,22 @@
+package deploy
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// newHTTPTransport returns the transport for Notehub requests. Like the default transport,
+// it routes requests through the proxy named by HTTPS_PROXY or HTTP_PROXY, except for
+// hosts in NO_PROXY, so Notehub can be reached through a corporate gateway. With
+// insecureSkipVerify, TLS certificates are not verified, for gateways with a private CA.
+func newHTTPTransport(insecureSkipVerify bool) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = http.ProxyFromEnvironment
+	if insecureSkipVerify {
+		if transport.TLSClientConfig == nil {
+			transport.TLSClientConfig = &tls.Config{}
+		}
+		transport.TLSClientConfig.InsecureSkipVerify = true
+	}
+	return transport
+}
@@ -0,0 +1,95 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+// getProjectVia authenticates and fetches a project with the client newNotehubClient
+// builds for a fake Notehub at apiBaseURL
+func getProjectVia(apiBaseURL string, insecureSkipVerify bool) error {
+	client := newNotehubClient(&DeploymentConfig{
+		APIBaseURL:         apiBaseURL,
+		OAuthTokenURL:      apiBaseURL + "/oauth2/token",
+		InsecureSkipVerify: insecureSkipVerify,
+	})
+	if err := client.Authenticate(context.Background(), "id", "secret"); err != nil {
+		return err
+	}
+	_, err := client.GetProject(context.Background(), "app:123")
+	return err
+}
+
+// serveProject answers the token and project requests of getProjectVia
+func serveProject(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/oauth2/token") {
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+		return
+	}
+	fmt.Fprint(w, `{"uid":"app:123"}`)
+}
+
+func TestNewHTTPTransport_InsecureSkipVerify(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(serveProject))
+	defer server.Close()
+
+	if err := getProjectVia(server.URL, false); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Fatalf("Expected the self-signed certificate to be rejected, got %v", err)
+	}
+	if err := getProjectVia(server.URL, true); err != nil {
+		t.Fatalf("Expected the request to succeed with insecure_skip_verify, got %v", err)
+	}
+	if tlsConfig := http.DefaultTransport.(*http.Transport).TLSClientConfig; tlsConfig != nil && tlsConfig.InsecureSkipVerify {
+		t.Error("insecure_skip_verify must not change the default transport")
+	}
+}
+
+// TestProxyHelperProcess runs in a subprocess started by TestNewNotehubClient_ProxyFromEnvironment,
+// since the proxy environment is read only once per process
+func TestProxyHelperProcess(t *testing.T) {
+	if os.Getenv("ODFU_PROXY_HELPER") != "1" {
+		return
+	}
+	if err := getProjectVia("http://notehub.example.internal/v1", false); err != nil {
+		t.Fatalf("Request through the proxy failed: %v", err)
+	}
+
+	transport := newHTTPTransport(false)
+	req, _ := http.NewRequest("GET", "http://bypass.example.internal/v1", nil)
+	if proxy, err := transport.Proxy(req); err != nil || proxy != nil {
+		t.Fatalf("Expected hosts in NO_PROXY to be reached directly, got proxy %v, %v", proxy, err)
+	}
+}
+
+func TestNewNotehubClient_ProxyFromEnvironment(t *testing.T) {
+	var proxied []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A proxy receives the absolute URL of the request it forwards
+		proxied = append(proxied, r.URL.String())
+		serveProject(w, r)
+	}))
+	defer proxy.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestProxyHelperProcess$")
+	cmd.Env = append(os.Environ(),
+		"ODFU_PROXY_HELPER=1",
+		"HTTP_PROXY="+proxy.URL,
+		"http_proxy="+proxy.URL,
+		"NO_PROXY=bypass.example.internal",
+		"no_proxy=bypass.example.internal",
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("Helper process failed: %v\n%s", err, out)
+	}
+
+	expected := []string{"http://notehub.example.internal/v1/oauth2/token", "http://notehub.example.internal/v1/projects/app:123"}
+	if len(proxied) != len(expected) || proxied[0] != expected[0] || proxied[1] != expected[1] {
+		t.Errorf("Expected the Notehub requests to go through the proxy, got %v", proxied)
+	}
+}
@@ -0,0 +1,32 @@
+package deploy
+
+// triggerTimeFormat is RFC3339 with milliseconds, precise enough to align device telemetry
+// with the DFU request that caused it
+const triggerTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// TriggerTime records one DFU trigger or schedule request: which part of the rollout it
+// covered, its targeting filters, when it was sent, and how many devices it targeted when
+// that is known
+type TriggerTime struct {
+	Scope       string `json:"scope"`
+	Filters     string `json:"filters"`
+	Timestamp   string `json:"timestamp"`
+	DeviceCount int    `json:"device_count,omitempty"`
+}
+
+// newTriggerTime records a DFU request for dfuConfig's targeting about to be sent, stamped
+// by the run's clock. Explicit device lists are counted; otherwise the count of devices
+// resolved beforehand is used, if any.
+func newTriggerTime(config *DeploymentConfig, report *DeploymentReport, dfuConfig *DeploymentConfig, scope string) TriggerTime {
+	params := buildTargetingParams(dfuConfig)
+	count := report.ResolvedDevices
+	if len(params) == 1 && len(params["deviceUID"]) > 0 {
+		count = len(params["deviceUID"])
+	}
+	return TriggerTime{
+		Scope:       scope,
+		Filters:     dfuParams(dfuConfig).Encode(),
+		Timestamp:   config.now().UTC().Format(triggerTimeFormat),
+		DeviceCount: count,
+	}
+}
@@ -0,0 +1,85 @@
+package deploy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTriggerTimes_JSONShape(t *testing.T) {
+	triggers := []TriggerTime{
+		{Scope: "batch 1/2", Filters: "deviceUID=dev%3A1&deviceUID=dev%3A2", Timestamp: "2025-06-02T02:00:00.000Z", DeviceCount: 2},
+		{Scope: "dfu", Filters: "", Timestamp: "2025-06-02T02:00:01.250Z"},
+	}
+	data, err := json.Marshal(triggers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden := `[{"scope":"batch 1/2","filters":"deviceUID=dev%3A1\u0026deviceUID=dev%3A2","timestamp":"2025-06-02T02:00:00.000Z","device_count":2},` +
+		`{"scope":"dfu","filters":"","timestamp":"2025-06-02T02:00:01.250Z"}]`
+	if string(data) != golden {
+		t.Errorf("trigger_times serialization changed:\ngot:      %s\nexpected: %s", data, golden)
+	}
+
+	outputs := (&DeploymentReport{Status: StatusSuccess, TriggerTimes: triggers}).Outputs()
+	if outputs["trigger_times"] != golden {
+		t.Errorf("Unexpected trigger_times output %q", outputs["trigger_times"])
+	}
+}
+
+func TestDeployFirmware_RecordsTriggerTimes(t *testing.T) {
+	server := newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/dfu/host/update": func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, `{"request_id":"dfu:%d","device_count":%d}`, len(r.URL.Query()["deviceUID"]), len(r.URL.Query()["deviceUID"]))
+		},
+	})
+	var uids []string
+	for i := 0; i < 150; i++ {
+		uids = append(uids, fmt.Sprintf("dev:%d", i))
+	}
+
+	// The pinned clock advances 1.5s each time it is read, first for the deployment start
+	now := time.Date(2025, 6, 2, 2, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+	config := server.config(t)
+	config.DeviceUID = strings.Join(uids, ",")
+	config.Clock = func() time.Time {
+		now = now.Add(1500 * time.Millisecond)
+		return now
+	}
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Deployment failed: %v", err)
+	}
+
+	if len(report.TriggerTimes) != 2 {
+		t.Fatalf("Expected a trigger time per batch, got %+v", report.TriggerTimes)
+	}
+	expected := []struct {
+		scope     string
+		timestamp string
+		count     int
+	}{
+		{"batch 1/2", "2025-06-02T00:00:03.000Z", 100},
+		{"batch 2/2", "2025-06-02T00:00:04.500Z", 50},
+	}
+	for i, e := range expected {
+		tr := report.TriggerTimes[i]
+		if tr.Scope != e.scope || tr.Timestamp != e.timestamp || tr.DeviceCount != e.count {
+			t.Errorf("Trigger %d: expected %s at %s for %d devices, got %+v", i, e.scope, e.timestamp, e.count, tr)
+		}
+		if !strings.HasPrefix(tr.Filters, "deviceUID=") {
+			t.Errorf("Trigger %d: expected the batch's device UIDs as filters, got %q", i, tr.Filters)
+		}
+	}
+	// Notehub's responses to the batches are combined
+	if report.DFUDeviceCount != 150 || strings.Join(report.DFURequestIDs, ",") != "dfu:100,dfu:50" {
+		t.Errorf("Expected both DFU responses recorded, got %d devices and %v", report.DFUDeviceCount, report.DFURequestIDs)
+	}
+	if !strings.Contains(DeploymentSummaryMarkdown(report), "| batch 2/2 | `deviceUID=dev%3A100") {
+		t.Error("Expected the summary to list each trigger")
+	}
+}
@@ -0,0 +1,38 @@
+package deploy
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// uploadAsPattern matches the filenames upload_as accepts: characters that need no
+// escaping in the upload URL, starting with a letter or digit
+var uploadAsPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._~$+@()-]*$`)
+
+// ParseUploadAs validates the upload_as input, the name to store the firmware under on
+// Notehub instead of the local file's name
+func ParseUploadAs(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	if strings.ContainsAny(value, "/\\") {
+		return "", fmt.Errorf("invalid upload_as %q: must be a filename, without path separators", value)
+	}
+	if !uploadAsPattern.MatchString(value) {
+		return "", fmt.Errorf("invalid upload_as %q: must start with a letter or digit and contain only letters, digits and . _ ~ $ + @ ( ) -", value)
+	}
+	return value, nil
+}
+
+// uploadFilename returns the name firmwareFile is uploaded and deployed under: upload_as
+// when it is set, otherwise the file's own name, with the channel's prefix either way
+func uploadFilename(config *DeploymentConfig, firmwareFile string) string {
+	name := filepath.Base(firmwareFile)
+	if config.UploadAs != "" {
+		name = config.UploadAs
+	}
+	return channelFilename(config.Channel, name)
+}
@@ -0,0 +1,54 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestParseUploadAs(t *testing.T) {
+	valid := map[string]string{
+		"":                   "",
+		"app-1.2.3.bin":      "app-1.2.3.bin",
+		" app-1.2.3.bin ":    "app-1.2.3.bin",
+		"app$20250101.bin":   "app$20250101.bin",
+		"App_v2+build.7.hex": "App_v2+build.7.hex",
+	}
+	for value, expected := range valid {
+		if got, err := ParseUploadAs(value); err != nil || got != expected {
+			t.Errorf("ParseUploadAs(%q) = %q, %v; expected %q", value, got, err, expected)
+		}
+	}
+
+	for _, value := range []string{"builds/app.bin", `builds\app.bin`, "../app.bin", ".app.bin", "app 1.bin", "app?.bin", "app#1.bin", "app%20.bin", "app&.bin"} {
+		if _, err := ParseUploadAs(value); err == nil {
+			t.Errorf("Expected ParseUploadAs(%q) to fail", value)
+		}
+	}
+}
+
+func TestDeployFirmware_UploadAs(t *testing.T) {
+	tests := []struct {
+		channel  string
+		expected string
+	}{
+		{"", "app-1.2.3.bin"},
+		{"beta", "beta-app-1.2.3.bin"},
+	}
+	for _, tt := range tests {
+		server := newFakeNotehub(t, nil)
+		config := server.config(t)
+		config.UploadAs = "app-1.2.3.bin"
+		config.Channel = tt.channel
+		report, err := DeployFirmware(context.Background(), config)
+		if err != nil {
+			t.Fatalf("Deployment failed: %v", err)
+		}
+		if server.count("PUT /projects/app:123/firmware/host/"+tt.expected) != 1 {
+			t.Errorf("Expected the upload to use %s, got %v", tt.expected, server.requests())
+		}
+		if dfuBodies := server.bodies("POST /projects/app:123/dfu/host/update"); len(dfuBodies) != 1 || dfuBodies[0] != fmt.Sprintf(`{"filename":%q}`, tt.expected) || report.UploadedFilename != tt.expected {
+			t.Errorf("Expected the DFU of %s, got %v (uploaded %s)", tt.expected, dfuBodies, report.UploadedFilename)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// DefaultValidateBudget bounds how long the validate operation may take in total
+const DefaultValidateBudget = 20 * time.Second
+
+// Validation check outcomes
+const (
+	CheckPassed  = "passed"
+	CheckWarning = "warning"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped"
+)
+
+// ValidationCheck records the outcome of one validate operation check
+type ValidationCheck struct {
+	Name       string `json:"name"`
+	Status     string `json:"status"`
+	Detail     string `json:"detail,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+}
+
+// ValidationResult records every check the validate operation considered, including
+// those skipped because they are too expensive or the time budget ran out
+type ValidationResult struct {
+	BudgetMs    int64             `json:"budget_ms"`
+	ElapsedMs   int64             `json:"elapsed_ms"`
+	ProjectName string            `json:"project_name,omitempty"`
+	Checks      []ValidationCheck `json:"checks"`
+}
+
+// performed returns the names of the checks that ran to a result
+func (r *ValidationResult) performed() []string {
+	var names []string
+	for _, c := range r.Checks {
+		if c.Status != CheckSkipped {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// skipped returns the names of the checks that did not run
+func (r *ValidationResult) skipped() []string {
+	var names []string
+	for _, c := range r.Checks {
+		if c.Status == CheckSkipped {
+			names = append(names, c.Name)
+		}
+	}
+	return names
+}
+
+// failed returns the failed checks formatted with their reasons
+func (r *ValidationResult) failed() []string {
+	var failures []string
+	for _, c := range r.Checks {
+		if c.Status == CheckFailed {
+			failures = append(failures, fmt.Sprintf("%s: %s", c.Name, c.Detail))
+		}
+	}
+	return failures
+}
+
+// checkWarning is returned by a check that passed but found something worth flagging
+type checkWarning struct {
+	msg string
+}
+
+func (w *checkWarning) Error() string { return w.msg }
+
+// validator runs checks against a shared deadline
+type validator struct {
+	ctx      context.Context
+	config   *DeploymentConfig
+	deadline time.Time
+	result   *ValidationResult
+}
+
+// skip records a check that was not run and why
+func (v *validator) skip(name, reason string) {
+	v.config.logf("  - %s: skipped (%s)", name, reason)
+	v.result.Checks = append(v.result.Checks, ValidationCheck{Name: name, Status: CheckSkipped, Detail: reason})
+}
+
+// run executes check under whatever remains of the time budget and records its outcome.
+// A check cut off by the budget is recorded as skipped rather than failed, since it says
+// nothing about the deployment. It reports whether the check passed.
+func (v *validator) run(name string, check func(ctx context.Context) (string, error)) bool {
+	if time.Until(v.deadline) <= 0 {
+		v.skip(name, "time budget exhausted before the check could start")
+		return false
+	}
+
+	ctx, cancel := context.WithDeadline(v.ctx, v.deadline)
+	defer cancel()
+
+	start := time.Now()
+	detail, err := check(ctx)
+	result := ValidationCheck{Name: name, Detail: detail, DurationMs: time.Since(start).Milliseconds()}
+
+	var warning *checkWarning
+	switch {
+	case err == nil:
+		result.Status = CheckPassed
+	case errors.As(err, &warning):
+		result.Status = CheckWarning
+		result.Detail = warning.msg
+	case ctx.Err() == context.DeadlineExceeded && v.ctx.Err() == nil:
+		result.Status = CheckSkipped
+		result.Detail = fmt.Sprintf("time budget exhausted after %s", time.Since(start).Round(time.Millisecond))
+	default:
+		result.Status = CheckFailed
+		result.Detail = err.Error()
+	}
+
+	if result.Detail != "" {
+		v.config.logf("  - %s: %s (%s)", name, result.Status, result.Detail)
+	} else {
+		v.config.logf("  - %s: %s", name, result.Status)
+	}
+	v.result.Checks = append(v.result.Checks, result)
+
+	return result.Status == CheckPassed || result.Status == CheckWarning
+}
+
+// validateDeployment runs the validate operation: fast, read-only checks suited to pull
+// request workflows. Only local validation, authentication, and single-request existence
+// checks run; anything that paginates or fans out across devices is skipped. Every check
+// shares one deadline, so the operation finishes within budget however slow Notehub is.
+func validateDeployment(ctx context.Context, config *DeploymentConfig, report *DeploymentReport) (*DeploymentReport, error) {
+	budget := config.ValidateBudget
+	if budget <= 0 {
+		budget = DefaultValidateBudget
+	}
+
+	start := time.Now()
+	v := &validator{
+		ctx:      ctx,
+		config:   config,
+		deadline: start.Add(budget),
+		result:   &ValidationResult{BudgetMs: budget.Milliseconds()},
+	}
+	report.Validation = v.result
+
+	config.logf("Validating deployment within a %s budget...", budget)
+
+	// Without a firmware file, only the credentials and access to the project are checked
+	firmwareFile := resolveFirmwarePath(config.FirmwareDir, config.FirmwareFile)
+	checkFirmware := v.run
+	if config.FirmwareFile == "" {
+		checkFirmware = func(name string, _ func(ctx context.Context) (string, error)) bool {
+			v.skip(name, "no firmware_file given")
+			return false
+		}
+	}
+	checkFirmware("firmware_file", func(ctx context.Context) (string, error) {
+		if IsFirmwareURL(config.FirmwareFile) {
+			path, cleanup, err := fetchFirmware(ctx, config, config.FirmwareFile, config.HTTPTimeout)
+			if err != nil {
+				return "", err
+			}
+			defer cleanup()
+			firmwareFile = path
+		}
+		info, err := os.Stat(firmwareFile)
+		if err != nil {
+			return "", fmt.Errorf("firmware file not found: %s", firmwareFile)
+		}
+		if err := checkFileReadable(firmwareFile); err != nil {
+			return "", err
+		}
+		if err := checkFirmwareSize(config, firmwareFile, info.Size()); err != nil {
+			return "", err
+		}
+		if !config.SkipFormatCheck {
+			if err := checkFirmwareFormat(firmwareFile, config.AllowedExtensions, config.CheckMagic); err != nil {
+				return "", err
+			}
+		}
+		sum, err := fileSHA256(firmwareFile)
+		if err != nil {
+			return "", err
+		}
+		report.FirmwareSHA256 = sum
+		if config.ExpectedSHA256 != "" && sum != config.ExpectedSHA256 {
+			return "", fmt.Errorf("firmware SHA-256 mismatch: expected %s, file has %s", config.ExpectedSHA256, sum)
+		}
+		return "SHA-256 " + sum, nil
+	})
+
+	checkFirmware("targeting", func(ctx context.Context) (string, error) {
+		warnEmptyTargeting(config)
+		if err := checkProjectWideDFU(config); err != nil {
+			return "", err
+		}
+		if err := checkConflictingTargets(config); err != nil {
+			return "", err
+		}
+		if params := buildTargetingParams(config).Encode(); params != "" {
+			return params, nil
+		}
+		return "all devices", nil
+	})
+
+	client := newNotehubClient(config)
+	authenticated := v.run("authentication", func(ctx context.Context) (string, error) {
+		if config.APIToken != "" {
+			// A session token is only checked by using it, and only a 401 means the token
+			// itself was refused rather than access to the project
+			_, err := client.GetProject(ctx, config.ProjectUID)
+			var notehubErr *notehub.NotehubError
+			if errors.As(err, &notehubErr) {
+				if notehubErr.StatusCode == http.StatusUnauthorized {
+					return "", fmt.Errorf("credentials invalid: %w", err)
+				}
+				return "api_token", nil
+			}
+			return "api_token", err
+		}
+		if err := client.Authenticate(ctx, config.ClientID, config.ClientSecret); err != nil {
+			if errors.Is(err, notehub.ErrAuthenticationRejected) {
+				return "", fmt.Errorf("credentials invalid: %w", err)
+			}
+			return "", err
+		}
+		return "", nil
+	})
+
+	remoteChecks := []string{"project"}
+	if config.FleetUID != "" {
+		remoteChecks = append(remoteChecks, "fleet")
+	}
+	if config.ProductUID != "" {
+		remoteChecks = append(remoteChecks, "product")
+	}
+	remoteChecks = append(remoteChecks, "firmware_conflict")
+	if authenticated {
+		projectVisible := v.run("project", func(ctx context.Context) (string, error) {
+			project, err := client.GetProject(ctx, config.ProjectUID)
+			if err != nil {
+				return "", projectAccessError(config.ProjectUID, err)
+			}
+			v.result.ProjectName = project.Label
+			return project.Label, nil
+		})
+
+		switch {
+		case config.FleetUID == "":
+		case !projectVisible:
+			v.skip("fleet", "requires access to the project")
+		default:
+			v.run("fleet", func(ctx context.Context) (string, error) {
+				fleets, err := client.ListFleets(ctx, config.ProjectUID)
+				if err != nil {
+					return "", err
+				}
+				var labels []string
+				for _, uid := range SplitTags(config.FleetUID) {
+					label, ok := "", false
+					for _, f := range fleets {
+						if f.UID == uid {
+							label, ok = f.Label, true
+						}
+					}
+					if !ok {
+						return "", fmt.Errorf("fleet_uid %s is not a fleet of project %s", uid, config.ProjectUID)
+					}
+					labels = append(labels, label)
+				}
+				return strings.Join(labels, ", "), nil
+			})
+		}
+
+		switch {
+		case config.ProductUID == "":
+		case !projectVisible:
+			v.skip("product", "requires access to the project")
+		default:
+			v.run("product", func(ctx context.Context) (string, error) {
+				products, err := client.ListProducts(ctx, config.ProjectUID)
+				if err != nil {
+					return "", err
+				}
+				for _, p := range products {
+					if p.UID == config.ProductUID {
+						return p.Label, nil
+					}
+				}
+				return "", fmt.Errorf("product_uid %s is not a product of project %s", config.ProductUID, config.ProjectUID)
+			})
+		}
+
+		filename := uploadFilename(config, firmwareBaseName(config.FirmwareFile))
+		checkFirmware("firmware_conflict", func(ctx context.Context) (string, error) {
+			files, err := client.ListFirmware(ctx, config.ProjectUID, config.FirmwareType, filename)
+			if err != nil {
+				return "", err
+			}
+			for _, f := range files {
+				if f.Filename == filename {
+					return "", &checkWarning{msg: fmt.Sprintf("%s is already uploaded and would be replaced", filename)}
+				}
+			}
+			return filename + " is not yet uploaded", nil
+		})
+	} else {
+		for _, name := range remoteChecks {
+			v.skip(name, "requires authentication")
+		}
+	}
+
+	v.skip("device_targeting", "resolving targets paginates the device list")
+
+	v.result.ElapsedMs = time.Since(start).Milliseconds()
+	config.logf("Validation finished in %s: %d check(s) performed, %d skipped",
+		time.Since(start).Round(time.Millisecond), len(v.result.performed()), len(v.result.skipped()))
+
+	if failures := v.result.failed(); len(failures) > 0 {
+		return report, fmt.Errorf("validation failed: %s", strings.Join(failures, "; "))
+	}
+
+	report.Status = StatusSuccess
+	return report, nil
+}
+
+// projectAccessError explains a failure to read the project once the credentials have been
+// accepted: a 401, 403 or 404 means they lack access to it rather than being invalid
+func projectAccessError(projectUID string, err error) error {
+	var notehubErr *notehub.NotehubError
+	if errors.As(err, &notehubErr) {
+		switch notehubErr.StatusCode {
+		case http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+			return fmt.Errorf("credentials valid but no access to project %s: %w", projectUID, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,244 @@
+package deploy
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newValidateServer starts a fake Notehub serving the token, project, fleet and product,
+// and firmware list endpoints used by the validate operation, and points new clients at it. projectDelay
+// holds the project response back to simulate a slow endpoint.
+func newValidateServer(t *testing.T, projectStatus int, projectDelay time.Duration, firmware string) {
+	t.Helper()
+	server := newFakeNotehub(t, fakeRoutes{
+		"/oauth2/token": respond(`{"access_token":"token","token_type":"bearer","expires_in":3600}`),
+		"/projects/app:123": func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(projectDelay):
+			}
+			w.WriteHeader(projectStatus)
+			w.Write([]byte(`{"uid":"app:123","label":"Fleet"}`))
+		},
+		"GET /projects/app:123/firmware": respond(firmware),
+		"/projects/app:123/fleets":       respond(`{"fleets":[{"uid":"fleet:1","label":"Production"}]}`),
+		"/projects/app:123/products":     respond(`{"products":[{"uid":"com.example:sensor","label":"Sensor"}]}`),
+		"/*": func(w http.ResponseWriter, r *http.Request) {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		},
+	})
+
+	origBase, origToken := DefaultAPIBaseURL, DefaultOAuthTokenURL
+	t.Cleanup(func() { DefaultAPIBaseURL, DefaultOAuthTokenURL = origBase, origToken })
+	DefaultAPIBaseURL = server.URL
+	DefaultOAuthTokenURL = server.URL + "/oauth2/token"
+}
+
+func newValidateConfig(t *testing.T, budget time.Duration) *DeploymentConfig {
+	t.Helper()
+	firmwareFile := filepath.Join(t.TempDir(), "firmware.bin")
+	if err := os.WriteFile(firmwareFile, []byte("firmware"), 0644); err != nil {
+		t.Fatalf("Failed to write firmware: %v", err)
+	}
+	return &DeploymentConfig{
+		ProjectUID:     "app:123",
+		FirmwareFile:   firmwareFile,
+		ClientID:       "id",
+		ClientSecret:   "secret",
+		Operation:      OperationValidate,
+		ValidateBudget: budget,
+	}
+}
+
+// checkStatuses maps each recorded check to its status
+func checkStatuses(result *ValidationResult) map[string]string {
+	statuses := map[string]string{}
+	for _, c := range result.Checks {
+		statuses[c.Name] = c.Status
+	}
+	return statuses
+}
+
+func TestValidateDeployment_AllChecksPass(t *testing.T) {
+	newValidateServer(t, http.StatusOK, 0, `[]`)
+
+	report, err := DeployFirmware(context.Background(), newValidateConfig(t, 5*time.Second))
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	if report.Status != StatusSuccess || report.UploadedFilename != "" || report.DFUTriggered {
+		t.Errorf("Validation should succeed without deploying, got %+v", report)
+	}
+
+	expected := map[string]string{
+		"firmware_file":     CheckPassed,
+		"authentication":    CheckPassed,
+		"project":           CheckPassed,
+		"firmware_conflict": CheckPassed,
+		"device_targeting":  CheckSkipped,
+	}
+	statuses := checkStatuses(report.Validation)
+	for name, status := range expected {
+		if statuses[name] != status {
+			t.Errorf("Check %s: expected %s, got %q", name, status, statuses[name])
+		}
+	}
+}
+
+func TestValidateDeployment_ExistingFirmwareWarns(t *testing.T) {
+	newValidateServer(t, http.StatusOK, 0, `[{"filename":"firmware.bin"}]`)
+
+	report, err := DeployFirmware(context.Background(), newValidateConfig(t, 5*time.Second))
+	if err != nil {
+		t.Fatalf("A conflict should only warn, got %v", err)
+	}
+	if status := checkStatuses(report.Validation)["firmware_conflict"]; status != CheckWarning {
+		t.Errorf("Expected firmware_conflict warning, got %q", status)
+	}
+}
+
+func TestValidateDeployment_MissingProjectFails(t *testing.T) {
+	newValidateServer(t, http.StatusNotFound, 0, `[]`)
+
+	report, err := DeployFirmware(context.Background(), newValidateConfig(t, 5*time.Second))
+	if err == nil || !strings.Contains(err.Error(), "validation failed: project") {
+		t.Fatalf("Expected project validation failure, got %v", err)
+	}
+	if status := checkStatuses(report.Validation)["project"]; status != CheckFailed {
+		t.Errorf("Expected project check to fail, got %q", status)
+	}
+}
+
+func TestValidateDeployment_SlowEndpointFinishesWithinBudget(t *testing.T) {
+	const budget = 300 * time.Millisecond
+	newValidateServer(t, http.StatusOK, 5*time.Second, `[]`)
+
+	start := time.Now()
+	report, err := DeployFirmware(context.Background(), newValidateConfig(t, budget))
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Budget exhaustion should skip checks rather than fail, got %v", err)
+	}
+	if elapsed > budget+time.Second {
+		t.Errorf("Validation took %s, expected it to finish within the %s budget", elapsed, budget)
+	}
+
+	statuses := checkStatuses(report.Validation)
+	if statuses["firmware_file"] != CheckPassed || statuses["authentication"] != CheckPassed {
+		t.Errorf("Expected the fast checks to pass, got %v", statuses)
+	}
+	for _, c := range report.Validation.Checks {
+		switch c.Name {
+		case "project":
+			if c.Status != CheckSkipped || !strings.HasPrefix(c.Detail, "time budget exhausted after") {
+				t.Errorf("Expected the slow project check to be cut off, got %+v", c)
+			}
+		case "firmware_conflict":
+			if c.Status != CheckSkipped || !strings.Contains(c.Detail, "before the check could start") {
+				t.Errorf("Expected firmware_conflict to be skipped before starting, got %+v", c)
+			}
+		}
+	}
+	if got := strings.Join(report.Validation.skipped(), ","); got != "project,firmware_conflict,device_targeting" {
+		t.Errorf("Unexpected skipped checks %q", got)
+	}
+}
+
+func TestValidateDeployment_CredentialsOnly(t *testing.T) {
+	newValidateServer(t, http.StatusOK, 0, `[]`)
+	config := newValidateConfig(t, 5*time.Second)
+	config.FirmwareFile = ""
+
+	report, err := DeployFirmware(context.Background(), config)
+	if err != nil {
+		t.Fatalf("Validation failed: %v", err)
+	}
+	statuses := checkStatuses(report.Validation)
+	if statuses["authentication"] != CheckPassed || statuses["project"] != CheckPassed {
+		t.Errorf("Expected the credential checks to pass, got %v", statuses)
+	}
+	for _, name := range []string{"firmware_file", "targeting", "firmware_conflict"} {
+		if statuses[name] != CheckSkipped {
+			t.Errorf("Expected %s to be skipped without a firmware_file, got %q", name, statuses[name])
+		}
+	}
+	outputs := report.Outputs()
+	if outputs["validated"] != "true" || outputs["project_name"] != "Fleet" {
+		t.Errorf("Expected validated true for project Fleet, got %q and %q", outputs["validated"], outputs["project_name"])
+	}
+}
+
+func TestValidateDeployment_FleetAndProduct(t *testing.T) {
+	tests := []struct {
+		name        string
+		fleetUID    string
+		productUID  string
+		expectError string
+	}{
+		{"both exist", "fleet:1", "com.example:sensor", ""},
+		{"unknown fleet", "fleet:1,fleet:2", "", "fleet_uid fleet:2 is not a fleet of project app:123"},
+		{"unknown product", "", "com.example:other", "product_uid com.example:other is not a product of project app:123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newValidateServer(t, http.StatusOK, 0, `[]`)
+			config := newValidateConfig(t, 5*time.Second)
+			config.FleetUID, config.ProductUID = tt.fleetUID, tt.productUID
+
+			report, err := DeployFirmware(context.Background(), config)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("Validation failed: %v", err)
+				}
+				statuses := checkStatuses(report.Validation)
+				if statuses["fleet"] != CheckPassed || statuses["product"] != CheckPassed {
+					t.Errorf("Expected fleet and product checks to pass, got %v", statuses)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+			if report.Outputs()["validated"] != "false" {
+				t.Errorf("Expected validated false, got %q", report.Outputs()["validated"])
+			}
+		})
+	}
+}
+
+func TestValidateDeployment_DistinguishesCredentialsFromAccess(t *testing.T) {
+	tests := []struct {
+		name        string
+		tokenStatus int
+		expectError string
+	}{
+		{"credentials rejected", http.StatusUnauthorized, "authentication: credentials invalid"},
+		{"no project access", http.StatusOK, "project: credentials valid but no access to project app:123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newFakeNotehub(t, fakeRoutes{
+				"/oauth2/token":     respondStatus(tt.tokenStatus, `{"access_token":"token","token_type":"bearer","expires_in":3600,"error":"invalid_client"}`),
+				"/projects/app:123": respondStatus(http.StatusForbidden, `{"err":"forbidden"}`),
+				"/*":                respond(`[]`),
+			})
+			origBase, origToken := DefaultAPIBaseURL, DefaultOAuthTokenURL
+			t.Cleanup(func() { DefaultAPIBaseURL, DefaultOAuthTokenURL = origBase, origToken })
+			DefaultAPIBaseURL, DefaultOAuthTokenURL = server.URL, server.URL+"/oauth2/token"
+
+			_, err := DeployFirmware(context.Background(), newValidateConfig(t, 5*time.Second))
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
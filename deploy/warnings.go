@@ -0,0 +1,53 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// strictWarnings collects the warnings emitted since the last strict checkpoint when the
+// config is strict, so that each phase's warnings fail the run together when the phase ends
+type strictWarnings struct {
+	mu      sync.Mutex
+	pending []string
+}
+
+// strictWarnings returns the deployment's collected warnings, creating them on first use.
+// Deployments create them before the config is copied, so every copy shares them.
+func (c *DeploymentConfig) strictWarnings() *strictWarnings {
+	if c.warnings == nil {
+		c.warnings = &strictWarnings{}
+	}
+	return c.warnings
+}
+
+// Warnf logs a warning through the deployment's logger. Every warning goes through here,
+// so that strict mode sees it.
+func (c *DeploymentConfig) Warnf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	c.logger().Warnf("%s", msg)
+
+	if c == nil || !c.Strict {
+		return
+	}
+	w := c.strictWarnings()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, msg)
+}
+
+// StrictCheckpoint ends a phase for strict mode: it returns an error listing every warning
+// emitted since the previous checkpoint, or nil when there were none or strict is off
+func (c *DeploymentConfig) StrictCheckpoint(phase string) error {
+	w := c.strictWarnings()
+	w.mu.Lock()
+	pending := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	return fmt.Errorf("strict mode: %d warning(s) during %s:\n  - %s", len(pending), phase, strings.Join(pending, "\n  - "))
+}
@@ -0,0 +1,130 @@
+package deploy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newWarningNotehub serves a project whose devices are all tagged prod, and a firmware
+// listing that reports no checksum, so a deployment can be led into warnings of several
+// subsystems
+func newWarningNotehub(t *testing.T) *fakeNotehub {
+	t.Helper()
+	return newFakeNotehub(t, fakeRoutes{
+		"/projects/app:123/devices": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("fleetUID") == "fleet:empty" {
+				fmt.Fprint(w, `{"devices":[],"has_more":false}`)
+				return
+			}
+			fmt.Fprint(w, `{"devices":[{"uid":"dev:1","tags":"prod"}],"has_more":false}`)
+		},
+		"GET /projects/app:123/firmware": respond(`[{"filename":"app.bin","length":2048}]`),
+	})
+}
+
+func TestStrictMode(t *testing.T) {
+	// Large enough not to be warned about as a placeholder
+	firmwareFile := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(firmwareFile, []byte(strings.Repeat("firmware", 256)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	frozenReport := filepath.Join(t.TempDir(), "report.json")
+	frozen := `{"frozen_targets":{"device_uids":["dev:1"],"firmware_sha256":"` + strings.Repeat("0", 64) + `"}}`
+	if err := os.WriteFile(frozenReport, []byte(frozen), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		configure   func(*DeploymentConfig)
+		expectError string
+		expectCalls string
+	}{
+		{
+			name:        "tag glob matching nothing",
+			configure:   func(c *DeploymentConfig) { c.Tag = "prod,ring-*"; c.NoMatchBehavior = NoMatchWarn },
+			expectError: "during validation:\n  - Tag glob \"ring-*\" matched no tags",
+			expectCalls: "",
+		},
+		{
+			name:        "targeting matches no devices",
+			configure:   func(c *DeploymentConfig) { c.CountTargets = true; c.FleetUID = "fleet:empty"; c.Tag = "" },
+			expectError: "during validation:\n  - Targeting matches no devices",
+			expectCalls: "",
+		},
+		{
+			name:        "no checksum from Notehub",
+			configure:   func(c *DeploymentConfig) {},
+			expectError: "during upload:\n  - Notehub reports no checksum for app.bin",
+			expectCalls: "upload",
+		},
+		{
+			name:        "frozen checksum differs",
+			configure:   func(c *DeploymentConfig) { c.ResumeFromReport = frozenReport },
+			expectError: "during validation:\n  - Firmware checksum",
+			expectCalls: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, strict := range []bool{false, true} {
+				server := newWarningNotehub(t)
+				config := server.config(t)
+				config.Strict = strict
+				config.FirmwareFile = firmwareFile
+				config.DeviceUID = ""
+				config.Tag = "prod"
+				tt.configure(config)
+
+				_, err := DeployFirmware(context.Background(), config)
+				if !strict {
+					if err != nil {
+						t.Fatalf("Expected the run to pass without strict, got %v", err)
+					}
+					continue
+				}
+				if err == nil || !strings.Contains(err.Error(), "strict mode: ") || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected strict mode to fail with %q, got %v", tt.expectError, err)
+				}
+				var calls []string
+				if len(server.uploaded()) > 0 {
+					calls = append(calls, "upload")
+				}
+				if server.count("POST /projects/app:123/dfu/host/update") > 0 {
+					calls = append(calls, "dfu")
+				}
+				if got := strings.Join(calls, ","); got != tt.expectCalls {
+					t.Errorf("Expected the run to stop before the next phase (%q), got %q", tt.expectCalls, got)
+				}
+			}
+		})
+	}
+}
+
+func TestStrictCheckpoint(t *testing.T) {
+	lenient := &DeploymentConfig{}
+	useRecordingLogger(lenient)
+	lenient.Warnf("ignored")
+	if err := lenient.StrictCheckpoint("configuration"); err != nil {
+		t.Errorf("Expected no failure without strict, got %v", err)
+	}
+
+	strict := &DeploymentConfig{Strict: true}
+	useRecordingLogger(strict)
+	strict.Warnf("first %d", 1)
+	copied := *strict
+	copied.Warnf("second")
+	err := strict.StrictCheckpoint("configuration")
+	if err == nil || err.Error() != "strict mode: 2 warning(s) during configuration:\n  - first 1\n  - second" {
+		t.Errorf("Expected both warnings listed, got %v", err)
+	}
+	if err := strict.StrictCheckpoint("validation"); err != nil {
+		t.Errorf("Expected the warnings to be reported once, got %v", err)
+	}
+}
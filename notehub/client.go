@@ -0,0 +1,459 @@
+// Package notehub is a client for the parts of the Notehub API used to deploy firmware:
+// OAuth2 authentication, firmware upload, device firmware updates, device listing, and
+// project environment variables.
+package notehub
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultBaseURL is the Notehub API base URL
+	DefaultBaseURL = "https://api.notefile.net/v1"
+
+	// DefaultOAuthURL is the Notehub OAuth2 token endpoint
+	DefaultOAuthURL = "https://notehub.io/oauth2/token"
+
+	// DefaultTimeout bounds each HTTP request to the Notehub API
+	DefaultTimeout = 30 * time.Second
+)
+
+// tokenRefreshMargin is how close to expiry an access token is refreshed before use
+const tokenRefreshMargin = 60 * time.Second
+
+// Client handles API communication with Notehub
+type Client struct {
+	httpClient       *http.Client
+	baseURL          string
+	tokenURL         string
+	maxRetries       int
+	maxRateLimitWait time.Duration
+	retryBaseDelay   time.Duration
+	rng              *rand.Rand
+	maxClockSkew     time.Duration
+	uploadTimeout    time.Duration
+	minUploadRate    int64
+	progressEvery    time.Duration
+	compressUpload   bool
+	onToken          func(token string)
+	sessionToken     string
+	onRequest        func(RequestOutcome)
+	logger           Logger
+
+	// mu guards the token, clock and rate limit state, which background work such
+	// as lock renewal may touch concurrently with the main deployment flow
+	mu           sync.Mutex
+	refreshMu    sync.Mutex
+	clientID     string
+	clientSecret string
+	accessToken  string
+	tokenExpiry  time.Time
+	clockSkew    time.Duration
+	rateLimit    rateLimitBudget
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// Logger receives the client's progress messages. A *log.Logger satisfies it. A Logger
+// that also has a Debugf method receives debug detail, such as the rate limit budget
+// left after each request.
+type Logger interface {
+	Printf(format string, args ...any)
+}
+
+// debugLogger is a Logger that takes debug messages
+type debugLogger interface {
+	Debugf(format string, args ...any)
+}
+
+// WithHTTPClient sets the HTTP client used for every request, replacing the default client
+// and its timeout
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithTransport sets the transport of the default HTTP client, e.g. to route requests
+// through a proxy or gateway
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithTimeout sets the timeout of the default HTTP client. The timeout applies to each
+// request as a whole, including transferring the firmware body during upload. Values <= 0
+// keep DefaultTimeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.httpClient.Timeout = timeout
+		}
+	}
+}
+
+// WithUploadTimeout sets how long a firmware upload may take, in place of the per-request
+// timeout, since a large image on a slow link needs far longer than any other request.
+// Values <= 0 keep the per-request timeout.
+func WithUploadTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		if timeout > 0 {
+			c.uploadTimeout = timeout
+		}
+	}
+}
+
+// WithMinUploadRate scales each firmware upload's deadline with its size, allowing
+// bytesPerSec for the transfer on top of the per-request timeout, so a large image on a
+// slow link gets proportionally more time than a small one. It takes the place of any
+// upload timeout. Values <= 0 disable the scaling.
+func WithMinUploadRate(bytesPerSec int64) Option {
+	return func(c *Client) {
+		c.minUploadRate = bytesPerSec
+	}
+}
+
+// WithBaseURL sets the Notehub API base URL
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// WithOAuthURL sets the OAuth2 token endpoint
+func WithOAuthURL(tokenURL string) Option {
+	return func(c *Client) {
+		c.tokenURL = tokenURL
+	}
+}
+
+// WithRetries sets how many times a transient failure is retried after the initial attempt
+// and the backoff before the first retry. A baseDelay <= 0 keeps DefaultRetryBaseDelay.
+func WithRetries(maxRetries int, baseDelay time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		if baseDelay > 0 {
+			c.retryBaseDelay = baseDelay
+		}
+	}
+}
+
+// WithRand sets the random number generator used to jitter retry backoff, which must be
+// safe for concurrent use, such as one from NewRand. By default the jitter is seeded from
+// the current time.
+func WithRand(rng *rand.Rand) Option {
+	return func(c *Client) {
+		c.rng = rng
+	}
+}
+
+// WithMaxClockSkew sets the largest difference between the local clock and the Date
+// header of Notehub's token response that Authenticate tolerates. Zero disables the check.
+func WithMaxClockSkew(maxSkew time.Duration) Option {
+	return func(c *Client) {
+		c.maxClockSkew = maxSkew
+	}
+}
+
+// WithAccessToken starts the client with an already issued access token, so requests can
+// be made without calling Authenticate. The token is never refreshed.
+func WithAccessToken(token string) Option {
+	return func(c *Client) {
+		c.accessToken = token
+	}
+}
+
+// WithSessionToken authenticates every request with a Notehub API session token, sent in
+// the X-Session-Token header, in place of OAuth2, so Authenticate need not be called. The
+// token is never refreshed.
+func WithSessionToken(token string) Option {
+	return func(c *Client) {
+		c.sessionToken = token
+	}
+}
+
+// WithTokenObserver registers a function called with every access token the client
+// obtains, before it is used, e.g. to mask it in CI logs
+func WithTokenObserver(fn func(token string)) Option {
+	return func(c *Client) {
+		c.onToken = fn
+	}
+}
+
+// WithLogger sets where the client's progress messages go, in place of the standard
+// library's default logger
+func WithLogger(logger Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithRequestObserver registers a function called when each API request finishes, after
+// any retries, e.g. to account for how much retrying a run needed. It may be called from
+// several goroutines at once.
+func WithRequestObserver(fn func(RequestOutcome)) Option {
+	return func(c *Client) {
+		c.onRequest = fn
+	}
+}
+
+// New creates a Notehub API client
+func New(opts ...Option) *Client {
+	c := &Client{
+		httpClient: &http.Client{
+			Timeout: DefaultTimeout,
+		},
+		baseURL:        DefaultBaseURL,
+		tokenURL:       DefaultOAuthURL,
+		maxRetries:     DefaultMaxRetries,
+		retryBaseDelay: DefaultRetryBaseDelay,
+		rng:            NewRand(time.Now().UnixNano()),
+		maxClockSkew:   DefaultMaxClockSkew,
+		logger:         log.Default(),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c
+}
+
+// OAuth2TokenResponse represents the response from OAuth2 token endpoint
+type OAuth2TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+// Authenticate obtains an OAuth2 access token from Notehub
+func (c *Client) Authenticate(ctx context.Context, clientID, clientSecret string) error {
+	c.logger.Printf("Obtaining OAuth2 bearer token from Notehub...")
+
+	// Prepare form data
+	data := url.Values{}
+	data.Set("grant_type", "client_credentials")
+	data.Set("client_id", clientID)
+	data.Set("client_secret", clientSecret)
+
+	// Execute request
+	resp, err := c.doWithRetry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", c.tokenURL, strings.NewReader(data.Encode()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OAuth2 request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("OAuth2 request failed before Notehub answered: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// The token response is the first from Notehub, so the clock is checked before
+	// anything is stamped with local time
+	if skew, ok := c.observeServerTime(resp); ok {
+		if err := c.checkClockSanity(skew); err != nil {
+			return err
+		}
+	} else {
+		c.logger.Printf("Notehub sent no Date header, so the local clock could not be checked")
+	}
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read OAuth2 response: %w", err)
+	}
+
+	// Check status code
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		notehubErr := newNotehubError("OAuth2 request", resp.StatusCode, scrubSecrets(c.scrub(body), clientSecret))
+		if resp.StatusCode == http.StatusBadRequest || resp.StatusCode == http.StatusUnauthorized {
+			return &authRejectedError{notehubErr: notehubErr}
+		}
+		return notehubErr
+	}
+
+	// Parse response
+	var tokenResp OAuth2TokenResponse
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return fmt.Errorf("failed to parse OAuth2 response: %w", err)
+	}
+
+	if tokenResp.AccessToken == "" {
+		return fmt.Errorf("OAuth2 response missing access token")
+	}
+	if c.onToken != nil {
+		c.onToken(tokenResp.AccessToken)
+	}
+
+	c.mu.Lock()
+	c.accessToken = tokenResp.AccessToken
+	c.clientID = clientID
+	c.clientSecret = clientSecret
+	c.tokenExpiry = time.Time{}
+	if tokenResp.ExpiresIn > 0 {
+		c.tokenExpiry = time.Now().Add(time.Duration(tokenResp.ExpiresIn) * time.Second)
+	}
+	c.mu.Unlock()
+	c.logger.Printf("✅ OAuth2 token obtained successfully")
+
+	return nil
+}
+
+// Session returns the current access token and its expiry, which is zero when unknown
+func (c *Client) Session() (token string, expiry time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accessToken, c.tokenExpiry
+}
+
+// ResumeSession adopts an access token issued earlier, e.g. to a previous step of the same
+// job, in place of calling Authenticate. The credentials are kept, so the token is
+// refreshed as usual when it nears expiry or is rejected.
+func (c *Client) ResumeSession(token string, expiry time.Time, clientID, clientSecret string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken = token
+	c.tokenExpiry = expiry
+	c.clientID = clientID
+	c.clientSecret = clientSecret
+}
+
+// ensureToken re-authenticates when the current access token is within
+// tokenRefreshMargin of expiring. Tokens without a known expiry are used as-is.
+func (c *Client) ensureToken(ctx context.Context) error {
+	// Serialize refreshes so concurrent callers don't each request a new token
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.Lock()
+	token, expiry, clientID, clientSecret := c.accessToken, c.tokenExpiry, c.clientID, c.clientSecret
+	c.mu.Unlock()
+
+	if token == "" || expiry.IsZero() || clientID == "" {
+		return nil
+	}
+	if time.Until(expiry) > tokenRefreshMargin {
+		return nil
+	}
+
+	c.logger.Printf("OAuth2 token expires at %s, refreshing...", expiry.Format(time.RFC3339))
+	if err := c.Authenticate(ctx, clientID, clientSecret); err != nil {
+		return fmt.Errorf("token refresh failed: %w", err)
+	}
+
+	return nil
+}
+
+// refreshRejectedToken re-authenticates with the stored credentials after Notehub rejected
+// token with a 401, e.g. because it was revoked before its expiry. Nothing is done when
+// another request already replaced the token.
+func (c *Client) refreshRejectedToken(ctx context.Context, token string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+
+	c.mu.Lock()
+	current, clientID, clientSecret := c.accessToken, c.clientID, c.clientSecret
+	c.mu.Unlock()
+	if current != token {
+		return nil
+	}
+
+	if err := c.Authenticate(ctx, clientID, clientSecret); err != nil {
+		return fmt.Errorf("token refresh failed: %w", err)
+	}
+	return nil
+}
+
+// canRefreshToken reports whether req was authorized with a token the client can replace,
+// returning that token. Tokens given with WithAccessToken cannot be refreshed.
+func (c *Client) canRefreshToken(req *http.Request) (string, bool) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return token, c.clientID != ""
+}
+
+// bearerToken returns the current access token for use in an Authorization header
+func (c *Client) bearerToken() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accessToken
+}
+
+// authorize sets the header that authenticates req: the session token given with
+// WithSessionToken, or else the OAuth2 access token as a bearer token
+func (c *Client) authorize(req *http.Request) {
+	if c.sessionToken != "" {
+		req.Header.Set("X-Session-Token", c.sessionToken)
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+c.bearerToken())
+}
+
+// apiResponse holds the result of a Notehub API request
+type apiResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// doAPIRequest performs an authenticated JSON request against the Notehub API and returns
+// the response regardless of status code; callers decide how to treat non-2xx responses.
+func (c *Client) doAPIRequest(ctx context.Context, method, apiURL string, payload []byte) (*apiResponse, error) {
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.doWithRetry(ctx, func() (*http.Request, error) {
+		var body io.Reader
+		if payload != nil {
+			body = bytes.NewReader(payload)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, apiURL, body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		c.authorize(req)
+		if payload != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		return req, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	c.observeServerTime(resp)
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	return &apiResponse{
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBody,
+	}, nil
+}
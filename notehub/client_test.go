@@ -0,0 +1,430 @@
+package notehub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestClient returns a client for server that is already authenticated and does not retry
+func newTestClient(server *httptest.Server) *Client {
+	return New(WithBaseURL(server.URL), WithAccessToken("token"), WithRetries(0, time.Millisecond))
+}
+
+// newStaticServer returns a server answering every request with status and body
+func newStaticServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// newTokenServer returns a fake OAuth2 token endpoint issuing numbered tokens
+// with the given lifetime, along with a counter of token requests.
+func newTokenServer(t *testing.T, expiresIn int) (*httptest.Server, *int32) {
+	t.Helper()
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":%d}`, n, expiresIn)
+	}))
+	t.Cleanup(server.Close)
+	return server, &count
+}
+
+func TestNew_Defaults(t *testing.T) {
+	client := New()
+
+	if client.baseURL != DefaultBaseURL {
+		t.Errorf("Expected baseURL to be %q, got %q", DefaultBaseURL, client.baseURL)
+	}
+	if client.tokenURL != DefaultOAuthURL {
+		t.Errorf("Expected tokenURL to be %q, got %q", DefaultOAuthURL, client.tokenURL)
+	}
+	if client.httpClient == nil {
+		t.Fatal("httpClient should not be nil")
+	}
+	if client.httpClient.Timeout != 30*time.Second {
+		t.Errorf("Expected timeout to be 30s, got %v", client.httpClient.Timeout)
+	}
+	if client.maxRetries != DefaultMaxRetries || client.retryBaseDelay != DefaultRetryBaseDelay {
+		t.Errorf("Expected default retries, got %d after %v", client.maxRetries, client.retryBaseDelay)
+	}
+}
+
+func TestNew_Options(t *testing.T) {
+	httpClient := &http.Client{}
+	client := New(
+		WithHTTPClient(httpClient),
+		WithBaseURL("http://localhost:8080/v1/"),
+		WithOAuthURL("http://localhost:8080/token"),
+		WithRetries(1, 5*time.Millisecond),
+	)
+
+	if client.httpClient != httpClient {
+		t.Error("Expected the injected HTTP client to be used")
+	}
+	if client.baseURL != "http://localhost:8080/v1" {
+		t.Errorf("Expected trailing slash to be trimmed, got %q", client.baseURL)
+	}
+	if client.tokenURL != "http://localhost:8080/token" {
+		t.Errorf("Unexpected tokenURL %q", client.tokenURL)
+	}
+	if client.maxRetries != 1 || client.retryBaseDelay != 5*time.Millisecond {
+		t.Errorf("Unexpected retries %d after %v", client.maxRetries, client.retryBaseDelay)
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	if client := New(WithTimeout(5 * time.Minute)); client.httpClient.Timeout != 5*time.Minute {
+		t.Errorf("Expected timeout to be 5m, got %v", client.httpClient.Timeout)
+	}
+	if client := New(WithTimeout(0)); client.httpClient.Timeout != DefaultTimeout {
+		t.Errorf("Expected a zero timeout to keep the default, got %v", client.httpClient.Timeout)
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectError string
+	}{
+		{"success", http.StatusOK, `{"access_token":"abc","token_type":"bearer","expires_in":3600}`, ""},
+		{"non-2xx", http.StatusUnauthorized, `{"error":"invalid_client"}`, "status 401"},
+		{"rejected", http.StatusUnauthorized, `{"error":"invalid_client"}`, "authentication rejected: check client_id/client_secret (OAuth2 request returned status 401: invalid_client)"},
+		{"bad request", http.StatusBadRequest, `{"error":"invalid_request"}`, "authentication rejected"},
+		{"server error", http.StatusInternalServerError, `{"err":"unavailable"}`, "OAuth2 request failed with status 500"},
+		{"malformed JSON", http.StatusOK, `{"access_token":`, "failed to parse OAuth2 response"},
+		{"missing token", http.StatusOK, `{"token_type":"bearer"}`, "missing access token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newStaticServer(t, tt.status, tt.body)
+			client := New(WithOAuthURL(server.URL), WithRetries(0, time.Millisecond))
+
+			err := client.Authenticate(context.Background(), "id", "secret")
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if client.bearerToken() != "abc" {
+					t.Errorf("Expected token abc, got %q", client.bearerToken())
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticate_Rejected(t *testing.T) {
+	server := newStaticServer(t, http.StatusUnauthorized, `{"error":"invalid_client","error_description":"unknown client"}`)
+	err := New(WithOAuthURL(server.URL)).Authenticate(context.Background(), "id", "secret")
+	if !errors.Is(err, ErrAuthenticationRejected) {
+		t.Fatalf("Expected ErrAuthenticationRejected, got %v", err)
+	}
+	var notehubErr *NotehubError
+	if !errors.As(err, &notehubErr) || notehubErr.StatusCode != http.StatusUnauthorized || notehubErr.Message != "unknown client" {
+		t.Errorf("Expected the upstream error to be kept, got %+v", notehubErr)
+	}
+
+	// Neither a server error nor an unreachable endpoint says the credentials are wrong
+	server = newStaticServer(t, http.StatusServiceUnavailable, `{"err":"down"}`)
+	err = New(WithOAuthURL(server.URL), WithRetries(0, time.Millisecond)).Authenticate(context.Background(), "id", "secret")
+	if err == nil || errors.Is(err, ErrAuthenticationRejected) {
+		t.Errorf("Expected a 503 not to be reported as rejected credentials, got %v", err)
+	}
+	server.Close()
+	err = New(WithOAuthURL(server.URL), WithRetries(0, time.Millisecond)).Authenticate(context.Background(), "id", "secret")
+	if err == nil || errors.Is(err, ErrAuthenticationRejected) || !strings.Contains(err.Error(), "before Notehub answered") {
+		t.Errorf("Expected a network error, got %v", err)
+	}
+}
+
+func TestAuthenticate_RecordsExpiry(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, 3600)
+
+	client := New(WithOAuthURL(tokenServer.URL))
+
+	if err := client.Authenticate(context.Background(), "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	remaining := time.Until(client.tokenExpiry)
+	if remaining < 59*time.Minute || remaining > time.Hour {
+		t.Errorf("Expected token expiry ~1h from now, got %v", remaining)
+	}
+}
+
+func TestAuthenticate_NotifiesTokenObserver(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, 3600)
+
+	var observed []string
+	client := New(WithOAuthURL(tokenServer.URL), WithTokenObserver(func(token string) {
+		observed = append(observed, token)
+	}))
+
+	if err := client.Authenticate(context.Background(), "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if len(observed) != 1 || observed[0] != "token-1" {
+		t.Errorf("Expected the observer to see token-1, got %v", observed)
+	}
+}
+
+func TestWithLogger(t *testing.T) {
+	tokenServer, _ := newTokenServer(t, 3600)
+
+	var logs strings.Builder
+	client := New(WithOAuthURL(tokenServer.URL), WithLogger(log.New(&logs, "", 0)))
+	if err := client.Authenticate(context.Background(), "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if !strings.Contains(logs.String(), "OAuth2 token obtained successfully") {
+		t.Errorf("Expected the client to log through the logger, got %q", logs.String())
+	}
+}
+
+func TestTriggerDFU_RefreshesExpiringToken(t *testing.T) {
+	// Tokens expire inside the refresh margin, so every authenticated request refreshes first
+	tokenServer, tokenCount := newTokenServer(t, 30)
+
+	var gotAuth string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{}`))
+	}))
+	defer apiServer.Close()
+
+	client := New(WithOAuthURL(tokenServer.URL), WithBaseURL(apiServer.URL))
+
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	if _, err := client.TriggerDFU(ctx, "app:123", FirmwareTypeHost, map[string][]string{"deviceUID": {"dev:1"}}, "fw.bin"); err != nil {
+		t.Fatalf("TriggerDFU failed: %v", err)
+	}
+
+	if n := atomic.LoadInt32(tokenCount); n != 2 {
+		t.Errorf("Expected a second token request, got %d token requests", n)
+	}
+	if gotAuth != "Bearer token-2" {
+		t.Errorf("Expected refreshed token to be used, got %q", gotAuth)
+	}
+}
+
+func TestEnsureToken_ValidTokenNotRefreshed(t *testing.T) {
+	tokenServer, tokenCount := newTokenServer(t, 3600)
+
+	client := New(WithOAuthURL(tokenServer.URL))
+
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if err := client.ensureToken(ctx); err != nil {
+		t.Fatalf("ensureToken failed: %v", err)
+	}
+
+	if n := atomic.LoadInt32(tokenCount); n != 1 {
+		t.Errorf("Expected no refresh for a fresh token, got %d token requests", n)
+	}
+}
+
+func TestEnsureToken_ExpiredTokenRefreshed(t *testing.T) {
+	tokenServer, tokenCount := newTokenServer(t, 3600)
+
+	client := New(WithOAuthURL(tokenServer.URL))
+
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	// Simulate the token having expired during a long deployment
+	client.tokenExpiry = time.Now().Add(-time.Minute)
+
+	if err := client.ensureToken(ctx); err != nil {
+		t.Fatalf("ensureToken failed: %v", err)
+	}
+	if n := atomic.LoadInt32(tokenCount); n != 2 {
+		t.Errorf("Expected a second token request, got %d", n)
+	}
+	if client.accessToken != "token-2" {
+		t.Errorf("Expected refreshed access token, got %q", client.accessToken)
+	}
+}
+
+func TestWithAccessToken_NotRefreshed(t *testing.T) {
+	var gotAuth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte(`{"devices":[],"has_more":false}`))
+	}))
+	defer server.Close()
+
+	client := New(WithBaseURL(server.URL), WithAccessToken("issued-token"))
+	if _, err := client.ListDevices(context.Background(), "app:123", nil); err != nil {
+		t.Fatalf("ListDevices failed: %v", err)
+	}
+	if gotAuth != "Bearer issued-token" {
+		t.Errorf("Expected the issued token to be used, got %q", gotAuth)
+	}
+}
+
+func TestResumeSession(t *testing.T) {
+	tokenServer, tokenCount := newTokenServer(t, 3600)
+
+	// The resumed token has been revoked since it was issued
+	var auths []string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer earlier-token" {
+			http.Error(w, `{"err":"token revoked"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"devices":[],"has_more":false}`))
+	}))
+	defer apiServer.Close()
+
+	client := New(WithOAuthURL(tokenServer.URL), WithBaseURL(apiServer.URL), WithRetries(0, time.Millisecond))
+	expiry := time.Now().Add(30 * time.Minute)
+	client.ResumeSession("earlier-token", expiry, "id", "secret")
+	if token, got := client.Session(); token != "earlier-token" || !got.Equal(expiry) {
+		t.Fatalf("Expected the resumed session, got %q expiring %s", token, got)
+	}
+
+	if _, err := client.ListDevices(context.Background(), "app:123", nil); err != nil {
+		t.Fatalf("Expected the request to succeed after refreshing, got %v", err)
+	}
+	if n := atomic.LoadInt32(tokenCount); n != 1 {
+		t.Errorf("Expected the revoked token refreshed once with the kept credentials, got %d token requests", n)
+	}
+	if len(auths) != 2 || auths[0] != "Bearer earlier-token" || auths[1] != "Bearer token-1" {
+		t.Errorf("Expected the resumed token used first, got %v", auths)
+	}
+}
+
+func TestRequest_RefreshesRevokedTokenOn401(t *testing.T) {
+	tokenServer, tokenCount := newTokenServer(t, 3600)
+
+	// The first token is revoked before its expiry
+	var auths []string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auths = append(auths, r.Header.Get("Authorization"))
+		if r.Header.Get("Authorization") == "Bearer token-1" {
+			http.Error(w, `{"err":"token revoked"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"devices":[],"has_more":false}`))
+	}))
+	defer apiServer.Close()
+
+	client := New(WithOAuthURL(tokenServer.URL), WithBaseURL(apiServer.URL), WithRetries(0, time.Millisecond))
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	if _, err := client.ListDevices(ctx, "app:123", nil); err != nil {
+		t.Fatalf("Expected the request to succeed after refreshing, got %v", err)
+	}
+	if n := atomic.LoadInt32(tokenCount); n != 2 {
+		t.Errorf("Expected one refresh, got %d token requests", n)
+	}
+	if len(auths) != 2 || auths[1] != "Bearer token-2" {
+		t.Errorf("Expected the request repeated with the new token, got %v", auths)
+	}
+}
+
+func TestRequest_RefreshesOnlyOnceOn401(t *testing.T) {
+	tokenServer, tokenCount := newTokenServer(t, 3600)
+	requests := 0
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, `{"err":"forbidden project"}`, http.StatusUnauthorized)
+	}))
+	defer apiServer.Close()
+
+	client := New(WithOAuthURL(tokenServer.URL), WithBaseURL(apiServer.URL), WithRetries(2, time.Millisecond))
+	ctx := context.Background()
+	if err := client.Authenticate(ctx, "id", "secret"); err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+
+	if _, err := client.ListDevices(ctx, "app:123", nil); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("Expected the 401 to be reported, got %v", err)
+	}
+	if n := atomic.LoadInt32(tokenCount); n != 2 || requests != 2 {
+		t.Errorf("Expected a single refresh and repeat, got %d token requests and %d API requests", n, requests)
+	}
+
+	// An issued token cannot be refreshed, so its 401 is returned directly
+	requests = 0
+	issued := New(WithBaseURL(apiServer.URL), WithAccessToken("issued-token"), WithRetries(0, time.Millisecond))
+	if _, err := issued.ListDevices(ctx, "app:123", nil); err == nil || requests != 1 {
+		t.Errorf("Expected one request failing with 401, got %d requests, %v", requests, err)
+	}
+}
+
+func TestWithSessionToken(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, fmt.Sprintf("%s %s session=%q auth=%q", r.Method, r.URL.Path, r.Header.Get("X-Session-Token"), r.Header.Get("Authorization")))
+		switch r.Method {
+		case "GET":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"err":"session expired"}`)
+		case "PUT":
+			fmt.Fprint(w, `{"filename":"app.bin"}`)
+		default:
+			fmt.Fprint(w, `{}`)
+		}
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(path, []byte("firmware"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	client := New(WithBaseURL(server.URL), WithOAuthURL(server.URL+"/oauth2/token"), WithSessionToken("session-token"), WithRetries(0, time.Millisecond))
+	if _, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path); err != nil {
+		t.Fatalf("UploadFirmware failed: %v", err)
+	}
+	if _, err := client.TriggerDFU(context.Background(), "app:123", FirmwareTypeHost, nil, "app.bin"); err != nil {
+		t.Fatalf("TriggerDFU failed: %v", err)
+	}
+	var notehubErr *NotehubError
+	if _, err := client.ListDevices(context.Background(), "app:123", nil); !errors.As(err, &notehubErr) || notehubErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("Expected a rejected session token to fail without a refresh, got %v", err)
+	}
+
+	expected := []string{
+		`PUT /projects/app:123/firmware/host/app.bin session="session-token" auth=""`,
+		`POST /projects/app:123/dfu/host/update session="session-token" auth=""`,
+		`GET /projects/app:123/devices session="session-token" auth=""`,
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected every request to carry only the session token:\n%s", strings.Join(requests, "\n"))
+	}
+}
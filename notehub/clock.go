@@ -0,0 +1,67 @@
+package notehub
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// DefaultMaxClockSkew is the largest difference between the local and Notehub clocks
+// tolerated before authentication fails. Smaller skews are compensated for by ServerNow.
+const DefaultMaxClockSkew = 24 * time.Hour
+
+// observeServerTime records the offset between the Notehub server clock and the local clock
+// using the response's Date header, returning it. Responses without a parseable Date header
+// are ignored.
+func (c *Client) observeServerTime(resp *http.Response) (time.Duration, bool) {
+	skew, ok := measureClockSkew(resp.Header, time.Now())
+	if !ok {
+		return 0, false
+	}
+
+	c.mu.Lock()
+	c.clockSkew = skew
+	c.mu.Unlock()
+	return skew, true
+}
+
+// checkClockSanity fails when the local clock differs from Notehub's by more than the
+// client's maximum skew, since every timestamp computed locally would then be wrong
+func (c *Client) checkClockSanity(skew time.Duration) error {
+	if c.maxClockSkew <= 0 {
+		return nil
+	}
+	abs := skew
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs <= c.maxClockSkew {
+		return nil
+	}
+	local := time.Now()
+	return fmt.Errorf("the local clock (%s) differs from Notehub's (%s) by %s, more than the %s allowed; every timestamp the action produces would be wrong, so correct the runner's clock, e.g. by enabling NTP",
+		local.UTC().Format(time.RFC3339), local.Add(skew).UTC().Format(time.RFC3339), abs.Round(time.Second), c.maxClockSkew)
+}
+
+// measureClockSkew returns how far the server clock is ahead of local time according to the
+// Date header. The header only has one-second resolution, so small skews are not meaningful.
+func measureClockSkew(header http.Header, localNow time.Time) (time.Duration, bool) {
+	date := header.Get("Date")
+	if date == "" {
+		return 0, false
+	}
+
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		return 0, false
+	}
+
+	return serverTime.Sub(localNow), true
+}
+
+// ServerNow returns the current time adjusted by the last observed server clock skew
+func (c *Client) ServerNow() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return time.Now().Add(c.clockSkew)
+}
@@ -0,0 +1,70 @@
+package notehub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newDatedTokenServer returns a token endpoint whose Date header is offset from the local
+// clock by skew, or absent when omitDate is set
+func newDatedTokenServer(t *testing.T, skew time.Duration, omitDate bool) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if omitDate {
+			w.Header()["Date"] = nil
+		} else {
+			w.Header().Set("Date", time.Now().Add(skew).UTC().Format(http.TimeFormat))
+		}
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestAuthenticate_ClockSanity(t *testing.T) {
+	tests := []struct {
+		name        string
+		skew        time.Duration
+		omitDate    bool
+		maxSkew     time.Duration
+		expectError string
+	}{
+		{name: "in sync", skew: 0, maxSkew: DefaultMaxClockSkew},
+		{name: "small skew compensated", skew: 2 * time.Hour, maxSkew: DefaultMaxClockSkew},
+		{name: "runner clock far behind", skew: 56 * 365 * 24 * time.Hour, maxSkew: DefaultMaxClockSkew, expectError: "more than the 24h0m0s allowed"},
+		{name: "runner clock far ahead", skew: -48 * time.Hour, maxSkew: DefaultMaxClockSkew, expectError: "from Notehub's"},
+		{name: "custom threshold", skew: 2 * time.Hour, maxSkew: time.Hour, expectError: "more than the 1h0m0s allowed"},
+		{name: "check disabled", skew: -48 * time.Hour, maxSkew: 0},
+		{name: "missing Date header", omitDate: true, maxSkew: DefaultMaxClockSkew},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newDatedTokenServer(t, tt.skew, tt.omitDate)
+			client := New(WithOAuthURL(server.URL), WithMaxClockSkew(tt.maxSkew))
+
+			err := client.Authenticate(context.Background(), "id", "secret")
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				if client.bearerToken() != "" {
+					t.Error("No token should be kept when the clock check fails")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// Skews within the threshold are compensated for
+			if drift := client.ServerNow().Sub(time.Now().Add(tt.skew)); drift < -2*time.Second || drift > 2*time.Second {
+				t.Errorf("Expected ServerNow to follow Notehub's clock, off by %s", drift)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package notehub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// WithCompressedUpload gzips firmware uploads and sends them with Content-Encoding: gzip,
+// falling back to an uncompressed upload when Notehub rejects the encoding
+func WithCompressedUpload(enabled bool) Option {
+	return func(c *Client) {
+		c.compressUpload = enabled
+	}
+}
+
+// compressedUpload is a gzipped firmware body and the Content-MD5 of the gzipped bytes
+type compressedUpload struct {
+	data       []byte
+	contentMD5 string
+}
+
+// gzipUpload reads body to its end, returning it gzipped, and rewinds it
+func gzipUpload(body io.ReadSeeker) (*compressedUpload, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := io.Copy(zw, body); err != nil {
+		return nil, fmt.Errorf("failed to read firmware file: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress firmware: %w", err)
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind firmware file: %w", err)
+	}
+	sum := md5.Sum(buf.Bytes())
+	return &compressedUpload{data: buf.Bytes(), contentMD5: base64.StdEncoding.EncodeToString(sum[:])}, nil
+}
+
+// compressionRejected reports whether an upload response refused the gzip encoding
+func compressionRejected(statusCode int) bool {
+	return statusCode == http.StatusUnsupportedMediaType
+}
@@ -0,0 +1,126 @@
+package notehub
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGzipUpload_RoundTrip(t *testing.T) {
+	data := bytes.Repeat([]byte("firmware image "), 4096)
+	body := bytes.NewReader(data)
+
+	compressed, err := gzipUpload(body)
+	if err != nil {
+		t.Fatalf("gzipUpload failed: %v", err)
+	}
+	if len(compressed.data) >= len(data) {
+		t.Errorf("Expected repetitive data to compress, got %d of %d bytes", len(compressed.data), len(data))
+	}
+	if pos, _ := body.Seek(0, io.SeekCurrent); pos != 0 {
+		t.Errorf("Expected the body to be rewound, at offset %d", pos)
+	}
+	sum := md5.Sum(compressed.data)
+	if compressed.contentMD5 != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("Content-MD5 %q is not the digest of the gzipped bytes", compressed.contentMD5)
+	}
+
+	zr, err := gzip.NewReader(bytes.NewReader(compressed.data))
+	if err != nil {
+		t.Fatalf("Not a valid gzip stream: %v", err)
+	}
+	restored, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Failed to decompress: %v", err)
+	}
+	if !bytes.Equal(restored, data) {
+		t.Error("Decompressed body does not match the original")
+	}
+}
+
+func TestUploadFirmware_Compressed(t *testing.T) {
+	data := bytes.Repeat([]byte("firmware image "), 4096)
+	path := writeFirmware(t, "app.bin", data)
+
+	var encoding string
+	var restored []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		restored, _ = io.ReadAll(zr)
+		fmt.Fprint(w, `{"filename":"app.bin"}`)
+	}))
+	defer server.Close()
+
+	client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithCompressedUpload(true))
+	if _, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if encoding != "gzip" {
+		t.Errorf("Expected Content-Encoding gzip, got %q", encoding)
+	}
+	if !bytes.Equal(restored, data) {
+		t.Error("Server did not restore the original firmware")
+	}
+}
+
+func TestUploadFirmware_CompressionRejected(t *testing.T) {
+	data := bytes.Repeat([]byte("firmware image "), 4096)
+	path := writeFirmware(t, "app.bin", data)
+
+	var encodings []string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encodings = append(encodings, r.Header.Get("Content-Encoding"))
+		if r.Header.Get("Content-Encoding") != "" {
+			http.Error(w, "unsupported encoding", http.StatusUnsupportedMediaType)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+		fmt.Fprint(w, `{"filename":"app.bin"}`)
+	}))
+	defer server.Close()
+
+	client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithCompressedUpload(true))
+	if _, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if strings.Join(encodings, ",") != "gzip," {
+		t.Errorf("Expected a gzip attempt then an uncompressed one, got %q", encodings)
+	}
+	if !bytes.Equal(body, data) {
+		t.Error("Uncompressed fallback did not send the original firmware")
+	}
+}
+
+func TestUploadFirmware_IncompressibleSentAsIs(t *testing.T) {
+	path := writeFirmware(t, "app.bin", []byte("firmware"))
+
+	var encoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding = r.Header.Get("Content-Encoding")
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, `{"filename":"app.bin"}`)
+	}))
+	defer server.Close()
+
+	client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithCompressedUpload(true))
+	if _, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if encoding != "" {
+		t.Errorf("Expected an image gzip does not shrink to be sent uncompressed, got %q", encoding)
+	}
+}
@@ -0,0 +1,72 @@
+package notehub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+// DevicePageSize is the number of entries requested per page from paginated endpoints
+const DevicePageSize = 500
+
+// Device represents a device entry returned by the Notehub devices API
+type Device struct {
+	UID          string   `json:"uid"`
+	SerialNumber string   `json:"serial_number,omitempty"`
+	Name         string   `json:"name,omitempty"`
+	SKU          string   `json:"sku,omitempty"`
+	Tags         string   `json:"tags,omitempty"`
+	FleetUIDs    []string `json:"fleet_uids,omitempty"`
+	ProductUID   string   `json:"product_uid,omitempty"`
+}
+
+// DeviceListResponse represents a single page of the devices listing
+type DeviceListResponse struct {
+	Devices []Device `json:"devices"`
+	HasMore bool     `json:"has_more"`
+}
+
+// pageQuery copies filters and adds the pagination parameters for the given page
+func pageQuery(filters url.Values, page int) url.Values {
+	query := url.Values{}
+	for k, v := range filters {
+		query[k] = append([]string(nil), v...)
+	}
+	query.Set("pageSize", strconv.Itoa(DevicePageSize))
+	query.Set("pageNum", strconv.Itoa(page))
+	return query
+}
+
+// ListDevices returns every device in the project matching the given filters, following pagination
+func (c *Client) ListDevices(ctx context.Context, projectUID string, filters url.Values) ([]Device, error) {
+	var devices []Device
+
+	for page := 1; ; page++ {
+		listURL := fmt.Sprintf("%s/projects/%s/devices?%s", c.baseURL, projectUID, pageQuery(filters, page).Encode())
+
+		resp, err := c.doAPIRequest(ctx, "GET", listURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("device list request failed: %w", err)
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, c.statusError("device list", resp.StatusCode, resp.Body)
+		}
+
+		var listResp DeviceListResponse
+		if err := json.Unmarshal(resp.Body, &listResp); err != nil {
+			return nil, fmt.Errorf("failed to parse device list response: %w", err)
+		}
+
+		devices = append(devices, listResp.Devices...)
+		if !listResp.HasMore || len(listResp.Devices) == 0 {
+			break
+		}
+	}
+
+	c.logger.Printf("Resolved %d device(s) in project %s", len(devices), projectUID)
+
+	return devices, nil
+}
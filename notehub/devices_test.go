@@ -0,0 +1,64 @@
+package notehub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListDevices_Pagination(t *testing.T) {
+	var pages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/projects/app:123/devices" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("tags") != "production" {
+			t.Errorf("Expected tag filter, got %s", r.URL.RawQuery)
+		}
+		page := r.URL.Query().Get("pageNum")
+		pages = append(pages, page)
+		switch page {
+		case "1":
+			fmt.Fprint(w, `{"devices":[{"uid":"dev:1"},{"uid":"dev:2"}],"has_more":true}`)
+		default:
+			fmt.Fprint(w, `{"devices":[{"uid":"dev:3","sku":"NOTE-WBNAW"}],"has_more":false}`)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	devices, err := client.ListDevices(context.Background(), "app:123", map[string][]string{"tags": {"production"}})
+	if err != nil {
+		t.Fatalf("ListDevices failed: %v", err)
+	}
+
+	if len(devices) != 3 {
+		t.Fatalf("Expected 3 devices, got %d", len(devices))
+	}
+	if devices[2].UID != "dev:3" || devices[2].SKU != "NOTE-WBNAW" {
+		t.Errorf("Unexpected device %+v", devices[2])
+	}
+	if len(pages) != 2 {
+		t.Errorf("Expected 2 pages to be requested, got %v", pages)
+	}
+}
+
+func TestListDevices_ErrorStatus(t *testing.T) {
+	client := newTestClient(newStaticServer(t, http.StatusForbidden, `{"err":"forbidden"}`))
+
+	if _, err := client.ListDevices(context.Background(), "app:123", nil); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
+
+func TestListDevices_MalformedJSON(t *testing.T) {
+	client := newTestClient(newStaticServer(t, http.StatusOK, `{"devices":[`))
+
+	if _, err := client.ListDevices(context.Background(), "app:123", nil); err == nil || !strings.Contains(err.Error(), "failed to parse device list response") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+}
@@ -0,0 +1,73 @@
+package notehub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+)
+
+// Terminal per-device DFU states reported by Notehub
+const (
+	DFUStateCompleted = "completed"
+	DFUStateError     = "error"
+)
+
+// DeviceDFUState is the DFU status of a single targeted device. Filename is the firmware
+// the device is updating to, and Percent how much of it has been downloaded, when Notehub
+// reports them. PreviousVersion is the version the device ran before the update and
+// Version the one it is updating to.
+type DeviceDFUState struct {
+	DeviceUID       string `json:"device_uid"`
+	SerialNumber    string `json:"serial_number,omitempty"`
+	Status          string `json:"status"`
+	Description     string `json:"description,omitempty"`
+	Filename        string `json:"filename,omitempty"`
+	Percent         int    `json:"percent,omitempty"`
+	PreviousVersion string `json:"previous_version,omitempty"`
+	Version         string `json:"version,omitempty"`
+}
+
+// DFUStatusResponse represents one page of the DFU status endpoint
+type DFUStatusResponse struct {
+	Devices []DeviceDFUState `json:"devices"`
+	HasMore bool             `json:"has_more"`
+}
+
+// Terminal reports whether the device has finished its update, successfully or not
+func (s DeviceDFUState) Terminal() bool {
+	return s.Status == DFUStateCompleted || s.Status == DFUStateError
+}
+
+// GetDFUStatus returns the DFU status of every device matching the given filters, sorted
+// by device UID
+func (c *Client) GetDFUStatus(ctx context.Context, projectUID, firmwareType string, filters url.Values) ([]DeviceDFUState, error) {
+	var states []DeviceDFUState
+
+	for page := 1; ; page++ {
+		statusURL := fmt.Sprintf("%s/projects/%s/dfu/%s/status?%s", c.baseURL, projectUID, FirmwareTypeOrDefault(firmwareType), pageQuery(filters, page).Encode())
+
+		resp, err := c.doAPIRequest(ctx, "GET", statusURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("DFU status request failed: %w", err)
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return nil, c.statusError("DFU status", resp.StatusCode, resp.Body)
+		}
+
+		var statusResp DFUStatusResponse
+		if err := json.Unmarshal(resp.Body, &statusResp); err != nil {
+			return nil, fmt.Errorf("failed to parse DFU status response: %w", err)
+		}
+
+		states = append(states, statusResp.Devices...)
+		if !statusResp.HasMore || len(statusResp.Devices) == 0 {
+			break
+		}
+	}
+
+	sort.Slice(states, func(i, j int) bool { return states[i].DeviceUID < states[j].DeviceUID })
+	return states, nil
+}
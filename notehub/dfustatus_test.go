@@ -0,0 +1,58 @@
+package notehub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestGetDFUStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/projects/app:123/dfu/notecard/status" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		if r.URL.Query().Get("tags") != "production" {
+			t.Errorf("Expected targeting filters, got %s", r.URL.RawQuery)
+		}
+		switch r.URL.Query().Get("pageNum") {
+		case "1":
+			fmt.Fprint(w, `{"devices":[{"device_uid":"dev:2","status":"downloading"}],"has_more":true}`)
+		default:
+			fmt.Fprint(w, `{"devices":[{"device_uid":"dev:1","status":"error","description":"image rejected"}],"has_more":false}`)
+		}
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+
+	states, err := client.GetDFUStatus(context.Background(), "app:123", FirmwareTypeNotecard, url.Values{"tags": {"production"}})
+	if err != nil {
+		t.Fatalf("GetDFUStatus failed: %v", err)
+	}
+	if len(states) != 2 || states[0].DeviceUID != "dev:1" || states[1].DeviceUID != "dev:2" {
+		t.Fatalf("Expected both pages sorted by device, got %+v", states)
+	}
+	if !states[0].Terminal() || states[1].Terminal() {
+		t.Errorf("Expected only the errored device to be terminal, got %+v", states)
+	}
+}
+
+func TestGetDFUStatus_ErrorStatus(t *testing.T) {
+	client := newTestClient(newStaticServer(t, http.StatusNotFound, `{"err":"not found"}`))
+
+	if _, err := client.GetDFUStatus(context.Background(), "app:123", FirmwareTypeHost, nil); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
+
+func TestGetDFUStatus_MalformedJSON(t *testing.T) {
+	client := newTestClient(newStaticServer(t, http.StatusOK, `not json`))
+
+	if _, err := client.GetDFUStatus(context.Background(), "app:123", FirmwareTypeHost, nil); err == nil || !strings.Contains(err.Error(), "failed to parse DFU status response") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+}
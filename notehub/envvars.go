@@ -0,0 +1,75 @@
+package notehub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// EnvironmentVariables represents the project environment variables payload
+type EnvironmentVariables struct {
+	EnvironmentVariables map[string]string `json:"environment_variables"`
+}
+
+// GetEnvironmentVariables returns the project-level environment variables
+func (c *Client) GetEnvironmentVariables(ctx context.Context, projectUID string) (map[string]string, error) {
+	envURL := fmt.Sprintf("%s/projects/%s/environment_variables", c.baseURL, projectUID)
+
+	resp, err := c.doAPIRequest(ctx, "GET", envURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("environment variables request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("get environment variables", resp.StatusCode, resp.Body)
+	}
+
+	var envResp EnvironmentVariables
+	if err := json.Unmarshal(resp.Body, &envResp); err != nil {
+		return nil, fmt.Errorf("failed to parse environment variables response: %w", err)
+	}
+
+	if envResp.EnvironmentVariables == nil {
+		envResp.EnvironmentVariables = map[string]string{}
+	}
+
+	return envResp.EnvironmentVariables, nil
+}
+
+// SetEnvironmentVariables creates or updates the given project-level environment variables
+func (c *Client) SetEnvironmentVariables(ctx context.Context, projectUID string, vars map[string]string) error {
+	envURL := fmt.Sprintf("%s/projects/%s/environment_variables", c.baseURL, projectUID)
+
+	payload, err := json.Marshal(EnvironmentVariables{EnvironmentVariables: vars})
+	if err != nil {
+		return fmt.Errorf("failed to marshal environment variables: %w", err)
+	}
+
+	resp, err := c.doAPIRequest(ctx, "PUT", envURL, payload)
+	if err != nil {
+		return fmt.Errorf("environment variables request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.statusError("set environment variables", resp.StatusCode, resp.Body)
+	}
+
+	return nil
+}
+
+// DeleteEnvironmentVariable removes a project-level environment variable
+func (c *Client) DeleteEnvironmentVariable(ctx context.Context, projectUID, key string) error {
+	envURL := fmt.Sprintf("%s/projects/%s/environment_variables/%s", c.baseURL, projectUID, url.PathEscape(key))
+
+	resp, err := c.doAPIRequest(ctx, "DELETE", envURL, nil)
+	if err != nil {
+		return fmt.Errorf("environment variables request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.statusError("delete environment variable", resp.StatusCode, resp.Body)
+	}
+
+	return nil
+}
@@ -0,0 +1,80 @@
+package notehub
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGetEnvironmentVariables(t *testing.T) {
+	client := newTestClient(newStaticServer(t, http.StatusOK, `{"environment_variables":{"_odfu_lock":"held"}}`))
+	vars, err := client.GetEnvironmentVariables(context.Background(), "app:123")
+	if err != nil || vars["_odfu_lock"] != "held" {
+		t.Errorf("Expected variables to be returned, got %v, %v", vars, err)
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusOK, `{}`))
+	if vars, err := client.GetEnvironmentVariables(context.Background(), "app:123"); err != nil || vars == nil {
+		t.Errorf("Expected an empty map for a project without variables, got %v, %v", vars, err)
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusUnauthorized, `{"err":"unauthorized"}`))
+	if _, err := client.GetEnvironmentVariables(context.Background(), "app:123"); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusOK, `{"environment_variables":`))
+	if _, err := client.GetEnvironmentVariables(context.Background(), "app:123"); err == nil || !strings.Contains(err.Error(), "failed to parse") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+}
+
+func TestSetEnvironmentVariables(t *testing.T) {
+	var got EnvironmentVariables
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/projects/app:123/environment_variables" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	if err := client.SetEnvironmentVariables(context.Background(), "app:123", map[string]string{"key": "value"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got.EnvironmentVariables["key"] != "value" {
+		t.Errorf("Expected variables in the request body, got %+v", got)
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusForbidden, `{"err":"forbidden"}`))
+	if err := client.SetEnvironmentVariables(context.Background(), "app:123", map[string]string{"key": "value"}); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
+
+func TestDeleteEnvironmentVariable(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.Method + " " + r.URL.Path
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := newTestClient(server)
+	if err := client.DeleteEnvironmentVariable(context.Background(), "app:123", "_odfu_lock"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotPath != "DELETE /projects/app:123/environment_variables/_odfu_lock" {
+		t.Errorf("Unexpected request %s", gotPath)
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusNotFound, `{"err":"not found"}`))
+	if err := client.DeleteEnvironmentVariable(context.Background(), "app:123", "_odfu_lock"); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package notehub
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// NotehubError is returned when Notehub answers a request with a non-2xx status. Message
+// and Code come from Notehub's standard {"err": ..., "code": ...} body when it has one;
+// otherwise Message is the whole body. Body is always the raw response, with credentials
+// scrubbed, for debugging. Use errors.As to branch on StatusCode.
+type NotehubError struct {
+	Operation  string
+	StatusCode int
+	Message    string
+	Code       int
+	Body       string
+}
+
+func (e *NotehubError) Error() string {
+	msg := fmt.Sprintf("%s failed with status %d: %s", e.Operation, e.StatusCode, e.Message)
+	if guidance := e.Guidance(); guidance != "" {
+		msg += " (" + guidance + ")"
+	}
+	return msg
+}
+
+// Guidance suggests what to check for the common failure statuses, or returns "" when
+// the status has no specific advice
+func (e *NotehubError) Guidance() string {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return "the credentials were rejected: check client_id and client_secret, and that the OAuth client has not been deleted, or that api_token is current; a token_handle from an earlier step may have expired"
+	case http.StatusForbidden:
+		return "access denied: check that project_uid is right and that the OAuth client belongs to a user with access to the project"
+	case http.StatusNotFound:
+		return "not found: check project_uid, and fleet_uid or the firmware filename if set"
+	case http.StatusRequestEntityTooLarge:
+		return "the firmware is larger than Notehub accepts"
+	case http.StatusTooManyRequests:
+		return "Notehub is rate limiting requests: run fewer deployments at once or raise max_rate_limit_wait"
+	}
+	return ""
+}
+
+// ErrAuthenticationRejected is matched, with errors.Is, by the error Authenticate returns
+// when the token endpoint answers that the credentials are wrong, as opposed to failing to
+// answer at all. The error also unwraps to the NotehubError with Notehub's message.
+var ErrAuthenticationRejected = errors.New("authentication rejected: check client_id/client_secret")
+
+// authRejectedError is a 400 or 401 from the token endpoint, which means the client ID or
+// secret is wrong, not that the request should be retried
+type authRejectedError struct {
+	notehubErr *NotehubError
+}
+
+func (e *authRejectedError) Error() string {
+	return fmt.Sprintf("%v (%s returned status %d: %s)", ErrAuthenticationRejected, e.notehubErr.Operation, e.notehubErr.StatusCode, e.notehubErr.Message)
+}
+
+func (e *authRejectedError) Unwrap() []error {
+	return []error{ErrAuthenticationRejected, e.notehubErr}
+}
+
+// newNotehubError builds the error for a non-2xx response to operation. body must
+// already be scrubbed of credentials.
+func newNotehubError(operation string, status int, body string) *NotehubError {
+	e := &NotehubError{Operation: operation, StatusCode: status, Message: body, Body: body}
+	var parsed struct {
+		Err              string `json:"err"`
+		Code             int    `json:"code"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if json.Unmarshal([]byte(body), &parsed) != nil {
+		return e
+	}
+	// The OAuth2 token endpoint reports errors in the RFC 6749 shape instead
+	switch {
+	case parsed.Err != "":
+		e.Message = parsed.Err
+	case parsed.ErrorDescription != "":
+		e.Message = parsed.ErrorDescription
+	case parsed.Error != "":
+		e.Message = parsed.Error
+	}
+	e.Code = parsed.Code
+	return e
+}
+
+// statusError returns the NotehubError for a non-2xx response to operation
+func (c *Client) statusError(operation string, status int, body []byte) *NotehubError {
+	return newNotehubError(operation, status, c.scrub(body))
+}
@@ -0,0 +1,56 @@
+package notehub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNewNotehubError(t *testing.T) {
+	tests := []struct {
+		name            string
+		status          int
+		body            string
+		expectedMessage string
+		expectedCode    int
+		expectedAdvice  string
+	}{
+		{"standard body", http.StatusForbidden, `{"err":"project access denied","code":403}`, "project access denied", 403, "check that project_uid is right"},
+		{"oauth body", http.StatusUnauthorized, `{"error":"invalid_client","error_description":"client authentication failed"}`, "client authentication failed", 0, "check client_id and client_secret"},
+		{"oauth error only", http.StatusUnauthorized, `{"error":"invalid_client"}`, "invalid_client", 0, "credentials were rejected"},
+		{"not json", http.StatusBadGateway, `<html>bad gateway</html>`, "<html>bad gateway</html>", 0, ""},
+		{"json without err", http.StatusNotFound, `{"detail":"nope"}`, `{"detail":"nope"}`, 0, "check project_uid, and fleet_uid"},
+		{"too large", http.StatusRequestEntityTooLarge, `{"err":"file too large"}`, "file too large", 0, "larger than Notehub accepts"},
+		{"rate limited", http.StatusTooManyRequests, `{"err":"slow down"}`, "slow down", 0, "raise max_rate_limit_wait"},
+		{"token rejected", http.StatusUnauthorized, `{"err":"token expired"}`, "token expired", 0, "or that api_token is current; a token_handle"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newNotehubError("get project", tt.status, tt.body)
+			if e.Message != tt.expectedMessage || e.Code != tt.expectedCode || e.Body != tt.body {
+				t.Errorf("Unexpected error fields %+v", e)
+			}
+			if !strings.Contains(e.Guidance(), tt.expectedAdvice) || (tt.expectedAdvice == "" && e.Guidance() != "") {
+				t.Errorf("Expected guidance containing %q, got %q", tt.expectedAdvice, e.Guidance())
+			}
+			if !strings.HasPrefix(e.Error(), "get project failed with status ") || !strings.Contains(e.Error(), tt.expectedMessage) {
+				t.Errorf("Unexpected message %q", e.Error())
+			}
+		})
+	}
+}
+
+func TestNotehubError_ErrorsAs(t *testing.T) {
+	client := newTestClient(newStaticServer(t, http.StatusForbidden, `{"err":"forbidden","code":17}`))
+
+	_, err := client.ListDevices(context.Background(), "app:123", nil)
+	var notehubErr *NotehubError
+	if !errors.As(err, &notehubErr) {
+		t.Fatalf("Expected a NotehubError, got %T: %v", err, err)
+	}
+	if notehubErr.StatusCode != http.StatusForbidden || notehubErr.Code != 17 || notehubErr.Operation != "device list" {
+		t.Errorf("Unexpected error fields %+v", notehubErr)
+	}
+}
@@ -0,0 +1,58 @@
+package notehub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// ErrEventsUnsupported is returned when the project's events cannot be read, because the
+// API does not offer them or the client lacks access
+var ErrEventsUnsupported = errors.New("device events are not available")
+
+// Event is a single event routed through Notehub. When is in Unix seconds.
+type Event struct {
+	UID  string          `json:"event"`
+	File string          `json:"file,omitempty"`
+	When int64           `json:"when,omitempty"`
+	Body json.RawMessage `json:"body,omitempty"`
+}
+
+// eventsResponse represents the events listing
+type eventsResponse struct {
+	Events []Event `json:"events"`
+}
+
+// GetDeviceEvents returns the device's events received since the given Unix time, oldest
+// first. It returns ErrEventsUnsupported when events cannot be read.
+func (c *Client) GetDeviceEvents(ctx context.Context, projectUID, deviceUID string, since int64) ([]Event, error) {
+	query := url.Values{}
+	query.Set("deviceUID", deviceUID)
+	query.Set("startDate", strconv.FormatInt(since, 10))
+	query.Set("sortOrder", "asc")
+	eventsURL := fmt.Sprintf("%s/projects/%s/events?%s", c.baseURL, projectUID, query.Encode())
+
+	resp, err := c.doAPIRequest(ctx, "GET", eventsURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("events request failed: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, ErrEventsUnsupported
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("events request", resp.StatusCode, resp.Body)
+	}
+
+	var eventsResp eventsResponse
+	if err := json.Unmarshal(resp.Body, &eventsResp); err != nil {
+		return nil, fmt.Errorf("failed to parse events response: %w", err)
+	}
+
+	return eventsResp.Events, nil
+}
@@ -0,0 +1,36 @@
+package notehub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetDeviceEvents(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if r.URL.Path != "/projects/app:123/events" || query.Get("deviceUID") != "dev:1" || query.Get("startDate") != "1700000000" {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		fmt.Fprint(w, `{"events":[{"event":"e1","file":"_health.qo","when":1700000001,"body":{"text":"boot"}}]}`)
+	}))
+	defer server.Close()
+
+	events, err := newTestClient(server).GetDeviceEvents(context.Background(), "app:123", "dev:1", 1700000000)
+	if err != nil {
+		t.Fatalf("GetDeviceEvents failed: %v", err)
+	}
+	if len(events) != 1 || events[0].UID != "e1" || events[0].File != "_health.qo" || string(events[0].Body) != `{"text":"boot"}` {
+		t.Errorf("Unexpected events %+v", events)
+	}
+
+	for _, status := range []int{http.StatusForbidden, http.StatusNotFound} {
+		client := newTestClient(newStaticServer(t, status, ""))
+		if _, err := client.GetDeviceEvents(context.Background(), "app:123", "dev:1", 0); !errors.Is(err, ErrEventsUnsupported) {
+			t.Errorf("Expected ErrEventsUnsupported for status %d, got %v", status, err)
+		}
+	}
+}
@@ -0,0 +1,560 @@
+package notehub
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Firmware types accepted by the Notehub firmware and DFU endpoints
+const (
+	FirmwareTypeHost     = "host"
+	FirmwareTypeNotecard = "notecard"
+)
+
+// FirmwareTypeOrDefault returns the firmware type to use in API paths, defaulting to host
+func FirmwareTypeOrDefault(firmwareType string) string {
+	if firmwareType == "" {
+		return FirmwareTypeHost
+	}
+	return firmwareType
+}
+
+// ErrServerCopyUnsupported is returned when Notehub cannot copy firmware server-side
+var ErrServerCopyUnsupported = errors.New("server-side firmware copy is not supported")
+
+// ErrDFUSchedulingUnsupported is returned when Notehub cannot defer a DFU to a later time
+var ErrDFUSchedulingUnsupported = errors.New("scheduled device firmware updates are not supported")
+
+// ErrNoDFUPending is returned when Notehub reports that none of the targeted devices had a
+// device firmware update to cancel
+var ErrNoDFUPending = errors.New("no device firmware update is pending")
+
+// FirmwareUploadResponse represents the response from firmware upload. The digests are
+// only present when Notehub reports them.
+type FirmwareUploadResponse struct {
+	Filename string `json:"filename"`
+	SHA256   string `json:"sha256,omitempty"`
+	MD5      string `json:"md5,omitempty"`
+	CRC32    string `json:"crc32,omitempty"`
+}
+
+// verifyDigest checks a digest Notehub reported against the one computed locally. An
+// empty reported digest is not checked.
+func verifyDigest(name, local, reported string) error {
+	if reported != "" && !strings.EqualFold(reported, local) {
+		return fmt.Errorf("uploaded firmware %s mismatch: sent %s, Notehub reports %s", name, local, reported)
+	}
+	return nil
+}
+
+// DFURequest represents the payload for triggering device firmware update. StartAt is
+// only sent when scheduling the update for later.
+type DFURequest struct {
+	Filename string `json:"filename"`
+	StartAt  string `json:"start_at,omitempty"`
+}
+
+// DFUResponse represents the response from DFU trigger. Notehub may answer with an empty
+// object, so every field is optional; DeviceCount is the number of devices the update was
+// issued to, when reported.
+type DFUResponse struct {
+	Success     bool   `json:"success,omitempty"`
+	Message     string `json:"message,omitempty"`
+	RequestID   string `json:"request_id,omitempty"`
+	DeviceCount int    `json:"device_count,omitempty"`
+}
+
+// UploadFirmware uploads a firmware binary file of the given firmware type to Notehub
+func (c *Client) UploadFirmware(ctx context.Context, projectUID, firmwareType, firmwareFile string) (*FirmwareUploadResponse, error) {
+	return c.UploadFirmwareAs(ctx, projectUID, firmwareType, firmwareFile, filepath.Base(firmwareFile))
+}
+
+// UploadFirmwareAs uploads a firmware binary file to Notehub under the given filename.
+// The file is streamed rather than read into memory, so large images are not held in
+// full; each retry rewinds it.
+func (c *Client) UploadFirmwareAs(ctx context.Context, projectUID, firmwareType, firmwareFile, filename string) (*FirmwareUploadResponse, error) {
+	f, err := os.Open(firmwareFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firmware file: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read firmware file: %w", err)
+	}
+
+	return c.uploadFirmware(ctx, projectUID, firmwareType, filename, f, info.Size())
+}
+
+// UploadFirmwareData uploads firmware bytes to Notehub under the given filename
+func (c *Client) UploadFirmwareData(ctx context.Context, projectUID, firmwareType, filename string, fileData []byte) (*FirmwareUploadResponse, error) {
+	return c.uploadFirmware(ctx, projectUID, firmwareType, filename, bytes.NewReader(fileData), int64(len(fileData)))
+}
+
+// uploadDigests are the local digests of an upload, checked against any Notehub reports
+type uploadDigests struct {
+	sha256, md5, crc32 string
+
+	// contentMD5 is the base64 MD5 sent in the Content-MD5 header, so the server can
+	// reject a body corrupted in transit
+	contentMD5 string
+}
+
+// digestUpload computes the digests of body in one pass and rewinds it
+func digestUpload(body io.ReadSeeker) (*uploadDigests, error) {
+	sha256Hash, md5Hash, crcHash := sha256.New(), md5.New(), crc32.NewIEEE()
+	if _, err := io.Copy(io.MultiWriter(sha256Hash, md5Hash, crcHash), body); err != nil {
+		return nil, fmt.Errorf("failed to read firmware file: %w", err)
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to rewind firmware file: %w", err)
+	}
+	md5Sum := md5Hash.Sum(nil)
+	return &uploadDigests{
+		sha256:     hex.EncodeToString(sha256Hash.Sum(nil)),
+		md5:        hex.EncodeToString(md5Sum),
+		crc32:      fmt.Sprintf("%08x", crcHash.Sum32()),
+		contentMD5: base64.StdEncoding.EncodeToString(md5Sum),
+	}, nil
+}
+
+// uploadHTTPClient returns the HTTP client for firmware uploads: the client's own, or a copy
+// sharing its transport but bounded by the upload timeout when one is set
+func (c *Client) uploadHTTPClient() *http.Client {
+	if c.uploadTimeout <= 0 {
+		return c.httpClient
+	}
+	uploadClient := *c.httpClient
+	uploadClient.Timeout = c.uploadTimeout
+	return &uploadClient
+}
+
+// ScaledUploadTimeout returns the deadline for uploading size bytes at no less than
+// bytesPerSec, plus allowance for the request itself
+func ScaledUploadTimeout(size, bytesPerSec int64, allowance time.Duration) time.Duration {
+	if bytesPerSec <= 0 {
+		return allowance
+	}
+	return allowance + time.Duration(float64(size)/float64(bytesPerSec)*float64(time.Second))
+}
+
+// scaledUploadTimeout returns the per-request deadline for uploading size bytes when a
+// minimum upload rate is set, or zero otherwise
+func (c *Client) scaledUploadTimeout(size int64) time.Duration {
+	if c.minUploadRate <= 0 {
+		return 0
+	}
+	allowance := c.httpClient.Timeout
+	if allowance <= 0 {
+		allowance = DefaultTimeout
+	}
+	return ScaledUploadTimeout(size, c.minUploadRate, allowance)
+}
+
+// uploadFirmware streams size bytes of body to Notehub under the given filename
+func (c *Client) uploadFirmware(ctx context.Context, projectUID, firmwareType, filename string, body io.ReadSeeker, size int64) (*FirmwareUploadResponse, error) {
+	// An empty image is never a real build, and a device would never finish updating to it
+	if size == 0 {
+		return nil, fmt.Errorf("firmware %s is empty (0 bytes); refusing to upload it", filename)
+	}
+
+	c.logger.Printf("Uploading firmware to Notehub...")
+
+	digests, err := digestUpload(body)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Printf("  - Project: %s", projectUID)
+	c.logger.Printf("  - File: %s", filename)
+	c.logger.Printf("  - SHA-256: %s", digests.sha256)
+	c.logger.Printf("  - Type: %s", FirmwareTypeOrDefault(firmwareType))
+	c.logger.Printf("  - Size: %d bytes", size)
+
+	// Create upload URL
+	uploadURL := c.FirmwareURL(projectUID, firmwareType, filename)
+
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	// A size-scaled deadline is applied to each attempt through its context, in place of
+	// the client's timeout
+	httpClient := c.uploadHTTPClient()
+	deadline := c.scaledUploadTimeout(size)
+	cancelAttempt := context.CancelFunc(func() {})
+	defer func() { cancelAttempt() }()
+	if deadline > 0 {
+		c.logger.Printf("  - Deadline: %s at %d bytes/s minimum", deadline.Round(time.Second), c.minUploadRate)
+		unbounded := *c.httpClient
+		unbounded.Timeout = 0
+		httpClient = &unbounded
+	}
+
+	// With compression, the gzipped image is sent when it is smaller than the file
+	var compressed *compressedUpload
+	if c.compressUpload {
+		compressed, err = gzipUpload(body)
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(compressed.data)) >= size {
+			c.logger.Printf("  - Compression: none, the image does not compress")
+			compressed = nil
+		} else {
+			c.logger.Printf("  - Compression: gzip, %d bytes (%d%%)", len(compressed.data), int64(len(compressed.data))*100/size)
+		}
+	}
+
+	// Execute request, rewinding the binary body for each attempt. The body is wrapped so
+	// the transport cannot close the file between attempts.
+	send := func() (*http.Response, error) {
+		return c.doWithRetryUsing(ctx, httpClient, func() (*http.Request, error) {
+			var payload io.ReadSeeker = body
+			length, contentMD5 := size, digests.contentMD5
+			if compressed != nil {
+				payload = bytes.NewReader(compressed.data)
+				length, contentMD5 = int64(len(compressed.data)), compressed.contentMD5
+			}
+			if _, err := payload.Seek(0, io.SeekStart); err != nil {
+				return nil, fmt.Errorf("failed to rewind firmware file: %w", err)
+			}
+			attemptCtx := ctx
+			cancelAttempt()
+			if deadline > 0 {
+				attemptCtx, cancelAttempt = context.WithTimeout(ctx, deadline)
+			}
+			req, err := http.NewRequestWithContext(attemptCtx, "PUT", uploadURL, io.NopCloser(c.uploadBody(payload, length)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to create upload request: %w", err)
+			}
+			req.ContentLength = length
+
+			// Set headers
+			c.authorize(req)
+			req.Header.Set("Content-Type", "application/octet-stream")
+			req.Header.Set("Content-MD5", contentMD5)
+			if compressed != nil {
+				req.Header.Set("Content-Encoding", "gzip")
+			}
+			return req, nil
+		})
+	}
+	resp, err := send()
+	if err == nil && compressed != nil && compressionRejected(resp.StatusCode) {
+		resp.Body.Close()
+		c.logger.Printf("Notehub rejected the compressed upload (HTTP %d); uploading uncompressed", resp.StatusCode)
+		compressed = nil
+		resp, err = send()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("firmware upload request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read upload response: %w", err)
+	}
+
+	// Check status code
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if qerr := c.classifyQuotaError(resp.StatusCode, respBody); qerr != nil {
+			return nil, qerr
+		}
+		return nil, c.statusError("firmware upload", resp.StatusCode, respBody)
+	}
+
+	// Parse response
+	var uploadResp FirmwareUploadResponse
+	if err := json.Unmarshal(respBody, &uploadResp); err != nil {
+		return nil, fmt.Errorf("failed to parse upload response: %w", err)
+	}
+
+	// Verify Notehub received the same bytes, when it reports a digest
+	if err := verifyDigest("SHA-256", digests.sha256, uploadResp.SHA256); err != nil {
+		return nil, err
+	}
+	if err := verifyDigest("MD5", digests.md5, uploadResp.MD5); err != nil {
+		return nil, err
+	}
+	if err := verifyDigest("CRC32", digests.crc32, uploadResp.CRC32); err != nil {
+		return nil, err
+	}
+
+	c.logger.Printf("✅ Firmware upload successful")
+	c.logger.Printf("✅ Captured uploaded filename: %s", uploadResp.Filename)
+
+	return &uploadResp, nil
+}
+
+// FirmwareURL returns the URL a firmware file of the given type is uploaded to and
+// downloaded from
+func (c *Client) FirmwareURL(projectUID, firmwareType, filename string) string {
+	return fmt.Sprintf("%s/projects/%s/firmware/%s/%s", c.baseURL, projectUID, FirmwareTypeOrDefault(firmwareType), filename)
+}
+
+// FirmwareInfo describes a firmware file uploaded to the project. Created is the upload
+// time in Unix seconds.
+type FirmwareInfo struct {
+	Filename string `json:"filename"`
+	Type     string `json:"type,omitempty"`
+	Length   int64  `json:"length,omitempty"`
+	SHA256   string `json:"sha256,omitempty"`
+	MD5      string `json:"md5,omitempty"`
+	Created  int64  `json:"created,omitempty"`
+	Version  string `json:"version,omitempty"`
+}
+
+// ListFirmware returns the project's uploaded firmware of the given type whose name is
+// filename, or every file of that type when filename is empty. It makes a single request.
+func (c *Client) ListFirmware(ctx context.Context, projectUID, firmwareType, filename string) ([]FirmwareInfo, error) {
+	query := url.Values{}
+	query.Set("firmwareType", FirmwareTypeOrDefault(firmwareType))
+	if filename != "" {
+		query.Set("filename", filename)
+	}
+	listURL := fmt.Sprintf("%s/projects/%s/firmware?%s", c.baseURL, projectUID, query.Encode())
+
+	resp, err := c.doAPIRequest(ctx, "GET", listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("firmware list request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("firmware list", resp.StatusCode, resp.Body)
+	}
+
+	var files []FirmwareInfo
+	if err := json.Unmarshal(resp.Body, &files); err != nil {
+		return nil, fmt.Errorf("failed to parse firmware list response: %w", err)
+	}
+
+	return files, nil
+}
+
+// DownloadFirmware returns the contents of a firmware file previously uploaded to Notehub
+func (c *Client) DownloadFirmware(ctx context.Context, projectUID, firmwareType, filename string) ([]byte, error) {
+	resp, err := c.doAPIRequest(ctx, "GET", c.FirmwareURL(projectUID, firmwareType, filename), nil)
+	if err != nil {
+		return nil, fmt.Errorf("firmware download request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("firmware download of "+filename, resp.StatusCode, resp.Body)
+	}
+
+	return resp.Body, nil
+}
+
+// DeleteFirmware deletes an uploaded firmware file
+func (c *Client) DeleteFirmware(ctx context.Context, projectUID, firmwareType, filename string) error {
+	resp, err := c.doAPIRequest(ctx, "DELETE", c.FirmwareURL(projectUID, firmwareType, filename), nil)
+	if err != nil {
+		return fmt.Errorf("firmware delete request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.statusError("firmware delete of "+filename, resp.StatusCode, resp.Body)
+	}
+
+	return nil
+}
+
+// CopyFirmware copies an uploaded firmware file to a new name on the server. It returns
+// ErrServerCopyUnsupported when the API does not offer copying.
+func (c *Client) CopyFirmware(ctx context.Context, projectUID, firmwareType, source, target string) (*FirmwareUploadResponse, error) {
+	payload, err := json.Marshal(map[string]string{"filename": target})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal copy payload: %w", err)
+	}
+
+	copyURL := c.FirmwareURL(projectUID, firmwareType, source) + "/copy"
+	resp, err := c.doAPIRequest(ctx, "POST", copyURL, payload)
+	if err != nil {
+		return nil, fmt.Errorf("firmware copy request failed: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, ErrServerCopyUnsupported
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("firmware copy", resp.StatusCode, resp.Body)
+	}
+
+	var copyResp FirmwareUploadResponse
+	if err := json.Unmarshal(resp.Body, &copyResp); err != nil {
+		return nil, fmt.Errorf("failed to parse copy response: %w", err)
+	}
+	if copyResp.Filename == "" {
+		copyResp.Filename = target
+	}
+
+	return &copyResp, nil
+}
+
+// DFUUpdateRequest builds the DFU URL, including the device targeting filters, and the
+// JSON payload that TriggerDFU sends
+func (c *Client) DFUUpdateRequest(projectUID, firmwareType string, filters url.Values, filename string) (string, []byte, error) {
+	return c.dfuRequest("update", projectUID, firmwareType, filters, DFURequest{Filename: filename})
+}
+
+// DFUScheduleRequest builds the URL and JSON payload that ScheduleDFU sends
+func (c *Client) DFUScheduleRequest(projectUID, firmwareType string, filters url.Values, filename string, startAt time.Time) (string, []byte, error) {
+	return c.dfuRequest("schedule", projectUID, firmwareType, filters, DFURequest{Filename: filename, StartAt: startAt.UTC().Format(time.RFC3339)})
+}
+
+// dfuRequest builds the URL of a DFU endpoint, including the device targeting filters,
+// and its JSON payload
+func (c *Client) dfuRequest(endpoint, projectUID, firmwareType string, filters url.Values, payload DFURequest) (string, []byte, error) {
+	// Build DFU URL
+	dfuURL := fmt.Sprintf("%s/projects/%s/dfu/%s/%s", c.baseURL, projectUID, FirmwareTypeOrDefault(firmwareType), endpoint)
+	if len(filters) > 0 {
+		dfuURL += "?" + filters.Encode()
+	}
+
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to marshal DFU payload: %w", err)
+	}
+
+	return dfuURL, payloadBytes, nil
+}
+
+// TriggerDFU initiates a device firmware update to filename for the devices matching filters
+// and returns Notehub's response
+func (c *Client) TriggerDFU(ctx context.Context, projectUID, firmwareType string, filters url.Values, filename string) (*DFUResponse, error) {
+	c.logger.Printf("Triggering device firmware update...")
+
+	dfuURL, payloadBytes, err := c.DFUUpdateRequest(projectUID, firmwareType, filters, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logger.Printf("DFU URL: %s", c.scrub([]byte(dfuURL)))
+
+	c.logger.Printf("Payload: %s", string(payloadBytes))
+
+	if err := c.ensureToken(ctx); err != nil {
+		return nil, err
+	}
+
+	// Execute request
+	resp, err := c.doWithRetry(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", dfuURL, bytes.NewReader(payloadBytes))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create DFU request: %w", err)
+		}
+
+		// Set headers
+		c.authorize(req)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("DFU request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Read response
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DFU response: %w", err)
+	}
+
+	// Check status code
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("device firmware update", resp.StatusCode, body)
+	}
+
+	c.logger.Printf("✅ Device firmware update triggered successfully")
+	c.logger.Printf("Response: %s", c.scrub(body))
+
+	// The trigger succeeded, so a body that is not the expected JSON leaves the fields unset
+	var dfuResp DFUResponse
+	if len(bytes.TrimSpace(body)) > 0 {
+		if err := json.Unmarshal(body, &dfuResp); err != nil {
+			c.logger.Printf("⚠️ Could not parse the DFU response: %v", err)
+		}
+	}
+	return &dfuResp, nil
+}
+
+// ScheduleDFU asks Notehub to start a device firmware update to filename for the devices
+// matching filters at startAt. It returns ErrDFUSchedulingUnsupported, without triggering
+// anything, when the API does not offer scheduling.
+func (c *Client) ScheduleDFU(ctx context.Context, projectUID, firmwareType string, filters url.Values, filename string, startAt time.Time) error {
+	c.logger.Printf("Scheduling device firmware update for %s...", startAt.UTC().Format(time.RFC3339))
+
+	dfuURL, payloadBytes, err := c.DFUScheduleRequest(projectUID, firmwareType, filters, filename, startAt)
+	if err != nil {
+		return err
+	}
+
+	c.logger.Printf("DFU URL: %s", c.scrub([]byte(dfuURL)))
+	c.logger.Printf("Payload: %s", string(payloadBytes))
+
+	resp, err := c.doAPIRequest(ctx, "POST", dfuURL, payloadBytes)
+	if err != nil {
+		return fmt.Errorf("DFU schedule request failed: %w", err)
+	}
+
+	switch resp.StatusCode {
+	case http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return ErrDFUSchedulingUnsupported
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.statusError("device firmware update scheduling", resp.StatusCode, resp.Body)
+	}
+
+	c.logger.Printf("✅ Device firmware update scheduled successfully")
+	c.logger.Printf("Response: %s", c.scrub(resp.Body))
+
+	return nil
+}
+
+// CancelDFU asks Notehub to cancel the pending device firmware update of the devices
+// matching filters. It returns ErrNoDFUPending when Notehub reports that none was pending.
+func (c *Client) CancelDFU(ctx context.Context, projectUID, firmwareType string, filters url.Values) error {
+	c.logger.Printf("Cancelling pending device firmware update...")
+
+	dfuURL, _, err := c.dfuRequest("cancel", projectUID, firmwareType, filters, DFURequest{})
+	if err != nil {
+		return err
+	}
+	c.logger.Printf("DFU URL: %s", c.scrub([]byte(dfuURL)))
+
+	resp, err := c.doAPIRequest(ctx, "POST", dfuURL, nil)
+	if err != nil {
+		return fmt.Errorf("DFU cancel request failed: %w", err)
+	}
+
+	if resp.StatusCode == http.StatusConflict ||
+		(resp.StatusCode >= 400 && resp.StatusCode < 500 && strings.Contains(strings.ToLower(string(resp.Body)), "pending")) {
+		return fmt.Errorf("%w: %s", ErrNoDFUPending, c.scrub(resp.Body))
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return c.statusError("device firmware update cancel", resp.StatusCode, resp.Body)
+	}
+
+	c.logger.Printf("✅ Pending device firmware update cancelled")
+	return nil
+}
@@ -0,0 +1,545 @@
+package notehub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// sha256("firmware") and md5("firmware")
+const (
+	testFirmwareSHA256 = "c3bf47ea1f4a4a605470313cacb3a44f4a461f68c6faeab07e737610cb5ac835"
+	testFirmwareMD5    = "74b5b5e9570efc5c0553bb327cd41940"
+	testFirmwareCRC32  = "d5ecd7c4"
+)
+
+// writeFirmware writes data to a temporary firmware file named name and returns its path
+func writeFirmware(t *testing.T, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	return path
+}
+
+func TestUploadFirmware(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectError string
+	}{
+		{"success", http.StatusOK, `{"filename":"app-1.bin"}`, ""},
+		{"non-2xx", http.StatusRequestEntityTooLarge, `{"err":"file too large"}`, "status 413"},
+		{"malformed JSON", http.StatusOK, `{"filename":`, "failed to parse upload response"},
+	}
+
+	path := writeFirmware(t, "app.bin", []byte("firmware"))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newStaticServer(t, tt.status, tt.body))
+
+			resp, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+				if resp.Filename != "app-1.bin" {
+					t.Errorf("Expected Notehub's filename app-1.bin, got %s", resp.Filename)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestUploadFirmware_SendsBinaryBody(t *testing.T) {
+	var gotPath, gotType, gotAuth, gotMD5 string
+	var gotBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.Method + " " + r.URL.Path
+		gotType = r.Header.Get("Content-Type")
+		gotMD5 = r.Header.Get("Content-MD5")
+		gotAuth = r.Header.Get("Authorization")
+		gotBody, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"filename":"stable-app.bin"}`))
+	}))
+	defer server.Close()
+
+	path := writeFirmware(t, "app.bin", []byte("firmware"))
+
+	client := newTestClient(server)
+	if _, err := client.UploadFirmwareAs(context.Background(), "app:123", FirmwareTypeHost, path, "stable-app.bin"); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	if gotPath != "PUT /projects/app:123/firmware/host/stable-app.bin" {
+		t.Errorf("Unexpected request %s", gotPath)
+	}
+	if gotType != "application/octet-stream" || gotAuth != "Bearer token" || string(gotBody) != "firmware" {
+		t.Errorf("Unexpected upload: type %q, auth %q, body %q", gotType, gotAuth, gotBody)
+	}
+	// The base64 of the raw MD5 digest testFirmwareMD5
+	if gotMD5 != "dLW16VcO/FwFU7syfNQZQA==" {
+		t.Errorf("Unexpected Content-MD5 %q", gotMD5)
+	}
+}
+
+func TestUploadFirmware_StreamsLargeFileAcrossRetries(t *testing.T) {
+	const size = 6 << 20
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	path := writeFirmware(t, "large.bin", data)
+
+	var attempts int
+	var received []int64
+	var contentLengths []int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := io.Copy(io.Discard, r.Body)
+		received = append(received, n)
+		contentLengths = append(contentLengths, r.ContentLength)
+		attempts++
+		if attempts == 1 {
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"filename":"large.bin"}`)
+	}))
+	defer server.Close()
+
+	client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithRetries(1, time.Millisecond))
+	if _, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+
+	// Each attempt, including the retry after the file was read once, sends every byte
+	if len(received) != 2 || received[0] != size || received[1] != size {
+		t.Errorf("Expected %d bytes on each of 2 attempts, got %v", size, received)
+	}
+	if contentLengths[0] != size || contentLengths[1] != size {
+		t.Errorf("Expected Content-Length %d from stat, got %v", size, contentLengths)
+	}
+}
+
+func TestUploadFirmware_VerifiesReportedDigest(t *testing.T) {
+	tests := []struct {
+		name        string
+		response    string
+		expectError string
+	}{
+		{"no digest reported", `{"filename":"app.bin"}`, ""},
+		{"matching sha256", fmt.Sprintf(`{"filename":"app.bin","sha256":%q}`, strings.ToUpper(testFirmwareSHA256)), ""},
+		{"matching md5", fmt.Sprintf(`{"filename":"app.bin","md5":%q}`, testFirmwareMD5), ""},
+		{"mismatched sha256", `{"filename":"app.bin","sha256":"0000"}`, "SHA-256 mismatch"},
+		{"mismatched md5", `{"filename":"app.bin","md5":"0000"}`, "MD5 mismatch"},
+		{"matching crc32", fmt.Sprintf(`{"filename":"app.bin","crc32":%q}`, strings.ToUpper(testFirmwareCRC32)), ""},
+		{"mismatched crc32", `{"filename":"app.bin","crc32":"00000000"}`, "CRC32 mismatch"},
+	}
+
+	path := writeFirmware(t, "app.bin", []byte("firmware"))
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newStaticServer(t, http.StatusOK, tt.response))
+
+			_, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path)
+			if tt.expectError == "" && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+			if tt.expectError != "" && (err == nil || !strings.Contains(err.Error(), tt.expectError)) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestUploadFirmware_MissingFile(t *testing.T) {
+	client := New()
+
+	_, err := client.UploadFirmware(context.Background(), "test-project", FirmwareTypeHost, "nonexistent-file.bin")
+	if err == nil || !strings.Contains(err.Error(), "failed to read firmware file") {
+		t.Errorf("Expected error about reading file, got: %v", err)
+	}
+}
+
+func TestUploadFirmware_EmptyFile(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	client := New(WithBaseURL(server.URL), WithAccessToken("token"))
+	_, err := client.UploadFirmwareData(context.Background(), "test-project", FirmwareTypeHost, "app.bin", nil)
+	if err == nil || !strings.Contains(err.Error(), "firmware app.bin is empty") {
+		t.Errorf("Expected an empty firmware error, got: %v", err)
+	}
+	if requests != 0 {
+		t.Errorf("Expected no request for empty firmware, got %d", requests)
+	}
+}
+
+func TestUploadAndTriggerDFU_NoToken(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, `{"err":"unauthorized"}`, http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"filename":"app.bin"}`))
+	}))
+	defer server.Close()
+
+	path := writeFirmware(t, "app.bin", []byte("firmware"))
+
+	// Don't authenticate or set an access token
+	client := New(WithBaseURL(server.URL))
+	ctx := context.Background()
+
+	if _, err := client.UploadFirmware(ctx, "test-project", FirmwareTypeHost, path); err == nil {
+		t.Error("Expected upload to fail without access token")
+	}
+	if _, err := client.TriggerDFU(ctx, "test-project", FirmwareTypeHost, url.Values{"deviceUID": {"test-device"}}, "app.bin"); err == nil {
+		t.Error("Expected DFU trigger to fail without access token")
+	}
+}
+
+func TestUploadFirmware_SlowUploadNeedsLongerTimeout(t *testing.T) {
+	// The stub reads the body in small chunks with pauses, like a slow runner uplink,
+	// so the whole transfer takes ~300ms
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1024)
+		for {
+			time.Sleep(30 * time.Millisecond)
+			if _, err := r.Body.Read(buf); err != nil {
+				break
+			}
+		}
+		w.Write([]byte(`{"filename":"big.bin"}`))
+	}))
+	defer server.Close()
+
+	path := writeFirmware(t, "big.bin", make([]byte, 10*1024))
+
+	upload := func(timeout time.Duration) error {
+		client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithTimeout(timeout), WithRetries(0, 0))
+		_, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path)
+		return err
+	}
+
+	if err := upload(100 * time.Millisecond); err == nil {
+		t.Error("Expected a short timeout to cut off the slow upload")
+	}
+	if err := upload(5 * time.Second); err != nil {
+		t.Errorf("Expected a longer timeout to let the slow upload complete, got: %v", err)
+	}
+
+	// An upload timeout replaces the per-request timeout for the upload alone
+	client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithTimeout(100*time.Millisecond), WithUploadTimeout(5*time.Second), WithRetries(0, 0))
+	if _, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path); err != nil {
+		t.Errorf("Expected the upload timeout to let the slow upload complete, got: %v", err)
+	}
+	if client.httpClient.Timeout != 100*time.Millisecond {
+		t.Errorf("Expected other requests to keep the 100ms timeout, got %v", client.httpClient.Timeout)
+	}
+	client = New(WithBaseURL(server.URL), WithAccessToken("token"), WithTimeout(5*time.Second), WithUploadTimeout(100*time.Millisecond), WithRetries(0, 0))
+	if _, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path); err == nil {
+		t.Error("Expected a short upload timeout to cut off the slow upload")
+	}
+}
+
+func TestScaledUploadTimeout(t *testing.T) {
+	const rate = 10 * 1024
+	small := ScaledUploadTimeout(100*1024, rate, 30*time.Second)
+	large := ScaledUploadTimeout(10*1024*1024, rate, 30*time.Second)
+	if small != 40*time.Second {
+		t.Errorf("Expected 100 KB at 10 KB/s to get 30s + 10s, got %s", small)
+	}
+	if large <= small || large != 30*time.Second+1024*time.Second {
+		t.Errorf("Expected the deadline to grow with the file size, got %s for 10 MB", large)
+	}
+	if got := ScaledUploadTimeout(10*1024*1024, 0, 30*time.Second); got != 30*time.Second {
+		t.Errorf("Expected no scaling without a rate, got %s", got)
+	}
+}
+
+func TestUploadFirmware_MinUploadRate(t *testing.T) {
+	// ~300ms for 10 KB, as in TestUploadFirmware_SlowUploadNeedsLongerTimeout
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf := make([]byte, 1024)
+		for {
+			time.Sleep(30 * time.Millisecond)
+			if _, err := r.Body.Read(buf); err != nil {
+				break
+			}
+		}
+		w.Write([]byte(`{"filename":"big.bin"}`))
+	}))
+	defer server.Close()
+
+	path := writeFirmware(t, "big.bin", make([]byte, 10*1024))
+	upload := func(rate int64) error {
+		client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithTimeout(100*time.Millisecond), WithMinUploadRate(rate), WithRetries(0, 0))
+		_, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path)
+		return err
+	}
+
+	// 100ms + 10 KB at 1 KB/s is ample, even though the client timeout alone is not
+	if err := upload(1024); err != nil {
+		t.Errorf("Expected the scaled deadline to let the slow upload complete, got: %v", err)
+	}
+	// 100ms + 10 KB at 1 MB/s is not
+	if err := upload(1024 * 1024); err == nil {
+		t.Error("Expected the scaled deadline to cut off the slow upload")
+	}
+}
+
+func TestListFirmware(t *testing.T) {
+	var gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotQuery = r.URL.RawQuery
+		w.Write([]byte(`[{"filename":"app.bin","type":"host","length":8}]`))
+	}))
+	defer server.Close()
+
+	files, err := newTestClient(server).ListFirmware(context.Background(), "app:123", "", "app.bin")
+	if err != nil || len(files) != 1 || files[0].Filename != "app.bin" {
+		t.Errorf("Expected app.bin to be listed, got %+v, %v", files, err)
+	}
+	if gotQuery != "filename=app.bin&firmwareType=host" {
+		t.Errorf("Unexpected query %s", gotQuery)
+	}
+
+	client := newTestClient(newStaticServer(t, http.StatusForbidden, `{"err":"forbidden"}`))
+	if _, err := client.ListFirmware(context.Background(), "app:123", FirmwareTypeHost, ""); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusOK, `{"filename":"app.bin"}`))
+	if _, err := client.ListFirmware(context.Background(), "app:123", FirmwareTypeHost, ""); err == nil || !strings.Contains(err.Error(), "failed to parse firmware list response") {
+		t.Errorf("Expected parse error, got %v", err)
+	}
+}
+
+func TestDownloadFirmware(t *testing.T) {
+	client := newTestClient(newStaticServer(t, http.StatusOK, "firmware"))
+	data, err := client.DownloadFirmware(context.Background(), "app:123", FirmwareTypeHost, "app.bin")
+	if err != nil || string(data) != "firmware" {
+		t.Errorf("Expected firmware contents, got %q, %v", data, err)
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusNotFound, `{"err":"not found"}`))
+	if _, err := client.DownloadFirmware(context.Background(), "app:123", FirmwareTypeHost, "app.bin"); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
+
+func TestDeleteFirmware(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" || r.URL.Path != "/projects/app:123/firmware/host/app.bin" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+		}
+	}))
+	defer server.Close()
+	if err := newTestClient(server).DeleteFirmware(context.Background(), "app:123", FirmwareTypeHost, "app.bin"); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	client := newTestClient(newStaticServer(t, http.StatusNotFound, `{"err":"not found"}`))
+	if err := client.DeleteFirmware(context.Background(), "app:123", FirmwareTypeHost, "app.bin"); err == nil || !strings.Contains(err.Error(), "status 404") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
+
+func TestCopyFirmware(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expected    string
+		expectError string
+	}{
+		{"success", http.StatusOK, `{"filename":"stable-app.bin"}`, "stable-app.bin", ""},
+		{"success without filename", http.StatusOK, `{}`, "stable-app.bin", ""},
+		{"unsupported", http.StatusMethodNotAllowed, "", "", ErrServerCopyUnsupported.Error()},
+		{"non-2xx", http.StatusForbidden, `{"err":"forbidden"}`, "", "status 403"},
+		{"malformed JSON", http.StatusOK, `{"filename":`, "", "failed to parse copy response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newStaticServer(t, tt.status, tt.body))
+
+			resp, err := client.CopyFirmware(context.Background(), "app:123", FirmwareTypeHost, "beta-app.bin", "stable-app.bin")
+			if tt.expectError == "" {
+				if err != nil || resp.Filename != tt.expected {
+					t.Errorf("Expected %s, got %+v, %v", tt.expected, resp, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+
+	client := newTestClient(newStaticServer(t, http.StatusNotImplemented, ""))
+	if _, err := client.CopyFirmware(context.Background(), "app:123", FirmwareTypeHost, "a.bin", "b.bin"); !errors.Is(err, ErrServerCopyUnsupported) {
+		t.Errorf("Expected ErrServerCopyUnsupported, got %v", err)
+	}
+}
+
+func TestDFUUpdateRequest(t *testing.T) {
+	client := New(WithBaseURL("https://api.example.com/v1"))
+
+	filters := url.Values{"tags": {"production", "beta"}}
+	dfuURL, payload, err := client.DFUUpdateRequest("app:123", "", filters, "app.bin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if dfuURL != "https://api.example.com/v1/projects/app:123/dfu/host/update?tags=production&tags=beta" {
+		t.Errorf("Unexpected DFU URL %s", dfuURL)
+	}
+	if string(payload) != `{"filename":"app.bin"}` {
+		t.Errorf("Unexpected payload %s", payload)
+	}
+
+	if dfuURL, _, _ := client.DFUUpdateRequest("app:123", FirmwareTypeNotecard, nil, "nc.bin"); strings.Contains(dfuURL, "?") {
+		t.Errorf("Expected no query string without filters, got %s", dfuURL)
+	}
+}
+
+func TestTriggerDFU(t *testing.T) {
+	filters := url.Values{"deviceUID": {"dev:1"}}
+
+	client := newTestClient(newStaticServer(t, http.StatusOK, `{"success":true,"message":"update requested","request_id":"dfu:4711","device_count":12}`))
+	resp, err := client.TriggerDFU(context.Background(), "app:123", FirmwareTypeHost, filters, "app.bin")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := DFUResponse{Success: true, Message: "update requested", RequestID: "dfu:4711", DeviceCount: 12}
+	if *resp != expected {
+		t.Errorf("Expected the response to be parsed into %+v, got %+v", expected, *resp)
+	}
+
+	// An empty or unexpected body does not fail a trigger Notehub accepted
+	for _, body := range []string{`{}`, ``, `OK`} {
+		client = newTestClient(newStaticServer(t, http.StatusOK, body))
+		if resp, err := client.TriggerDFU(context.Background(), "app:123", FirmwareTypeHost, filters, "app.bin"); err != nil || *resp != (DFUResponse{}) {
+			t.Errorf("Body %q: expected an empty response, got %+v, %v", body, resp, err)
+		}
+	}
+
+	client = newTestClient(newStaticServer(t, http.StatusBadRequest, `{"err":"no such file"}`))
+	if _, err := client.TriggerDFU(context.Background(), "app:123", FirmwareTypeHost, filters, "app.bin"); err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
+
+func TestScheduleDFU(t *testing.T) {
+	startAt := time.Date(2025, 6, 1, 2, 0, 0, 0, time.FixedZone("CEST", 2*3600))
+
+	var gotPath, gotBody string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotPath, gotBody = r.URL.RequestURI(), string(body)
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	filters := url.Values{"deviceUID": {"dev:1"}}
+	if err := newTestClient(server).ScheduleDFU(context.Background(), "app:123", FirmwareTypeHost, filters, "app.bin", startAt); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotPath != "/projects/app:123/dfu/host/schedule?deviceUID=dev%3A1" {
+		t.Errorf("Unexpected schedule URL %s", gotPath)
+	}
+	if gotBody != `{"filename":"app.bin","start_at":"2025-06-01T00:00:00Z"}` {
+		t.Errorf("Unexpected payload %s", gotBody)
+	}
+
+	for _, status := range []int{http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusNotImplemented} {
+		client := newTestClient(newStaticServer(t, status, ""))
+		if err := client.ScheduleDFU(context.Background(), "app:123", FirmwareTypeHost, filters, "app.bin", startAt); !errors.Is(err, ErrDFUSchedulingUnsupported) {
+			t.Errorf("Status %d: expected ErrDFUSchedulingUnsupported, got %v", status, err)
+		}
+	}
+
+	client := newTestClient(newStaticServer(t, http.StatusBadRequest, `{"err":"start_at is in the past"}`))
+	if err := client.ScheduleDFU(context.Background(), "app:123", FirmwareTypeHost, filters, "app.bin", startAt); err == nil || !strings.Contains(err.Error(), "status 400") {
+		t.Errorf("Expected error for non-2xx response, got %v", err)
+	}
+}
+
+func TestFirmwareType_RoutesEndpoints(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"filename":"nc.bin"}`))
+	}))
+	defer server.Close()
+
+	path := writeFirmware(t, "nc.bin", []byte("notecard firmware"))
+
+	client := newTestClient(server)
+
+	ctx := context.Background()
+	if _, err := client.UploadFirmware(ctx, "app:123", FirmwareTypeNotecard, path); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if _, err := client.TriggerDFU(ctx, "app:123", FirmwareTypeNotecard, url.Values{"deviceUID": {"dev:1"}}, "nc.bin"); err != nil {
+		t.Fatalf("TriggerDFU failed: %v", err)
+	}
+
+	expected := []string{"PUT /projects/app:123/firmware/notecard/nc.bin", "POST /projects/app:123/dfu/notecard/update"}
+	if len(paths) != 2 || paths[0] != expected[0] || paths[1] != expected[1] {
+		t.Errorf("Expected requests %v, got %v", expected, paths)
+	}
+}
+
+func TestCancelDFU(t *testing.T) {
+	var gotRequest string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotRequest = r.Method + " " + r.URL.RequestURI()
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	filters := url.Values{"tags": {"prod"}}
+	if err := newTestClient(server).CancelDFU(context.Background(), "app:123", FirmwareTypeHost, filters); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if gotRequest != "POST /projects/app:123/dfu/host/cancel?tags=prod" {
+		t.Errorf("Unexpected cancel request %s", gotRequest)
+	}
+
+	for status, body := range map[int]string{
+		http.StatusConflict:   `{"err":"nothing to cancel"}`,
+		http.StatusBadRequest: `{"err":"no DFU is pending for the selected devices"}`,
+	} {
+		client := newTestClient(newStaticServer(t, status, body))
+		if err := client.CancelDFU(context.Background(), "app:123", FirmwareTypeHost, filters); !errors.Is(err, ErrNoDFUPending) {
+			t.Errorf("Status %d: expected ErrNoDFUPending, got %v", status, err)
+		}
+	}
+
+	client := newTestClient(newStaticServer(t, http.StatusForbidden, `{"err":"forbidden"}`))
+	if err := client.CancelDFU(context.Background(), "app:123", FirmwareTypeHost, filters); err == nil || errors.Is(err, ErrNoDFUPending) || !strings.Contains(err.Error(), "status 403") {
+		t.Errorf("Expected a plain error for 403, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package notehub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Fleet represents a fleet in a Notehub project
+type Fleet struct {
+	UID   string `json:"uid"`
+	Label string `json:"label"`
+}
+
+// fleetListResponse represents the fleets listing of a project
+type fleetListResponse struct {
+	Fleets []Fleet `json:"fleets"`
+}
+
+// ListFleets returns the fleets of the project
+func (c *Client) ListFleets(ctx context.Context, projectUID string) ([]Fleet, error) {
+	listURL := fmt.Sprintf("%s/projects/%s/fleets", c.baseURL, projectUID)
+
+	resp, err := c.doAPIRequest(ctx, "GET", listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("fleet list request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("fleet list", resp.StatusCode, resp.Body)
+	}
+
+	var listResp fleetListResponse
+	if err := json.Unmarshal(resp.Body, &listResp); err != nil {
+		return nil, fmt.Errorf("failed to parse fleet list response: %w", err)
+	}
+
+	return listResp.Fleets, nil
+}
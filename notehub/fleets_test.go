@@ -0,0 +1,51 @@
+package notehub
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestListFleets(t *testing.T) {
+	var gotPath string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		fmt.Fprint(w, `{"fleets":[{"uid":"fleet:1","label":"Staging"},{"uid":"fleet:2","label":"Production"}]}`)
+	}))
+	defer server.Close()
+
+	fleets, err := newTestClient(server).ListFleets(context.Background(), "app:123")
+	if err != nil {
+		t.Fatalf("ListFleets failed: %v", err)
+	}
+	if gotPath != "/projects/app:123/fleets" {
+		t.Errorf("Unexpected path %s", gotPath)
+	}
+	if len(fleets) != 2 || fleets[1].UID != "fleet:2" || fleets[1].Label != "Production" {
+		t.Errorf("Unexpected fleets %+v", fleets)
+	}
+}
+
+func TestListFleets_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectError string
+	}{
+		{"non-2xx", http.StatusForbidden, `{"err":"forbidden"}`, "status 403"},
+		{"malformed JSON", http.StatusOK, `{"fleets":`, "failed to parse fleet list response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newStaticServer(t, tt.status, tt.body))
+			if _, err := client.ListFleets(context.Background(), "app:123"); err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package notehub
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// WithUploadProgress logs how much of a firmware upload has been sent, at most once per
+// interval, so a long upload of a large image does not look hung. Values <= 0 disable it.
+func WithUploadProgress(interval time.Duration) Option {
+	return func(c *Client) {
+		c.progressEvery = interval
+	}
+}
+
+// progressReader reports how many of total bytes have been read from r, at most once per
+// interval. Nothing is reported for a body read faster than that.
+type progressReader struct {
+	r        io.Reader
+	total    int64
+	sent     int64
+	interval time.Duration
+	now      func() time.Time
+	last     time.Time
+	report   func(sent, total int64)
+}
+
+// newProgressReader returns a progressReader for total bytes of r, starting its interval now
+func newProgressReader(r io.Reader, total int64, interval time.Duration, now func() time.Time, report func(sent, total int64)) *progressReader {
+	return &progressReader{r: r, total: total, interval: interval, now: now, last: now(), report: report}
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.sent += int64(n)
+	if n > 0 {
+		if t := p.now(); t.Sub(p.last) >= p.interval {
+			p.last = t
+			p.report(p.sent, p.total)
+		}
+	}
+	return n, err
+}
+
+// uploadBody returns the body of one upload attempt, reporting its progress through the
+// client's logger when an interval is set
+func (c *Client) uploadBody(body io.Reader, size int64) io.Reader {
+	if c.progressEvery <= 0 {
+		return body
+	}
+	return newProgressReader(body, size, c.progressEvery, time.Now, func(sent, total int64) {
+		c.logger.Printf("  - Uploaded %s of %s (%d%%)", formatBytes(sent), formatBytes(total), sent*100/total)
+	})
+}
+
+// formatBytes formats a byte count for progress messages
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
@@ -0,0 +1,67 @@
+package notehub
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressReader(t *testing.T) {
+	// Each read advances the clock by 4s, so with a 10s interval every third read reports
+	now := time.Unix(0, 0)
+	clock := func() time.Time { return now }
+	var reports []string
+	r := newProgressReader(bytes.NewReader(make([]byte, 1000)), 1000, 10*time.Second, clock, func(sent, total int64) {
+		reports = append(reports, fmt.Sprintf("%d/%d", sent, total))
+	})
+
+	buf := make([]byte, 100)
+	for {
+		now = now.Add(4 * time.Second)
+		if _, err := r.Read(buf); err == io.EOF {
+			break
+		}
+	}
+
+	expected := "300/1000,600/1000,900/1000"
+	if got := strings.Join(reports, ","); got != expected {
+		t.Errorf("Expected progress %s, got %s", expected, got)
+	}
+}
+
+func TestUploadFirmware_LogsProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		fmt.Fprint(w, `{"filename":"app.bin"}`)
+	}))
+	defer server.Close()
+
+	var logged bytes.Buffer
+	logger := log.New(&logged, "", 0)
+	data := make([]byte, 256*1024)
+
+	// A nanosecond interval reports on every read
+	client := New(WithBaseURL(server.URL), WithAccessToken("token"), WithLogger(logger), WithUploadProgress(time.Nanosecond))
+	if _, err := client.UploadFirmwareData(context.Background(), "app:123", FirmwareTypeHost, "app.bin", data); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if !strings.Contains(logged.String(), "  - Uploaded 256.0 KB of 256.0 KB (100%)") {
+		t.Errorf("Expected upload progress in the log, got:\n%s", logged.String())
+	}
+
+	logged.Reset()
+	client = New(WithBaseURL(server.URL), WithAccessToken("token"), WithLogger(logger))
+	if _, err := client.UploadFirmwareData(context.Background(), "app:123", FirmwareTypeHost, "app.bin", data); err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	if strings.Contains(logged.String(), "Uploaded ") {
+		t.Errorf("Expected no progress without an interval, got:\n%s", logged.String())
+	}
+}
@@ -0,0 +1,66 @@
+package notehub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Project represents a Notehub project
+type Project struct {
+	UID   string `json:"uid"`
+	Label string `json:"label,omitempty"`
+}
+
+// GetProject returns the project, confirming it exists and is visible to the client
+func (c *Client) GetProject(ctx context.Context, projectUID string) (*Project, error) {
+	projectURL := fmt.Sprintf("%s/projects/%s", c.baseURL, projectUID)
+
+	resp, err := c.doAPIRequest(ctx, "GET", projectURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("project request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("get project", resp.StatusCode, resp.Body)
+	}
+
+	var project Project
+	if err := json.Unmarshal(resp.Body, &project); err != nil {
+		return nil, fmt.Errorf("failed to parse project response: %w", err)
+	}
+
+	return &project, nil
+}
+
+// Product represents a product in a Notehub project
+type Product struct {
+	UID   string `json:"uid"`
+	Label string `json:"label,omitempty"`
+}
+
+// productListResponse represents the products listing of a project
+type productListResponse struct {
+	Products []Product `json:"products"`
+}
+
+// ListProducts returns the products of the project
+func (c *Client) ListProducts(ctx context.Context, projectUID string) ([]Product, error) {
+	listURL := fmt.Sprintf("%s/projects/%s/products", c.baseURL, projectUID)
+
+	resp, err := c.doAPIRequest(ctx, "GET", listURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("product list request failed: %w", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, c.statusError("product list", resp.StatusCode, resp.Body)
+	}
+
+	var listResp productListResponse
+	if err := json.Unmarshal(resp.Body, &listResp); err != nil {
+		return nil, fmt.Errorf("failed to parse product list response: %w", err)
+	}
+
+	return listResp.Products, nil
+}
@@ -0,0 +1,68 @@
+package notehub
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestGetProject(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectError string
+	}{
+		{"success", http.StatusOK, `{"uid":"app:123","label":"Fleet"}`, ""},
+		{"non-2xx", http.StatusNotFound, `{"err":"project not found"}`, "status 404"},
+		{"malformed JSON", http.StatusOK, `{"uid":`, "failed to parse project response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newStaticServer(t, tt.status, tt.body))
+
+			project, err := client.GetProject(context.Background(), "app:123")
+			if tt.expectError == "" {
+				if err != nil || project.Label != "Fleet" {
+					t.Errorf("Expected project Fleet, got %+v, %v", project, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestListProducts(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		expectError string
+	}{
+		{"success", http.StatusOK, `{"products":[{"uid":"com.example:sensor","label":"Sensor"}]}`, ""},
+		{"non-2xx", http.StatusForbidden, `{"err":"forbidden"}`, "status 403"},
+		{"malformed JSON", http.StatusOK, `{"products":`, "failed to parse product list response"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(newStaticServer(t, tt.status, tt.body))
+
+			products, err := client.ListProducts(context.Background(), "app:123")
+			if tt.expectError == "" {
+				if err != nil || len(products) != 1 || products[0].UID != "com.example:sensor" || products[0].Label != "Sensor" {
+					t.Errorf("Expected the Sensor product, got %+v, %v", products, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
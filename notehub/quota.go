@@ -0,0 +1,67 @@
+package notehub
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// QuotaError is returned when an upload is rejected because the project's firmware
+// storage is full. Used and Limit are in bytes, and zero when Notehub does not report them.
+type QuotaError struct {
+	StatusCode int
+	Used       int64
+	Limit      int64
+	Message    string
+}
+
+func (e *QuotaError) Error() string {
+	msg := fmt.Sprintf("project firmware storage quota exceeded (status %d)", e.StatusCode)
+	if e.Limit > 0 {
+		msg += fmt.Sprintf(", %d of %d bytes used", e.Used, e.Limit)
+	}
+	return msg + ": " + e.Message
+}
+
+// quotaStatuses are the statuses Notehub may use to reject an upload for lack of storage.
+// Most are also used for unrelated failures, so the body must mention the quota too.
+var quotaStatuses = map[int]bool{
+	http.StatusForbidden:             true,
+	http.StatusConflict:              true,
+	http.StatusRequestEntityTooLarge: true,
+	http.StatusUnprocessableEntity:   true,
+	http.StatusInsufficientStorage:   true,
+}
+
+// quotaPhrases identify a quota failure in a response body
+var quotaPhrases = []string{"quota", "storage limit", "storage full", "insufficient storage"}
+
+// classifyQuotaError returns a QuotaError when an upload response indicates the storage
+// quota was exceeded, and nil otherwise
+func (c *Client) classifyQuotaError(status int, body []byte) *QuotaError {
+	if !quotaStatuses[status] {
+		return nil
+	}
+	lower := strings.ToLower(string(body))
+	matched := status == http.StatusInsufficientStorage
+	for _, phrase := range quotaPhrases {
+		if strings.Contains(lower, phrase) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return nil
+	}
+
+	qerr := &QuotaError{StatusCode: status, Message: c.scrub(body)}
+	var usage struct {
+		Used  int64 `json:"used"`
+		Limit int64 `json:"limit"`
+	}
+	if json.Unmarshal(body, &usage) == nil {
+		qerr.Used, qerr.Limit = usage.Used, usage.Limit
+	}
+	return qerr
+}
@@ -0,0 +1,54 @@
+package notehub
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClassifyQuotaError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		quota  bool
+		used   int64
+		limit  int64
+	}{
+		{"insufficient storage", http.StatusInsufficientStorage, "", true, 0, 0},
+		{"quota with usage", http.StatusForbidden, `{"err":"firmware storage quota exceeded","used":900,"limit":1000}`, true, 900, 1000},
+		{"storage limit", http.StatusRequestEntityTooLarge, `{"err":"project storage limit reached"}`, true, 0, 0},
+		{"unrelated forbidden", http.StatusForbidden, `{"err":"forbidden"}`, false, 0, 0},
+		{"file too large", http.StatusRequestEntityTooLarge, `{"err":"file too large"}`, false, 0, 0},
+		{"quota on other status", http.StatusBadRequest, `{"err":"quota"}`, false, 0, 0},
+	}
+
+	client := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			qerr := client.classifyQuotaError(tt.status, []byte(tt.body))
+			if (qerr != nil) != tt.quota {
+				t.Fatalf("Expected quota error %t, got %v", tt.quota, qerr)
+			}
+			if qerr != nil && (qerr.Used != tt.used || qerr.Limit != tt.limit) {
+				t.Errorf("Expected %d of %d bytes used, got %d of %d", tt.used, tt.limit, qerr.Used, qerr.Limit)
+			}
+		})
+	}
+}
+
+func TestUploadFirmware_QuotaExceeded(t *testing.T) {
+	path := writeFirmware(t, "app.bin", []byte("firmware"))
+	client := newTestClient(newStaticServer(t, http.StatusForbidden, `{"err":"quota exceeded","used":1000,"limit":1000}`))
+
+	_, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path)
+	var qerr *QuotaError
+	if !errors.As(err, &qerr) {
+		t.Fatalf("Expected a QuotaError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "1000 of 1000 bytes used") {
+		t.Errorf("Expected the usage in the error, got %v", err)
+	}
+}
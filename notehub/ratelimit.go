@@ -0,0 +1,233 @@
+package notehub
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultMaxRateLimitWait is how long the action waits out Notehub's rate limit for one
+// request before giving up
+const DefaultMaxRateLimitWait = 5 * time.Minute
+
+// lowRateLimitRemaining is the number of requests left in Notehub's rate limit window at
+// or below which the client starts spacing out its requests. It also does so once a tenth
+// or less of the limit is left, when the limit is reported.
+const lowRateLimitRemaining = 5
+
+// unixTimeThreshold separates X-RateLimit-Reset values that are a Unix time from those that
+// are seconds to wait: a reset more than ten years away is taken to be a timestamp
+const unixTimeThreshold = 10 * 365 * 24 * 60 * 60
+
+// ErrRateLimited is matched, with errors.Is, by the error a request returns when Notehub
+// kept rate limiting it for longer than the client is willing to wait
+var ErrRateLimited = errors.New("Notehub rate limit")
+
+// RateLimitError is returned when waiting out a 429 would exceed the client's maximum
+// rate limit wait or the request's deadline. Waited is how long the request had already
+// waited, Wait how much longer Notehub asked for, and ResetAt when that wait would end.
+// Backoff is set when the client does not wait out rate limits, so MaxWait is the longest
+// retry backoff instead.
+type RateLimitError struct {
+	Method   string
+	Path     string
+	Waited   time.Duration
+	Wait     time.Duration
+	MaxWait  time.Duration
+	ResetAt  time.Time
+	Deadline bool
+	Backoff  bool
+}
+
+func (e *RateLimitError) Error() string {
+	limit := fmt.Sprintf("max_rate_limit_wait (%s)", e.MaxWait)
+	switch {
+	case e.Deadline:
+		limit = "the deployment's deadline"
+	case e.Backoff:
+		limit = fmt.Sprintf("the longest retry backoff (%s)", e.MaxWait)
+	}
+	var waited, reset string
+	if e.Waited > 0 {
+		waited = fmt.Sprintf(" after waiting %s", e.Waited.Round(time.Second))
+	}
+	if !e.ResetAt.IsZero() {
+		reset = fmt.Sprintf(" (the limit resets at %s)", e.ResetAt.UTC().Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%v: %s %s was asked to wait %s more%s%s, which would exceed %s; run fewer deployments at once or raise max_rate_limit_wait",
+		ErrRateLimited, e.Method, e.Path, e.Wait.Round(time.Second), waited, reset, limit)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return ErrRateLimited
+}
+
+// WithMaxRateLimitWait makes the client wait out 429 responses, for as long as Notehub
+// asks, without counting them as retries, until a request has waited maxWait in total.
+// Values <= 0 leave 429s to the normal retry limit.
+func WithMaxRateLimitWait(maxWait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRateLimitWait = maxWait
+	}
+}
+
+// waitOutRateLimit sleeps for delay before req is repeated after a 429, adding it to
+// waited, unless that would take the request's total wait past the client's maximum or
+// outlast the context's deadline
+func (c *Client) waitOutRateLimit(ctx context.Context, req *http.Request, delay time.Duration, source string, waited *time.Duration) error {
+	limitErr := &RateLimitError{Method: req.Method, Path: req.URL.Path, Waited: *waited, Wait: delay,
+		MaxWait: c.maxRateLimitWait, ResetAt: time.Now().Add(delay)}
+	if *waited+delay > c.maxRateLimitWait {
+		return limitErr
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Now().Add(delay).After(deadline) {
+		limitErr.Deadline = true
+		return limitErr
+	}
+	*waited += delay
+
+	c.logger.Printf("  - Notehub rate limited %s %s (status 429); waiting %s per %s before repeating it",
+		req.Method, req.URL.Path, delay.Round(time.Millisecond), source)
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("request cancelled while waiting out the rate limit: %w", ctx.Err())
+	case <-time.After(delay):
+	}
+	return nil
+}
+
+// rateLimitDelay returns how long a 429 response asks the client to wait and the header
+// that said so: Retry-After, or else X-RateLimit-Reset or RateLimit-Reset, which hold
+// either the seconds until the limit resets or the Unix time it resets at
+func rateLimitDelay(h http.Header, now time.Time) (time.Duration, string, bool) {
+	if d, ok := parseRetryAfter(h.Get("Retry-After"), now); ok {
+		return d, "Retry-After", true
+	}
+	return rateLimitReset(h, now)
+}
+
+// rateLimitReset returns how long until the rate limit resets, from an X-RateLimit-Reset
+// or RateLimit-Reset header, and the header that said so
+func rateLimitReset(h http.Header, now time.Time) (time.Duration, string, bool) {
+	for _, name := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		secs, err := strconv.ParseInt(strings.TrimSpace(h.Get(name)), 10, 64)
+		if err != nil || secs < 0 {
+			continue
+		}
+		if secs > unixTimeThreshold {
+			d := time.Unix(secs, 0).Sub(now)
+			if d < 0 {
+				d = 0
+			}
+			return d, name, true
+		}
+		return time.Duration(secs) * time.Second, name, true
+	}
+	return 0, "", false
+}
+
+// rateLimitBudget is what the last response's rate limit headers said about the requests
+// left in the current window. Limit is 0 when not reported, and resetAt zero when the
+// reset time is unknown. The zero value, with reported false, is no budget seen yet.
+type rateLimitBudget struct {
+	reported  bool
+	remaining int
+	limit     int
+	resetAt   time.Time
+}
+
+// low reports whether few enough requests are left that later ones should be spaced out
+func (b rateLimitBudget) low() bool {
+	return b.remaining <= lowRateLimitRemaining || (b.limit > 0 && b.remaining <= b.limit/10)
+}
+
+// parseRateLimitBudget reads the X-RateLimit-Remaining and X-RateLimit-Limit headers, or
+// their unprefixed RateLimit- forms, that Notehub sends with every response
+func parseRateLimitBudget(h http.Header, now time.Time) (rateLimitBudget, bool) {
+	header := func(name string) (int, bool) {
+		for _, prefix := range []string{"X-", ""} {
+			if n, err := strconv.Atoi(strings.TrimSpace(h.Get(prefix + name))); err == nil && n >= 0 {
+				return n, true
+			}
+		}
+		return 0, false
+	}
+
+	remaining, ok := header("RateLimit-Remaining")
+	if !ok {
+		return rateLimitBudget{}, false
+	}
+	budget := rateLimitBudget{reported: true, remaining: remaining}
+	budget.limit, _ = header("RateLimit-Limit")
+	if reset, _, ok := rateLimitReset(h, now); ok {
+		budget.resetAt = now.Add(reset)
+	}
+	return budget, true
+}
+
+// observeRateLimit records the rate limit budget reported by a response, or that it
+// reported none, logging it when the logger takes debug messages
+func (c *Client) observeRateLimit(req *http.Request, resp *http.Response) {
+	now := time.Now()
+	budget, ok := parseRateLimitBudget(resp.Header, now)
+	if debug, isDebug := c.logger.(debugLogger); ok && isDebug {
+		limit, reset := "", ""
+		if budget.limit > 0 {
+			limit = fmt.Sprintf(" of %d", budget.limit)
+		}
+		if !budget.resetAt.IsZero() {
+			reset = fmt.Sprintf(", resetting in %s", budget.resetAt.Sub(now).Round(time.Second))
+		}
+		debug.Debugf("Notehub rate limit after %s %s: %d%s requests remaining%s", req.Method, req.URL.Path, budget.remaining, limit, reset)
+	}
+
+	c.mu.Lock()
+	c.rateLimit = budget
+	c.mu.Unlock()
+}
+
+// paceRequest delays req when the last response said the rate limit is nearly used up,
+// spreading the requests left over the time until it resets so the client slows down
+// instead of running into 429s. Without a reset time each request waits the retry base
+// delay. No single delay is longer than the maximum rate limit wait, when one is set, or
+// else the longest retry backoff.
+func (c *Client) paceRequest(ctx context.Context, req *http.Request) error {
+	c.mu.Lock()
+	budget := c.rateLimit
+	c.mu.Unlock()
+	if !budget.reported || !budget.low() {
+		return nil
+	}
+
+	delay := c.retryBaseDelay
+	if !budget.resetAt.IsZero() {
+		untilReset := time.Until(budget.resetAt)
+		if untilReset <= 0 {
+			return nil
+		}
+		delay = untilReset / time.Duration(budget.remaining+1)
+	}
+	maxDelay := maxRetryDelay
+	if c.maxRateLimitWait > 0 {
+		maxDelay = c.maxRateLimitWait
+	}
+	if delay > maxDelay {
+		delay = maxDelay
+	}
+	if delay <= 0 {
+		return nil
+	}
+
+	c.logger.Printf("  - Notehub rate limit nearly used up (%d requests remaining), waiting %s before %s %s",
+		budget.remaining, delay.Round(time.Millisecond), req.Method, req.URL.Path)
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("request cancelled while slowing down for the rate limit: %w", ctx.Err())
+	case <-time.After(delay):
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package notehub
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRateLimitDelay(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		headers        map[string]string
+		expected       time.Duration
+		expectedSource string
+		ok             bool
+	}{
+		{"retry after seconds", map[string]string{"Retry-After": "7"}, 7 * time.Second, "Retry-After", true},
+		{"retry after wins", map[string]string{"Retry-After": "7", "X-RateLimit-Reset": "30"}, 7 * time.Second, "Retry-After", true},
+		{"reset seconds", map[string]string{"X-RateLimit-Reset": "30"}, 30 * time.Second, "X-RateLimit-Reset", true},
+		{"reset unix time", map[string]string{"X-RateLimit-Reset": strconv.FormatInt(now.Add(90*time.Second).Unix(), 10)}, 90 * time.Second, "X-RateLimit-Reset", true},
+		{"reset in the past", map[string]string{"X-RateLimit-Reset": strconv.FormatInt(now.Add(-time.Minute).Unix(), 10)}, 0, "X-RateLimit-Reset", true},
+		{"standard reset", map[string]string{"RateLimit-Reset": "12"}, 12 * time.Second, "RateLimit-Reset", true},
+		{"unparseable", map[string]string{"X-RateLimit-Reset": "soon"}, 0, "", false},
+		{"none", nil, 0, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			got, source, ok := rateLimitDelay(h, now)
+			if got != tt.expected || source != tt.expectedSource || ok != tt.ok {
+				t.Errorf("rateLimitDelay(%v) = %v, %q, %v; expected %v, %q, %v", tt.headers, got, source, ok, tt.expected, tt.expectedSource, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDoWithRetry_WaitsOutRateLimit(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&requests, 1) {
+		case 1:
+			w.Header().Set("X-RateLimit-Reset", "1")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		case 2:
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		default:
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	var logged bytes.Buffer
+	var outcome RequestOutcome
+	client := New(WithRetries(0, time.Millisecond), WithMaxRateLimitWait(time.Minute),
+		WithLogger(log.New(&logged, "", 0)), WithRequestObserver(func(o RequestOutcome) { outcome = o }))
+
+	started := time.Now()
+	resp, err := client.doAPIRequest(context.Background(), "GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("Expected the rate limit to be waited out despite max_retries 0, got %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || atomic.LoadInt32(&requests) != 3 {
+		t.Errorf("Expected success on the third request, got status %d after %d", resp.StatusCode, requests)
+	}
+	if waited := time.Since(started); waited < time.Second {
+		t.Errorf("Expected a 1s wait per X-RateLimit-Reset, waited %v", waited)
+	}
+	for _, want := range []string{"waiting 1s per X-RateLimit-Reset", "per backoff"} {
+		if !strings.Contains(logged.String(), want) {
+			t.Errorf("Expected %q in the log:\n%s", want, logged.String())
+		}
+	}
+	if outcome.Attempts != 3 {
+		t.Errorf("Expected the request observer to see 3 attempts, got %d", outcome.Attempts)
+	}
+}
+
+func TestDoWithRetry_RateLimitWaitExceeded(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		expectDetail string
+	}{
+		{"max wait", 0, "max_rate_limit_wait (1m0s)"},
+		{"deadline", time.Second, "the deployment's deadline"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.Header().Set("Retry-After", "90")
+				http.Error(w, "rate limited", http.StatusTooManyRequests)
+			}))
+			defer server.Close()
+
+			maxWait := time.Minute
+			if tt.timeout > 0 {
+				maxWait = time.Hour
+			}
+			ctx := context.Background()
+			if tt.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.timeout)
+				defer cancel()
+			}
+			client := New(WithRetries(DefaultMaxRetries, time.Millisecond), WithMaxRateLimitWait(maxWait))
+
+			_, err := client.doAPIRequest(ctx, "GET", server.URL, nil)
+			if !errors.Is(err, ErrRateLimited) {
+				t.Fatalf("Expected a rate limit error, got %v", err)
+			}
+			var rateErr *RateLimitError
+			if !errors.As(err, &rateErr) || rateErr.Wait != 90*time.Second {
+				t.Errorf("Expected the requested 90s wait in the error, got %v", err)
+			}
+			if !strings.Contains(err.Error(), tt.expectDetail) {
+				t.Errorf("Expected %q in %v", tt.expectDetail, err)
+			}
+			if n := atomic.LoadInt32(&requests); n != 1 {
+				t.Errorf("Expected no repeat once the wait was refused, got %d requests", n)
+			}
+		})
+	}
+}
+
+func TestDoWithRetry_RateLimitOverBackoffFailsFast(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Header().Set("X-RateLimit-Reset", "3600")
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+
+	// Without a rate limit wait, a 429 is retried like any other failure, up to the backoff cap
+	client := New(WithRetries(DefaultMaxRetries, time.Millisecond), WithMaxRateLimitWait(0))
+
+	start := time.Now()
+	_, err := client.doAPIRequest(context.Background(), "GET", server.URL, nil)
+	if !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected a rate limit error, got %v", err)
+	}
+	var rateErr *RateLimitError
+	if !errors.As(err, &rateErr) || rateErr.Wait != time.Hour || rateErr.MaxWait != maxRetryDelay {
+		t.Errorf("Expected the hour's wait against the %s backoff cap, got %v", maxRetryDelay, err)
+	}
+	if rateErr != nil && rateErr.ResetAt.Sub(start) < time.Hour {
+		t.Errorf("Expected the reset an hour out, got %s", rateErr.ResetAt)
+	}
+	for _, detail := range []string{"the longest retry backoff (30s)", "the limit resets at"} {
+		if !strings.Contains(err.Error(), detail) {
+			t.Errorf("Expected %q in %v", detail, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != 1 {
+		t.Errorf("Expected no retry once the wait was refused, got %d requests", n)
+	}
+}
+
+func TestParseRateLimitBudget(t *testing.T) {
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		headers  map[string]string
+		expected rateLimitBudget
+		ok       bool
+		low      bool
+	}{
+		{"plenty left", map[string]string{"X-RateLimit-Remaining": "900", "X-RateLimit-Limit": "1000", "X-RateLimit-Reset": "60"},
+			rateLimitBudget{reported: true, remaining: 900, limit: 1000, resetAt: now.Add(time.Minute)}, true, false},
+		{"tenth of the limit", map[string]string{"X-RateLimit-Remaining": "100", "X-RateLimit-Limit": "1000"},
+			rateLimitBudget{reported: true, remaining: 100, limit: 1000}, true, true},
+		{"few left without limit", map[string]string{"RateLimit-Remaining": "3"},
+			rateLimitBudget{reported: true, remaining: 3}, true, true},
+		{"unparseable", map[string]string{"X-RateLimit-Remaining": "lots"}, rateLimitBudget{}, false, false},
+		{"none", nil, rateLimitBudget{}, false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			for k, v := range tt.headers {
+				h.Set(k, v)
+			}
+			got, ok := parseRateLimitBudget(h, now)
+			if got != tt.expected || ok != tt.ok {
+				t.Errorf("parseRateLimitBudget(%v) = %+v, %v; expected %+v, %v", tt.headers, got, ok, tt.expected, tt.ok)
+			}
+			if ok && got.low() != tt.low {
+				t.Errorf("Expected low %t for %+v", tt.low, got)
+			}
+		})
+	}
+}
+
+// debugRecorder is a Logger that also takes debug messages
+type debugRecorder struct {
+	messages, debug []string
+}
+
+func (r *debugRecorder) Printf(format string, args ...any) {
+	r.messages = append(r.messages, fmt.Sprintf(format, args...))
+}
+
+func (r *debugRecorder) Debugf(format string, args ...any) {
+	r.debug = append(r.debug, fmt.Sprintf(format, args...))
+}
+
+func TestDoWithRetry_SlowsDownWhenBudgetIsLow(t *testing.T) {
+	tests := []struct {
+		name        string
+		remaining   string
+		maxWait     time.Duration
+		expectPaced bool
+	}{
+		{"near-zero budget", "0", time.Minute, true},
+		{"plenty left", "500", time.Minute, false},
+		{"paced without max_rate_limit_wait", "0", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-RateLimit-Remaining", tt.remaining)
+				w.Header().Set("X-RateLimit-Limit", "1000")
+				w.Header().Set("X-RateLimit-Reset", "1")
+				w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			logged := &debugRecorder{}
+			client := New(WithMaxRateLimitWait(tt.maxWait), WithLogger(logged))
+
+			if _, err := client.doAPIRequest(context.Background(), "GET", server.URL, nil); err != nil {
+				t.Fatalf("First request failed: %v", err)
+			}
+			started := time.Now()
+			if _, err := client.doAPIRequest(context.Background(), "GET", server.URL, nil); err != nil {
+				t.Fatalf("Second request failed: %v", err)
+			}
+			waited := time.Since(started)
+
+			if tt.expectPaced && waited < 500*time.Millisecond {
+				t.Errorf("Expected the second request to wait for the reset, it took %v", waited)
+			}
+			if !tt.expectPaced && waited >= 500*time.Millisecond {
+				t.Errorf("Expected the second request to go straight out, it took %v", waited)
+			}
+			paced := strings.Contains(strings.Join(logged.messages, "\n"), "rate limit nearly used up")
+			if paced != tt.expectPaced {
+				t.Errorf("Expected the slowdown logged %t, got %v", tt.expectPaced, logged.messages)
+			}
+			if len(logged.debug) != 2 || !strings.Contains(logged.debug[0], tt.remaining+" of 1000 requests remaining") {
+				t.Errorf("Expected the remaining budget logged at debug level after each request, got %v", logged.debug)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package notehub
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of retries after the initial attempt
+	DefaultMaxRetries = 3
+
+	// DefaultRetryBaseDelay is the backoff before the first retry
+	DefaultRetryBaseDelay = time.Second
+
+	// maxRetryDelay caps the backoff between attempts
+	maxRetryDelay = 30 * time.Second
+)
+
+// isRetryableStatus reports whether a response status indicates a transient failure. A
+// full storage quota is not transient, so 507 is not retried.
+func isRetryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || (status >= 500 && status != http.StatusInsufficientStorage)
+}
+
+// retryDelay returns the jittered exponential backoff before retry number attempt (0-based),
+// drawing the jitter from rng
+func retryDelay(rng *rand.Rand, base time.Duration, attempt int) time.Duration {
+	delay := base << attempt
+	if delay <= 0 || delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	// Pick uniformly from [delay/2, delay] so concurrent runs don't retry in lockstep
+	half := delay / 2
+	return half + time.Duration(rng.Int63n(int64(half)+1))
+}
+
+// parseRetryAfter parses a Retry-After header in either its delay-seconds or HTTP-date form
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0, false
+		}
+		return time.Duration(secs) * time.Second, true
+	}
+
+	if t, err := http.ParseTime(value); err == nil {
+		d := t.Sub(now)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+
+	return 0, false
+}
+
+// RequestOutcome describes a finished API request: how many attempts it took and how the
+// last one ended. StatusCode is 0 when the last attempt got no response.
+type RequestOutcome struct {
+	Method     string
+	Path       string
+	Attempts   int
+	StatusCode int
+	Err        error
+}
+
+// Retried reports whether the request needed more than one attempt
+func (o RequestOutcome) Retried() bool {
+	return o.Attempts > 1
+}
+
+// Failed reports whether the request ended without a successful response
+func (o RequestOutcome) Failed() bool {
+	return o.Err != nil || o.StatusCode < 200 || o.StatusCode >= 300
+}
+
+// doWithRetry executes the request returned by newRequest, retrying on connection errors and
+// on 429/5xx responses with exponential backoff. A 429 carrying a Retry-After or rate limit
+// reset header waits for the duration the server asked for instead. With a maximum rate
+// limit wait set, 429s are waited out without counting as retries, until the request has
+// waited that long in total or would outlast ctx's deadline. newRequest is called for every attempt so
+// that request bodies are rebuilt from the start each time.
+//
+// All callers are safe to repeat: the OAuth2 token exchange and reads have no side effects,
+// the firmware PUT replaces the file with identical content, and the DFU POST sets the
+// desired firmware for the targeted devices, so a repeated trigger leaves the same state.
+//
+// A 401 for a request authorized with a refreshable token re-authenticates and repeats the
+// request once, without counting as a retry, so a token revoked mid-run does not fail
+// every later call.
+//
+// The final response is returned unread even if its status is retryable, so callers can
+// report the body of the last failure.
+func (c *Client) doWithRetry(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	return c.doWithRetryUsing(ctx, c.httpClient, newRequest)
+}
+
+// doWithRetryUsing is doWithRetry sending each attempt with httpClient, e.g. one whose
+// timeout suits a firmware upload
+func (c *Client) doWithRetryUsing(ctx context.Context, httpClient *http.Client, newRequest func() (*http.Request, error)) (finalResp *http.Response, finalErr error) {
+	var outcome RequestOutcome
+	if c.onRequest != nil {
+		defer func() {
+			if outcome.Attempts == 0 {
+				return
+			}
+			outcome.Err = finalErr
+			if finalResp != nil {
+				outcome.StatusCode = finalResp.StatusCode
+			}
+			c.onRequest(outcome)
+		}()
+	}
+
+	refreshed := false
+	rateLimited := 0
+	var rateLimitWaited time.Duration
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := c.paceRequest(ctx, req); err != nil {
+			return nil, err
+		}
+		resp, err := httpClient.Do(req)
+		if err != nil {
+			c.scrubURLError(err)
+		} else {
+			c.observeRateLimit(req, resp)
+		}
+		outcome = RequestOutcome{Method: req.Method, Path: req.URL.Path, Attempts: attempt + rateLimited + 1}
+		if err == nil && resp.StatusCode == http.StatusUnauthorized && !refreshed {
+			if token, ok := c.canRefreshToken(req); ok {
+				refreshed = true
+				io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+
+				c.logger.Printf("  - %s %s was rejected with status 401, refreshing the OAuth2 token and repeating it", req.Method, req.URL.Path)
+				if err := c.refreshRejectedToken(ctx, token); err != nil {
+					return nil, err
+				}
+				attempt--
+				continue
+			}
+		}
+		if err == nil && !isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if err == nil && resp.StatusCode == http.StatusTooManyRequests && c.maxRateLimitWait > 0 {
+			delay, source, ok := rateLimitDelay(resp.Header, time.Now())
+			if !ok || delay <= 0 {
+				delay, source = retryDelay(c.rng, c.retryBaseDelay, rateLimited), "backoff"
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+
+			if err := c.waitOutRateLimit(ctx, req, delay, source, &rateLimitWaited); err != nil {
+				return nil, err
+			}
+			rateLimited++
+			attempt--
+			continue
+		}
+		if attempt >= c.maxRetries || ctx.Err() != nil {
+			return resp, err
+		}
+
+		var reason string
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = fmt.Sprintf("status %d", resp.StatusCode)
+
+			// Drain so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		delay := retryDelay(c.rng, c.retryBaseDelay, attempt)
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			if after, _, ok := rateLimitDelay(resp.Header, time.Now()); ok {
+				// A wait past the cap fails now rather than holding the run until the reset
+				maxDelay := c.maxRateLimitWait
+				if maxDelay <= 0 {
+					maxDelay = maxRetryDelay
+				}
+				if after > maxDelay {
+					return nil, &RateLimitError{Method: req.Method, Path: req.URL.Path, Wait: after, MaxWait: maxDelay,
+						ResetAt: time.Now().Add(after), Backoff: c.maxRateLimitWait <= 0}
+				}
+				delay = after
+			}
+		}
+		c.logger.Printf("  - Attempt %d/%d for %s %s failed (%s), retrying in %s",
+			attempt+1, c.maxRetries+1, req.Method, req.URL.Path, reason, delay.Round(time.Millisecond))
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("request cancelled while waiting to retry: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package notehub
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryDelay(t *testing.T) {
+	rng := NewRand(1)
+	base := 100 * time.Millisecond
+	for attempt := 0; attempt < 4; attempt++ {
+		max := base << attempt
+		for i := 0; i < 20; i++ {
+			d := retryDelay(rng, base, attempt)
+			if d < max/2 || d > max {
+				t.Errorf("attempt %d: delay %v outside [%v, %v]", attempt, d, max/2, max)
+			}
+		}
+	}
+
+	if d := retryDelay(rng, time.Second, 20); d > maxRetryDelay {
+		t.Errorf("Expected delay to be capped at %v, got %v", maxRetryDelay, d)
+	}
+}
+
+func TestRetryDelay_DeterministicForSeed(t *testing.T) {
+	delays := func(seed int64) []time.Duration {
+		rng := NewRand(seed)
+		var delays []time.Duration
+		for attempt := 0; attempt < 5; attempt++ {
+			delays = append(delays, retryDelay(rng, time.Second, attempt))
+		}
+		return delays
+	}
+
+	if a, b := delays(42), delays(42); !reflect.DeepEqual(a, b) {
+		t.Errorf("Expected the same seed to give the same backoff, got %v and %v", a, b)
+	}
+	if a, b := delays(42), delays(43); reflect.DeepEqual(a, b) {
+		t.Errorf("Expected different seeds to give different backoff, got %v for both", a)
+	}
+}
+
+func TestUploadFirmware_RetriesTransientFailures(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if string(body) != "firmware bytes" {
+			t.Errorf("Attempt received incomplete body %q", body)
+		}
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"filename":"app.bin"}`))
+	}))
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "app.bin")
+	if err := os.WriteFile(path, []byte("firmware bytes"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	client := New(WithBaseURL(server.URL), WithRetries(DefaultMaxRetries, time.Millisecond))
+
+	resp, err := client.UploadFirmware(context.Background(), "app:123", FirmwareTypeHost, path)
+	if err != nil {
+		t.Fatalf("Expected upload to succeed after retries, got: %v", err)
+	}
+	if resp.Filename != "app.bin" {
+		t.Errorf("Expected filename app.bin, got %s", resp.Filename)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestDoWithRetry_LogsAttemptAndStatus(t *testing.T) {
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	client := New(WithRetries(DefaultMaxRetries, time.Millisecond))
+
+	if _, err := client.doAPIRequest(context.Background(), "GET", server.URL+"/projects/app:123/devices", nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !strings.Contains(logs.String(), "Attempt 1/4 for GET /projects/app:123/devices failed (status 429)") {
+		t.Errorf("Expected retry log with attempt number and status, got: %s", logs.String())
+	}
+}
+
+func TestDoWithRetry_GivesUpAfterMaxRetries(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		http.Error(w, "bad gateway", http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client := New(WithBaseURL(server.URL), WithRetries(2, time.Millisecond))
+
+	resp, err := client.doAPIRequest(context.Background(), "GET", server.URL+"/projects/app:123/devices", nil)
+	if err != nil {
+		t.Fatalf("Expected final response to be returned, got error: %v", err)
+	}
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("Expected final status 502, got %d", resp.StatusCode)
+	}
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Errorf("Expected 3 attempts, got %d", n)
+	}
+}
+
+func TestDoWithRetry_ReportsOutcome(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/flaky" && atomic.AddInt32(&attempts, 1) <= 2 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.URL.Path == "/down" {
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	var outcomes []RequestOutcome
+	client := New(WithRetries(2, time.Millisecond), WithRequestObserver(func(o RequestOutcome) {
+		outcomes = append(outcomes, o)
+	}))
+	for _, path := range []string{"/ok", "/flaky", "/down"} {
+		if _, err := client.doAPIRequest(context.Background(), "GET", server.URL+path, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	expected := []RequestOutcome{
+		{Method: "GET", Path: "/ok", Attempts: 1, StatusCode: http.StatusOK},
+		{Method: "GET", Path: "/flaky", Attempts: 3, StatusCode: http.StatusOK},
+		{Method: "GET", Path: "/down", Attempts: 3, StatusCode: http.StatusBadGateway},
+	}
+	if !reflect.DeepEqual(outcomes, expected) {
+		t.Fatalf("Expected outcomes %+v, got %+v", expected, outcomes)
+	}
+	if outcomes[0].Retried() || !outcomes[1].Retried() || outcomes[1].Failed() || !outcomes[2].Failed() {
+		t.Errorf("Unexpected Retried/Failed for %+v", outcomes)
+	}
+}
+
+func TestDoWithRetry_DoesNotRetryClientErrors(t *testing.T) {
+	for _, status := range []int{http.StatusForbidden, http.StatusInsufficientStorage} {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&attempts, 1)
+			http.Error(w, http.StatusText(status), status)
+		}))
+
+		client := New(WithRetries(DefaultMaxRetries, time.Millisecond))
+
+		if _, err := client.doAPIRequest(context.Background(), "GET", server.URL, nil); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if n := atomic.LoadInt32(&attempts); n != 1 {
+			t.Errorf("Expected a single attempt for a %d, got %d", status, n)
+		}
+		server.Close()
+	}
+}
+
+func TestDoWithRetry_HonorsCancellation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client := New(WithRetries(DefaultMaxRetries, 10*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.doAPIRequest(ctx, "GET", server.URL, nil); err == nil {
+		t.Error("Expected cancellation error")
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("Retry backoff did not stop on context cancellation")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name     string
+		value    string
+		expected time.Duration
+		ok       bool
+	}{
+		{"seconds", "2", 2 * time.Second, true},
+		{"zero seconds", "0", 0, true},
+		{"http date", now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{"http date in the past", now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"empty", "", 0, false},
+		{"negative", "-5", 0, false},
+		{"garbage", "soon", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			if ok != tt.ok || got != tt.expected {
+				t.Errorf("parseRetryAfter(%q) = %v, %v; expected %v, %v", tt.value, got, ok, tt.expected, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDoWithRetry_HonorsRetryAfter(t *testing.T) {
+	var attempts int32
+	var firstAttempt, secondAttempt time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&attempts, 1) {
+		case 1:
+			firstAttempt = time.Now()
+			w.Header().Set("Retry-After", "2")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+		default:
+			secondAttempt = time.Now()
+			w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+
+	client := New(WithRetries(DefaultMaxRetries, time.Millisecond))
+
+	resp, err := client.doAPIRequest(context.Background(), "GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected eventual success, got status %d", resp.StatusCode)
+	}
+
+	if waited := secondAttempt.Sub(firstAttempt); waited < 2*time.Second {
+		t.Errorf("Expected client to wait at least 2s per Retry-After, waited %v", waited)
+	}
+}
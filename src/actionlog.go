@@ -0,0 +1,19 @@
+package main
+
+import (
+	"log"
+
+	"github.com/sethvargo/go-githubactions"
+)
+
+// actionLogger logs a deployment to the workflow log: warnings become annotations, and
+// masked secrets are replaced by *** in everything the runner prints afterwards. Debug
+// messages are only shown with step debug logging enabled.
+type actionLogger struct {
+	action *githubactions.Action
+}
+
+func (l actionLogger) Printf(format string, args ...any) { log.Printf(format, args...) }
+func (l actionLogger) Warnf(format string, args ...any)  { l.action.Warningf(format, args...) }
+func (l actionLogger) Mask(secret string)                { l.action.AddMask(secret) }
+func (l actionLogger) Debugf(format string, args ...any) { l.action.Debugf(format, args...) }
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blues/note-dfu-github/deploy"
+	"github.com/blues/note-dfu-github/notehub"
+	"github.com/sethvargo/go-githubactions"
+)
+
+// syncFile flushes a file's contents to stable storage. Missing paths are ignored, since
+// not every run writes every file.
+func syncFile(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open %s for sync: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// Phases of a run that fails before the deployment starts, set as its error_phase
+const (
+	phaseInputs         = "inputs"
+	phaseStrict         = "strict"
+	phaseExportBaseline = "export_baseline"
+)
+
+// annotatedError is a failure reported with its own annotation title and message, such as
+// the list of invalid inputs
+type annotatedError struct {
+	title, message string
+}
+
+func (e *annotatedError) Error() string {
+	return e.message
+}
+
+// failureAnnotation returns the title and message of the error annotation for a failed
+// deployment, naming the phase it failed in and, for a Notehub error, the HTTP status and
+// Notehub's error code
+func failureAnnotation(err error, phase string) (title, message string) {
+	var annotated *annotatedError
+	if errors.As(err, &annotated) {
+		return annotated.title, annotated.message
+	}
+	title = "Deployment failed"
+	var details []string
+	if phase != "" {
+		title += " during " + phase
+		details = append(details, "phase "+phase)
+	}
+	var notehubErr *notehub.NotehubError
+	if errors.As(err, &notehubErr) {
+		details = append(details, fmt.Sprintf("HTTP status %d", notehubErr.StatusCode))
+		if notehubErr.Code != 0 {
+			details = append(details, fmt.Sprintf("Notehub error code %d", notehubErr.Code))
+		}
+	}
+	message = fmt.Sprintf("Deployment failed: %v", err)
+	if len(details) > 0 {
+		message += " [" + strings.Join(details, ", ") + "]"
+	}
+	return title, message
+}
+
+// exitWith is the single exit path once the deployment has started writing results. Every
+// file the run wrote (step outputs, the step summary, and any files passed in) is synced
+// and closed first, then the failure is reported as an annotation naming the phase it
+// failed in, then the process exits with code.
+func exitWith(action *githubactions.Action, code int, err error, phase string, files ...string) {
+	files = append([]string{action.Getenv("GITHUB_OUTPUT"), action.Getenv("GITHUB_STEP_SUMMARY")}, files...)
+	for _, path := range files {
+		if serr := syncFile(path); serr != nil {
+			action.Warningf("%v", serr)
+		}
+	}
+
+	if err != nil {
+		title, message := failureAnnotation(err, phase)
+		action.WithFieldsMap(map[string]string{"title": title}).Errorf("%s", message)
+		// The raw response is only shown with step debug logging enabled
+		var notehubErr *notehub.NotehubError
+		if errors.As(err, &notehubErr) {
+			action.Debugf("Notehub response to %s (status %d): %s", notehubErr.Operation, notehubErr.StatusCode, notehubErr.Body)
+		}
+	}
+	os.Exit(code)
+}
+
+// failBeforeDeployment fails a run that stopped in phase before the deployment started,
+// e.g. on invalid inputs. The deployment_status, error_phase and result_json outputs and
+// the step summary are written as for a failed deployment, then the run exits through
+// exitWith.
+func failBeforeDeployment(action *githubactions.Action, err error, phase string) {
+	report := &deploy.DeploymentReport{ErrorPhase: phase}
+	report.RecordFailure(err)
+	setOutputs(action, report)
+	action.AddStepSummary(deploy.DeploymentSummaryMarkdown(report))
+	exitWith(action, 1, err, phase)
+}
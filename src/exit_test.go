@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/deploy"
+	"github.com/blues/note-dfu-github/notehub"
+)
+
+// TestHelperProcess runs the action's main in a subprocess for the end-to-end exit tests.
+// It does nothing when run as part of the normal test suite.
+func TestHelperProcess(t *testing.T) {
+	if os.Getenv("ODFU_HELPER_PROCESS") != "1" {
+		return
+	}
+	deploy.DefaultAPIBaseURL = os.Getenv("ODFU_FAKE_NOTEHUB")
+	deploy.DefaultOAuthTokenURL = deploy.DefaultAPIBaseURL + "/oauth2/token"
+	main()
+}
+
+// newFailingNotehub returns a fake Notehub that fails the request at failAt
+func newFailingNotehub(t *testing.T, failAt string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/oauth2/token":
+			if failAt == "auth" {
+				http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+		case r.Method == "PUT" && strings.HasPrefix(r.URL.Path, "/projects/app:123/firmware/host/"):
+			if failAt == "upload" {
+				http.Error(w, `{"err":"storage unavailable"}`, http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprint(w, `{"filename":"app$20250101.bin"}`)
+		case r.Method == "GET" && r.URL.Path == "/projects/app:123/firmware":
+			fmt.Fprint(w, `[{"filename":"app$20250101.bin","length":8}]`)
+		case r.Method == "POST" && r.URL.Path == "/projects/app:123/dfu/host/update":
+			if failAt == "dfu" {
+				http.Error(w, `{"err":"no devices match"}`, http.StatusBadRequest)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// parseOutputFile parses a GITHUB_OUTPUT file, failing on any output whose heredoc
+// delimiter is not closed
+func parseOutputFile(t *testing.T, path string) map[string]string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+
+	outputs := map[string]string{}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		name, delimiter, ok := strings.Cut(lines[i], "<<")
+		if !ok {
+			t.Fatalf("Malformed output line %q", lines[i])
+		}
+		var value []string
+		for i++; i < len(lines) && lines[i] != delimiter; i++ {
+			value = append(value, lines[i])
+		}
+		if i == len(lines) {
+			t.Fatalf("Output %s is truncated: delimiter %s never closed", name, delimiter)
+		}
+		outputs[name] = strings.Join(value, "\n")
+	}
+	return outputs
+}
+
+// runAction runs the action in a subprocess against the fake Notehub at serverURL, with
+// the firmware file, output file, and report written in a temporary directory. Extra
+// environment entries override the defaults. It returns the exit code, the directory,
+// and the combined output.
+func runAction(t *testing.T, serverURL string, env ...string) (int, string, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	firmware := filepath.Join(dir, "app.bin")
+	if err := os.WriteFile(firmware, []byte("firmware"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(),
+		"ODFU_HELPER_PROCESS=1",
+		"ODFU_FAKE_NOTEHUB="+serverURL,
+		"GITHUB_WORKSPACE="+dir,
+		"GITHUB_OUTPUT="+filepath.Join(dir, "output"),
+		"GITHUB_STEP_SUMMARY="+filepath.Join(dir, "summary"),
+		"INPUT_PROJECT_UID=app:123",
+		"INPUT_FIRMWARE_FILE="+firmware,
+		"INPUT_CLIENT_ID=id",
+		"INPUT_CLIENT_SECRET=secret",
+		"INPUT_DEVICE_UID=dev:1",
+		"INPUT_MAX_RETRIES=0",
+		"INPUT_REPORT_PATH="+filepath.Join(dir, "report.json"),
+		"INPUT_RESULT_FILE="+filepath.Join(dir, "result.json"),
+	)
+	cmd.Env = append(cmd.Env, env...)
+	out, err := cmd.CombinedOutput()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), dir, out
+	}
+	if err != nil {
+		t.Fatalf("Failed to run action: %v", err)
+	}
+	return 0, dir, out
+}
+
+func TestExitFlushesResultsAtEachFailurePoint(t *testing.T) {
+	tests := []struct {
+		failAt           string
+		expectedCode     int
+		expectedStatus   string
+		expectedFilename string
+		expectedPhase    string
+		expectedStatusIn string
+	}{
+		{"auth", 1, deploy.StatusFailed, "", "authenticate", "HTTP status 401"},
+		{"upload", 1, deploy.StatusFailed, "", "upload", "HTTP status 500"},
+		{"dfu", 1, deploy.StatusFailed, "app$20250101.bin", "trigger_dfu", "HTTP status 400"},
+		{"", 0, deploy.StatusSuccess, "app$20250101.bin", "", ""},
+	}
+
+	for _, tt := range tests {
+		name := tt.failAt
+		if name == "" {
+			name = "success"
+		}
+		t.Run(name, func(t *testing.T) {
+			server := newFailingNotehub(t, tt.failAt)
+			code, dir, out := runAction(t, server.URL)
+			if code != tt.expectedCode {
+				t.Fatalf("Expected exit code %d, got %d:\n%s", tt.expectedCode, code, out)
+			}
+			outputFile := filepath.Join(dir, "output")
+			reportFile := filepath.Join(dir, "report.json")
+
+			outputs := parseOutputFile(t, outputFile)
+			if outputs["deployment_status"] != tt.expectedStatus {
+				t.Errorf("Expected deployment_status %s, got %q", tt.expectedStatus, outputs["deployment_status"])
+			}
+			if outputs["uploaded_filename"] != tt.expectedFilename {
+				t.Errorf("Expected uploaded_filename %q, got %q", tt.expectedFilename, outputs["uploaded_filename"])
+			}
+			if outputs["error_phase"] != tt.expectedPhase {
+				t.Errorf("Expected error_phase %q, got %q", tt.expectedPhase, outputs["error_phase"])
+			}
+			if tt.expectedPhase != "" {
+				annotation := "::error title=Deployment failed during " + tt.expectedPhase + "::Deployment failed: "
+				if !strings.Contains(string(out), annotation) || !strings.Contains(string(out), "[phase "+tt.expectedPhase+", "+tt.expectedStatusIn) {
+					t.Errorf("Expected an annotation naming phase %s and %s, got:\n%s", tt.expectedPhase, tt.expectedStatusIn, out)
+				}
+			}
+
+			data, err := os.ReadFile(reportFile)
+			if err != nil {
+				t.Fatalf("Report not written: %v", err)
+			}
+			var report deploy.DeploymentReport
+			if err := json.Unmarshal(data, &report); err != nil {
+				t.Fatalf("Report is not valid JSON: %v\n%s", err, data)
+			}
+			if report.Status != tt.expectedStatus {
+				t.Errorf("Expected report status %s, got %s", tt.expectedStatus, report.Status)
+			}
+
+			data, err = os.ReadFile(filepath.Join(dir, "result.json"))
+			if err != nil {
+				t.Fatalf("Result not written: %v", err)
+			}
+			var result deploy.DeploymentResult
+			if err := json.Unmarshal(data, &result); err != nil || result.Status != tt.expectedStatus || result.SchemaVersion != deploy.ResultSchemaVersion {
+				t.Errorf("Expected a result with status %s, got %+v, %v", tt.expectedStatus, result, err)
+			}
+			if outputs["result_json"] == "" {
+				t.Error("Expected the result_json output to be set")
+			}
+
+			summary, err := os.ReadFile(filepath.Join(dir, "summary"))
+			if err != nil {
+				t.Fatalf("Step summary not written: %v", err)
+			}
+			if !strings.Contains(string(summary), "| Status | "+tt.expectedStatus+" |") {
+				t.Errorf("Expected status in step summary:\n%s", summary)
+			}
+			if tt.expectedStatus == deploy.StatusFailed && (report.Error == "" || !strings.Contains(string(summary), "| Failure | ")) {
+				t.Errorf("Expected the failure reason in the report and step summary:\n%s", summary)
+			}
+		})
+	}
+}
+
+func TestFailureAnnotation(t *testing.T) {
+	notehubErr := &notehub.NotehubError{Operation: "DFU trigger", StatusCode: 400, Message: "no devices match", Code: 17}
+	tests := []struct {
+		err             error
+		phase           string
+		expectedTitle   string
+		expectedMessage string
+	}{
+		{fmt.Errorf("DFU trigger failed: %w", notehubErr), "trigger_dfu", "Deployment failed during trigger_dfu",
+			"Deployment failed: DFU trigger failed: DFU trigger failed with status 400: no devices match [phase trigger_dfu, HTTP status 400, Notehub error code 17]"},
+		{errors.New("firmware file not found: app.bin"), "validate_file", "Deployment failed during validate_file",
+			"Deployment failed: firmware file not found: app.bin [phase validate_file]"},
+		{errors.New("boom"), "", "Deployment failed", "Deployment failed: boom"},
+	}
+	for _, tt := range tests {
+		title, message := failureAnnotation(tt.err, tt.phase)
+		if title != tt.expectedTitle || message != tt.expectedMessage {
+			t.Errorf("failureAnnotation(%v, %q) = %q, %q; expected %q, %q", tt.err, tt.phase, title, message, tt.expectedTitle, tt.expectedMessage)
+		}
+	}
+}
+
+func TestInvalidInputsReportedTogether(t *testing.T) {
+	code, _, out := runAction(t, "https://notehub.invalid",
+		"INPUT_CLIENT_ID=",
+		"INPUT_POLL_INTERVAL=soon",
+		"INPUT_ISSUE_DFU=maybe",
+	)
+	if code != 1 {
+		t.Fatalf("Expected exit code 1, got %d:\n%s", code, out)
+	}
+	expected := "::error title=Invalid inputs::3 inputs are missing or invalid:%0A  - client_id is required%0A  - invalid issue_dfu \"maybe\" (accepted values: true, false, yes, no, 1, 0)%0A  - Invalid poll_interval \"soon\": must be a positive duration such as 30s"
+	if !strings.Contains(string(out), expected) {
+		t.Errorf("Expected one annotation listing every invalid input, got:\n%s", out)
+	}
+	if strings.Count(string(out), "::error") != 1 {
+		t.Errorf("Expected a single error annotation, got:\n%s", out)
+	}
+}
+
+func TestFailuresBeforeDeploymentWriteResults(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           []string
+		expectedPhase string
+		expectedError string
+	}{
+		{"invalid inputs", []string{"INPUT_POLL_INTERVAL=soon"}, "inputs", "::error title=Invalid input::Invalid poll_interval"},
+		{"strict configuration", []string{"INPUT_STRICT=true", "INPUT_ISSUE_DFU=false", "INPUT_ROLLOUT_PERCENTAGE=50"}, "strict", "::error title=Deployment failed during strict::Deployment failed: strict mode: 1 warning(s) during configuration"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, dir, out := runAction(t, "https://notehub.invalid", tt.env...)
+			if code != 1 {
+				t.Fatalf("Expected exit code 1, got %d:\n%s", code, out)
+			}
+			if !strings.Contains(string(out), tt.expectedError) {
+				t.Errorf("Expected %q in the output, got:\n%s", tt.expectedError, out)
+			}
+			outputs := parseOutputFile(t, filepath.Join(dir, "output"))
+			if outputs["error_phase"] != tt.expectedPhase || outputs["deployment_status"] != deploy.StatusFailed {
+				t.Errorf("Expected error_phase %s and a failed deployment_status, got %q and %q", tt.expectedPhase, outputs["error_phase"], outputs["deployment_status"])
+			}
+			if !strings.Contains(outputs["result_json"], `"status":"failed"`) {
+				t.Errorf("Expected a failed result_json, got %s", outputs["result_json"])
+			}
+			summary, err := os.ReadFile(filepath.Join(dir, "summary"))
+			if err != nil || !strings.Contains(string(summary), "❌") {
+				t.Errorf("Expected a failed step summary, got %q (%v)", summary, err)
+			}
+		})
+	}
+}
+
+func TestCredentialInputs(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      []string
+		expected string
+	}{
+		{"both", []string{"INPUT_API_TOKEN=api-token"}, "api_token replaces client_id and client_secret; set either the token or the client credentials, not both"},
+		{"neither", []string{"INPUT_CLIENT_ID=", "INPUT_CLIENT_SECRET="}, "client_id and client_secret, or api_token, are required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, _, out := runAction(t, "https://notehub.invalid", tt.env...)
+			if code != 1 || !strings.Contains(string(out), "::error title=Invalid input::"+tt.expected) {
+				t.Errorf("Expected exit code 1 and %q, got %d:\n%s", tt.expected, code, out)
+			}
+		})
+	}
+}
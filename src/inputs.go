@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/sethvargo/go-githubactions"
+)
+
+// parseBoolInput strictly parses a boolean input. Empty values take the default; anything
+// other than true/false, yes/no, or 1/0 (case-insensitive) is rejected so that a typo can't
+// silently flip a setting such as issue_dfu.
+func parseBoolInput(name, value string, defaultValue bool) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		return defaultValue, nil
+	case "true", "yes", "1":
+		return true, nil
+	case "false", "no", "0":
+		return false, nil
+	default:
+		return false, fmt.Errorf("invalid %s %q (accepted values: true, false, yes, no, 1, 0)", name, value)
+	}
+}
+
+// parseHTTPSURLInput validates an endpoint URL input such as api_base_url. The URL must be
+// absolute https; a trailing slash is removed so that paths join cleanly. Empty values are
+// returned as is, leaving the caller's default in place.
+func parseHTTPSURLInput(name, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	if u.Scheme != "https" || u.Host == "" {
+		return "", fmt.Errorf("invalid %s %q: must be an https URL such as https://api.notefile.net/v1", name, value)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("invalid %s %q: must not include a query or fragment", name, value)
+	}
+	return strings.TrimRight(value, "/"), nil
+}
+
+// inputProblems collects every missing or invalid input, so that a run reports them all
+// in one annotation rather than stopping at the first
+type inputProblems []string
+
+// addf records a problem, once however many checks find it
+func (p *inputProblems) addf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if !slices.Contains(*p, msg) {
+		*p = append(*p, msg)
+	}
+}
+
+// check fails the run in the inputs phase with a single error annotation listing the
+// problems, if any
+func (p inputProblems) check(action *githubactions.Action) {
+	switch len(p) {
+	case 0:
+		return
+	case 1:
+		failBeforeDeployment(action, &annotatedError{title: "Invalid input", message: p[0]}, phaseInputs)
+	}
+	failBeforeDeployment(action, &annotatedError{
+		title:   "Invalid inputs",
+		message: fmt.Sprintf("%d inputs are missing or invalid:\n  - %s", len(p), strings.Join(p, "\n  - ")),
+	}, phaseInputs)
+}
@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestParseBoolInput(t *testing.T) {
+	accepted := map[string]bool{
+		"true": true, "TRUE": true, "True": true, "yes": true, "YES": true, "1": true, " true ": true,
+		"false": false, "FALSE": false, "no": false, "No": false, "0": false,
+	}
+	for value, expected := range accepted {
+		got, err := parseBoolInput("issue_dfu", value, !expected)
+		if err != nil || got != expected {
+			t.Errorf("parseBoolInput(%q) = %t, %v; expected %t", value, got, err, expected)
+		}
+	}
+
+	for _, defaultValue := range []bool{true, false} {
+		if got, err := parseBoolInput("issue_dfu", "", defaultValue); err != nil || got != defaultValue {
+			t.Errorf("Expected empty value to take default %t, got %t, %v", defaultValue, got, err)
+		}
+	}
+
+	for _, value := range []string{"flase", "ture", "y", "n", "on", "off", "2", "truee"} {
+		if _, err := parseBoolInput("issue_dfu", value, true); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestParseHTTPSURLInput(t *testing.T) {
+	accepted := map[string]string{
+		"":                                  "",
+		"https://api.eu.notefile.net/v1":    "https://api.eu.notefile.net/v1",
+		" https://api.eu.notefile.net/v1/ ": "https://api.eu.notefile.net/v1",
+		"https://notehub.example.com/oauth2/token//": "https://notehub.example.com/oauth2/token",
+	}
+	for value, expected := range accepted {
+		got, err := parseHTTPSURLInput("api_base_url", value)
+		if err != nil || got != expected {
+			t.Errorf("parseHTTPSURLInput(%q) = %q, %v; expected %q", value, got, err, expected)
+		}
+	}
+
+	for _, value := range []string{"http://api.notefile.net/v1", "api.notefile.net/v1", "https://", "https://api.notefile.net/v1?x=1", "://bad"} {
+		if _, err := parseHTTPSURLInput("api_base_url", value); err == nil {
+			t.Errorf("Expected %q to be rejected", value)
+		}
+	}
+}
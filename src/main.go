@@ -1,413 +1,955 @@
 package main
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/blues/note-dfu-github/deploy"
+	"github.com/blues/note-dfu-github/notehub"
 	"github.com/sethvargo/go-githubactions"
 )
 
 func main() {
-	ctx := context.Background()
+	if len(os.Args) > 1 && os.Args[1] == "--version" {
+		fmt.Println(buildVersion())
+		return
+	}
 
 	// Initialize GitHub Actions
 	action := githubactions.New()
 
+	// Cancel the run on SIGINT or SIGTERM rather than dying mid-request
+	ctx, stop := shutdownContext(action.Warningf)
+	defer stop()
+	inputs := newInputReader(action)
+
+	// Say which build is running, e.g. to tell a pinned tag from @main in the log
+	if ref := action.Getenv("GITHUB_ACTION_REF"); ref != "" {
+		log.Printf("notehub-dfu %s, run as %s@%s", buildVersion(), action.Getenv("GITHUB_ACTION_REPOSITORY"), ref)
+	} else {
+		log.Printf("notehub-dfu %s", buildVersion())
+	}
+	action.SetOutput("version", buildVersion())
+
+	// Every invalid input is reported at once, before anything else runs
+	var problems inputProblems
+
 	// Get required inputs
-	projectUID := action.GetInput("project_uid")
-	firmwareFile := action.GetInput("firmware_file")
+	projectUID := inputs.get("project_uid")
+	firmwareFile := inputs.get("firmware_file")
+	firmwareDir := inputs.get("firmware_dir")
+	workspace := action.Getenv("GITHUB_WORKSPACE")
+	firmwareType, err := deploy.ParseFirmwareType(inputs.get("firmware_type"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+
+	randomSeed, err := deploy.ParseRandomSeed(inputs.get("random_seed"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	strict, err := parseBoolInput("strict", inputs.get("strict"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	// The deployment's settings are filled in once every input has been read; until then
+	// the config carries the logger and strict mode, so warnings about inputs count too
+	config := &deploy.DeploymentConfig{Logger: actionLogger{action}, Strict: strict}
 
 	// Get secrets
-	clientID := action.GetInput("client_id")
-	clientSecret := action.GetInput("client_secret")
+	clientID := inputs.get("client_id")
+	clientSecret := inputs.get("client_secret")
+	apiToken := strings.TrimSpace(inputs.get("api_token"))
+	for _, secret := range []string{clientSecret, apiToken} {
+		if secret != "" {
+			action.AddMask(secret)
+		}
+	}
+	requireConfirmationToken := inputs.get("require_confirmation_token")
+	confirmationToken := inputs.get("confirmation_token")
+	for _, token := range []string{requireConfirmationToken, confirmationToken} {
+		if token != "" {
+			action.AddMask(token)
+		}
+	}
+
+	// Exporting a baseline works only on local reports, so needs none of the inputs below
+	operation, err := deploy.ParseOperation(inputs.get("operation"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if operation == deploy.OperationExportBaseline {
+		reports, path := inputs.get("baseline_reports"), inputs.get("baseline_file")
+		if reports == "" || path == "" {
+			problems.addf("operation export-baseline requires baseline_reports and baseline_file")
+		}
+		problems.check(action)
+		runExportBaseline(action, reports, path)
+	}
 
 	// Validate required inputs
 	if projectUID == "" {
-		action.Fatalf("project_uid is required")
+		problems.addf("project_uid is required")
 	}
-	if firmwareFile == "" {
-		action.Fatalf("firmware_file is required")
+	if firmwareFile == "" && operation != deploy.OperationCancel && operation != deploy.OperationValidate {
+		problems.addf("firmware_file is required")
 	}
-	if clientID == "" {
-		action.Fatalf("client_id is required")
-	}
-	if clientSecret == "" {
-		action.Fatalf("client_secret is required")
+	switch {
+	case apiToken != "" && (clientID != "" || clientSecret != ""):
+		problems.addf("api_token replaces client_id and client_secret; set either the token or the client credentials, not both")
+	case apiToken != "":
+	case clientID == "" && clientSecret == "":
+		problems.addf("client_id and client_secret, or api_token, are required")
+	case clientID == "":
+		problems.addf("client_id is required")
+	case clientSecret == "":
+		problems.addf("client_secret is required")
 	}
 
 	// Get optional inputs
-	deviceUID := action.GetInput("device_uid")
-	tag := action.GetInput("tag")
-	serialNumber := action.GetInput("serial_number")
-	fleetUID := action.GetInput("fleet_uid")
-	productUID := action.GetInput("product_uid")
-	notecardFirmware := action.GetInput("notecard_firmware")
-	location := action.GetInput("location")
-	sku := action.GetInput("sku")
+	channel, err := deploy.ParseChannel("channel", inputs.get("channel"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	promoteFrom, err := deploy.ParseChannel("promote_from", inputs.get("promote_from"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if operation == deploy.OperationPromote && channel == "" && promoteFrom == "" {
+		problems.addf("operation promote requires channel and/or promote_from")
+	}
+	if operation == deploy.OperationPromote && deploy.IsFirmwareURL(firmwareFile) {
+		problems.addf("operation promote copies firmware already on Notehub, so firmware_file must be its filename rather than a URL")
+	}
+	skipUpload, err := parseBoolInput("skip_upload", inputs.get("skip_upload"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if skipUpload && operation != deploy.OperationDeploy {
+		problems.addf("skip_upload only applies to operation deploy, not %s", operation)
+	}
+	if skipUpload && (deploy.IsFirmwareURL(firmwareFile) || strings.Contains(firmwareFile, ",")) {
+		problems.addf("skip_upload deploys firmware already on Notehub, so firmware_file must be a single filename in the project")
+	}
+	// Cancelling a DFU uploads nothing, so ignores firmware_file, validate may check only
+	// the credentials, and skip_upload names a file on Notehub rather than in the workspace
+	var firmwareFiles []string
+	if skipUpload {
+		firmwareFiles = []string{strings.TrimSpace(firmwareFile)}
+	} else if operation != deploy.OperationCancel && (firmwareFile != "" || operation != deploy.OperationValidate) {
+		firmwareFiles, err = deploy.ExpandFirmwareFiles(workspace, firmwareDir, firmwareFile)
+		if err != nil {
+			problems.addf("%v", err)
+		}
+	}
+	if len(firmwareFiles) > 1 && operation != deploy.OperationDeploy && operation != deploy.OperationAB {
+		problems.addf("operation %s takes a single firmware_file, got %d: %s", operation, len(firmwareFiles), strings.Join(firmwareFiles, ", "))
+	}
+	uploadAs, err := deploy.ParseUploadAs(inputs.get("upload_as"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	switch {
+	case uploadAs == "":
+	case len(firmwareFiles) > 1:
+		problems.addf("upload_as names a single upload, but firmware_file gives %d files", len(firmwareFiles))
+	case skipUpload || operation != deploy.OperationDeploy:
+		problems.addf("upload_as only applies to a deployment that uploads the firmware")
+	}
+	dfuFile := strings.TrimSpace(inputs.get("dfu_file"))
+	expectedSHA256, err := deploy.ParseExpectedSHA256(inputs.get("expected_sha256"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	verifyArtifactChain, err := parseBoolInput("verify_artifact_chain", inputs.get("verify_artifact_chain"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if verifyArtifactChain && len(firmwareFiles) > 1 {
+		problems.addf("verify_artifact_chain checks a single firmware_file against its recorded digest, got %d files", len(firmwareFiles))
+	}
+	expectedSHA256, err = deploy.RecordedSHA256(verifyArtifactChain, expectedSHA256, strings.TrimSpace(inputs.get("artifact_manifest")), firmwareFile)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	issueDFU, err := parseBoolInput("issue_dfu", inputs.get("issue_dfu"), true)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if skipUpload && !issueDFU {
+		problems.addf("skip_upload with issue_dfu: false would neither upload nor deploy anything")
+	}
+	if issueDFU && len(firmwareFiles) > 1 && operation != deploy.OperationAB {
+		if _, err := deploy.SelectDFUFile(firmwareFiles, dfuFile); err != nil {
+			problems.addf("%v", err)
+		}
+	}
+	dryRun, err := parseBoolInput("dry_run", inputs.get("dry_run"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	scheduleAt, err := deploy.ParseScheduleAt(inputs.get("schedule_at"), time.Now())
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	skipIfExists, err := parseBoolInput("skip_if_exists", inputs.get("skip_if_exists"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	forceUpload, err := parseBoolInput("force_upload", inputs.get("force_upload"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	reuseIdentical, err := parseBoolInput("reuse_identical", inputs.get("reuse_identical"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	autoCleanupOnQuota, err := parseBoolInput("auto_cleanup_on_quota", inputs.get("auto_cleanup_on_quota"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	retainLast := deploy.DefaultRetainLast
+	if v := inputs.get("retain_last"); v != "" {
+		retainLast, err = strconv.Atoi(v)
+		if err != nil || retainLast < 1 {
+			problems.addf("Invalid retain_last %q: must be a positive integer", v)
+		}
+	}
+	retainFirmwareCount := 0
+	if v := inputs.get("retain_firmware_count"); v != "" {
+		retainFirmwareCount, err = strconv.Atoi(v)
+		if err != nil || retainFirmwareCount < 0 {
+			problems.addf("Invalid retain_firmware_count %q: must be 0 or a positive integer", v)
+		}
+	}
+	retentionDryRun, err := parseBoolInput("retention_dry_run", inputs.get("retention_dry_run"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if retentionDryRun && retainFirmwareCount == 0 {
+		config.Warnf("retention_dry_run has no effect without retain_firmware_count")
+	}
+	cleanupOnFailure, err := parseBoolInput("cleanup_on_failure", inputs.get("cleanup_on_failure"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	maxDFUQueryLength := deploy.DefaultMaxDFUQueryLength
+	if v := inputs.get("max_dfu_query_length"); v != "" {
+		maxDFUQueryLength, err = strconv.Atoi(v)
+		if err != nil || maxDFUQueryLength < 1 {
+			problems.addf("Invalid max_dfu_query_length %q: must be a positive integer", v)
+		}
+	}
+	var maxFirmwareSize int64 = deploy.DefaultMaxFirmwareSize
+	if v := inputs.get("max_firmware_size"); v != "" {
+		maxFirmwareSize, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || maxFirmwareSize < 0 {
+			problems.addf("Invalid max_firmware_size %q: must be a number of bytes, or 0 for no limit", v)
+		}
+	}
+	allowAllDevices, err := parseBoolInput("allow_all_devices", inputs.get("allow_all_devices"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	allowConflictingTargets, err := parseBoolInput("allow_conflicting_targets", inputs.get("allow_conflicting_targets"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	countTargets, err := parseBoolInput("count_targets", inputs.get("count_targets"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	var maxDevices int
+	if v := inputs.get("max_devices"); v != "" {
+		maxDevices, err = strconv.Atoi(v)
+		if err != nil || maxDevices < 1 {
+			problems.addf("Invalid max_devices %q: must be a positive integer", v)
+		}
+	}
+	rolloutPercentage, err := deploy.ParseRolloutPercentage(inputs.get("rollout_percentage"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if rolloutPercentage > 0 && !issueDFU {
+		config.Warnf("rollout_percentage only applies to the DFU, and issue_dfu is false; ignoring it")
+	}
+	deviceUID := inputs.get("device_uid")
+	tag := inputs.get("tag")
+	noMatchBehavior, err := deploy.ParseNoMatchBehavior(inputs.get("no_match_behavior"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	tagMatch, err := deploy.ParseTagMatch(inputs.get("tag_match"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	firmwareVersion := strings.TrimSpace(inputs.get("firmware_version"))
+	allowDowngrade, err := parseBoolInput("allow_downgrade", inputs.get("allow_downgrade"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	serialNumber := inputs.get("serial_number")
+	deviceName := inputs.get("device_name")
+	resolveTargets, err := parseBoolInput("resolve_targets", inputs.get("resolve_targets"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if deviceName != "" && !resolveTargets {
+		problems.addf("device_name is only matched by looking devices up; set resolve_targets: true")
+	}
+	fleetUID := inputs.get("fleet_uid")
+	fleetName := strings.TrimSpace(inputs.get("fleet_name"))
+	if fleetUID != "" && fleetName != "" {
+		problems.addf("fleet_uid and fleet_name both select a fleet; set only one of them")
+	}
+	productUID := inputs.get("product_uid")
+	notecardFirmware := inputs.get("notecard_firmware")
+	location := inputs.get("location")
+	sku := inputs.get("sku")
+	excludeTags := deploy.SplitTags(inputs.get("exclude_tags"))
+	excludeDeviceUIDs := deploy.SplitTags(inputs.get("exclude_device_uid"))
+	deviceQuery, err := deploy.ParseDeviceQueryJSON(inputs.get("device_query_json"))
+	if err != nil {
+		problems.addf("Invalid device_query_json: %v", err)
+	}
+	extraDFUParams, err := deploy.ParseExtraDFUParams(inputs.get("extra_dfu_params"), deviceQuery)
+	if err != nil {
+		problems.addf("%v", err)
+	}
 
-	log.Printf("Starting firmware deployment to Notehub...")
-	log.Printf("Project UID: %s", projectUID)
-	log.Printf("Firmware File: %s", firmwareFile)
+	// Get ab operation inputs
+	cohortA, err := deploy.ParseDeviceQuery("cohort_a", inputs.get("cohort_a"))
+	if err != nil {
+		problems.addf("Invalid cohort_a: %v", err)
+	}
+	cohortB, err := deploy.ParseDeviceQuery("cohort_b", inputs.get("cohort_b"))
+	if err != nil {
+		problems.addf("Invalid cohort_b: %v", err)
+	}
+	abMinCohortSize := deploy.DefaultABMinCohortSize
+	if v := inputs.get("ab_min_cohort_size"); v != "" {
+		abMinCohortSize, err = strconv.Atoi(v)
+		if err != nil || abMinCohortSize < 0 {
+			problems.addf("Invalid ab_min_cohort_size %q: must be a non-negative integer", v)
+		}
+	}
 
-	// Execute deployment
-	if err := deployFirmware(ctx, &DeploymentConfig{
-		ProjectUID:       projectUID,
-		FirmwareFile:     firmwareFile,
-		ClientID:         clientID,
-		ClientSecret:     clientSecret,
-		DeviceUID:        deviceUID,
-		Tag:              tag,
-		SerialNumber:     serialNumber,
-		FleetUID:         fleetUID,
-		ProductUID:       productUID,
-		NotecardFirmware: notecardFirmware,
-		Location:         location,
-		SKU:              sku,
-	}); err != nil {
-		action.Fatalf("Deployment failed: %v", err)
+	// Get hook inputs
+	hookCommand := inputs.get("hook_command")
+	var hookPhases []string
+	hookPhases, err = deploy.ParseHookPhases(inputs.get("hook_phases"))
+	if err != nil {
+		problems.addf("Invalid hook_phases: %v", err)
+	}
+	if hookCommand != "" && len(hookPhases) == 0 {
+		problems.addf("hook_phases is required when hook_command is set")
+	}
+	hookTimeout := deploy.DefaultHookTimeout
+	if v := inputs.get("hook_timeout"); v != "" {
+		hookTimeout, err = time.ParseDuration(v)
+		if err != nil || hookTimeout <= 0 {
+			problems.addf("Invalid hook_timeout %q: must be a positive duration such as 30s or 5m", v)
+		}
+	}
+	hookPassSecrets, err := parseBoolInput("hook_pass_secrets", inputs.get("hook_pass_secrets"), false)
+	if err != nil {
+		problems.addf("%v", err)
 	}
 
-	log.Printf("✅ Firmware deployment completed successfully")
-}
+	// Get deployment lock inputs
+	lockEnabled, err := parseBoolInput("lock", inputs.get("lock"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	lockOnHeld, err := deploy.ParseLockOnHeld(inputs.get("on_lock_held"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	lockTTL := deploy.DefaultLockTTL
+	if v := inputs.get("lock_ttl"); v != "" {
+		lockTTL, err = time.ParseDuration(v)
+		if err != nil || lockTTL <= 0 {
+			problems.addf("Invalid lock_ttl %q: must be a positive duration such as 15m", v)
+		}
+	}
+	lockWaitTimeout := deploy.DefaultLockWaitTimeout
+	if v := inputs.get("lock_wait_timeout"); v != "" {
+		lockWaitTimeout, err = time.ParseDuration(v)
+		if err != nil || lockWaitTimeout <= 0 {
+			problems.addf("Invalid lock_wait_timeout %q: must be a positive duration such as 10m", v)
+		}
+	}
 
-// DeploymentConfig contains all the configuration for firmware deployment
-type DeploymentConfig struct {
-	ProjectUID       string
-	FirmwareFile     string
-	ClientID         string
-	ClientSecret     string
-	DeviceUID        string
-	Tag              string
-	SerialNumber     string
-	FleetUID         string
-	ProductUID       string
-	NotecardFirmware string
-	Location         string
-	SKU              string
-}
+	// Get Notehub endpoint inputs, for EU and self-hosted instances
+	apiBaseURL, err := parseHTTPSURLInput("api_base_url", inputs.get("api_base_url"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	oauthTokenURL, err := parseHTTPSURLInput("oauth_token_url", inputs.get("oauth_token_url"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+
+	// Get timeout inputs
+	httpTimeout := notehub.DefaultTimeout
+	httpTimeoutInput := "request_timeout"
+	httpTimeoutValue := inputs.get(httpTimeoutInput)
+	if httpTimeoutValue == "" {
+		// http_timeout is the original name of request_timeout
+		httpTimeoutInput = "http_timeout"
+		httpTimeoutValue = inputs.get(httpTimeoutInput)
+	}
+	if httpTimeoutValue != "" {
+		httpTimeout, err = time.ParseDuration(httpTimeoutValue)
+		if err != nil || httpTimeout <= 0 {
+			problems.addf("Invalid %s %q: must be a positive duration such as 30s or 5m", httpTimeoutInput, httpTimeoutValue)
+		}
+	}
+	uploadTimeout := deploy.DefaultUploadTimeout
+	if v := inputs.get("upload_timeout"); v != "" {
+		uploadTimeout, err = time.ParseDuration(v)
+		if err != nil || uploadTimeout <= 0 {
+			problems.addf("Invalid upload_timeout %q: must be a positive duration such as 10m", v)
+		}
+	}
+	var minUploadBytesPerSec int64
+	if v := inputs.get("min_upload_bytes_per_sec"); v != "" {
+		minUploadBytesPerSec, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || minUploadBytesPerSec < 0 {
+			problems.addf("Invalid min_upload_bytes_per_sec %q: must be a non-negative integer", v)
+		}
+	}
+	uploadProgressInterval := deploy.DefaultUploadProgressInterval
+	if v := inputs.get("upload_progress_interval"); v != "" {
+		uploadProgressInterval, err = time.ParseDuration(v)
+		if err != nil || uploadProgressInterval < 0 {
+			problems.addf("Invalid upload_progress_interval %q: must be a duration such as 10s, or 0 to disable", v)
+		}
+	}
+	compressUpload, err := parseBoolInput("compress_upload", inputs.get("compress_upload"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if compressUpload && skipUpload {
+		config.Warnf("compress_upload has no effect with skip_upload, which uploads nothing")
+	}
+	var overallTimeout time.Duration
+	overallTimeoutInput := "overall_timeout"
+	overallTimeoutValue := inputs.get(overallTimeoutInput)
+	if overallTimeoutValue == "" {
+		// total_timeout is accepted as an alias of overall_timeout
+		overallTimeoutInput = "total_timeout"
+		overallTimeoutValue = inputs.get(overallTimeoutInput)
+	}
+	if overallTimeoutValue != "" {
+		overallTimeout, err = time.ParseDuration(overallTimeoutValue)
+		if err != nil || overallTimeout <= 0 {
+			problems.addf("Invalid %s %q: must be a positive duration such as 45m", overallTimeoutInput, overallTimeoutValue)
+		}
+	}
+	cancelDFUOnAbort, err := parseBoolInput("cancel_dfu_on_abort", inputs.get("cancel_dfu_on_abort"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
 
-// NotehubClient handles API communication with Notehub
-type NotehubClient struct {
-	httpClient  *http.Client
-	accessToken string
-	baseURL     string
-}
+	// Get clock sanity input; larger skews would corrupt every timestamp the action produces
+	maxClockSkew := notehub.DefaultMaxClockSkew
+	if v := inputs.get("max_clock_skew"); v != "" {
+		maxClockSkew, err = time.ParseDuration(v)
+		if err != nil || maxClockSkew < 0 {
+			problems.addf("Invalid max_clock_skew %q: must be a duration such as 24h, or 0 to disable the check", v)
+		}
+	}
 
-// OAuth2TokenResponse represents the response from OAuth2 token endpoint
-type OAuth2TokenResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int    `json:"expires_in"`
-}
+	// Get token handoff inputs, which let a later step of the job skip authentication
+	tokenHandle := strings.TrimSpace(inputs.get("token_handle"))
+	exportTokenHandle, err := parseBoolInput("export_token_handle", inputs.get("export_token_handle"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if apiToken != "" && (tokenHandle != "" || exportTokenHandle) {
+		problems.addf("token_handle and export_token_handle hand off an OAuth2 token, so cannot be used with api_token")
+	}
 
-// FirmwareUploadResponse represents the response from firmware upload
-type FirmwareUploadResponse struct {
-	Filename string `json:"filename"`
-}
+	// Get TLS verification input, for gateways that present a private certificate
+	insecureSkipVerify, err := parseBoolInput("insecure_skip_verify", inputs.get("insecure_skip_verify"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	if insecureSkipVerify {
+		config.Warnf("insecure_skip_verify is true: TLS certificates presented for Notehub are NOT verified, so the client secret and firmware could be intercepted. Use this only with a trusted internal gateway.")
+	}
 
-// DFURequest represents the payload for triggering device firmware update
-type DFURequest struct {
-	Filename string `json:"filename"`
-}
+	// Get retry inputs
+	maxRetries := notehub.DefaultMaxRetries
+	if v := inputs.get("max_retries"); v != "" {
+		maxRetries, err = strconv.Atoi(v)
+		if err != nil || maxRetries < 0 {
+			problems.addf("Invalid max_retries %q: must be a non-negative integer", v)
+		}
+	}
+	retryBaseDelay := notehub.DefaultRetryBaseDelay
+	retryDelayInput := "retry_initial_delay"
+	retryDelayValue := inputs.get(retryDelayInput)
+	if retryDelayValue == "" {
+		// retry_base_delay is the original name of retry_initial_delay
+		retryDelayInput = "retry_base_delay"
+		retryDelayValue = inputs.get(retryDelayInput)
+	}
+	if retryDelayValue != "" {
+		retryBaseDelay, err = time.ParseDuration(retryDelayValue)
+		if err != nil || retryBaseDelay <= 0 {
+			problems.addf("Invalid %s %q: must be a positive duration such as 500ms or 2s", retryDelayInput, retryDelayValue)
+		}
+	}
+	maxRateLimitWait := notehub.DefaultMaxRateLimitWait
+	if v := inputs.get("max_rate_limit_wait"); v != "" {
+		maxRateLimitWait, err = time.ParseDuration(v)
+		if err != nil || maxRateLimitWait < 0 {
+			problems.addf("Invalid max_rate_limit_wait %q: must be a duration such as 5m, or 0 to count 429s as retries", v)
+		}
+	}
 
-// DFUResponse represents the response from DFU trigger
-type DFUResponse struct {
-	Success bool   `json:"success,omitempty"`
-	Message string `json:"message,omitempty"`
-}
+	// Get upload throughput inputs
+	minUploadThroughput := int64(deploy.DefaultMinUploadThroughputBps)
+	if v := inputs.get("min_upload_throughput_bps"); v != "" {
+		minUploadThroughput, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || minUploadThroughput < 0 {
+			problems.addf("Invalid min_upload_throughput_bps %q: must be a non-negative integer", v)
+		}
+	}
 
-// NewNotehubClient creates a new Notehub API client
-func NewNotehubClient() *NotehubClient {
-	return &NotehubClient{
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		baseURL: "https://api.notefile.net/v1",
+	// Get SKU size limit inputs
+	skuSizeLimits, err := deploy.ParseSKUSizeLimits(inputs.get("sku_size_limits"))
+	if err != nil {
+		problems.addf("Invalid sku_size_limits: %v", err)
+	}
+	onSizeExceeded, err := deploy.ParseOnSizeExceeded(inputs.get("on_size_exceeded"))
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	unknownSKUBehavior, err := deploy.ParseUnknownSKUBehavior(inputs.get("unknown_sku_behavior"))
+	if err != nil {
+		problems.addf("%v", err)
 	}
-}
 
-// Authenticate obtains an OAuth2 access token from Notehub
-func (c *NotehubClient) Authenticate(ctx context.Context, clientID, clientSecret string) error {
-	log.Printf("Obtaining OAuth2 bearer token from Notehub...")
+	// Get DFU completion inputs
+	waitForCompletion, err := parseBoolInput("wait_for_completion", inputs.get("wait_for_completion"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	waitTimeout := deploy.DefaultWaitTimeout
+	waitTimeoutInput := "wait_timeout"
+	waitTimeoutValue := inputs.get(waitTimeoutInput)
+	if waitTimeoutValue == "" {
+		// dfu_timeout is accepted as an alias of wait_timeout
+		waitTimeoutInput = "dfu_timeout"
+		waitTimeoutValue = inputs.get(waitTimeoutInput)
+	}
+	if waitTimeoutValue != "" {
+		waitTimeout, err = time.ParseDuration(waitTimeoutValue)
+		if err != nil || waitTimeout <= 0 {
+			problems.addf("Invalid %s %q: must be a positive duration such as 30m", waitTimeoutInput, waitTimeoutValue)
+		}
+	}
+	pollInterval := deploy.DefaultPollInterval
+	if v := inputs.get("poll_interval"); v != "" {
+		pollInterval, err = time.ParseDuration(v)
+		if err != nil || pollInterval <= 0 {
+			problems.addf("Invalid poll_interval %q: must be a positive duration such as 30s", v)
+		}
+	}
+	failOnDeviceError, err := parseBoolInput("fail_on_device_error", inputs.get("fail_on_device_error"), true)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	treatPendingAsFailure, err := parseBoolInput("treat_pending_as_failure", inputs.get("treat_pending_as_failure"), true)
+	if err != nil {
+		problems.addf("%v", err)
+	}
+	var maxFailedDevices int
+	if v := inputs.get("max_failed_devices"); v != "" {
+		maxFailedDevices, err = strconv.Atoi(v)
+		if err != nil || maxFailedDevices < 0 {
+			problems.addf("Invalid max_failed_devices %q: must be a non-negative integer", v)
+		}
+	}
+	var minCompletedPercent float64
+	if v := inputs.get("min_completed_percent"); v != "" {
+		minCompletedPercent, err = strconv.ParseFloat(v, 64)
+		if err != nil || minCompletedPercent < 0 || minCompletedPercent > 100 {
+			problems.addf("Invalid min_completed_percent %q: must be a number from 0 to 100", v)
+		}
+	}
+	if (maxFailedDevices > 0 || minCompletedPercent > 0) && !waitForCompletion {
+		config.Warnf("max_failed_devices and min_completed_percent are only used with wait_for_completion; ignoring them")
+	}
 
-	// Prepare form data
-	data := url.Values{}
-	data.Set("grant_type", "client_credentials")
-	data.Set("client_id", clientID)
-	data.Set("client_secret", clientSecret)
+	// Get rollout baseline inputs
+	var baseline *deploy.BaselineCurve
+	if v := inputs.get("baseline_file"); v != "" {
+		baselinePercentile := deploy.DefaultBaselinePercentile
+		if p := inputs.get("baseline_percentile"); p != "" {
+			baselinePercentile, err = strconv.Atoi(p)
+			if err != nil || baselinePercentile < 1 || baselinePercentile > 99 {
+				problems.addf("Invalid baseline_percentile %q: must be an integer from 1 to 99", p)
+			}
+		}
+		history, err := deploy.LoadBaseline(v)
+		if err != nil {
+			problems.addf("%v", err)
+		} else if baseline, err = history.Curve(baselinePercentile); err != nil {
+			problems.addf("%v", err)
+		}
+		if !waitForCompletion {
+			config.Warnf("baseline_file is only used with wait_for_completion; ignoring it")
+		}
+	}
+	failOnSlowRollout, err := parseBoolInput("fail_on_slow_rollout", inputs.get("fail_on_slow_rollout"), false)
+	if err != nil {
+		problems.addf("%v", err)
+	}
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://notehub.io/oauth2/token", strings.NewReader(data.Encode()))
+	if !scheduleAt.IsZero() && waitForCompletion {
+		problems.addf("schedule_at cannot be combined with wait_for_completion; the scheduled DFU starts after the action exits")
+	}
+
+	// Get follow inputs
+	follow, err := parseBoolInput("follow", inputs.get("follow"), false)
 	if err != nil {
-		return fmt.Errorf("failed to create OAuth2 request: %w", err)
+		problems.addf("%v", err)
+	}
+	followTimeout := deploy.DefaultFollowTimeout
+	if v := inputs.get("follow_timeout"); v != "" {
+		followTimeout, err = time.ParseDuration(v)
+		if err != nil || followTimeout <= 0 {
+			problems.addf("Invalid follow_timeout %q: must be a positive duration such as 10m", v)
+		}
+	}
+	if follow {
+		switch {
+		case len(deploy.SplitTags(deviceUID)) != 1:
+			problems.addf("follow requires device_uid to name a single device")
+		case !issueDFU:
+			problems.addf("follow requires issue_dfu to be enabled")
+		case !scheduleAt.IsZero():
+			problems.addf("follow cannot be combined with schedule_at; the scheduled DFU starts after the action exits")
+		case waitForCompletion:
+			problems.addf("follow cannot be combined with wait_for_completion; follow already waits for the device")
+		}
 	}
 
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if operation == deploy.OperationAB {
+		switch {
+		case len(firmwareFiles) != 2:
+			problems.addf("operation ab takes two firmware files, A then B, got %d", len(firmwareFiles))
+		case len(cohortA) == 0 || len(cohortB) == 0:
+			problems.addf("operation ab requires cohort_a and cohort_b to select the devices for each firmware file")
+		case deviceUID != "" || tag != "" || serialNumber != "" || fleetUID != "" || fleetName != "" ||
+			productUID != "" || sku != "" || location != "" || notecardFirmware != "" || len(deviceQuery) > 0:
+			problems.addf("operation ab targets the devices selected by cohort_a and cohort_b; unset %s", strings.Join(deploy.TargetingInputs, ", "))
+		case !issueDFU:
+			problems.addf("operation ab requires issue_dfu to be enabled")
+		case dryRun:
+			problems.addf("operation ab cannot be combined with dry_run")
+		case !scheduleAt.IsZero():
+			problems.addf("operation ab cannot be combined with schedule_at; the comparison needs both rollouts to start now")
+		case follow:
+			problems.addf("operation ab cannot be combined with follow; it already waits for both cohorts")
+		case rolloutPercentage > 0:
+			problems.addf("operation ab cannot be combined with rollout_percentage; size the cohorts instead")
+		}
+	} else if len(cohortA) > 0 || len(cohortB) > 0 {
+		config.Warnf("cohort_a and cohort_b are only used with operation ab; ignoring them")
+	}
+	if len(extraDFUParams) > 0 && !issueDFU {
+		config.Warnf("extra_dfu_params only applies to the DFU request; ignoring it because issue_dfu is false")
+	}
+
+	// Get validate operation inputs
+	validateBudget := deploy.DefaultValidateBudget
+	if v := inputs.get("validate_budget"); v != "" {
+		validateBudget, err = time.ParseDuration(v)
+		if err != nil || validateBudget <= 0 {
+			problems.addf("Invalid validate_budget %q: must be a positive duration such as 20s", v)
+		}
+	}
 
-	// Execute request
-	resp, err := c.httpClient.Do(req)
+	// Get report and target freezing inputs
+	reportPath := inputs.get("report_path")
+	resultFile := inputs.get("result_file")
+	freezeTargets, err := parseBoolInput("freeze_targets", inputs.get("freeze_targets"), false)
 	if err != nil {
-		return fmt.Errorf("OAuth2 request failed: %w", err)
+		problems.addf("%v", err)
+	}
+	resumeFromReport := inputs.get("resume_from_report")
+	if freezeTargets && reportPath == "" {
+		problems.addf("report_path is required when freeze_targets is true")
 	}
-	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+	// Get firmware format inputs
+	skipFormatCheck, err := parseBoolInput("skip_format_check", inputs.get("skip_format_check"), false)
 	if err != nil {
-		return fmt.Errorf("failed to read OAuth2 response: %w", err)
+		problems.addf("%v", err)
+	}
+	var allowedExtensions []string
+	checkMagic := false
+	if !skipFormatCheck {
+		allowed := inputs.get("allowed_extensions")
+		if allowed == "" {
+			allowed = deploy.DefaultAllowedExtensions
+		}
+		allowedExtensions, err = deploy.ParseAllowedExtensions(allowed)
+		if err != nil {
+			problems.addf("%v", err)
+		}
+		checkMagic, err = parseBoolInput("check_magic", inputs.get("check_magic"), false)
+		if err != nil {
+			problems.addf("%v", err)
+		}
 	}
 
-	// Check status code
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("OAuth2 request failed with status %d: %s", resp.StatusCode, string(body))
+	// Get file stability inputs
+	waitForStable, err := parseBoolInput("wait_for_stable_file", inputs.get("wait_for_stable_file"), false)
+	if err != nil {
+		problems.addf("%v", err)
 	}
+	stableFileTimeout := deploy.DefaultStableFileTimeout
+	if v := inputs.get("stable_file_timeout"); v != "" {
+		stableFileTimeout, err = time.ParseDuration(v)
+		if err != nil || stableFileTimeout <= 0 {
+			problems.addf("Invalid stable_file_timeout %q: must be a positive duration such as 30s or 5m", v)
+		}
+	}
+
+	problems.check(action)
 
-	// Parse response
-	var tokenResp OAuth2TokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return fmt.Errorf("failed to parse OAuth2 response: %w", err)
+	log.Printf("Starting firmware deployment to Notehub...")
+	log.Printf("Project UID: %s", projectUID)
+	for _, f := range firmwareFiles {
+		log.Printf("Firmware File: %s", deploy.DisplayFirmwareFile(f))
 	}
+	log.Printf("Firmware Type: %s", firmwareType)
+	log.Printf("Random Seed: %d (set random_seed to replay this run)", randomSeed)
+	if firmwareDir != "" {
+		log.Printf("Firmware Directory: %s", firmwareDir)
+	}
+	provenance := inputs.provenance()
+	logProvenance(provenance)
 
-	if tokenResp.AccessToken == "" {
-		return fmt.Errorf("OAuth2 response missing access token")
+	if err := config.StrictCheckpoint("configuration"); err != nil {
+		failBeforeDeployment(action, err, phaseStrict)
 	}
 
-	c.accessToken = tokenResp.AccessToken
-	log.Printf("✅ OAuth2 token obtained successfully")
+	// Execute deployment
+	*config = deploy.DeploymentConfig{
+		ProjectUID:       projectUID,
+		FirmwareFile:     firmwareFile,
+		FirmwareDir:      firmwareDir,
+		FirmwareType:     firmwareType,
+		Operation:        operation,
+		Channel:          channel,
+		PromoteFrom:      promoteFrom,
+		ExpectedSHA256:   expectedSHA256,
+		IssueDFU:         issueDFU,
+		ScheduleAt:       scheduleAt,
+		SkipIfExists:     skipIfExists,
+		ForceUpload:      forceUpload,
+		DryRun:           dryRun,
+		ClientID:         clientID,
+		ClientSecret:     clientSecret,
+		DeviceUID:        deviceUID,
+		Tag:              tag,
+		NoMatchBehavior:  noMatchBehavior,
+		SerialNumber:     serialNumber,
+		FleetUID:         fleetUID,
+		FleetName:        fleetName,
+		ProductUID:       productUID,
+		NotecardFirmware: notecardFirmware,
+		Location:         location,
+		SKU:              sku,
+		DeviceQuery:      deviceQuery,
+		Hook: &deploy.HookConfig{
+			Command:      hookCommand,
+			Phases:       hookPhases,
+			Timeout:      hookTimeout,
+			PassSecrets:  hookPassSecrets,
+			ClientID:     clientID,
+			ClientSecret: clientSecret,
+			APIToken:     apiToken,
+		},
+		Lock: &deploy.LockConfig{
+			Enabled:     lockEnabled,
+			OnHeld:      lockOnHeld,
+			TTL:         lockTTL,
+			WaitTimeout: lockWaitTimeout,
+			SettleDelay: deploy.DefaultLockSettleDelay,
+		},
+		APIBaseURL:        apiBaseURL,
+		OAuthTokenURL:     oauthTokenURL,
+		HTTPTimeout:       httpTimeout,
+		MaxRetries:        maxRetries,
+		RetryBaseDelay:    retryBaseDelay,
+		WaitForStableFile: waitForStable,
+		StableFileTimeout: stableFileTimeout,
 
-	return nil
-}
+		MinUploadThroughputBps: minUploadThroughput,
 
-// UploadFirmware uploads a firmware binary file to Notehub
-func (c *NotehubClient) UploadFirmware(ctx context.Context, projectUID, firmwareFile string) (*FirmwareUploadResponse, error) {
-	log.Printf("Uploading firmware to Notehub...")
+		SKUSizeLimits:      skuSizeLimits,
+		OnSizeExceeded:     onSizeExceeded,
+		UnknownSKUBehavior: unknownSKUBehavior,
 
-	// Read firmware file
-	fileData, err := os.ReadFile(firmwareFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read firmware file: %w", err)
-	}
+		FreezeTargets:    freezeTargets,
+		ResumeFromReport: resumeFromReport,
 
-	filename := filepath.Base(firmwareFile)
-	fileSize := len(fileData)
+		WaitForCompletion: waitForCompletion,
+		WaitTimeout:       waitTimeout,
+		PollInterval:      pollInterval,
+		FailOnDeviceError: failOnDeviceError,
 
-	log.Printf("  - Project: %s", projectUID)
-	log.Printf("  - File: %s", filename)
-	log.Printf("  - Size: %d bytes", fileSize)
+		Baseline:          baseline,
+		FailOnSlowRollout: failOnSlowRollout,
 
-	// Create upload URL
-	uploadURL := fmt.Sprintf("%s/projects/%s/firmware/host/%s", c.baseURL, projectUID, filename)
+		ValidateBudget: validateBudget,
 
-	// Create request with binary data
-	req, err := http.NewRequestWithContext(ctx, "PUT", uploadURL, bytes.NewReader(fileData))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create upload request: %w", err)
-	}
+		AutoCleanupOnQuota: autoCleanupOnQuota,
+		RetainLast:         retainLast,
 
-	// Set headers
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
-	req.Header.Set("Content-Type", "application/octet-stream")
+		AllowAllDevices: allowAllDevices,
+		CountTargets:    countTargets,
 
-	// Execute request
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("firmware upload request failed: %w", err)
-	}
-	defer resp.Body.Close()
+		Follow:         follow,
+		FollowTimeout:  followTimeout,
+		FollowInterval: deploy.DefaultFollowInterval,
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read upload response: %w", err)
-	}
+		RandomSeed: randomSeed,
 
-	// Check status code
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, fmt.Errorf("firmware upload failed with status %d: %s", resp.StatusCode, string(body))
-	}
+		InsecureSkipVerify: insecureSkipVerify,
 
-	// Parse response
-	var uploadResp FirmwareUploadResponse
-	if err := json.Unmarshal(body, &uploadResp); err != nil {
-		return nil, fmt.Errorf("failed to parse upload response: %w", err)
-	}
+		ExcludeTags:       excludeTags,
+		ExcludeDeviceUIDs: excludeDeviceUIDs,
 
-	log.Printf("✅ Firmware upload successful")
-	log.Printf("✅ Captured uploaded filename: %s", uploadResp.Filename)
+		ConfigProvenance: provenance,
 
-	return &uploadResp, nil
-}
+		MaxClockSkew: maxClockSkew,
 
-// addCommaSeparatedParams adds comma-separated values as multiple query parameters
-func addCommaSeparatedParams(queryParams url.Values, paramName, value string) {
-	if value == "" {
-		return
-	}
+		AllowedExtensions: allowedExtensions,
+		CheckMagic:        checkMagic,
+		SkipFormatCheck:   skipFormatCheck,
 
-	if strings.Contains(value, ",") {
-		values := strings.Split(value, ",")
-		for _, v := range values {
-			v = strings.TrimSpace(v)
-			if v != "" {
-				queryParams.Add(paramName, v)
-			}
-		}
-	} else {
-		queryParams.Set(paramName, value)
-	}
-}
+		VerifyArtifactChain: verifyArtifactChain,
 
-// TriggerDFU initiates a device firmware update for targeted devices
-func (c *NotehubClient) TriggerDFU(ctx context.Context, config *DeploymentConfig, filename string) error {
-	log.Printf("Triggering device firmware update...")
+		UploadTimeout:  uploadTimeout,
+		OverallTimeout: overallTimeout,
 
-	// Build query parameters from optional targeting inputs
-	queryParams := url.Values{}
+		MinUploadBytesPerSec: minUploadBytesPerSec,
 
-	addCommaSeparatedParams(queryParams, "deviceUID", config.DeviceUID)
-	addCommaSeparatedParams(queryParams, "tags", config.Tag)
-	addCommaSeparatedParams(queryParams, "serialNumber", config.SerialNumber)
-	addCommaSeparatedParams(queryParams, "fleetUID", config.FleetUID)
-	addCommaSeparatedParams(queryParams, "productUID", config.ProductUID)
-	addCommaSeparatedParams(queryParams, "notecardFirmware", config.NotecardFirmware)
-	addCommaSeparatedParams(queryParams, "location", config.Location)
-	addCommaSeparatedParams(queryParams, "sku", config.SKU)
+		TokenHandle:       tokenHandle,
+		ExportTokenHandle: exportTokenHandle,
 
-	// Build DFU URL
-	dfuURL := fmt.Sprintf("%s/projects/%s/dfu/host/update", c.baseURL, config.ProjectUID)
-	if len(queryParams) > 0 {
-		dfuURL += "?" + queryParams.Encode()
-	}
+		MaxDevices: maxDevices,
 
-	log.Printf("DFU URL: %s", dfuURL)
+		CohortA:         cohortA,
+		CohortB:         cohortB,
+		ABMinCohortSize: abMinCohortSize,
 
-	// Create JSON payload
-	payload := DFURequest{
-		Filename: filename,
-	}
+		RolloutPercentage: rolloutPercentage,
 
-	payloadBytes, err := json.Marshal(payload)
-	if err != nil {
-		return fmt.Errorf("failed to marshal DFU payload: %w", err)
-	}
+		ReuseIdentical: reuseIdentical,
 
-	log.Printf("Payload: %s", string(payloadBytes))
+		MaxDFUQueryLength: maxDFUQueryLength,
 
-	// Create request
-	req, err := http.NewRequestWithContext(ctx, "POST", dfuURL, bytes.NewReader(payloadBytes))
-	if err != nil {
-		return fmt.Errorf("failed to create DFU request: %w", err)
-	}
+		ExtraDFUParams: extraDFUParams,
 
-	// Set headers
-	req.Header.Set("Authorization", "Bearer "+c.accessToken)
-	req.Header.Set("Content-Type", "application/json")
+		MaxFirmwareSize: maxFirmwareSize,
 
-	// Execute request
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("DFU request failed: %w", err)
-	}
-	defer resp.Body.Close()
+		RetainFirmwareCount: retainFirmwareCount,
+		RetentionDryRun:     retentionDryRun,
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read DFU response: %w", err)
-	}
+		TagMatch: tagMatch,
 
-	// Check status code
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return fmt.Errorf("device firmware update failed with status %d: %s", resp.StatusCode, string(body))
-	}
+		RequireConfirmationToken: requireConfirmationToken,
+		ConfirmationToken:        confirmationToken,
 
-	log.Printf("✅ Device firmware update triggered successfully")
-	log.Printf("Response: %s", string(body))
+		FirmwareVersion: firmwareVersion,
+		AllowDowngrade:  allowDowngrade,
 
-	return nil
-}
+		UploadProgressInterval: uploadProgressInterval,
 
-// deployFirmware orchestrates the entire firmware deployment process
-func deployFirmware(ctx context.Context, config *DeploymentConfig) error {
-	// Initialize Notehub client
-	client := NewNotehubClient()
+		ResolveTargets: resolveTargets,
+		DeviceName:     deviceName,
 
-	// Step 1: Authenticate with Notehub
-	if err := client.Authenticate(ctx, config.ClientID, config.ClientSecret); err != nil {
-		return fmt.Errorf("authentication failed: %w", err)
-	}
+		CancelDFUOnAbort: cancelDFUOnAbort,
 
-	// Step 2: Validate firmware file exists
-	firmwareFile := filepath.Join("./firmware", config.FirmwareFile)
-	if _, err := os.Stat(firmwareFile); os.IsNotExist(err) {
-		return fmt.Errorf("firmware file not found: %s", firmwareFile)
-	}
+		CleanupOnFailure: cleanupOnFailure,
 
-	log.Printf("✅ Input validation passed")
+		SkipUpload: skipUpload,
 
-	// Step 3: Upload firmware to Notehub
-	uploadResp, err := client.UploadFirmware(ctx, config.ProjectUID, firmwareFile)
-	if err != nil {
-		return fmt.Errorf("firmware upload failed: %w", err)
-	}
+		UploadAs: uploadAs,
 
-	log.Printf("✅ Firmware uploaded to Notehub")
+		APIToken: apiToken,
 
-	// Step 4: Trigger Device Firmware Update
-	if err := client.TriggerDFU(ctx, config, uploadResp.Filename); err != nil {
-		return fmt.Errorf("DFU trigger failed: %w", err)
-	}
+		CompressUpload: compressUpload,
 
-	log.Printf("✅ Device firmware update triggered")
+		TreatPendingAsFailure: treatPendingAsFailure,
+		MaxFailedDevices:      maxFailedDevices,
+		MinCompletedPercent:   minCompletedPercent,
 
-	// Step 5: Deployment Summary
-	logDeploymentSummary(config, uploadResp.Filename)
+		MaxRateLimitWait: maxRateLimitWait,
 
-	return nil
-}
+		AllowConflictingTargets: allowConflictingTargets,
 
-// logDeploymentSummary prints a comprehensive deployment summary
-func logDeploymentSummary(config *DeploymentConfig, filename string) {
-	log.Printf("=== Deployment Summary ===")
-	log.Printf("Project UID: %s", config.ProjectUID)
-	log.Printf("Firmware File: %s", config.FirmwareFile)
-	log.Printf("Uploaded Filename: %s", filename)
+		Workspace: workspace,
 
-	// Log targeting parameters if specified
-	if config.DeviceUID != "" {
-		log.Printf("Target Device UID: %s", config.DeviceUID)
-	}
-	if config.Tag != "" {
-		log.Printf("Target Tag: %s", config.Tag)
+		Logger: config.Logger,
+		Strict: config.Strict,
 	}
-	if config.SerialNumber != "" {
-		log.Printf("Target Serial: %s", config.SerialNumber)
+	report, err := deploy.DeployFirmwareFiles(ctx, config, firmwareFiles, dfuFile)
+	if err == nil {
+		err = config.StrictCheckpoint("the deployment")
 	}
-	if config.FleetUID != "" {
-		log.Printf("Fleet UID: %s", config.FleetUID)
-	}
-	if config.ProductUID != "" {
-		log.Printf("Product UID: %s", config.ProductUID)
+	if err != nil {
+		report.RecordFailure(err)
+	}
+	deploy.LogRetrySummary(report.RetrySummary, config.Logger)
+	if reportPath != "" {
+		if werr := deploy.WriteReport(reportPath, report); werr != nil {
+			action.Errorf("%v", werr)
+		} else {
+			log.Printf("Deployment report written to %s", reportPath)
+		}
 	}
-	if config.NotecardFirmware != "" {
-		log.Printf("Notecard Firmware: %s", config.NotecardFirmware)
+	if resultFile != "" {
+		if werr := deploy.WriteResult(resultFile, report); werr != nil {
+			action.Errorf("%v", werr)
+		} else {
+			log.Printf("Deployment result written to %s", resultFile)
+		}
 	}
-	if config.Location != "" {
-		log.Printf("Location: %s", config.Location)
+	setOutputs(action, report)
+	action.AddStepSummary(deploy.DeploymentSummaryMarkdown(report))
+	if err != nil {
+		exitWith(action, 1, err, report.ErrorPhase, reportPath, resultFile)
 	}
-	if config.SKU != "" {
-		log.Printf("SKU: %s", config.SKU)
+
+	log.Printf("✅ Firmware deployment completed successfully")
+	exitWith(action, 0, nil, "", reportPath, resultFile)
+}
+
+// runExportBaseline performs the export-baseline operation, which needs no Notehub access,
+// writing the baseline of the reports matching the reports pattern to path
+func runExportBaseline(action *githubactions.Action, reports, path string) {
+	log.Printf("Exporting rollout baseline from %s...", reports)
+	baseline, err := deploy.ExportBaseline(reports, path, actionLogger{action})
+	if err != nil {
+		failBeforeDeployment(action, err, phaseExportBaseline)
 	}
 
-	log.Printf("Deployment Status: SUCCESS")
+	log.Printf("✅ Baseline of %d rollout(s) written to %s", baseline.Runs, path)
+	action.SetOutput("baseline_runs", fmt.Sprint(baseline.Runs))
+	exitWith(action, 0, nil, "", path)
 }
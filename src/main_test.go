@@ -1,415 +1,86 @@
 package main
 
 import (
-	"context"
 	"fmt"
-	"net/url"
-	"os"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
-	"time"
 )
 
-func TestNewNotehubClient(t *testing.T) {
-	client := NewNotehubClient()
+func TestExpectedSHA256MismatchFailsBeforeUpload(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		fmt.Fprint(w, `{"access_token":"token","expires_in":3600}`)
+	}))
+	defer server.Close()
 
-	if client == nil {
-		t.Fatal("NewNotehubClient returned nil")
+	code, _, out := runAction(t, server.URL, "INPUT_EXPECTED_SHA256="+strings.Repeat("0", 64))
+	if code != 1 {
+		t.Fatalf("Expected the action to fail, got exit code %d:\n%s", code, out)
 	}
-
-	if client.baseURL != "https://api.notefile.net/v1" {
-		t.Errorf("Expected baseURL to be 'https://api.notefile.net/v1', got '%s'", client.baseURL)
-	}
-
-	if client.httpClient == nil {
-		t.Fatal("httpClient should not be nil")
-	}
-
-	if client.httpClient.Timeout != 30*time.Second {
-		t.Errorf("Expected timeout to be 30s, got %v", client.httpClient.Timeout)
-	}
-}
-
-func TestAuthenticate_InvalidCredentials(t *testing.T) {
-	client := NewNotehubClient()
-	ctx := context.Background()
-
-	// Test with empty credentials - should fail
-	err := client.Authenticate(ctx, "", "")
-	if err == nil {
-		t.Error("Expected authentication to fail with empty credentials")
-	}
-}
-
-func TestDeploymentConfig_Validation(t *testing.T) {
-	config := &DeploymentConfig{
-		ProjectUID:   "test-project",
-		FirmwareFile: "test.bin",
-		ClientID:     "test-client",
-		ClientSecret: "test-secret",
+	if !strings.Contains(string(out), "SHA-256 mismatch") {
+		t.Errorf("Expected a checksum mismatch error, got:\n%s", out)
 	}
-
-	if config.ProjectUID == "" {
-		t.Error("ProjectUID should not be empty")
-	}
-
-	if config.FirmwareFile == "" {
-		t.Error("FirmwareFile should not be empty")
+	for _, r := range requests {
+		if r != "POST /oauth2/token" {
+			t.Errorf("Expected no requests after the checksum check, got %s", r)
+		}
 	}
 }
 
-func TestUploadFirmware_MissingFile(t *testing.T) {
-	client := NewNotehubClient()
-	ctx := context.Background()
-
-	// Test with non-existent file - should fail
-	_, err := client.UploadFirmware(ctx, "test-project", "nonexistent-file.bin")
-	if err == nil {
-		t.Error("Expected upload to fail with non-existent file")
-	}
-
-	if !strings.Contains(err.Error(), "failed to read firmware file") {
-		t.Errorf("Expected error about reading file, got: %v", err)
-	}
-}
-
-func TestUploadFirmware_NoToken(t *testing.T) {
-	client := NewNotehubClient()
-	// Don't set access token
-	ctx := context.Background()
-
-	// Create a temporary test file
-	testFile := "test-firmware.bin"
-	testData := []byte("test firmware data")
-	err := os.WriteFile(testFile, testData, 0644)
-	if err != nil {
-		t.Fatalf("Failed to create test file: %v", err)
-	}
-	defer os.Remove(testFile)
-
-	// Test upload without authentication - should eventually fail at HTTP level
-	_, err = client.UploadFirmware(ctx, "test-project", testFile)
-	if err == nil {
-		t.Error("Expected upload to fail without access token")
-	}
-}
-
-func TestTriggerDFU_NoToken(t *testing.T) {
-	client := NewNotehubClient()
-	// Don't set access token
-	ctx := context.Background()
-
-	config := &DeploymentConfig{
-		ProjectUID: "test-project",
-		DeviceUID:  "test-device",
-	}
-
-	// Test DFU trigger without authentication - should eventually fail at HTTP level
-	err := client.TriggerDFU(ctx, config, "test-firmware.bin")
-	if err == nil {
-		t.Error("Expected DFU trigger to fail without access token")
-	}
-}
-
-func TestTriggerDFU_QueryParams(t *testing.T) {
-	// Test query parameter building (without making HTTP calls)
-	config := &DeploymentConfig{
-		ProjectUID:       "test-project",
-		DeviceUID:        "device-123",
-		Tag:              "production",
-		SerialNumber:     "SN123",
-		FleetUID:         "fleet-456",
-		ProductUID:       "product-789",
-		NotecardFirmware: "v1.0.0",
-		Location:         "factory",
-		SKU:              "SKU-ABC",
-	}
-
-	// Verify all fields are set
-	if config.DeviceUID == "" {
-		t.Error("DeviceUID should not be empty")
-	}
-	if config.Tag == "" {
-		t.Error("Tag should not be empty")
-	}
-	if config.SerialNumber == "" {
-		t.Error("SerialNumber should not be empty")
-	}
-	if config.FleetUID == "" {
-		t.Error("FleetUID should not be empty")
-	}
-	if config.ProductUID == "" {
-		t.Error("ProductUID should not be empty")
-	}
-	if config.NotecardFirmware == "" {
-		t.Error("NotecardFirmware should not be empty")
-	}
-	if config.Location == "" {
-		t.Error("Location should not be empty")
-	}
-	if config.SKU == "" {
-		t.Error("SKU should not be empty")
-	}
-}
-
-func TestAddCommaSeparatedParams(t *testing.T) {
+func TestDryRun_EndToEnd(t *testing.T) {
 	tests := []struct {
-		name           string
-		paramName      string
-		value          string
-		expectedParams map[string][]string
+		name       string
+		issueDFU   string
+		expectPOST bool
 	}{
-		{
-			name:      "single value",
-			paramName: "deviceUID",
-			value:     "device-123",
-			expectedParams: map[string][]string{
-				"deviceUID": {"device-123"},
-			},
-		},
-		{
-			name:      "multiple values",
-			paramName: "tags",
-			value:     "production,sensor,outdoor",
-			expectedParams: map[string][]string{
-				"tags": {"production", "sensor", "outdoor"},
-			},
-		},
-		{
-			name:      "values with spaces",
-			paramName: "location",
-			value:     "warehouse, factory , office",
-			expectedParams: map[string][]string{
-				"location": {"warehouse", "factory", "office"},
-			},
-		},
-		{
-			name:           "empty value",
-			paramName:      "sku",
-			value:          "",
-			expectedParams: map[string][]string{},
-		},
-		{
-			name:      "values with empty segments",
-			paramName: "serialNumber",
-			value:     "SN001,,SN003,",
-			expectedParams: map[string][]string{
-				"serialNumber": {"SN001", "SN003"},
-			},
-		},
+		{"full DFU", "true", true},
+		{"upload only", "false", false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			queryParams := url.Values{}
-			addCommaSeparatedParams(queryParams, tt.paramName, tt.value)
-
-			// Check if we got the expected parameters
-			for expectedParam, expectedValues := range tt.expectedParams {
-				actualValues := queryParams[expectedParam]
-				if len(actualValues) != len(expectedValues) {
-					t.Errorf("Expected %d values for %s, got %d", len(expectedValues), expectedParam, len(actualValues))
-					continue
-				}
-				for i, expectedValue := range expectedValues {
-					if actualValues[i] != expectedValue {
-						t.Errorf("Expected value %s at index %d, got %s", expectedValue, i, actualValues[i])
-					}
+			var mu sync.Mutex
+			var mutating []string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/oauth2/token" {
+					w.Write([]byte(`{"access_token":"token","expires_in":3600}`))
+					return
 				}
+				mu.Lock()
+				mutating = append(mutating, r.Method+" "+r.URL.Path)
+				mu.Unlock()
+				w.Write([]byte(`{}`))
+			}))
+			defer server.Close()
+
+			code, dir, out := runAction(t, server.URL, "INPUT_DRY_RUN=true", "INPUT_ISSUE_DFU="+tt.issueDFU)
+			if code != 0 {
+				t.Fatalf("Expected dry run to succeed, got exit code %d:\n%s", code, out)
 			}
-
-			// Check that we don't have unexpected parameters
-			for actualParam := range queryParams {
-				if _, expected := tt.expectedParams[actualParam]; !expected {
-					t.Errorf("Unexpected parameter %s found", actualParam)
-				}
+			if len(mutating) > 0 {
+				t.Errorf("Dry run sent requests: %v", mutating)
 			}
-		})
-	}
-}
-
-func TestTriggerDFU_CommaSeparatedQueryParams(t *testing.T) {
-	tests := []struct {
-		name           string
-		config         *DeploymentConfig
-		expectedParams map[string][]string
-	}{
-		{
-			name: "single values",
-			config: &DeploymentConfig{
-				ProjectUID:   "test-project",
-				DeviceUID:    "device-123",
-				Tag:          "production",
-				SerialNumber: "SN123",
-			},
-			expectedParams: map[string][]string{
-				"deviceUID":    {"device-123"},
-				"tags":         {"production"},
-				"serialNumber": {"SN123"},
-			},
-		},
-		{
-			name: "multiple comma-separated values",
-			config: &DeploymentConfig{
-				ProjectUID:   "test-project",
-				DeviceUID:    "device-123,device-456,device-789",
-				Tag:          "production,sensor,outdoor",
-				SerialNumber: "SN001,SN002,SN003",
-				FleetUID:     "fleet-1,fleet-2",
-				ProductUID:   "product-A,product-B",
-			},
-			expectedParams: map[string][]string{
-				"deviceUID":    {"device-123", "device-456", "device-789"},
-				"tags":         {"production", "sensor", "outdoor"},
-				"serialNumber": {"SN001", "SN002", "SN003"},
-				"fleetUID":     {"fleet-1", "fleet-2"},
-				"productUID":   {"product-A", "product-B"},
-			},
-		},
-		{
-			name: "values with spaces and empty segments",
-			config: &DeploymentConfig{
-				ProjectUID:       "test-project",
-				Tag:              "production, sensor , outdoor",
-				NotecardFirmware: "v1.0.0,,v1.0.2,",
-				Location:         "warehouse, factory",
-				SKU:              "SKU-A,, SKU-C",
-			},
-			expectedParams: map[string][]string{
-				"tags":             {"production", "sensor", "outdoor"},
-				"notecardFirmware": {"v1.0.0", "v1.0.2"},
-				"location":         {"warehouse", "factory"},
-				"sku":              {"SKU-A", "SKU-C"},
-			},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// We'll test the query parameter building logic by examining what gets built
-			// without actually making HTTP calls
-			queryParams := url.Values{}
-
-			// Apply the same logic as TriggerDFU
-			addCommaSeparatedParams(queryParams, "deviceUID", tt.config.DeviceUID)
-			addCommaSeparatedParams(queryParams, "tags", tt.config.Tag)
-			addCommaSeparatedParams(queryParams, "serialNumber", tt.config.SerialNumber)
-			addCommaSeparatedParams(queryParams, "fleetUID", tt.config.FleetUID)
-			addCommaSeparatedParams(queryParams, "productUID", tt.config.ProductUID)
-			addCommaSeparatedParams(queryParams, "notecardFirmware", tt.config.NotecardFirmware)
-			addCommaSeparatedParams(queryParams, "location", tt.config.Location)
-			addCommaSeparatedParams(queryParams, "sku", tt.config.SKU)
 
-			// Verify expected parameters
-			for expectedParam, expectedValues := range tt.expectedParams {
-				actualValues := queryParams[expectedParam]
-				if len(actualValues) != len(expectedValues) {
-					t.Errorf("Expected %d values for %s, got %d", len(expectedValues), expectedParam, len(actualValues))
-					continue
-				}
-				for i, expectedValue := range expectedValues {
-					if actualValues[i] != expectedValue {
-						t.Errorf("Expected value %s at index %d for %s, got %s", expectedValue, i, expectedParam, actualValues[i])
-					}
-				}
+			logs := string(out)
+			if !strings.Contains(logs, "Would PUT "+server.URL+"/projects/app:123/firmware/host/app.bin") {
+				t.Errorf("Expected planned upload URL in:\n%s", logs)
 			}
-
-			// Verify we don't have unexpected parameters
-			for actualParam := range queryParams {
-				if _, expected := tt.expectedParams[actualParam]; !expected {
-					t.Errorf("Unexpected parameter %s found with values %v", actualParam, queryParams[actualParam])
-				}
+			if got := strings.Contains(logs, "Would POST "+server.URL+"/projects/app:123/dfu/host/update?deviceUID=dev%3A1"); got != tt.expectPOST {
+				t.Errorf("Planned DFU logged = %t, expected %t:\n%s", got, tt.expectPOST, logs)
 			}
-		})
-	}
-}
-
-func TestTriggerDFU_CompleteURLGeneration(t *testing.T) {
-	tests := []struct {
-		name        string
-		config      *DeploymentConfig
-		expectedURL string
-	}{
-		{
-			name: "single tag",
-			config: &DeploymentConfig{
-				ProjectUID: "app:12345678-1234-1234-1234-123456789012",
-				Tag:        "production",
-			},
-			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?tags=production",
-		},
-		{
-			name: "multiple tags",
-			config: &DeploymentConfig{
-				ProjectUID: "app:12345678-1234-1234-1234-123456789012",
-				Tag:        "production,sensor,outdoor",
-			},
-			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?tags=production&tags=sensor&tags=outdoor",
-		},
-		{
-			name: "multiple device UIDs",
-			config: &DeploymentConfig{
-				ProjectUID: "app:12345678-1234-1234-1234-123456789012",
-				DeviceUID:  "device-123,device-456,device-789",
-			},
-			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?deviceUID=device-123&deviceUID=device-456&deviceUID=device-789",
-		},
-		{
-			name: "mixed parameters with comma-separated values",
-			config: &DeploymentConfig{
-				ProjectUID:   "app:12345678-1234-1234-1234-123456789012",
-				DeviceUID:    "device-123,device-456",
-				Tag:          "production,sensor",
-				SerialNumber: "SN001",
-				FleetUID:     "fleet-A,fleet-B",
-			},
-			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?deviceUID=device-123&deviceUID=device-456&fleetUID=fleet-A&fleetUID=fleet-B&serialNumber=SN001&tags=production&tags=sensor",
-		},
-		{
-			name: "all parameters with multiple values",
-			config: &DeploymentConfig{
-				ProjectUID:       "app:12345678-1234-1234-1234-123456789012",
-				DeviceUID:        "dev1,dev2",
-				Tag:              "tag1,tag2",
-				SerialNumber:     "SN1,SN2",
-				FleetUID:         "fleet1,fleet2",
-				ProductUID:       "prod1,prod2",
-				NotecardFirmware: "fw1,fw2",
-				Location:         "loc1,loc2",
-				SKU:              "sku1,sku2",
-			},
-			expectedURL: "https://api.notefile.net/v1/projects/app:12345678-1234-1234-1234-123456789012/dfu/host/update?deviceUID=dev1&deviceUID=dev2&fleetUID=fleet1&fleetUID=fleet2&location=loc1&location=loc2&notecardFirmware=fw1&notecardFirmware=fw2&productUID=prod1&productUID=prod2&serialNumber=SN1&serialNumber=SN2&sku=sku1&sku=sku2&tags=tag1&tags=tag2",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			// Build query parameters using the same logic as TriggerDFU
-			queryParams := url.Values{}
-
-			addCommaSeparatedParams(queryParams, "deviceUID", tt.config.DeviceUID)
-			addCommaSeparatedParams(queryParams, "tags", tt.config.Tag)
-			addCommaSeparatedParams(queryParams, "serialNumber", tt.config.SerialNumber)
-			addCommaSeparatedParams(queryParams, "fleetUID", tt.config.FleetUID)
-			addCommaSeparatedParams(queryParams, "productUID", tt.config.ProductUID)
-			addCommaSeparatedParams(queryParams, "notecardFirmware", tt.config.NotecardFirmware)
-			addCommaSeparatedParams(queryParams, "location", tt.config.Location)
-			addCommaSeparatedParams(queryParams, "sku", tt.config.SKU)
-
-			// Build the complete URL
-			baseURL := "https://api.notefile.net/v1"
-			dfuURL := fmt.Sprintf("%s/projects/%s/dfu/host/update", baseURL, tt.config.ProjectUID)
-			if len(queryParams) > 0 {
-				dfuURL += "?" + queryParams.Encode()
+			if !strings.Contains(logs, "Deployment Summary (DRY RUN)") {
+				t.Errorf("Expected summary marked DRY RUN in:\n%s", logs)
 			}
 
-			// Verify the complete URL matches expected
-			if dfuURL != tt.expectedURL {
-				t.Errorf("URL mismatch:\nExpected: %s\nActual:   %s", tt.expectedURL, dfuURL)
+			outputs := parseOutputFile(t, filepath.Join(dir, "output"))
+			if outputs["dry_run"] != "true" || outputs["dfu_triggered"] != "false" {
+				t.Errorf("Unexpected outputs %v", outputs)
 			}
-
-			// Also log the URL for visual verification
-			t.Logf("Generated URL: %s", dfuURL)
 		})
 	}
 }
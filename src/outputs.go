@@ -0,0 +1,22 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/blues/note-dfu-github/deploy"
+	"github.com/sethvargo/go-githubactions"
+)
+
+// setOutputs publishes the deployment results as step outputs for later workflow steps.
+// It is called whether or not the deployment succeeded, so outputs reflect how far it got.
+func setOutputs(action *githubactions.Action, report *deploy.DeploymentReport) {
+	outputs := report.Outputs()
+	names := make([]string, 0, len(outputs))
+	for name := range outputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action.SetOutput(name, outputs[name])
+	}
+}
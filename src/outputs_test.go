@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/blues/note-dfu-github/deploy"
+	"github.com/sethvargo/go-githubactions"
+)
+
+// readOutputs runs setOutputs against a temporary GITHUB_OUTPUT file and returns the
+// outputs written to it
+func readOutputs(t *testing.T, report *deploy.DeploymentReport) map[string]string {
+	t.Helper()
+	outputFile := filepath.Join(t.TempDir(), "output")
+	action := githubactions.New(githubactions.WithGetenv(func(key string) string {
+		if key == "GITHUB_OUTPUT" {
+			return outputFile
+		}
+		return ""
+	}))
+
+	setOutputs(action, report)
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read outputs: %v", err)
+	}
+
+	// Each output is written as "name<<DELIMITER\nvalue\nDELIMITER"
+	outputs := map[string]string{}
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i+1 < len(lines); i++ {
+		if name, _, ok := strings.Cut(lines[i], "<<"); ok {
+			outputs[name] = lines[i+1]
+		}
+	}
+	return outputs
+}
+
+func TestSetOutputs(t *testing.T) {
+	report := &deploy.DeploymentReport{UploadedFilename: "app$20250101.bin", DFUTriggered: true, Status: deploy.StatusSuccess}
+	outputs := readOutputs(t, report)
+
+	if len(outputs) != len(report.Outputs()) {
+		t.Errorf("Expected every output written, got %v", outputs)
+	}
+	for name, value := range report.Outputs() {
+		if outputs[name] != value {
+			t.Errorf("Output %s: expected %q, got %q", name, value, outputs[name])
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/sethvargo/go-githubactions"
+)
+
+// Input provenance values, recording where the value of each input came from
+const (
+	// ProvenanceInput marks a value given explicitly in the workflow step
+	ProvenanceInput = "input"
+
+	// ProvenanceActionDefault marks the default declared in action.yml, which the runner
+	// passes to the action as though it were given
+	ProvenanceActionDefault = "action_default"
+
+	// ProvenanceDefault marks an input left empty, so the action's built-in default applies
+	ProvenanceDefault = "default"
+)
+
+// actionDefaults mirrors the input defaults declared in action.yml. The runner passes
+// these to the action like any other value, so they are recognized by value.
+var actionDefaults = map[string]string{
+	"firmware_dir":              "./firmware",
+	"operation":                 "deploy",
+	"validate_budget":           "20s",
+	"issue_dfu":                 "true",
+	"skip_upload":               "false",
+	"dry_run":                   "false",
+	"skip_if_exists":            "false",
+	"force_upload":              "false",
+	"reuse_identical":           "false",
+	"auto_cleanup_on_quota":     "false",
+	"retain_last":               "10",
+	"retain_firmware_count":     "0",
+	"retention_dry_run":         "false",
+	"cleanup_on_failure":        "false",
+	"max_dfu_query_length":      "2000",
+	"max_firmware_size":         "1572864",
+	"firmware_type":             "host",
+	"allow_all_devices":         "false",
+	"allow_conflicting_targets": "false",
+	"strict":                    "false",
+	"verify_artifact_chain":     "false",
+	"count_targets":             "false",
+	"no_match_behavior":         "fail",
+	"tag_match":                 "any",
+	"resolve_targets":           "false",
+	"on_size_exceeded":          "fail",
+	"unknown_sku_behavior":      "allow",
+	"follow":                    "false",
+	"follow_timeout":            "15m",
+	"wait_for_completion":       "false",
+	"wait_timeout":              "30m",
+	"poll_interval":             "30s",
+	"fail_on_device_error":      "true",
+	"treat_pending_as_failure":  "true",
+	"baseline_percentile":       "90",
+	"fail_on_slow_rollout":      "false",
+	"freeze_targets":            "false",
+	"hook_timeout":              "60s",
+	"hook_pass_secrets":         "false",
+	"lock":                      "false",
+	"on_lock_held":              "fail",
+	"lock_ttl":                  "15m",
+	"lock_wait_timeout":         "10m",
+	"api_base_url":              "https://api.notefile.net/v1",
+	"oauth_token_url":           "https://notehub.io/oauth2/token",
+	"http_timeout":              "30s",
+	"upload_timeout":            "10m",
+	"min_upload_bytes_per_sec":  "0",
+	"upload_progress_interval":  "10s",
+	"compress_upload":           "false",
+	"cancel_dfu_on_abort":       "false",
+	"max_clock_skew":            "24h",
+	"ab_min_cohort_size":        "30",
+	"export_token_handle":       "false",
+	"insecure_skip_verify":      "false",
+	"max_retries":               "3",
+	"retry_initial_delay":       "1s",
+	"max_rate_limit_wait":       "5m",
+	"min_upload_throughput_bps": "10240",
+	"wait_for_stable_file":      "false",
+	"stable_file_timeout":       "30s",
+	"allowed_extensions":        ".bin,.hex",
+	"check_magic":               "false",
+	"skip_format_check":         "false",
+	"allow_downgrade":           "false",
+}
+
+// inputReader reads action inputs, recording the provenance of each one read
+type inputReader struct {
+	action  *githubactions.Action
+	sources map[string]string
+}
+
+// newInputReader returns an inputReader for the action's inputs
+func newInputReader(action *githubactions.Action) *inputReader {
+	return &inputReader{action: action, sources: map[string]string{}}
+}
+
+// get returns the named input, as action.GetInput does, and records where it came from
+func (r *inputReader) get(name string) string {
+	value := r.action.GetInput(name)
+	r.sources[name] = inputProvenance(name, value)
+	return value
+}
+
+// inputProvenance classifies the value read for the named input. The runner sets INPUT_*
+// for every input with an action.yml default, so whether the variable is set says nothing;
+// an input given its default value explicitly is reported as action_default.
+func inputProvenance(name, value string) string {
+	if value == "" {
+		return ProvenanceDefault
+	}
+	if d, ok := actionDefaults[name]; ok && value == d {
+		return ProvenanceActionDefault
+	}
+	return ProvenanceInput
+}
+
+// provenance returns the provenance of every input read so far, by input name
+func (r *inputReader) provenance() map[string]string {
+	p := make(map[string]string, len(r.sources))
+	for name, source := range r.sources {
+		p[name] = source
+	}
+	return p
+}
+
+// logProvenance prints which inputs were given explicitly; every other input took a default
+func logProvenance(provenance map[string]string) {
+	var explicit []string
+	for name, source := range provenance {
+		if source == ProvenanceInput {
+			explicit = append(explicit, name)
+		}
+	}
+	sort.Strings(explicit)
+	log.Printf("Inputs Given: %s (%d other input(s) defaulted)", strings.Join(explicit, ", "), len(provenance)-len(explicit))
+}
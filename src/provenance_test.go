@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/blues/note-dfu-github/deploy"
+	"github.com/sethvargo/go-githubactions"
+)
+
+func TestInputReader_Provenance(t *testing.T) {
+	env := map[string]string{
+		"INPUT_DEVICE_UID":    "dev:1",
+		"INPUT_FIRMWARE_TYPE": "host",
+		"INPUT_HTTP_TIMEOUT":  "5m",
+		"INPUT_TAG":           "   ",
+		"INPUT_ISSUE_DFU":     "TRUE",
+		"INPUT_POLL_INTERVAL": "1m",
+		// The runner sets every input with an action.yml default, given or not
+		"INPUT_LOCK_TTL": "15m",
+	}
+	inputs := newInputReader(githubactions.New(githubactions.WithGetenv(func(key string) string { return env[key] })))
+
+	tests := []struct {
+		name           string
+		expectedValue  string
+		expectedSource string
+	}{
+		{"device_uid", "dev:1", ProvenanceInput},
+		{"firmware_type", "host", ProvenanceActionDefault},
+		{"http_timeout", "5m", ProvenanceInput},
+		{"tag", "", ProvenanceDefault},
+		{"issue_dfu", "TRUE", ProvenanceInput},
+		{"random_seed", "", ProvenanceDefault},
+		{"max_retries", "", ProvenanceDefault},
+		{"poll_interval", "1m", ProvenanceInput},
+		{"lock_ttl", "15m", ProvenanceActionDefault},
+	}
+	for _, tt := range tests {
+		if value := inputs.get(tt.name); value != tt.expectedValue {
+			t.Errorf("get(%q) = %q, expected %q", tt.name, value, tt.expectedValue)
+		}
+	}
+
+	provenance := inputs.provenance()
+	for _, tt := range tests {
+		if provenance[tt.name] != tt.expectedSource {
+			t.Errorf("Provenance of %s: expected %q, got %q", tt.name, tt.expectedSource, provenance[tt.name])
+		}
+	}
+	if len(provenance) != len(tests) {
+		t.Errorf("Expected provenance for the %d inputs read, got %v", len(tests), provenance)
+	}
+}
+
+func TestActionDefaultsMatchActionYAML(t *testing.T) {
+	data, err := os.ReadFile("../action.yml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each input is an indented name, followed by its description, required flag, and default
+	declared := map[string]string{}
+	input := regexp.MustCompile(`(?m)^  ([a-z0-9_]+):\n(?:    [a-z]+: .*\n)*?    default: '(.*)'$`)
+	outputs := regexp.MustCompile(`(?m)^outputs:`).FindIndex(data)
+	for _, m := range input.FindAllSubmatch(data[:outputs[0]], -1) {
+		declared[string(m[1])] = string(m[2])
+	}
+
+	if !reflect.DeepEqual(declared, actionDefaults) {
+		t.Errorf("actionDefaults is out of sync with action.yml:\naction.yml: %v\nactionDefaults: %v", declared, actionDefaults)
+	}
+}
+
+func TestSetOutputs_ConfigProvenance(t *testing.T) {
+	outputs := readOutputs(t, &deploy.DeploymentReport{
+		Status:           deploy.StatusSuccess,
+		ConfigProvenance: map[string]string{"device_uid": ProvenanceInput, "tag": ProvenanceDefault},
+	})
+
+	if outputs["config_provenance"] != `{"device_uid":"input","tag":"default"}` {
+		t.Errorf("Unexpected config_provenance output %q", outputs["config_provenance"])
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownContext(t *testing.T) {
+	logged := make(chan string, 1)
+	ctx, stop := shutdownContext(func(format string, args ...any) { logged <- fmt.Sprintf(format, args...) })
+	defer stop()
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected SIGTERM to cancel the context")
+	}
+	if msg := <-logged; msg != "Received terminated; cancelling the deployment" {
+		t.Errorf("Unexpected log %q", msg)
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"runtime/debug"
+)
+
+// version and commit identify the build of the action, injected at build time with
+// -ldflags "-X main.version=v1.2.3 -X main.commit=<sha>"
+var (
+	version = "dev"
+	commit  = ""
+)
+
+// buildVersion returns the version logged at startup and set as the version output,
+// followed by the commit when known. Without an injected commit, the VCS revision Go
+// records in builds from a git checkout is used.
+func buildVersion() string {
+	rev := commit
+	if rev == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			for _, s := range info.Settings {
+				if s.Key == "vcs.revision" {
+					rev = s.Value
+				}
+			}
+		}
+	}
+	if rev == "" {
+		return version
+	}
+	if len(rev) > 12 {
+		rev = rev[:12]
+	}
+	return version + " (" + rev + ")"
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildVersion(t *testing.T) {
+	defer func(v, c string) { version, commit = v, c }(version, commit)
+
+	version, commit = "v1.4.0", "3f2a9c1d0b7e55aa01"
+	if got := buildVersion(); got != "v1.4.0 (3f2a9c1d0b7e)" {
+		t.Errorf("Expected the version and short commit, got %q", got)
+	}
+
+	// Without injected values, the build is dev, with whatever revision Go recorded
+	version, commit = "dev", ""
+	if got := buildVersion(); !strings.HasPrefix(got, "dev") {
+		t.Errorf("Expected a dev version, got %q", got)
+	}
+}
+
+func TestVersionOutput(t *testing.T) {
+	// The version is reported even when the deployment fails
+	server := newFailingNotehub(t, "auth")
+	_, dir, out := runAction(t, server.URL, "GITHUB_ACTION_REPOSITORY=blues/note-dfu-github", "GITHUB_ACTION_REF=v1")
+	if !strings.Contains(string(out), "notehub-dfu dev") || !strings.Contains(string(out), "run as blues/note-dfu-github@v1") {
+		t.Errorf("Expected the version and action ref logged at startup:\n%s", out)
+	}
+	if outputs := parseOutputFile(t, filepath.Join(dir, "output")); !strings.HasPrefix(outputs["version"], "dev") {
+		t.Errorf("Expected the version output to be set, got %q", outputs["version"])
+	}
+}